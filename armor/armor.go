@@ -6,6 +6,7 @@ import (
 	"bytes"
 	"io"
 	"io/ioutil"
+	"strings"
 
 	"github.com/ProtonMail/go-crypto/openpgp/armor"
 	"github.com/angel-one/gopenpgp/v2/constants"
@@ -42,6 +43,37 @@ func ArmorWithTypeAndCustomHeaders(input []byte, armorType, version, comment str
 	return armorWithTypeAndHeaders(input, armorType, headers)
 }
 
+// ArmorWithHeaders armors input with the given armorType and headers, in
+// the order of headers.
+// * headers : (optional) the armor headers, nil for none.
+func ArmorWithHeaders(input []byte, armorType string, headers *Headers) (string, error) {
+	var b bytes.Buffer
+
+	w, err := ArmorWithHeadersBuffered(&b, armorType, headers)
+	if err != nil {
+		return "", err
+	}
+	if _, err = w.Write(input); err != nil {
+		return "", errors.Wrap(err, "gopenpgp: unable to write armored to buffer")
+	}
+	if err := w.Close(); err != nil {
+		return "", errors.Wrap(err, "gopenpgp: unable to close armor buffer")
+	}
+	return b.String(), nil
+}
+
+// ArmorWithHeadersBuffered returns a io.WriteCloser which, when written to,
+// writes armored data to w with the given armorType and headers, in the order
+// of headers. The headers are validated, e.g. the ones read in lenient mode.
+// * headers : (optional) the armor headers, nil for none.
+func ArmorWithHeadersBuffered(w io.Writer, armorType string, headers *Headers) (io.WriteCloser, error) {
+	armorWriter, err := newEncoder(w, armorType, headers)
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: unable to encode armoring")
+	}
+	return armorWriter, nil
+}
+
 // Unarmor unarmors an armored input into a byte array.
 func Unarmor(input string) ([]byte, error) {
 	b, err := internal.Unarmor(input)
@@ -51,6 +83,20 @@ func Unarmor(input string) ([]byte, error) {
 	return ioutil.ReadAll(b.Body)
 }
 
+// UnarmorWithHeaders unarmors an armored input into a byte array, and returns
+// its armor headers in order.
+func UnarmorWithHeaders(input string) ([]byte, *Headers, error) {
+	block, err := UnarmorReader(strings.NewReader(input))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "gopenpgp: unable to unarmor")
+	}
+	data, err := ioutil.ReadAll(block.Body)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "gopenpgp: unable to unarmor")
+	}
+	return data, block.Headers, nil
+}
+
 func armorWithTypeAndHeaders(input []byte, armorType string, headers map[string]string) (string, error) {
 	var b bytes.Buffer
 
@@ -0,0 +1,285 @@
+package armor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	crc24Init = 0xb704ce
+	crc24Poly = 0x1864cfb
+	crc24Mask = 0xffffff
+)
+
+var (
+	armorBegin      = []byte("-----BEGIN ")
+	armorEnd        = []byte("-----END ")
+	armorEndOfLine  = []byte("-----")
+	errLineTooLong  = errors.New("gopenpgp: armor line is too long")
+	errChecksum     = errors.New("gopenpgp: armor checksum mismatch")
+	errNoArmorBlock = errors.New("gopenpgp: no armored block found")
+)
+
+// Decoder reads the armored blocks of a stream one after the other, without
+// holding the stream in memory. Text before, between and after the blocks is
+// ignored.
+//
+// In strict mode, a block must have a valid CRC24 checksum and an END line
+// matching its type, and its lines must have no whitespace other than the line
+// break. In lenient mode, the checksum is optional, as recommended by RFC 9580,
+// but is still verified when present, the whitespace around the lines is
+// ignored, as are empty lines in the data, and the empty line after the headers
+// may be missing.
+type Decoder struct {
+	in     *bufio.Reader
+	strict bool
+	body   *bodyReader // the body of the last block returned by Next
+}
+
+// Block is an armored block read by a Decoder.
+type Block struct {
+	// Type is the armor type, e.g. constants.PGPMessageHeader.
+	Type string
+	// Headers are the armor headers, such as "Version" and "Comment".
+	Headers *Headers
+	// Body reads the unarmored data. It fails if the block is malformed.
+	Body io.Reader
+}
+
+// NewDecoder returns a decoder for the armored blocks of a reader.
+// * r : the armored stream.
+// * strict : selects the strict mode instead of the lenient one.
+func NewDecoder(r io.Reader, strict bool) *Decoder {
+	return &Decoder{in: bufio.NewReader(r), strict: strict}
+}
+
+// Next returns the next armored block, or io.EOF once there are no more. The
+// unread data of the previous block is skipped.
+func (d *Decoder) Next() (*Block, error) {
+	if d.body != nil {
+		for d.body.err == nil && !d.body.done {
+			d.body.err = d.body.readLine()
+		}
+		if d.body.err != nil {
+			return nil, d.body.err
+		}
+		d.body = nil
+	}
+
+	armorType, err := d.readBeginLine()
+	if err != nil {
+		return nil, err
+	}
+	body := &bodyReader{decoder: d, armorType: armorType}
+	headers, err := d.readHeaders(body)
+	if err != nil {
+		return nil, err
+	}
+	d.body = body
+
+	return &Block{
+		Type:    armorType,
+		Headers: headers,
+		Body: &checksumReader{
+			body:    body,
+			decoder: base64.NewDecoder(base64.StdEncoding, body),
+			crc:     crc24Init,
+		},
+	}, nil
+}
+
+// UnarmorReader returns the first armored block of a reader, in lenient mode.
+// * r : the armored stream.
+func UnarmorReader(r io.Reader) (*Block, error) {
+	block, err := NewDecoder(r, false).Next()
+	if errors.Is(err, io.EOF) {
+		return nil, errNoArmorBlock
+	}
+	return block, err
+}
+
+// readBeginLine skips the lines up to the next BEGIN line, and returns its
+// armor type.
+func (d *Decoder) readBeginLine() (string, error) {
+	for {
+		line, err := d.in.ReadSlice('\n')
+		for errors.Is(err, bufio.ErrBufferFull) {
+			// Text outside of the blocks may have long lines
+			_, err = d.in.ReadSlice('\n')
+			line = nil
+		}
+		if err != nil && (len(line) == 0 || !errors.Is(err, io.EOF)) {
+			if errors.Is(err, io.EOF) {
+				return "", io.EOF
+			}
+			return "", errors.Wrap(err, "gopenpgp: error in reading armored data")
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) > len(armorBegin)+len(armorEndOfLine) &&
+			bytes.HasPrefix(line, armorBegin) && bytes.HasSuffix(line, armorEndOfLine) {
+			return string(line[len(armorBegin) : len(line)-len(armorEndOfLine)]), nil
+		}
+	}
+}
+
+// readHeaders reads the armor headers and the empty line after them. In
+// strict mode, the headers are validated. In lenient mode, a line without
+// colon ends the headers and is passed to body.
+func (d *Decoder) readHeaders(body *bodyReader) (*Headers, error) {
+	headers := NewHeaders()
+	for {
+		line, err := d.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 {
+			return headers, nil
+		}
+		separator := bytes.IndexByte(line, ':')
+		if separator < 0 {
+			if d.strict {
+				return nil, errors.New("gopenpgp: invalid armor header line")
+			}
+			return headers, body.processLine(line)
+		}
+		if d.strict && !bytes.HasPrefix(line[separator:], []byte(": ")) && separator != len(line)-1 {
+			return nil, errors.New("gopenpgp: invalid armor header line")
+		}
+		key := string(line[:separator])
+		value := string(line[separator+1:])
+		if d.strict {
+			if err := headers.Set(key, strings.TrimPrefix(value, " ")); err != nil {
+				return nil, err
+			}
+		} else {
+			headers.set(strings.TrimSpace(key), strings.TrimSpace(value))
+		}
+	}
+}
+
+// readLine reads a line of a block without the line break, and without the
+// surrounding whitespace in lenient mode.
+func (d *Decoder) readLine() ([]byte, error) {
+	line, err := d.in.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return nil, errLineTooLong
+	}
+	if err != nil && (len(line) == 0 || !errors.Is(err, io.EOF)) {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, errors.Wrap(err, "gopenpgp: error in reading armored data")
+	}
+	if !d.strict {
+		return bytes.TrimSpace(line), nil
+	}
+	line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+	if len(bytes.TrimSpace(line)) != len(line) {
+		return nil, errors.New("gopenpgp: whitespace around armor line")
+	}
+	return line, nil
+}
+
+// bodyReader reads the base64 data of a block, up to its END line.
+type bodyReader struct {
+	decoder   *Decoder
+	armorType string
+	data      []byte // base64 data of the current line not yet read
+	checksum  []byte // the decoded checksum, nil until the checksum line
+	done      bool   // the END line has been read
+	err       error
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	for len(b.data) == 0 {
+		if b.err != nil {
+			return 0, b.err
+		}
+		if b.done {
+			return 0, io.EOF
+		}
+		b.err = b.readLine()
+	}
+	n := copy(p, b.data)
+	b.data = b.data[n:]
+	return n, nil
+}
+
+func (b *bodyReader) readLine() error {
+	line, err := b.decoder.readLine()
+	if err != nil {
+		return err
+	}
+	return b.processLine(line)
+}
+
+func (b *bodyReader) processLine(line []byte) error {
+	strict := b.decoder.strict
+	switch {
+	case bytes.HasPrefix(line, armorEnd):
+		if strict && string(line) != string(armorEnd)+b.armorType+string(armorEndOfLine) {
+			return errors.New("gopenpgp: armor END line does not match the BEGIN line")
+		}
+		if strict && b.checksum == nil {
+			return errors.New("gopenpgp: missing armor checksum")
+		}
+		b.done = true
+	case len(line) == 0:
+		if strict {
+			return errors.New("gopenpgp: empty line in armored data")
+		}
+	case b.checksum != nil:
+		return errors.New("gopenpgp: armored data after the checksum")
+	case line[0] == '=' && len(line) == 5:
+		checksum, err := base64.StdEncoding.DecodeString(string(line[1:]))
+		if err != nil || len(checksum) != 3 {
+			return errors.New("gopenpgp: invalid armor checksum")
+		}
+		b.checksum = checksum
+	default:
+		b.data = append(b.data[:0], line...)
+	}
+	return nil
+}
+
+// checksumReader decodes the data of a block, and verifies its checksum if
+// present. The checksum is required in strict mode.
+type checksumReader struct {
+	body    *bodyReader
+	decoder io.Reader
+	crc     uint32
+}
+
+func (r *checksumReader) Read(p []byte) (int, error) {
+	n, err := r.decoder.Read(p)
+	r.crc = crc24(r.crc, p[:n])
+	var corrupt base64.CorruptInputError
+	if errors.As(err, &corrupt) {
+		return n, errors.Wrap(err, "gopenpgp: invalid armored data")
+	}
+	if checksum := r.body.checksum; errors.Is(err, io.EOF) && checksum != nil {
+		if uint32(checksum[0])<<16|uint32(checksum[1])<<8|uint32(checksum[2]) != r.crc&crc24Mask {
+			return n, errChecksum
+		}
+	}
+	return n, err
+}
+
+// crc24 computes the checksum of armored data, see RFC 4880, section 6.1.
+func crc24(crc uint32, data []byte) uint32 {
+	for _, b := range data {
+		crc ^= uint32(b) << 16
+		for i := 0; i < 8; i++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= crc24Poly
+			}
+		}
+	}
+	return crc
+}
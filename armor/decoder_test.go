@@ -0,0 +1,128 @@
+package armor
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/angel-one/gopenpgp/v2/constants"
+	"github.com/stretchr/testify/assert"
+)
+
+func armorTestData(t *testing.T, data, armorType string) string {
+	armored, err := ArmorWithTypeAndCustomHeaders([]byte(data), armorType, "", "test comment")
+	if err != nil {
+		t.Fatal("Expected no error while armoring, got:", err)
+	}
+	return armored
+}
+
+func TestDecoderMultipleBlocks(t *testing.T) {
+	armored := "Some text\n" + armorTestData(t, "first block", constants.PGPMessageHeader) +
+		"\nbetween blocks " + strings.Repeat("long line ", 1000) + "\n" +
+		armorTestData(t, "second block", constants.PGPSignatureHeader) + "\n" +
+		armorTestData(t, strings.Repeat("third block", 100), constants.PublicKeyHeader) + "\ntrailing text"
+
+	decoder := NewDecoder(strings.NewReader(armored), true)
+	block, err := decoder.Next()
+	if err != nil {
+		t.Fatal("Expected no error while decoding, got:", err)
+	}
+	assert.Exactly(t, constants.PGPMessageHeader, block.Type)
+	assert.Exactly(t, []string{"Comment"}, block.Headers.GetNames())
+	assert.Exactly(t, "test comment", block.Headers.Get("Comment"))
+	data, err := ioutil.ReadAll(block.Body)
+	if err != nil {
+		t.Fatal("Expected no error while reading, got:", err)
+	}
+	assert.Exactly(t, "first block", string(data))
+
+	block, err = decoder.Next()
+	if err != nil {
+		t.Fatal("Expected no error while decoding, got:", err)
+	}
+	assert.Exactly(t, constants.PGPSignatureHeader, block.Type)
+	data, err = ioutil.ReadAll(block.Body)
+	if err != nil {
+		t.Fatal("Expected no error while reading, got:", err)
+	}
+	assert.Exactly(t, "second block", string(data))
+
+	block, err = decoder.Next()
+	if err != nil {
+		t.Fatal("Expected no error while decoding, got:", err)
+	}
+	assert.Exactly(t, constants.PublicKeyHeader, block.Type)
+	// The rest of the block is skipped by Next
+	_, err = block.Body.Read(make([]byte, 10))
+	assert.Nil(t, err)
+
+	_, err = decoder.Next()
+	assert.Exactly(t, io.EOF, err)
+}
+
+func TestDecoderChecksum(t *testing.T) {
+	armored := armorTestData(t, "data", constants.PGPMessageHeader)
+	lines := strings.Split(armored, "\n")
+	checksumLine := len(lines) - 2
+	if !strings.HasPrefix(lines[checksumLine], "=") {
+		t.Fatal("Expected a checksum line, got:", lines[checksumLine])
+	}
+
+	badChecksum := append([]string{}, lines...)
+	badChecksum[checksumLine] = "=AAAA"
+	noChecksum := append(append([]string{}, lines[:checksumLine]...), lines[checksumLine+1:]...)
+
+	for _, test := range []struct {
+		armored string
+		strict  bool
+		valid   bool
+	}{
+		{armored, true, true},
+		{strings.Join(badChecksum, "\n"), true, false},
+		{strings.Join(badChecksum, "\n"), false, false},
+		{strings.Join(noChecksum, "\n"), true, false},
+		{strings.Join(noChecksum, "\n"), false, true},
+	} {
+		block, err := NewDecoder(strings.NewReader(test.armored), test.strict).Next()
+		if err != nil {
+			t.Fatal("Expected no error while decoding, got:", err)
+		}
+		data, err := ioutil.ReadAll(block.Body)
+		if test.valid {
+			assert.Nil(t, err)
+			assert.Exactly(t, "data", string(data))
+		} else {
+			assert.NotNil(t, err)
+		}
+	}
+}
+
+func TestDecoderWhitespace(t *testing.T) {
+	armored := armorTestData(t, "data", constants.PGPMessageHeader)
+	lines := strings.Split(armored, "\n")
+	for i := range lines {
+		lines[i] = "  " + lines[i] + " \t\r"
+	}
+	indented := strings.Join(lines, "\n")
+
+	block, err := NewDecoder(strings.NewReader(indented), true).Next()
+	if err == nil {
+		_, err = ioutil.ReadAll(block.Body)
+	}
+	assert.NotNil(t, err)
+
+	block, err = UnarmorReader(strings.NewReader(indented))
+	if err != nil {
+		t.Fatal("Expected no error while decoding, got:", err)
+	}
+	data, err := ioutil.ReadAll(block.Body)
+	if err != nil {
+		t.Fatal("Expected no error while reading, got:", err)
+	}
+	assert.Exactly(t, "data", string(data))
+
+	_, err = UnarmorReader(strings.NewReader("no armor"))
+	assert.NotNil(t, err)
+}
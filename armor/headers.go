@@ -0,0 +1,203 @@
+package armor
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// messageIDLength is the length of a MessageID header, see RFC 4880, section 6.2.
+	messageIDLength = 32
+	// armorLineLength is the length of the base64 lines written, as armor.Encode.
+	armorLineLength = 64
+)
+
+// Headers are armor headers, such as "Version", "Comment", "MessageID", "Hash"
+// and "Charset", in the order they are written.
+type Headers struct {
+	names  []string
+	values map[string]string
+}
+
+// NewHeaders returns an empty list of armor headers.
+func NewHeaders() *Headers {
+	return &Headers{values: make(map[string]string)}
+}
+
+// Set sets the value of a header. A new header is written after the existing
+// ones, an existing header keeps its position.
+// * name : the header name, printable ASCII characters without colon.
+// * value : the header value, a single line of printable UTF-8 text.
+func (headers *Headers) Set(name, value string) error {
+	if err := validateHeader(name, value); err != nil {
+		return err
+	}
+	headers.set(name, value)
+	return nil
+}
+
+// Get returns the value of a header, or "" if it is not set.
+func (headers *Headers) Get(name string) string {
+	return headers.values[name]
+}
+
+// Has returns whether a header is set.
+func (headers *Headers) Has(name string) bool {
+	_, ok := headers.values[name]
+	return ok
+}
+
+// Delete removes a header.
+func (headers *Headers) Delete(name string) {
+	if !headers.Has(name) {
+		return
+	}
+	delete(headers.values, name)
+	for i, existing := range headers.names {
+		if existing == name {
+			headers.names = append(headers.names[:i], headers.names[i+1:]...)
+			break
+		}
+	}
+}
+
+// Len returns the number of headers.
+func (headers *Headers) Len() int {
+	return len(headers.names)
+}
+
+// GetName returns the name of the header at the given position, or "" if
+// there is none.
+func (headers *Headers) GetName(index int) string {
+	if index < 0 || index >= len(headers.names) {
+		return ""
+	}
+	return headers.names[index]
+}
+
+// GetNames returns the header names, in order.
+func (headers *Headers) GetNames() []string {
+	return append([]string(nil), headers.names...)
+}
+
+func (headers *Headers) set(name, value string) {
+	if !headers.Has(name) {
+		headers.names = append(headers.names, name)
+	}
+	headers.values[name] = value
+}
+
+// validateHeader checks a header against the rules of RFC 4880, section 6.2.
+func validateHeader(name, value string) error {
+	if name == "" {
+		return errors.New("gopenpgp: empty armor header name")
+	}
+	for i := 0; i < len(name); i++ {
+		if name[i] <= ' ' || name[i] > '~' || name[i] == ':' {
+			return errors.Errorf("gopenpgp: invalid armor header name %q", name)
+		}
+	}
+	if !utf8.ValidString(value) {
+		return errors.Errorf("gopenpgp: armor header %s is not valid UTF-8", name)
+	}
+	for _, r := range value {
+		if !unicode.IsPrint(r) && r != ' ' && r != '\t' {
+			return errors.Errorf("gopenpgp: invalid character in armor header %s", name)
+		}
+	}
+	if value != strings.TrimSpace(value) {
+		return errors.Errorf("gopenpgp: whitespace around armor header %s", name)
+	}
+	if name == "MessageID" && (len(value) != messageIDLength || strings.ContainsAny(value, " \t")) {
+		return errors.Errorf("gopenpgp: armor header MessageID must be %d printable characters", messageIDLength)
+	}
+	return nil
+}
+
+// encoder armors the data written to it, with the headers in order, as
+// armor.Encode, which cannot write ordered headers.
+type encoder struct {
+	out       io.Writer
+	base64    io.WriteCloser
+	crc       uint32
+	armorType string
+}
+
+// newEncoder writes the BEGIN line, the headers and the empty line after them,
+// and returns an encoder for the data. The headers are validated, as the
+// headers read in lenient mode may be invalid.
+func newEncoder(out io.Writer, armorType string, headers *Headers) (*encoder, error) {
+	var header bytes.Buffer
+	header.WriteString(string(armorBegin) + armorType + string(armorEndOfLine) + "\n")
+	if headers != nil {
+		for _, name := range headers.names {
+			if err := validateHeader(name, headers.values[name]); err != nil {
+				return nil, err
+			}
+			header.WriteString(name + ": " + headers.values[name] + "\n")
+		}
+	}
+	header.WriteString("\n")
+	if _, err := out.Write(header.Bytes()); err != nil {
+		return nil, err
+	}
+	return &encoder{
+		out:       out,
+		base64:    base64.NewEncoder(base64.StdEncoding, &lineBreaker{out: out}),
+		crc:       crc24Init,
+		armorType: armorType,
+	}, nil
+}
+
+func (e *encoder) Write(p []byte) (int, error) {
+	e.crc = crc24(e.crc, p)
+	return e.base64.Write(p)
+}
+
+// Close writes the rest of the data, the checksum and the END line.
+func (e *encoder) Close() error {
+	if err := e.base64.Close(); err != nil {
+		return err
+	}
+	checksum := []byte{byte(e.crc >> 16), byte(e.crc >> 8), byte(e.crc)}
+	_, err := io.WriteString(e.out, "\n="+base64.StdEncoding.EncodeToString(checksum)+"\n"+
+		string(armorEnd)+e.armorType+string(armorEndOfLine))
+	return err
+}
+
+// lineBreaker writes base64 data in lines of armorLineLength characters. The
+// line break is written before the next line, so that the last line has none.
+type lineBreaker struct {
+	out  io.Writer
+	used int // the length of the current line
+}
+
+func (l *lineBreaker) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if l.used == armorLineLength {
+			if _, err := l.out.Write([]byte{'\n'}); err != nil {
+				return written, err
+			}
+			l.used = 0
+		}
+		n := armorLineLength - l.used
+		if n > len(p) {
+			n = len(p)
+		}
+		m, err := l.out.Write(p[:n])
+		written += m
+		l.used += m
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
@@ -0,0 +1,111 @@
+package armor
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/angel-one/gopenpgp/v2/constants"
+	"github.com/stretchr/testify/assert"
+)
+
+const testMessageID = "0123456789abcdef0123456789ABCDEF"
+
+func TestArmorWithHeaders(t *testing.T) {
+	headers := NewHeaders()
+	for _, header := range [][2]string{
+		{"MessageID", testMessageID},
+		{"Hash", "SHA256,SHA512"},
+		{"Charset", "UTF-8"},
+		{"Comment", "Grüße"},
+	} {
+		if err := headers.Set(header[0], header[1]); err != nil {
+			t.Fatal("Expected no error while setting header, got:", err)
+		}
+	}
+	if err := headers.Set("Hash", "SHA512"); err != nil {
+		t.Fatal("Expected no error while setting header, got:", err)
+	}
+
+	armored, err := ArmorWithHeaders([]byte("data"), constants.PGPMessageHeader, headers)
+	if err != nil {
+		t.Fatal("Expected no error while armoring, got:", err)
+	}
+	assert.True(t, strings.HasPrefix(armored, "-----BEGIN PGP MESSAGE-----\n"+
+		"MessageID: "+testMessageID+"\nHash: SHA512\nCharset: UTF-8\nComment: Grüße\n\n"))
+
+	data, unarmoredHeaders, err := UnarmorWithHeaders(armored)
+	if err != nil {
+		t.Fatal("Expected no error while unarmoring, got:", err)
+	}
+	assert.Exactly(t, "data", string(data))
+	assert.Exactly(t, []string{"MessageID", "Hash", "Charset", "Comment"}, unarmoredHeaders.GetNames())
+	assert.Exactly(t, "SHA512", unarmoredHeaders.Get("Hash"))
+	assert.Exactly(t, "Grüße", unarmoredHeaders.Get("Comment"))
+
+	unarmoredHeaders.Delete("Hash")
+	assert.Exactly(t, 3, unarmoredHeaders.Len())
+	assert.Exactly(t, "Charset", unarmoredHeaders.GetName(1))
+	assert.Exactly(t, "", unarmoredHeaders.GetName(3))
+	assert.Exactly(t, "", unarmoredHeaders.GetName(-1))
+	assert.False(t, unarmoredHeaders.Has("Hash"))
+
+	armored, err = ArmorWithHeaders([]byte("data"), constants.PGPMessageHeader, nil)
+	if err != nil {
+		t.Fatal("Expected no error while armoring, got:", err)
+	}
+	assert.True(t, strings.HasPrefix(armored, "-----BEGIN PGP MESSAGE-----\n\n"))
+}
+
+func TestHeadersValidation(t *testing.T) {
+	headers := NewHeaders()
+	for _, header := range [][2]string{
+		{"", "value"},
+		{"Bad Name", "value"},
+		{"Bad:Name", "value"},
+		{"Comment", "two\nlines"},
+		{"Comment", "carriage\rreturn"},
+		{"Comment", " padded"},
+		{"Comment", "invalid \xff"},
+		{"MessageID", "too short"},
+		{"MessageID", strings.Repeat("a", 31) + " "},
+	} {
+		assert.NotNil(t, headers.Set(header[0], header[1]), header)
+	}
+	assert.Exactly(t, 0, headers.Len())
+
+	armored := "-----BEGIN PGP MESSAGE-----\nMessageID: short\n\nZGF0YQ==\n=9EZn\n-----END PGP MESSAGE-----\n"
+	_, err := NewDecoder(strings.NewReader(armored), true).Next()
+	assert.NotNil(t, err)
+	block, err := NewDecoder(strings.NewReader(armored), false).Next()
+	if err != nil {
+		t.Fatal("Expected no error while decoding, got:", err)
+	}
+	assert.Exactly(t, "short", block.Headers.Get("MessageID"))
+
+	// The invalid headers read in lenient mode are not armored again
+	_, err = ArmorWithHeaders([]byte("data"), constants.PGPMessageHeader, block.Headers)
+	assert.NotNil(t, err)
+}
+
+func TestArmorWithHeadersEncoding(t *testing.T) {
+	for _, size := range []int{0, 1, 47, 48, 49, 96, 1000} {
+		data := bytes.Repeat([]byte{0xa5}, size)
+		var expected bytes.Buffer
+		w, err := armor.Encode(&expected, constants.PGPMessageHeader, nil)
+		if err != nil {
+			t.Fatal("Expected no error while armoring, got:", err)
+		}
+		_, _ = w.Write(data)
+		if err = w.Close(); err != nil {
+			t.Fatal("Expected no error while armoring, got:", err)
+		}
+
+		armored, err := ArmorWithHeaders(data, constants.PGPMessageHeader, nil)
+		if err != nil {
+			t.Fatal("Expected no error while armoring, got:", err)
+		}
+		assert.Exactly(t, expected.String(), armored, size)
+	}
+}
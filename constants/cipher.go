@@ -10,13 +10,64 @@ const (
 	AES256    = "aes256"
 )
 
+// String-to-key (S2K) function names, to derive keys from passwords.
+const (
+	S2KSimple         = "simple"
+	S2KSalted         = "salted"
+	S2KIteratedSalted = "iterated-salted"
+	S2KArgon2         = "argon2"
+	S2KGNUDummy       = "gnu-dummy" // Marks a private key stored elsewhere, e.g. on a smartcard.
+)
+
+// Compression algorithm names.
+const (
+	CompressionNone  = "none"
+	CompressionZIP   = "zip"
+	CompressionZLIB  = "zlib"
+	CompressionBZIP2 = "bzip2" // Only supported for decompression.
+)
+
 const (
 	SIGNATURE_OK          int = 0
 	SIGNATURE_NOT_SIGNED  int = 1
 	SIGNATURE_NO_VERIFIER int = 2
 	SIGNATURE_FAILED      int = 3
 	SIGNATURE_BAD_CONTEXT int = 4
+	// SIGNATURE_BAD_RECIPIENT is returned when the signature is valid, but the
+	// decryption key is not among the intended recipients listed in the signature.
+	SIGNATURE_BAD_RECIPIENT int = 5
+	// SIGNATURE_BAD_SIGNER is returned when the signature is valid, but none
+	// of the identities of the signing key has the expected email address.
+	SIGNATURE_BAD_SIGNER int = 6
 )
 
 const DefaultCompression = 2      // ZLIB
 const DefaultCompressionLevel = 6 // Corresponds to default -1 for ZLIB
+
+// DefaultMaxDecompressedSize is the maximum number of bytes output by the
+// decompression of the compressed packets of a message decrypted in memory, 1 GiB.
+const DefaultMaxDecompressedSize = 1 << 30
+
+// DefaultMaxTrialDecryptions is the maximum number of private keys tried
+// against the session key packets with a wildcard key ID of a message.
+const DefaultMaxTrialDecryptions = 64
+
+// DefaultMaxCompressionDepth is the maximum nesting depth of the compressed
+// packets of a message.
+const DefaultMaxCompressionDepth = 4
+
+// DefaultMaxPackets is the maximum number of packets in a message.
+const DefaultMaxPackets = 4096
+
+// Phases of the streaming encryption and decryption, reported to progress observers.
+const (
+	ProgressKeyPacketEncryption   = "key-packet-encryption"
+	ProgressBodyEncryption        = "body-encryption"
+	ProgressKeyPacketDecryption   = "key-packet-decryption"
+	ProgressBodyDecryption        = "body-decryption"
+	ProgressSignatureVerification = "signature-verification"
+	ProgressDone                  = "done"
+)
+
+// DefaultSeekableChunkSize is the size of the plaintext chunks of the seekable encryption.
+const DefaultSeekableChunkSize = 1 << 16
@@ -0,0 +1,5 @@
+package constants
+
+// ProtectedHeadersObscuredSubject is the outer Subject of PGP/MIME messages
+// with protected headers, which carry the real Subject in the encrypted part.
+const ProtectedHeadersObscuredSubject = "..."
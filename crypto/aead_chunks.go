@@ -0,0 +1,181 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+
+	"github.com/ProtonMail/go-crypto/eax"
+	"github.com/ProtonMail/go-crypto/ocb"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/hkdf"
+)
+
+// The chunks of an AEAD-chunked body are the ones of the version 2 Symmetrically
+// Encrypted Integrity Protected Data packet (RFC 9580, section 5.13.2).
+// The body starts with a header: the version 2, the cipher algorithm, the
+// AEAD mode, the chunk size byte c and a random salt of 32 bytes.
+// The chunk key and the IV are derived from the session key with
+// HKDF-SHA256, using the salt, and the packet tag followed by the header
+// before the salt as info. Chunk i holds 1 << (c + 6) bytes of plaintext,
+// except for the last one which may be shorter, and is followed by its tag.
+// It is encrypted with the IV followed by i as a 64 bits big-endian integer
+// as nonce, and the info as associated data. The chunks are followed by a
+// final tag authenticating the plaintext size, so that the truncation of the
+// data is detected.
+const (
+	aeadChunkVersion    = 2
+	aeadChunkSaltSize   = 32
+	aeadChunkHeaderSize = 4 + aeadChunkSaltSize
+	aeadChunkMaxSize    = 16 // 4 MiB chunks
+	aeadChunkTagSize    = 16
+	aeadChunkPacketTag  = 0xD2
+)
+
+// aeadChunkCrypter encrypts and decrypts the chunks of an AEAD-chunked body.
+// It must not be used on several goroutines, see clone.
+type aeadChunkCrypter struct {
+	block          cipher.Block
+	mode           packet.AEADMode
+	aead           cipher.AEAD
+	iv             []byte
+	associatedData []byte
+	chunkSize      int
+}
+
+// newAEADChunkCrypter returns the chunk cipher of the body header, for the session key.
+func newAEADChunkCrypter(sk *SessionKey, header []byte) (*aeadChunkCrypter, error) {
+	if len(header) != aeadChunkHeaderSize {
+		return nil, newError("gopenpgp: invalid AEAD chunk header", ErrMalformedPacket)
+	}
+	if header[0] != aeadChunkVersion {
+		return nil, newError("gopenpgp: unsupported AEAD chunk version", ErrUnsupportedAlgorithm)
+	}
+	cf, err := sk.GetCipherFunc()
+	if err != nil {
+		return nil, err
+	}
+	if packet.CipherFunction(header[1]) != cf {
+		return nil, newError("gopenpgp: the session key does not match the cipher of the encrypted data", ErrNoDecryptionKey)
+	}
+	switch cf {
+	case packet.CipherAES128, packet.CipherAES192, packet.CipherAES256:
+	default:
+		return nil, newError("gopenpgp: AEAD chunks require an AES session key", ErrUnsupportedAlgorithm)
+	}
+	mode := packet.AEADMode(header[2])
+	if mode.TagLength() != aeadChunkTagSize {
+		return nil, newError("gopenpgp: unsupported AEAD mode", ErrUnsupportedAlgorithm)
+	}
+	if header[3] > aeadChunkMaxSize {
+		return nil, newError("gopenpgp: invalid AEAD chunk size", ErrMalformedPacket)
+	}
+	if err := sk.checkSize(); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: unable to use the session key")
+	}
+
+	associatedData := append([]byte{aeadChunkPacketTag}, header[:4]...)
+	derived := make([]byte, len(sk.Key)+mode.IvLength()-8)
+	defer clearMem(derived)
+	kdf := hkdf.New(sha256.New, sk.Key, header[4:], associatedData)
+	if _, err := io.ReadFull(kdf, derived); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: unable to derive the chunk key")
+	}
+	block, err := aes.NewCipher(derived[:len(sk.Key)])
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: unable to create the chunk cipher")
+	}
+	aead, err := newChunkAEAD(block, mode)
+	if err != nil {
+		return nil, err
+	}
+	return &aeadChunkCrypter{
+		block:          block,
+		mode:           mode,
+		aead:           aead,
+		iv:             clone(derived[len(sk.Key):]),
+		associatedData: associatedData,
+		chunkSize:      1 << (header[3] + 6),
+	}, nil
+}
+
+func newChunkAEAD(block cipher.Block, mode packet.AEADMode) (aead cipher.AEAD, err error) {
+	switch mode {
+	case packet.AEADModeEAX:
+		aead, err = eax.NewEAX(block)
+	case packet.AEADModeOCB:
+		aead, err = ocb.NewOCB(block)
+	default:
+		aead, err = cipher.NewGCM(block)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: unable to create the chunk cipher")
+	}
+	return aead, nil
+}
+
+// clone returns a crypter with its own AEAD instance, for another goroutine:
+// the OCB and EAX instances keep state between calls.
+func (c *aeadChunkCrypter) clone() (*aeadChunkCrypter, error) {
+	aead, err := newChunkAEAD(c.block, c.mode)
+	if err != nil {
+		return nil, err
+	}
+	crypter := *c
+	crypter.aead = aead
+	return &crypter, nil
+}
+
+// newAEADChunkHeader returns the body header of the session key, with the salt.
+func (sk *SessionKey) newAEADChunkHeader(mode packet.AEADMode, chunkSizeByte byte, salt []byte) ([]byte, error) {
+	cf, err := sk.GetCipherFunc()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{aeadChunkVersion, byte(cf), byte(mode), chunkSizeByte}, salt...), nil
+}
+
+func (c *aeadChunkCrypter) nonce(index uint64) []byte {
+	nonce := make([]byte, len(c.iv)+8)
+	copy(nonce, c.iv)
+	binary.BigEndian.PutUint64(nonce[len(c.iv):], index)
+	return nonce
+}
+
+// sealChunk appends the encrypted chunk index to dst.
+func (c *aeadChunkCrypter) sealChunk(dst, plaintext []byte, index uint64) []byte {
+	return c.aead.Seal(dst, c.nonce(index), plaintext, c.associatedData)
+}
+
+// openChunk appends the decrypted chunk index to dst.
+func (c *aeadChunkCrypter) openChunk(dst, ciphertext []byte, index uint64) ([]byte, error) {
+	plaintext, err := c.aead.Open(dst, c.nonce(index), ciphertext, c.associatedData)
+	if err != nil {
+		return nil, newError("gopenpgp: integrity check of the encrypted data chunk failed", ErrIntegrity)
+	}
+	return plaintext, nil
+}
+
+// finalTag returns the tag following the chunks, for the number of chunks
+// and the size of the plaintext.
+func (c *aeadChunkCrypter) finalTag(chunks, size uint64) []byte {
+	return c.aead.Seal(nil, c.nonce(chunks), nil, c.finalAssociatedData(size))
+}
+
+// checkFinalTag authenticates the number of chunks and the size of the plaintext.
+func (c *aeadChunkCrypter) checkFinalTag(tag []byte, chunks, size uint64) error {
+	if _, err := c.aead.Open(nil, c.nonce(chunks), tag, c.finalAssociatedData(size)); err != nil {
+		return newError("gopenpgp: integrity check of the encrypted data size failed", ErrIntegrity)
+	}
+	return nil
+}
+
+func (c *aeadChunkCrypter) finalAssociatedData(size uint64) []byte {
+	associatedData := make([]byte, len(c.associatedData)+8)
+	copy(associatedData, c.associatedData)
+	binary.BigEndian.PutUint64(associatedData[len(c.associatedData):], size)
+	return associatedData
+}
@@ -0,0 +1,449 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"sync"
+
+	pgpErrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/pkg/errors"
+)
+
+// chunkJob is the encryption or decryption of a chunk by the workers of a
+// pipeline. The final job is the one of the final tag, whose index is the
+// number of chunks and whose size is the size of the plaintext.
+type chunkJob struct {
+	index  uint64
+	size   uint64
+	final  bool
+	input  []byte
+	output []byte
+	err    error
+	ready  chan struct{} // closed once output or err is set
+}
+
+// chunkPipeline encrypts or decrypts chunks on several goroutines.
+// The jobs are queued in order in pending, which bounds the number of chunks
+// in memory, and are processed in any order by the workers.
+type chunkPipeline struct {
+	crypter *aeadChunkCrypter
+	decrypt bool
+	jobs    chan *chunkJob
+	pending chan *chunkJob
+	quit    chan struct{}
+	once    sync.Once
+}
+
+func newChunkPipeline(crypter *aeadChunkCrypter, workers int, decrypt bool) (*chunkPipeline, error) {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	crypters := make([]*aeadChunkCrypter, workers)
+	for i := range crypters {
+		var err error
+		if crypters[i], err = crypter.clone(); err != nil {
+			return nil, err
+		}
+	}
+	p := &chunkPipeline{
+		crypter: crypter,
+		decrypt: decrypt,
+		jobs:    make(chan *chunkJob, workers),
+		pending: make(chan *chunkJob, 2*workers),
+		quit:    make(chan struct{}),
+	}
+	for _, workerCrypter := range crypters {
+		go p.work(workerCrypter)
+	}
+	return p, nil
+}
+
+// work processes jobs with its own crypter, as an AEAD instance may not be
+// used on several goroutines.
+func (p *chunkPipeline) work(crypter *aeadChunkCrypter) {
+	for job := range p.jobs {
+		switch {
+		case job.final && p.decrypt:
+			job.err = crypter.checkFinalTag(job.input, job.index, job.size)
+		case job.final:
+			job.output = crypter.finalTag(job.index, job.size)
+		case p.decrypt:
+			job.output, job.err = crypter.openChunk(nil, job.input, job.index)
+		default:
+			job.output = crypter.sealChunk(nil, job.input, job.index)
+			clearMem(job.input)
+		}
+		job.input = nil
+		close(job.ready)
+	}
+}
+
+// submit queues a job, and returns false if the pipeline is stopped.
+func (p *chunkPipeline) submit(index, size uint64, final bool, input []byte, err error) bool {
+	job := &chunkJob{index: index, size: size, final: final, input: input, err: err, ready: make(chan struct{})}
+	select {
+	case p.pending <- job:
+	case <-p.quit:
+		return false
+	}
+	if err != nil {
+		close(job.ready)
+		return true
+	}
+	p.jobs <- job
+	return true
+}
+
+// finish is called once all the jobs are submitted.
+func (p *chunkPipeline) finish() {
+	close(p.jobs)
+	close(p.pending)
+}
+
+// stop makes the pending and future submissions fail.
+func (p *chunkPipeline) stop() {
+	p.once.Do(func() { close(p.quit) })
+}
+
+// parallelChunkWriter encrypts the data written to it in chunks, on several
+// goroutines, and writes them in order, followed by the final tag. Each chunk
+// and the final tag are written in a single call, as go-crypto does.
+type parallelChunkWriter struct {
+	writer   io.Writer
+	closer   io.Closer // closed after the final tag, if not nil
+	written  func(plaintextSize, ciphertextSize int)
+	pipeline *chunkPipeline
+	buffer   []byte
+	chunks   uint64
+	size     uint64
+	closed   bool
+	done     chan struct{}
+	lock     sync.Mutex
+	err      error // the first write error
+}
+
+// newParallelChunkWriter starts the encryption of the chunks written to w.
+// written is called, if not nil, after each chunk is written.
+func newParallelChunkWriter(w io.Writer, closer io.Closer, crypter *aeadChunkCrypter, workers int, written func(int, int)) (*parallelChunkWriter, error) {
+	pipeline, err := newChunkPipeline(crypter, workers, false)
+	if err != nil {
+		return nil, err
+	}
+	writer := &parallelChunkWriter{
+		writer:   w,
+		closer:   closer,
+		written:  written,
+		pipeline: pipeline,
+		done:     make(chan struct{}),
+	}
+	go writer.writeChunks()
+	return writer, nil
+}
+
+func (w *parallelChunkWriter) writeChunks() {
+	defer close(w.done)
+	for job := range w.pipeline.pending {
+		<-job.ready
+		if w.getErr() != nil {
+			continue
+		}
+		if _, err := w.writer.Write(job.output); err != nil {
+			w.setErr(errors.Wrap(err, "gopenpgp: error in writing the encrypted data"))
+			w.pipeline.stop()
+			continue
+		}
+		if !job.final && w.written != nil {
+			w.written(int(job.size), len(job.output))
+		}
+	}
+}
+
+func (w *parallelChunkWriter) getErr() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.err
+}
+
+func (w *parallelChunkWriter) setErr(err error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+func (w *parallelChunkWriter) Write(b []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("gopenpgp: the encryption writer is closed")
+	}
+	if err := w.getErr(); err != nil {
+		return 0, err
+	}
+	chunkSize := w.pipeline.crypter.chunkSize
+	w.buffer = append(w.buffer, b...)
+	for len(w.buffer) >= chunkSize {
+		if !w.submitChunk(clone(w.buffer[:chunkSize])) {
+			return 0, w.getErr()
+		}
+		remaining := copy(w.buffer, w.buffer[chunkSize:])
+		clearMem(w.buffer[remaining:])
+		w.buffer = w.buffer[:remaining]
+	}
+	return len(b), nil
+}
+
+func (w *parallelChunkWriter) Close() error {
+	if w.closed {
+		return w.getErr()
+	}
+	w.closed = true
+	// The last chunk is only empty if there is no data
+	if len(w.buffer) > 0 || w.chunks == 0 {
+		w.submitChunk(w.buffer)
+	}
+	w.buffer = nil
+	w.pipeline.submit(w.chunks, w.size, true, nil, nil)
+	w.pipeline.finish()
+	<-w.done
+	if err := w.getErr(); err != nil {
+		return err
+	}
+	if w.closer != nil {
+		if err := w.closer.Close(); err != nil {
+			return errors.Wrap(err, "gopenpgp: error in writing the encrypted data")
+		}
+	}
+	return nil
+}
+
+func (w *parallelChunkWriter) submitChunk(chunk []byte) bool {
+	size := uint64(len(chunk))
+	if !w.pipeline.submit(w.chunks, size, false, chunk, nil) {
+		return false
+	}
+	w.chunks++
+	w.size += size
+	return true
+}
+
+// parallelChunkReader decrypts the chunks and the final tag read from a
+// stream, on several goroutines, and returns them in order.
+type parallelChunkReader struct {
+	pipeline *chunkPipeline
+	current  []byte
+	err      error
+}
+
+// newParallelChunkReader starts the decryption of the chunks read from r.
+func newParallelChunkReader(r io.Reader, crypter *aeadChunkCrypter, workers int) (*parallelChunkReader, error) {
+	pipeline, err := newChunkPipeline(crypter, workers, true)
+	if err != nil {
+		return nil, err
+	}
+	reader := &parallelChunkReader{pipeline: pipeline}
+	go reader.readChunks(bufio.NewReaderSize(r, crypter.chunkSize+2*aeadChunkTagSize))
+	return reader, nil
+}
+
+// readChunks reads the encrypted chunks and the final tag, and submits them
+// to the pipeline. The final tag is the last tag size bytes of the stream,
+// so a chunk is the last one if the stream ends less than a tag after it.
+func (r *parallelChunkReader) readChunks(dataReader *bufio.Reader) {
+	defer r.pipeline.finish()
+	encryptedChunkSize := r.pipeline.crypter.chunkSize + aeadChunkTagSize
+	var size uint64
+	for index := uint64(0); ; index++ {
+		peeked, err := dataReader.Peek(encryptedChunkSize + aeadChunkTagSize)
+		if err != nil && !errors.Is(err, io.EOF) {
+			r.pipeline.submit(index, 0, false, nil, wrapError(err, "gopenpgp: error in reading the encrypted data"))
+			return
+		}
+		n := len(peeked) - aeadChunkTagSize
+		if n > encryptedChunkSize {
+			n = encryptedChunkSize
+		}
+		if n < 0 || (n < aeadChunkTagSize && (n > 0 || index == 0)) {
+			r.pipeline.submit(index, 0, false, nil, newError("gopenpgp: the encrypted data is truncated", ErrTruncatedInput))
+			return
+		}
+		if n == 0 {
+			r.pipeline.submit(index, size, true, clone(peeked), nil)
+			return
+		}
+		chunk := clone(peeked[:n])
+		if _, err := dataReader.Discard(n); err != nil {
+			r.pipeline.submit(index, 0, false, nil, wrapError(err, "gopenpgp: error in reading the encrypted data"))
+			return
+		}
+		size += uint64(n - aeadChunkTagSize)
+		if !r.pipeline.submit(index, uint64(n-aeadChunkTagSize), false, chunk, nil) {
+			return
+		}
+	}
+}
+
+// Read reads the decrypted data. Only authenticated chunks are returned,
+// and the final tag is checked before io.EOF is returned.
+func (r *parallelChunkReader) Read(b []byte) (n int, err error) {
+	for len(r.current) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		job, ok := <-r.pipeline.pending
+		if !ok {
+			r.err = io.EOF
+			continue
+		}
+		<-job.ready
+		if job.err != nil {
+			r.err = job.err
+			r.pipeline.stop()
+			continue
+		}
+		r.current = job.output
+	}
+	n = copy(b, r.current)
+	clearMem(r.current[:n])
+	r.current = r.current[n:]
+	return n, nil
+}
+
+// Close reads the data until the end, so that the final tag is checked, and
+// stops the decryption. It is called by the OpenPGP message reader once the
+// literal data is read, as go-crypto does with its decrypter.
+func (r *parallelChunkReader) Close() error {
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		r.stop()
+		return err
+	}
+	r.stop()
+	return nil
+}
+
+// stop stops the decryption, if the reader has not been read until the end.
+func (r *parallelChunkReader) stop() {
+	r.pipeline.stop()
+	clearMem(r.current)
+	r.current = nil
+	if r.err == nil {
+		r.err = errors.New("gopenpgp: the reader is closed")
+	}
+}
+
+// serializeSymmetricallyEncryptedParallel writes a version 2 Symmetrically
+// Encrypted Integrity Protected Data packet to w, encrypting the chunks on
+// several goroutines. The packet is identical to the one of
+// packet.SerializeSymmetricallyEncrypted with the same config.
+func serializeSymmetricallyEncryptedParallel(w io.Writer, sk *SessionKey, config *packet.Config, workers int) (io.WriteCloser, error) {
+	salt := make([]byte, aeadChunkSaltSize)
+	if _, err := io.ReadFull(config.Random(), salt); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: unable to generate the salt")
+	}
+	header, err := sk.newAEADChunkHeader(config.AEAD().Mode(), config.AEAD().ChunkSizeByte(), salt)
+	if err != nil {
+		return nil, err
+	}
+	crypter, err := newAEADChunkCrypter(sk, header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write([]byte{aeadChunkPacketTag}); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in writing the encrypted data")
+	}
+	body := &partialLengthWriter{w: w}
+	// The header and the salt are written separately, as go-crypto does
+	if _, err := body.Write(header[:4]); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in writing the encrypted data")
+	}
+	if _, err := body.Write(header[4:]); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in writing the encrypted data")
+	}
+	return newParallelChunkWriter(body, body, crypter, workers, nil)
+}
+
+// decryptSymmetricallyEncryptedParallel returns a reader decrypting the
+// chunks of a version 2 Symmetrically Encrypted Integrity Protected Data
+// packet on several goroutines.
+func decryptSymmetricallyEncryptedParallel(p *packet.SymmetricallyEncrypted, sk *SessionKey, workers int) (*seipdChunkReader, error) {
+	header := append([]byte{byte(p.Version), byte(p.Cipher), byte(p.Mode), p.ChunkSizeByte}, p.Salt[:]...)
+	crypter, err := newAEADChunkCrypter(sk, header)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := newParallelChunkReader(p.Contents, crypter, workers)
+	if err != nil {
+		return nil, err
+	}
+	return &seipdChunkReader{reader}, nil
+}
+
+// seipdChunkReader reports the integrity errors of the chunks as go-crypto
+// does, as the message reader replaces the other errors of the decrypted
+// data with a generic parsing error.
+type seipdChunkReader struct {
+	*parallelChunkReader
+}
+
+func (r *seipdChunkReader) Read(b []byte) (int, error) {
+	n, err := r.parallelChunkReader.Read(b)
+	return n, seipdChunkError(err)
+}
+
+func (r *seipdChunkReader) Close() error {
+	return seipdChunkError(r.parallelChunkReader.Close())
+}
+
+func seipdChunkError(err error) error {
+	if errors.Is(err, ErrIntegrity) || errors.Is(err, ErrTruncatedInput) {
+		return pgpErrors.ErrAEADTagVerification
+	}
+	return err
+}
+
+// partialLengthWriter writes a packet body with partial body lengths, as
+// go-crypto does, so that the packets serialized with it are identical to
+// the ones of go-crypto: the buffered data is written in the largest power
+// of two part once more than 512 bytes are buffered, before each write.
+type partialLengthWriter struct {
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+func (w *partialLengthWriter) Write(b []byte) (int, error) {
+	if bufLen := w.buf.Len(); bufLen > 512 {
+		power := uint(30)
+		for 1<<power > bufLen {
+			power--
+		}
+		if _, err := w.w.Write([]byte{224 + uint8(power)}); err != nil {
+			return 0, err
+		}
+		if _, err := w.w.Write(w.buf.Next(1 << power)); err != nil {
+			return 0, err
+		}
+	}
+	return w.buf.Write(b)
+}
+
+// Close writes the buffered data with a definite length.
+func (w *partialLengthWriter) Close() error {
+	length := w.buf.Len()
+	var header []byte
+	switch {
+	case length < 192:
+		header = []byte{byte(length)}
+	case length < 8384:
+		header = []byte{192 + byte((length-192)>>8), byte(length - 192)}
+	default:
+		header = []byte{255, byte(length >> 24), byte(length >> 16), byte(length >> 8), byte(length)}
+	}
+	if _, err := w.w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.buf.WriteTo(w.w)
+	return err
+}
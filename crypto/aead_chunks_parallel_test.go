@@ -0,0 +1,196 @@
+package crypto
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func testAEADClock() time.Time {
+	return time.Unix(1500000000, 0)
+}
+
+func newAEADTestKeyRing(t *testing.T) *KeyRing {
+	entity, err := openpgp.NewEntity(keyTestName, "", keyTestDomain, &packet.Config{
+		V6Keys:     true,
+		Algorithm:  packet.PubKeyAlgoEd25519,
+		AEADConfig: &packet.AEADConfig{},
+		Time:       testAEADClock,
+	})
+	if err != nil {
+		t.Fatal("Expected no error when generating key, got:", err)
+	}
+	keyRing, err := NewKeyRing(&Key{entity: entity})
+	if err != nil {
+		t.Fatal("Expected no error when creating the keyring, got:", err)
+	}
+	return keyRing
+}
+
+func encryptAEADStream(t *testing.T, keyRing *KeyRing, data []byte, workers int) []byte {
+	var ciphertext bytes.Buffer
+	writer, err := keyRing.EncryptStreamWithOptions(&ciphertext, testMeta, keyRing, &EncryptionOptions{
+		AEAD:    true,
+		Workers: workers,
+		TestingSources: &TestingSources{
+			Rand:  &testRandReader{seed: []byte("seed")},
+			Clock: testAEADClock,
+		},
+	})
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+	for i := 0; i < len(data); i += 10000 {
+		end := i + 10000
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err = writer.Write(data[i:end]); err != nil {
+			t.Fatal("Expected no error while writing data, got:", err)
+		}
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatal("Expected no error while closing the writer, got:", err)
+	}
+	return ciphertext.Bytes()
+}
+
+func decryptAEADStream(keyRing *KeyRing, ciphertext []byte, workers int) ([]byte, error) {
+	reader, err := keyRing.DecryptStreamWithOptions(
+		bytes.NewReader(ciphertext),
+		keyRing,
+		GetUnixTime(),
+		&DecryptionOptions{Workers: workers},
+	)
+	if err != nil {
+		return nil, err
+	}
+	decrypted, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if err = reader.VerifySignature(); err != nil {
+		return nil, err
+	}
+	return decrypted, nil
+}
+
+func TestAEADParallelEncryption(t *testing.T) {
+	keyRing := newAEADTestKeyRing(t)
+	for _, size := range []int{0, 1000, 1 << 18, 600000} {
+		data := bytes.Repeat([]byte("0123456789"), size/10)
+
+		serial := encryptAEADStream(t, keyRing, data, 0)
+		for _, workers := range []int{2, 4} {
+			assert.Exactly(t, serial, encryptAEADStream(t, keyRing, data, workers))
+		}
+
+		md, err := openpgp.ReadMessage(bytes.NewReader(serial), keyRing.entities, nil, nil)
+		if err != nil {
+			t.Fatal("Expected no error when reading the message, got:", err)
+		}
+		decrypted, err := ioutil.ReadAll(md.UnverifiedBody)
+		if err != nil {
+			t.Fatal("Expected no error when reading the message body, got:", err)
+		}
+		assert.Exactly(t, data, decrypted)
+		assert.Nil(t, md.SignatureError)
+
+		message := &peekReader{r: bytes.NewReader(serial)}
+		if _, err = readKeyPackets(message); err != nil {
+			t.Fatal("Expected no error when reading the key packets, got:", err)
+		}
+		dataPacket, err := packet.Read(message)
+		if err != nil {
+			t.Fatal("Expected no error when reading the data packet, got:", err)
+		}
+		if encrypted, ok := dataPacket.(*packet.SymmetricallyEncrypted); !ok || encrypted.Version != 2 {
+			t.Fatal("Expected a SEIPD version 2 packet, got:", dataPacket)
+		}
+	}
+}
+
+func TestAEADParallelDecryption(t *testing.T) {
+	keyRing := newAEADTestKeyRing(t)
+	for _, size := range []int{0, 1000, 1 << 18, 600000} {
+		data, err := RandomToken(size)
+		if err != nil {
+			t.Fatal("Expected no error while generating data, got:", err)
+		}
+		ciphertext := encryptAEADStream(t, keyRing, data, 4)
+		for _, workers := range []int{0, 4} {
+			decrypted, err := decryptAEADStream(keyRing, ciphertext, workers)
+			if err != nil {
+				t.Fatal("Expected no error while decrypting, got:", err)
+			}
+			assert.Exactly(t, data, decrypted)
+		}
+
+		message := &peekReader{r: bytes.NewReader(ciphertext)}
+		keyPackets, err := readKeyPackets(message)
+		if err != nil {
+			t.Fatal("Expected no error when reading the key packets, got:", err)
+		}
+		sessionKey, err := keyRing.DecryptSessionKey(bytes.Join(keyPackets, nil))
+		if err != nil {
+			t.Fatal("Expected no error when decrypting the session key, got:", err)
+		}
+		reader, err := sessionKey.DecryptStreamWithOptions(message, keyRing, GetUnixTime(), &DecryptionOptions{Workers: 4})
+		if err != nil {
+			t.Fatal("Expected no error while decrypting, got:", err)
+		}
+		decrypted, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal("Expected no error while reading the decrypted data, got:", err)
+		}
+		assert.Exactly(t, data, decrypted)
+		if err = reader.VerifySignature(); err != nil {
+			t.Fatal("Expected no error while verifying the signature, got:", err)
+		}
+	}
+
+	// Messages without AEAD chunks are decrypted on a single goroutine
+	data := []byte("plain text")
+	ciphertext := encryptAEADStream(t, keyRingTestPrivate, data, 4)
+	reader, err := keyRingTestPrivate.DecryptStreamWithOptions(
+		bytes.NewReader(ciphertext),
+		nil,
+		0,
+		&DecryptionOptions{Workers: 4},
+	)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting, got:", err)
+	}
+	decrypted, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal("Expected no error while reading the decrypted data, got:", err)
+	}
+	assert.Exactly(t, data, decrypted)
+}
+
+func TestAEADParallelDecryptionIntegrity(t *testing.T) {
+	keyRing := newAEADTestKeyRing(t)
+	data := bytes.Repeat([]byte("0123456789"), 60000)
+	ciphertext := encryptAEADStream(t, keyRing, data, 4)
+
+	for _, position := range []int{len(ciphertext) / 2, len(ciphertext) - 1} {
+		tampered := clone(ciphertext)
+		tampered[position] ^= 1
+		for _, workers := range []int{0, 4} {
+			_, err := decryptAEADStream(keyRing, tampered, workers)
+			if !errors.Is(err, ErrIntegrity) {
+				t.Fatal("Expected an integrity error, got:", err)
+			}
+		}
+	}
+
+	if _, err := decryptAEADStream(keyRing, ciphertext[:len(ciphertext)-1], 4); err == nil {
+		t.Fatal("Expected an error while decrypting a truncated message")
+	}
+}
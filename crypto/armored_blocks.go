@@ -0,0 +1,165 @@
+package crypto
+
+import (
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/angel-one/gopenpgp/v2/constants"
+)
+
+const armorBeginPrefix = "-----BEGIN PGP "
+
+var (
+	htmlDetectRegex    = regexp.MustCompile(`(?i)<(?:br|pre|p|div|span|html|body|blockquote)\b[^>]*>`)
+	htmlLineBreakRegex = regexp.MustCompile(`(?i)(?:<br\s*/?>|</?(?:p|div|pre|blockquote)\b[^>]*>)\r?\n?`)
+	htmlTagRegex       = regexp.MustCompile(`<[^>]*>`)
+)
+
+// ArmoredBlock is an armored PGP block found in a text by FindArmoredBlocks.
+type ArmoredBlock struct {
+	// Type is the armor type of the block, e.g. constants.PGPMessageHeader.
+	Type string
+	// Start and End are the byte offsets of the block in the scanned text,
+	// from the first dash of the BEGIN line to the last dash of the END line.
+	Start, End int
+	// Armored is the block, without HTML markup and quote prefixes.
+	Armored string
+	// Message is set for a PGP MESSAGE block.
+	Message *PGPMessage
+	// ClearText is set for a PGP SIGNED MESSAGE block.
+	ClearText *ClearTextMessage
+	// Signature is set for a PGP SIGNATURE block.
+	Signature *PGPSignature
+	// Key is set for a PGP PUBLIC KEY BLOCK or PGP PRIVATE KEY BLOCK block.
+	Key *Key
+	// Err is the error in parsing the block, if any.
+	Err error
+}
+
+// FindArmoredBlocks returns every armored PGP block of a text, such as a
+// pasted email, in the order they appear. The blocks may be surrounded by
+// other text, quoted with "> ", or part of an HTML document, e.g. in <pre>
+// tags. Blocks without END line are ignored, blocks which fail to parse are
+// returned with their Err set. Replacing text[Start:End] of each block, from
+// the last one to the first, splices the results back into the text.
+// * text : the text or HTML to scan.
+func FindArmoredBlocks(text string) []*ArmoredBlock {
+	isHTML := htmlDetectRegex.MatchString(text)
+	var blocks []*ArmoredBlock
+	for offset := 0; ; {
+		start, quote := findArmorLine(text, armorBeginPrefix, offset, isHTML)
+		if start < 0 {
+			return blocks
+		}
+		offset = start + len(armorBeginPrefix)
+		typeLength := strings.Index(text[offset:], "-----")
+		if typeLength < 0 {
+			return blocks
+		}
+		armorType := "PGP " + text[offset:offset+typeLength]
+		if !isArmorBlockType(armorType) {
+			continue
+		}
+		bodyStart := offset + typeLength + len("-----")
+
+		endMarker := "-----END " + armorType + "-----"
+		if armorType == constants.PGPSignedMessageHeader {
+			// The signed text ends at the BEGIN line of the signature.
+			signatureMarker := "-----BEGIN " + constants.PGPSignatureHeader + "-----"
+			signatureStart, _ := findArmorLine(text, signatureMarker, bodyStart, isHTML)
+			if signatureStart < 0 {
+				continue
+			}
+			if next, _ := findArmorLine(text, armorBeginPrefix, bodyStart, isHTML); next != signatureStart {
+				continue
+			}
+			bodyStart = signatureStart + len(signatureMarker)
+			endMarker = "-----END " + constants.PGPSignatureHeader + "-----"
+		}
+		end, _ := findArmorLine(text, endMarker, bodyStart, isHTML)
+		if end < 0 {
+			continue
+		}
+		if next, _ := findArmorLine(text, armorBeginPrefix, bodyStart, isHTML); next >= 0 && next < end {
+			// Truncated block, the next one starts before its END line.
+			continue
+		}
+		end += len(endMarker)
+
+		blocks = append(blocks, newArmoredBlock(text[start:end], armorType, quote, isHTML, start, end))
+		offset = end
+	}
+}
+
+func isArmorBlockType(armorType string) bool {
+	switch armorType {
+	case constants.PGPMessageHeader, constants.PGPSignedMessageHeader, constants.PGPSignatureHeader,
+		constants.PublicKeyHeader, constants.PrivateKeyHeader:
+		return true
+	}
+	return false
+}
+
+// findArmorLine returns the offset of the next occurrence of marker from the
+// offset from, which starts a line or follows a quote prefix, and the prefix.
+// It returns -1 if there is none.
+func findArmorLine(text, marker string, from int, isHTML bool) (int, string) {
+	for {
+		index := strings.Index(text[from:], marker)
+		if index < 0 {
+			return -1, ""
+		}
+		index += from
+		prefix := text[strings.LastIndexByte(text[:index], '\n')+1 : index]
+		if isHTML {
+			if lineBreaks := htmlLineBreakRegex.FindAllStringIndex(prefix, -1); len(lineBreaks) > 0 {
+				prefix = prefix[lineBreaks[len(lineBreaks)-1][1]:]
+			}
+			prefix = html.UnescapeString(htmlTagRegex.ReplaceAllString(prefix, ""))
+		}
+		if strings.Trim(prefix, "> \t\u00a0") == "" {
+			return index, prefix
+		}
+		from = index + len(marker)
+	}
+}
+
+// newArmoredBlock cleans up and parses a block found by FindArmoredBlocks.
+func newArmoredBlock(raw, armorType, quote string, isHTML bool, start, end int) *ArmoredBlock {
+	if isHTML {
+		raw = htmlLineBreakRegex.ReplaceAllString(raw, "\n")
+		raw = html.UnescapeString(htmlTagRegex.ReplaceAllString(raw, ""))
+	}
+	trimmedQuote := strings.TrimRight(quote, " \t\u00a0")
+	lines := strings.Split(raw, "\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, " \t\r\u00a0")
+		if i > 0 && quote != "" {
+			if strings.HasPrefix(line, quote) {
+				line = line[len(quote):]
+			} else {
+				line = strings.TrimPrefix(line, trimmedQuote)
+			}
+		}
+		lines[i] = line
+	}
+
+	block := &ArmoredBlock{
+		Type:    armorType,
+		Start:   start,
+		End:     end,
+		Armored: strings.Join(lines, "\n"),
+	}
+	switch armorType {
+	case constants.PGPMessageHeader:
+		block.Message, block.Err = NewPGPMessageFromArmored(block.Armored)
+	case constants.PGPSignedMessageHeader:
+		block.ClearText, block.Err = NewClearTextMessageFromArmored(block.Armored)
+	case constants.PGPSignatureHeader:
+		block.Signature, block.Err = NewPGPSignatureFromArmored(block.Armored)
+	default:
+		block.Key, block.Err = NewKeyFromArmored(block.Armored)
+	}
+	return block
+}
@@ -0,0 +1,151 @@
+package crypto
+
+import (
+	"html"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/angel-one/gopenpgp/v2/constants"
+)
+
+type testArmoredBlocks struct {
+	message, clearText, publicKey string
+}
+
+func newTestArmoredBlocks(t *testing.T) *testArmoredBlocks {
+	message, err := keyRingTestPublic.Encrypt(NewPlainMessageFromString("inline message"), nil)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+	armoredMessage, err := message.GetArmored()
+	if err != nil {
+		t.Fatal("Expected no error while armoring, got:", err)
+	}
+
+	signature, err := keyRingTestPrivate.SignDetached(NewPlainMessageFromString("signed text"))
+	if err != nil {
+		t.Fatal("Expected no error while signing, got:", err)
+	}
+	clearText, err := NewClearTextMessage([]byte("signed text"), signature.GetBinary()).GetArmored()
+	if err != nil {
+		t.Fatal("Expected no error while armoring, got:", err)
+	}
+
+	publicKey, err := keyRingTestPublic.GetKey(0)
+	if err != nil {
+		t.Fatal("Expected no error while getting key, got:", err)
+	}
+	armoredKey, err := publicKey.GetArmoredPublicKey()
+	if err != nil {
+		t.Fatal("Expected no error while armoring, got:", err)
+	}
+
+	return &testArmoredBlocks{message: armoredMessage, clearText: clearText, publicKey: armoredKey}
+}
+
+func TestFindArmoredBlocks(t *testing.T) {
+	blocks := newTestArmoredBlocks(t)
+	text := "Hi,\n\nhere is the message:\n" + blocks.message +
+		"\n\nand a signed note:\n\n" + blocks.clearText +
+		"\nMy key:\n" + blocks.publicKey + "\nBye\n"
+
+	found := FindArmoredBlocks(text)
+	if len(found) != 3 {
+		t.Fatal("Expected 3 blocks, got:", len(found))
+	}
+
+	assert.Exactly(t, constants.PGPMessageHeader, found[0].Type)
+	assert.Exactly(t, blocks.message, text[found[0].Start:found[0].End])
+	assert.Nil(t, found[0].Err)
+	decrypted, err := keyRingTestPrivate.Decrypt(found[0].Message, nil, 0)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting, got:", err)
+	}
+	assert.Exactly(t, "inline message", decrypted.GetString())
+
+	assert.Exactly(t, constants.PGPSignedMessageHeader, found[1].Type)
+	assert.Exactly(t, strings.TrimSpace(blocks.clearText), text[found[1].Start:found[1].End])
+	assert.Nil(t, found[1].Err)
+	assert.Exactly(t, "signed text", found[1].ClearText.GetString())
+	err = keyRingTestPublic.VerifyDetached(
+		NewPlainMessage(found[1].ClearText.GetBinary()),
+		NewPGPSignature(found[1].ClearText.GetBinarySignature()),
+		GetUnixTime(),
+	)
+	assert.Nil(t, err)
+
+	assert.Exactly(t, constants.PublicKeyHeader, found[2].Type)
+	assert.Nil(t, found[2].Err)
+	assert.Exactly(t, keyRingTestPublic.GetKeyIDs()[0], found[2].Key.GetKeyID())
+
+	spliced := text
+	for i := len(found) - 1; i >= 0; i-- {
+		spliced = spliced[:found[i].Start] + "[" + found[i].Type + "]" + spliced[found[i].End:]
+	}
+	assert.Exactly(t, "Hi,\n\nhere is the message:\n[PGP MESSAGE]\n\nand a signed note:\n\n"+
+		"[PGP SIGNED MESSAGE]\nMy key:\n[PGP PUBLIC KEY BLOCK]\nBye\n", spliced)
+}
+
+func TestFindArmoredBlocksQuoted(t *testing.T) {
+	blocks := newTestArmoredBlocks(t)
+	quoted := "> " + strings.ReplaceAll(strings.TrimSpace(blocks.message), "\n", "\n> ")
+	text := "On Monday, someone wrote:\n" + quoted + "\n"
+
+	found := FindArmoredBlocks(text)
+	if len(found) != 1 {
+		t.Fatal("Expected 1 block, got:", len(found))
+	}
+	assert.Nil(t, found[0].Err)
+	assert.Exactly(t, len("On Monday, someone wrote:\n> "), found[0].Start)
+	decrypted, err := keyRingTestPrivate.Decrypt(found[0].Message, nil, 0)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting, got:", err)
+	}
+	assert.Exactly(t, "inline message", decrypted.GetString())
+}
+
+func TestFindArmoredBlocksHTML(t *testing.T) {
+	blocks := newTestArmoredBlocks(t)
+	text := "<html><body><p>Hello &amp; welcome</p><pre>" + html.EscapeString(blocks.message) + "</pre>" +
+		"<div>" + strings.ReplaceAll(html.EscapeString(strings.TrimSpace(blocks.clearText)), "\n", "<br>") + "</div>" +
+		"</body></html>"
+
+	found := FindArmoredBlocks(text)
+	if len(found) != 2 {
+		t.Fatal("Expected 2 blocks, got:", len(found))
+	}
+
+	assert.Nil(t, found[0].Err)
+	assert.True(t, strings.HasPrefix(text[found[0].Start:], "-----BEGIN PGP MESSAGE-----"))
+	assert.True(t, strings.HasPrefix(text[found[0].End:], "</pre>"))
+	decrypted, err := keyRingTestPrivate.Decrypt(found[0].Message, nil, 0)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting, got:", err)
+	}
+	assert.Exactly(t, "inline message", decrypted.GetString())
+
+	assert.Nil(t, found[1].Err)
+	assert.True(t, strings.HasPrefix(text[found[1].End:], "</div>"))
+	assert.Exactly(t, "signed text", found[1].ClearText.GetString())
+}
+
+func TestFindArmoredBlocksMalformed(t *testing.T) {
+	blocks := newTestArmoredBlocks(t)
+	text := "-----BEGIN PGP MESSAGE-----\n\nnot base64!\n-----END PGP MESSAGE-----\n" +
+		"-----BEGIN PGP MESSAGE-----\ntruncated\n\n" +
+		"- -----BEGIN PGP MESSAGE-----\nnot a block\n" +
+		blocks.message
+
+	found := FindArmoredBlocks(text)
+	if len(found) != 2 {
+		t.Fatal("Expected 2 blocks, got:", len(found))
+	}
+	assert.NotNil(t, found[0].Err)
+	assert.Nil(t, found[0].Message)
+	assert.Exactly(t, 0, found[0].Start)
+
+	assert.Nil(t, found[1].Err)
+	assert.Exactly(t, blocks.message, text[found[1].Start:found[1].End])
+}
@@ -85,7 +85,8 @@ func (keyRing *KeyRing) newAttachmentProcessor(
 
 	config := &packet.Config{
 		DefaultCipher: packet.CipherAES256,
-		Time:          getTimeGenerator(),
+		Time:          keyRing.getPGP().getTimeGenerator(),
+		Rand:          keyRing.getPGP().rand,
 	}
 
 	reader, writer := io.Pipe()
@@ -149,7 +150,7 @@ func (keyRing *KeyRing) EncryptAttachment(message *PlainMessage, filename string
 func (keyRing *KeyRing) NewLowMemoryAttachmentProcessor(
 	estimatedSize int, filename string,
 ) (*AttachmentProcessor, error) {
-	return keyRing.newAttachmentProcessor(estimatedSize, filename, true, uint32(GetUnixTime()), 1<<20)
+	return keyRing.newAttachmentProcessor(estimatedSize, filename, true, uint32(keyRing.getPGP().GetUnixTime()), 1<<20)
 }
 
 // DecryptAttachment takes a PGPSplitMessage, containing a session key packet and symmetrically encrypted data
@@ -163,17 +164,17 @@ func (keyRing *KeyRing) DecryptAttachment(message *PGPSplitMessage) (*PlainMessa
 
 	encryptedReader := io.MultiReader(keyReader, dataReader)
 
-	config := &packet.Config{Time: getTimeGenerator()}
+	config := &packet.Config{Time: keyRing.getPGP().getTimeGenerator()}
 
-	md, err := openpgp.ReadMessage(encryptedReader, privKeyEntries, nil, config)
+	md, err := readMessage(encryptedReader, privKeyEntries, nil, config, keyRing.getPGP().getInMemoryDecryptionLimits())
 	if err != nil {
-		return nil, errors.Wrap(err, "gopengpp: unable to read attachment")
+		return nil, wrapError(err, "gopengpp: unable to read attachment")
 	}
 
 	decrypted := md.UnverifiedBody
 	b, err := ioutil.ReadAll(decrypted)
 	if err != nil {
-		return nil, errors.Wrap(err, "gopengpp: unable to read attachment body")
+		return nil, wrapError(err, "gopengpp: unable to read attachment body")
 	}
 
 	return &PlainMessage{
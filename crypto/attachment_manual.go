@@ -85,7 +85,7 @@ func (keyRing *KeyRing) NewManualAttachmentProcessor(
 
 	// hints for the encrypted file
 	isBinary := true
-	modTime := GetUnixTime()
+	modTime := keyRing.getPGP().GetUnixTime()
 	hints := &openpgp.FileHints{
 		FileName: filename,
 		IsBinary: isBinary,
@@ -95,7 +95,8 @@ func (keyRing *KeyRing) NewManualAttachmentProcessor(
 	// encryption config
 	config := &packet.Config{
 		DefaultCipher: packet.CipherAES256,
-		Time:          getTimeGenerator(),
+		Time:          keyRing.getPGP().getTimeGenerator(),
+		Rand:          keyRing.getPGP().rand,
 	}
 
 	// goroutine that reads the key packet
@@ -0,0 +1,117 @@
+package crypto
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// cancellationError returns the error of a cancelled operation, matching
+// ctx.Err() with errors.Is, or nil if ctx is not done.
+func cancellationError(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, "gopenpgp: operation cancelled")
+	}
+	return nil
+}
+
+// contextReader is a reader failing with the cancellation error once its
+// context is done.
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r *contextReader) Read(b []byte) (int, error) {
+	if err := cancellationError(r.ctx); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(b)
+}
+
+// contextReadSeeker is a contextReader keeping the Seek method of its reader.
+type contextReadSeeker struct {
+	contextReader
+	seeker io.Seeker
+}
+
+func (r *contextReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	if err := cancellationError(r.ctx); err != nil {
+		return 0, err
+	}
+	return r.seeker.Seek(offset, whence)
+}
+
+// newContextReader returns a reader reading from r until ctx is done.
+// The reader implements io.Seeker if r does.
+func newContextReader(ctx context.Context, r io.Reader) io.Reader {
+	if seeker, ok := r.(io.ReadSeeker); ok {
+		return &contextReadSeeker{contextReader{ctx, r}, seeker}
+	}
+	return &contextReader{ctx, r}
+}
+
+// contextWriter is a writer failing with the cancellation error once its
+// context is done.
+type contextWriter struct {
+	ctx    context.Context
+	writer io.Writer
+}
+
+func (w *contextWriter) Write(b []byte) (int, error) {
+	if err := cancellationError(w.ctx); err != nil {
+		return 0, err
+	}
+	return w.writer.Write(b)
+}
+
+// encryptionState holds the session key and the serializer of an encryption,
+// so that they can be wiped when the encryption is cancelled.
+type encryptionState struct {
+	sessionKey *SessionKey
+	serializer io.WriteCloser
+}
+
+// wipe zeroes the session key and drops the serializer, whose cipher holds
+// the expanded session key, without closing it.
+func (s *encryptionState) wipe() {
+	if s.sessionKey != nil {
+		s.sessionKey.Clear()
+		s.sessionKey = nil
+	}
+	s.serializer = nil
+}
+
+// contextWriteCloser is a WriteCloser failing with the cancellation error
+// once its context is done. After a cancellation the underlying writer is
+// released without being closed, so that the encrypted message is left
+// unterminated, and the session key of the encryption is wiped.
+type contextWriteCloser struct {
+	ctx    context.Context
+	writer WriteCloser
+	state  *encryptionState
+}
+
+func (w *contextWriteCloser) Write(b []byte) (int, error) {
+	if err := w.cancel(); err != nil {
+		return 0, err
+	}
+	return w.writer.Write(b)
+}
+
+func (w *contextWriteCloser) Close() error {
+	if err := w.cancel(); err != nil {
+		return err
+	}
+	return w.writer.Close()
+}
+
+func (w *contextWriteCloser) cancel() error {
+	err := cancellationError(w.ctx)
+	if err != nil {
+		w.writer = nil
+		w.state.wipe()
+	}
+	return err
+}
@@ -0,0 +1,230 @@
+package crypto
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/eddsa"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// cancellingReader reads one byte at a time from reader and cancels the
+// context after the first read.
+type cancellingReader struct {
+	reader io.Reader
+	cancel context.CancelFunc
+}
+
+func (r *cancellingReader) Read(b []byte) (int, error) {
+	defer r.cancel()
+	if len(b) > 1 {
+		b = b[:1]
+	}
+	return r.reader.Read(b)
+}
+
+func TestEncryptDecryptStreamCtx(t *testing.T) {
+	messageBytes := []byte("Hello World!")
+
+	var ciphertextBuf bytes.Buffer
+	messageWriter, err := keyRingTestPublic.EncryptStreamCtx(context.Background(), &ciphertextBuf, testMeta, keyRingTestPrivate)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting stream with key ring, got:", err)
+	}
+	if _, err = messageWriter.Write(messageBytes); err != nil {
+		t.Fatal("Expected no error while writing data, got:", err)
+	}
+	if err = messageWriter.Close(); err != nil {
+		t.Fatal("Expected no error while closing plaintext writer, got:", err)
+	}
+
+	decryptedReader, err := keyRingTestPrivate.DecryptStreamCtx(
+		context.Background(),
+		bytes.NewReader(ciphertextBuf.Bytes()),
+		keyRingTestPublic,
+		GetUnixTime(),
+	)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting stream with key ring, got:", err)
+	}
+	decryptedBytes, err := ioutil.ReadAll(decryptedReader)
+	if err != nil {
+		t.Fatal("Expected no error while reading the decrypted data, got:", err)
+	}
+	assert.Exactly(t, messageBytes, decryptedBytes)
+	if err = decryptedReader.VerifySignature(); err != nil {
+		t.Fatal("Expected no error while verifying the signature, got:", err)
+	}
+}
+
+func TestEncryptStreamCtxCancellation(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := keyRingTestPublic.EncryptStreamCtx(cancelled, &bytes.Buffer{}, testMeta, nil)
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var ciphertextBuf bytes.Buffer
+	messageWriter, err := keyRingTestPublic.EncryptStreamCtx(ctx, &ciphertextBuf, testMeta, nil)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting stream with key ring, got:", err)
+	}
+	if _, err = messageWriter.Write([]byte("Hello")); err != nil {
+		t.Fatal("Expected no error while writing data, got:", err)
+	}
+	cancel()
+	_, err = messageWriter.Write([]byte(" World!"))
+	assert.True(t, errors.Is(err, context.Canceled))
+	err = messageWriter.Close()
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	// The message is left unterminated
+	decryptedReader, err := keyRingTestPrivate.DecryptStream(bytes.NewReader(ciphertextBuf.Bytes()), nil, 0)
+	if err == nil {
+		_, err = ioutil.ReadAll(decryptedReader)
+	}
+	assert.Error(t, err)
+}
+
+func TestEncryptStreamCtxCancellationWipesSessionKey(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	plainMessageWriter, err := keyRingTestPublic.EncryptStreamCtx(ctx, &bytes.Buffer{}, testMeta, nil)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting stream with key ring, got:", err)
+	}
+	messageWriter, ok := plainMessageWriter.(*contextWriteCloser)
+	if !ok {
+		t.Fatal("Expected a contextWriteCloser, got:", plainMessageWriter)
+	}
+	sessionKey := messageWriter.state.sessionKey.Key
+	assert.NotEqual(t, make([]byte, len(sessionKey)), sessionKey)
+	assert.NotNil(t, messageWriter.state.serializer)
+
+	cancel()
+	_, err = messageWriter.Write([]byte("Hello"))
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Exactly(t, make([]byte, len(sessionKey)), sessionKey)
+	assert.Nil(t, messageWriter.state.sessionKey)
+	assert.Nil(t, messageWriter.state.serializer)
+	assert.Nil(t, messageWriter.writer)
+}
+
+func TestDecryptStreamCtxCancellation(t *testing.T) {
+	ciphertext, err := keyRingTestPublic.Encrypt(NewPlainMessage(bytes.Repeat([]byte("Hello World!"), 10000)), nil)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = keyRingTestPrivate.DecryptStreamCtx(cancelled, bytes.NewReader(ciphertext.GetBinary()), nil, 0)
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	decryptedReader, err := keyRingTestPrivate.DecryptStreamCtx(ctx, bytes.NewReader(ciphertext.GetBinary()), nil, 0)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting stream with key ring, got:", err)
+	}
+	if _, err = decryptedReader.Read(make([]byte, 100)); err != nil {
+		t.Fatal("Expected no error while reading the decrypted data, got:", err)
+	}
+	cancel()
+	_, err = ioutil.ReadAll(decryptedReader)
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestSignVerifyDetachedStreamCtx(t *testing.T) {
+	messageBytes := []byte("Hello World!")
+
+	signature, err := keyRingTestPrivate.SignDetachedStreamCtx(context.Background(), bytes.NewReader(messageBytes))
+	if err != nil {
+		t.Fatal("Expected no error while signing, got:", err)
+	}
+	err = keyRingTestPublic.VerifyDetachedStreamCtx(context.Background(), bytes.NewReader(messageBytes), signature, GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error while verifying, got:", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err = keyRingTestPrivate.SignDetachedStreamCtx(ctx, &cancellingReader{bytes.NewReader(messageBytes), cancel})
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	ctx, cancel = context.WithCancel(context.Background())
+	err = keyRingTestPublic.VerifyDetachedStreamCtx(ctx, &cancellingReader{bytes.NewReader(messageBytes), cancel}, signature, GetUnixTime())
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestGenerateKeyCtx(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	key, err := GenerateKeyCtx(ctx, keyTestName, keyTestDomain, "x25519", 0)
+	if err != nil {
+		t.Fatal("Expected no error while generating the key, got:", err)
+	}
+	assert.True(t, key.IsPrivate())
+
+	cancel()
+	_, err = GenerateKeyCtx(ctx, keyTestName, keyTestDomain, "x25519", 0)
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = GenerateKeyCtx(ctx, keyTestName, keyTestDomain, "rsa", 8192)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestGenerateKeyCtxKeepsConfig(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	if _, err := newEntityCtx(ctx, keyTestName, "", keyTestDomain, config); err != nil {
+		t.Fatal("Expected no error while generating the key, got:", err)
+	}
+	assert.Nil(t, config.Rand)
+}
+
+func TestGenerateKeyCtxCancelledGeneration(t *testing.T) {
+	entity, err := openpgp.NewEntity(keyTestName, "", keyTestDomain, &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatal("Expected no error while generating the key, got:", err)
+	}
+	privateKey, ok := entity.PrivateKey.PrivateKey.(*eddsa.PrivateKey)
+	if !ok {
+		t.Fatal("Expected an EdDSA private key")
+	}
+	secret := privateKey.D
+
+	// The generation completes after the cancellation
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	release := make(chan struct{})
+	discarded := make(chan struct{})
+	start := time.Now()
+	_, err = generateEntityCtx(ctx, func() (*openpgp.Entity, error) {
+		<-release
+		return entity, nil
+	}, func(e *openpgp.Entity) {
+		discardEntity(e)
+		close(discarded)
+	})
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.True(t, time.Since(start) < time.Second)
+
+	close(release)
+	select {
+	case <-discarded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the abandoned entity to be discarded")
+	}
+	assert.Nil(t, entity.PrivateKey)
+	assert.Exactly(t, make([]byte, len(secret)), secret)
+}
@@ -0,0 +1,217 @@
+package crypto
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/angel-one/gopenpgp/v2/constants"
+	"github.com/pkg/errors"
+)
+
+// CompressionConfig selects the compression of the plaintext before encryption.
+type CompressionConfig struct {
+	// Algorithm is constants.CompressionNone, constants.CompressionZIP or
+	// constants.CompressionZLIB, the empty string selects ZLIB.
+	// Messages compressed with constants.CompressionBZIP2 can be decrypted,
+	// but not created.
+	Algorithm string
+	// Level is the compression level, from 1 (fastest) to 9 (smallest).
+	// 0 selects constants.DefaultCompressionLevel.
+	Level int
+	// SkipCompressedData disables the compression when the plaintext starts
+	// with the magic bytes of an already compressed format, such as JPEG, PNG or ZIP.
+	SkipCompressedData bool
+}
+
+// NewCompressionConfig returns a configuration compressing with the given
+// algorithm and level.
+// * algorithm : constants.CompressionNone, constants.CompressionZIP or constants.CompressionZLIB.
+// * level     : from 1 (fastest) to 9 (smallest), 0 selects the default.
+func NewCompressionConfig(algorithm string, level int) *CompressionConfig {
+	return &CompressionConfig{Algorithm: algorithm, Level: level}
+}
+
+// defaultCompressionConfig is used by the functions compressing with the default settings.
+var defaultCompressionConfig = &CompressionConfig{Algorithm: constants.CompressionZLIB}
+
+// setPacketConfig sets the compression algorithm and level of the go-crypto configuration.
+func (config *CompressionConfig) setPacketConfig(packetConfig *packet.Config) error {
+	if config == nil {
+		return nil
+	}
+
+	if config.Level < 0 || config.Level > 9 {
+		return errors.New("gopenpgp: compression level must be between 1 and 9")
+	}
+	level := config.Level
+	if level == 0 {
+		level = constants.DefaultCompressionLevel
+	}
+
+	switch config.Algorithm {
+	case constants.CompressionNone:
+		packetConfig.DefaultCompressionAlgo = packet.CompressionNone
+		return nil
+	case constants.CompressionZIP:
+		packetConfig.DefaultCompressionAlgo = packet.CompressionZIP
+	case "", constants.CompressionZLIB:
+		packetConfig.DefaultCompressionAlgo = packet.CompressionZLIB
+	case constants.CompressionBZIP2:
+		return newError("gopenpgp: BZIP2 compression is only supported for decryption", ErrUnsupportedAlgorithm)
+	default:
+		return newError("gopenpgp: unsupported compression algorithm "+config.Algorithm, ErrUnsupportedAlgorithm)
+	}
+	packetConfig.CompressionConfig = &packet.CompressionConfig{Level: level}
+	return nil
+}
+
+func (config *CompressionConfig) skipCompressedData() bool {
+	return config != nil && config.SkipCompressedData
+}
+
+// compressedDataMagics are the signatures of compressed file formats,
+// with their offset from the start of the file.
+var compressedDataMagics = []struct {
+	offset int
+	magic  []byte
+}{
+	{0, []byte{0xff, 0xd8, 0xff}},                            // JPEG
+	{0, []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}}, // PNG
+	{0, []byte("GIF8")},                                      // GIF
+	{0, []byte("PK\x03\x04")},                                // ZIP, and the formats based on it
+	{0, []byte("PK\x05\x06")},                                // empty ZIP
+	{0, []byte{0x1f, 0x8b}},                                  // gzip
+	{0, []byte("BZh")},                                       // bzip2
+	{0, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},              // xz
+	{0, []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c}},            // 7z
+	{0, []byte{0x28, 0xb5, 0x2f, 0xfd}},                      // zstd
+	{0, []byte("Rar!\x1a\x07")},                              // RAR
+	{0, []byte("OggS")},                                      // Ogg
+	{0, []byte("fLaC")},                                      // FLAC
+	{0, []byte("ID3")},                                       // MP3
+	{0, []byte("wOF2")},                                      // WOFF2
+	{0, []byte{0x1a, 0x45, 0xdf, 0xa3}},                      // Matroska, WebM
+	{4, []byte("ftyp")},                                      // MP4, MOV, HEIC
+	{8, []byte("WEBP")},                                      // WebP, in a RIFF container
+}
+
+// compressedDataHeaderSize is the number of bytes needed to detect all formats.
+const compressedDataHeaderSize = 12
+
+// isCompressedData reports whether data starts with the magic bytes of a compressed format.
+func isCompressedData(data []byte) bool {
+	for _, format := range compressedDataMagics {
+		end := format.offset + len(format.magic)
+		if len(data) >= end && bytes.Equal(data[format.offset:end], format.magic) {
+			return true
+		}
+	}
+	return false
+}
+
+// plaintextWritersBuilder writes the packets containing the plaintext of a
+// message, compressed with the given algorithm. It returns the writer of the
+// data packets, and the writer of the signature if the message is signed.
+type plaintextWritersBuilder func(algo packet.CompressionAlgo) (encryptWriter, signWriter io.WriteCloser, err error)
+
+// compressionSkippingWriter buffers the beginning of the plaintext to choose
+// the compression, before writing the packets of the message.
+type compressionSkippingWriter struct {
+	algo          packet.CompressionAlgo
+	build         plaintextWritersBuilder
+	header        []byte
+	encryptWriter io.WriteCloser
+	signWriter    io.WriteCloser
+}
+
+// newCompressionSkippingWriters returns writers that compress the plaintext
+// with algo, unless it is already compressed. If signed, the plaintext is
+// written to signWriter, otherwise to encryptWriter.
+func newCompressionSkippingWriters(
+	algo packet.CompressionAlgo,
+	signed bool,
+	build plaintextWritersBuilder,
+) (encryptWriter, signWriter io.WriteCloser, err error) {
+	w := &compressionSkippingWriter{algo: algo, build: build}
+	if signed {
+		return &compressionSkippingDataWriter{w}, &compressionSkippingPlaintextWriter{w}, nil
+	}
+	return &compressionSkippingPlaintextWriter{w}, nil, nil
+}
+
+// start chooses the compression and writes the buffered plaintext.
+func (w *compressionSkippingWriter) start() error {
+	if w.encryptWriter != nil {
+		return nil
+	}
+	algo := w.algo
+	if isCompressedData(w.header) {
+		algo = packet.CompressionNone
+	}
+	encryptWriter, signWriter, err := w.build(algo)
+	if err != nil {
+		return err
+	}
+	w.encryptWriter, w.signWriter = encryptWriter, signWriter
+	_, err = w.plaintext().Write(w.header)
+	return err
+}
+
+func (w *compressionSkippingWriter) plaintext() io.WriteCloser {
+	if w.signWriter != nil {
+		return w.signWriter
+	}
+	return w.encryptWriter
+}
+
+// compressionSkippingPlaintextWriter is the writer of the plaintext.
+type compressionSkippingPlaintextWriter struct {
+	*compressionSkippingWriter
+}
+
+func (w *compressionSkippingPlaintextWriter) Write(data []byte) (int, error) {
+	if w.encryptWriter != nil {
+		return w.plaintext().Write(data)
+	}
+
+	n := compressedDataHeaderSize - len(w.header)
+	if n > len(data) {
+		n = len(data)
+	}
+	w.header = append(w.header, data[:n]...)
+	if len(w.header) < compressedDataHeaderSize {
+		return n, nil
+	}
+	if err := w.start(); err != nil {
+		return 0, err
+	}
+	written, err := w.plaintext().Write(data[n:])
+	return n + written, err
+}
+
+func (w *compressionSkippingPlaintextWriter) Close() error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	return w.plaintext().Close()
+}
+
+// compressionSkippingDataWriter is the writer of the data packets of a signed message.
+type compressionSkippingDataWriter struct {
+	*compressionSkippingWriter
+}
+
+func (w *compressionSkippingDataWriter) Write(data []byte) (int, error) {
+	if err := w.start(); err != nil {
+		return 0, err
+	}
+	return w.encryptWriter.Write(data)
+}
+
+func (w *compressionSkippingDataWriter) Close() error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	return w.encryptWriter.Close()
+}
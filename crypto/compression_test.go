@@ -0,0 +1,116 @@
+package crypto
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/angel-one/gopenpgp/v2/constants"
+)
+
+func TestMessageEncryptionWithCompressionAlgorithms(t *testing.T) {
+	message := NewPlainMessage(bytes.Repeat([]byte("Hello World! "), 1000))
+
+	sizes := make(map[string]int)
+	for _, algorithm := range []string{constants.CompressionNone, constants.CompressionZIP, constants.CompressionZLIB} {
+		options := &EncryptionOptions{Compression: NewCompressionConfig(algorithm, 9)}
+		ciphertext, err := keyRingTestPublic.EncryptWithOptions(message, keyRingTestPrivate, options)
+		if err != nil {
+			t.Fatal("Expected no error when encrypting with "+algorithm+", got:", err)
+		}
+		decrypted, err := keyRingTestPrivate.Decrypt(ciphertext, keyRingTestPublic, GetUnixTime())
+		if err != nil {
+			t.Fatal("Expected no error when decrypting with "+algorithm+", got:", err)
+		}
+		assert.Exactly(t, message.GetBinary(), decrypted.GetBinary())
+		sizes[algorithm] = len(ciphertext.GetBinary())
+	}
+	assert.Less(t, sizes[constants.CompressionZIP], sizes[constants.CompressionNone]/10)
+	assert.Less(t, sizes[constants.CompressionZLIB], sizes[constants.CompressionNone]/10)
+
+	_, err := keyRingTestPublic.EncryptWithOptions(message, nil, &EncryptionOptions{
+		Compression: NewCompressionConfig(constants.CompressionBZIP2, 0),
+	})
+	assert.Error(t, err)
+
+	_, err = keyRingTestPublic.EncryptWithOptions(message, nil, &EncryptionOptions{
+		Compression: NewCompressionConfig(constants.CompressionZLIB, 10),
+	})
+	assert.Error(t, err)
+}
+
+func TestMessageDecryptionWithBZIP2(t *testing.T) {
+	ciphertext, err := NewPGPMessageFromArmored(readTestFile("message_bzip2", false))
+	if err != nil {
+		t.Fatal("Expected no error when unarmoring, got:", err)
+	}
+	decrypted, err := DecryptMessageWithPassword(ciphertext, []byte("password"))
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, "Hello World! Hello World! Hello World!", decrypted.GetString())
+}
+
+func TestEncryptionSkippingCompressedData(t *testing.T) {
+	compressible := bytes.Repeat([]byte{0}, 1<<14)
+	jpeg := append([]byte{0xff, 0xd8, 0xff, 0xe0}, compressible...)
+	options := &EncryptionOptions{
+		Compression: &CompressionConfig{Algorithm: constants.CompressionZLIB, SkipCompressedData: true},
+	}
+
+	sessionKey, err := GenerateSessionKey()
+	if err != nil {
+		t.Fatal("Expected no error when generating the session key, got:", err)
+	}
+	dataPacket, err := sessionKey.EncryptWithOptions(NewPlainMessage(compressible), nil, options)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	assert.Less(t, len(dataPacket), 1<<10)
+
+	dataPacket, err = sessionKey.EncryptWithOptions(NewPlainMessage(jpeg), nil, options)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	assert.Greater(t, len(dataPacket), len(jpeg))
+	decrypted, err := sessionKey.Decrypt(dataPacket)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, jpeg, decrypted.GetBinary())
+
+	// Stream the data in small chunks, to split the magic bytes
+	var ciphertextBuf bytes.Buffer
+	messageWriter, err := keyRingTestPublic.EncryptStreamWithOptions(&ciphertextBuf, nil, keyRingTestPrivate, options)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting the stream, got:", err)
+	}
+	for i := 0; i < len(jpeg); i += 3 {
+		end := i + 3
+		if end > len(jpeg) {
+			end = len(jpeg)
+		}
+		if _, err = messageWriter.Write(jpeg[i:end]); err != nil {
+			t.Fatal("Expected no error when writing, got:", err)
+		}
+	}
+	if err = messageWriter.Close(); err != nil {
+		t.Fatal("Expected no error when closing, got:", err)
+	}
+	assert.Greater(t, ciphertextBuf.Len(), len(jpeg))
+
+	reader, err := keyRingTestPrivate.DecryptStream(&ciphertextBuf, keyRingTestPublic, GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error when decrypting the stream, got:", err)
+	}
+	decryptedBytes, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal("Expected no error when reading, got:", err)
+	}
+	assert.Exactly(t, jpeg, decryptedBytes)
+	if err = reader.VerifySignature(); err != nil {
+		t.Fatal("Expected no error when verifying the signature, got:", err)
+	}
+}
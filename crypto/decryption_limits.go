@@ -0,0 +1,571 @@
+package crypto
+
+import (
+	"compress/bzip2"
+	"compress/flate"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgpErrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/angel-one/gopenpgp/v2/constants"
+)
+
+// DecryptionLimits bounds the resources used to decrypt a message, to defend
+// against compression bombs and packet abuse. A zero field disables the limit,
+// except for MaxDecompressedSize in the in-memory functions.
+type DecryptionLimits struct {
+	// MaxDecompressedSize is the maximum number of bytes output by the
+	// decompression of the compressed packets of a message. The compressed
+	// packets of an encrypted message are decompressed by go-crypto: the
+	// size of its plaintext is limited instead.
+	// If zero, the functions decrypting a whole message in memory use
+	// constants.DefaultMaxDecompressedSize, and the streaming functions
+	// do not limit the size.
+	MaxDecompressedSize int64
+	// MaxCompressionDepth is the maximum nesting depth of compressed packets.
+	// The depth of the compressed packets of an encrypted message is bounded
+	// by go-crypto, except with session keys.
+	MaxCompressionDepth int
+	// MaxPackets is the maximum number of packets in a message, including the
+	// packets nested in compressed packets. The packets of the decrypted data
+	// are only counted when decrypting with a session key.
+	MaxPackets int
+	// MaxTrialDecryptions is the maximum number of private keys tried against
+	// the session key packets with a wildcard key ID.
+	MaxTrialDecryptions int
+}
+
+// NewDefaultDecryptionLimits returns the default decryption limits.
+// The decompressed size is not set: the in-memory functions limit it to
+// constants.DefaultMaxDecompressedSize, which fits most messages and
+// attachments, and the streaming functions do not limit it.
+func NewDefaultDecryptionLimits() *DecryptionLimits {
+	return &DecryptionLimits{
+		MaxCompressionDepth: constants.DefaultMaxCompressionDepth,
+		MaxPackets:          constants.DefaultMaxPackets,
+		MaxTrialDecryptions: constants.DefaultMaxTrialDecryptions,
+	}
+}
+
+// SetDecryptionLimits sets the limits enforced by all decryption functions
+// of the default instance. A nil limits restores the defaults.
+func SetDecryptionLimits(limits *DecryptionLimits) {
+	pgp.SetDecryptionLimits(limits)
+}
+
+// GetDecryptionLimits returns a copy of the limits enforced by all decryption
+// functions of the default instance.
+func GetDecryptionLimits() *DecryptionLimits {
+	return pgp.GetDecryptionLimits()
+}
+
+// SetDecryptionLimits sets the limits enforced by the decryption functions
+// of the instance. A nil limits restores the defaults.
+func (pgp *GopenPGP) SetDecryptionLimits(limits *DecryptionLimits) {
+	pgp.lock.Lock()
+	defer pgp.lock.Unlock()
+
+	if limits == nil {
+		limits = NewDefaultDecryptionLimits()
+	}
+	pgp.decryptionLimits = *limits
+}
+
+// GetDecryptionLimits returns a copy of the limits enforced by the decryption
+// functions of the instance.
+func (pgp *GopenPGP) GetDecryptionLimits() *DecryptionLimits {
+	limits := pgp.getDecryptionLimits()
+	return &limits
+}
+
+// DecryptionLimitError is returned when decrypting a message exceeds one of
+// the DecryptionLimits.
+type DecryptionLimitError struct {
+	// Limit is the name of the exceeded field of DecryptionLimits.
+	Limit string
+	// Max is the value of the exceeded limit.
+	Max int64
+}
+
+// Error is the base method for all errors.
+func (e DecryptionLimitError) Error() string {
+	return fmt.Sprintf("gopenpgp: decryption limit exceeded: %s (%d)", e.Limit, e.Max)
+}
+
+// ----- INTERNAL FUNCTIONS -----
+
+func (pgp *GopenPGP) getDecryptionLimits() DecryptionLimits {
+	pgp.lock.RLock()
+	defer pgp.lock.RUnlock()
+
+	return pgp.decryptionLimits
+}
+
+// getInMemoryDecryptionLimits returns the decryption limits of the functions
+// which decrypt a whole message in memory: the decompressed size defaults to
+// constants.DefaultMaxDecompressedSize.
+func (pgp *GopenPGP) getInMemoryDecryptionLimits() DecryptionLimits {
+	limits := pgp.getDecryptionLimits()
+	if limits.MaxDecompressedSize == 0 {
+		limits.MaxDecompressedSize = constants.DefaultMaxDecompressedSize
+	}
+	return limits
+}
+
+// decryptionLimitState counts the resources used by the decryption of a message.
+type decryptionLimitState struct {
+	limits       DecryptionLimits
+	packets      int
+	decompressed int64
+	err          error // the first exceeded limit
+
+	// authenticatedChunks is set when the encrypted data packet is
+	// AEAD-protected: each chunk is then released once authenticated.
+	authenticatedChunks bool
+	// integrityProtected is set when the encrypted data packet has an MDC
+	// or is AEAD-protected.
+	integrityProtected bool
+}
+
+// exceeded records and returns the error for the exceeded limit.
+func (state *decryptionLimitState) exceeded(limit string, max int64) error {
+	if state.err == nil {
+		state.err = DecryptionLimitError{Limit: limit, Max: max}
+	}
+	return state.err
+}
+
+// checkError returns the error for the exceeded limit, if any, and err otherwise.
+// go-crypto turns some errors of the packet stream into parsing errors,
+// so the limit errors are returned from the state.
+func (state *decryptionLimitState) checkError(err error) error {
+	if state.err != nil {
+		return state.err
+	}
+	return err
+}
+
+func (state *decryptionLimitState) countPacket() error {
+	state.packets++
+	if state.limits.MaxPackets > 0 && state.packets > state.limits.MaxPackets {
+		return state.exceeded("MaxPackets", int64(state.limits.MaxPackets))
+	}
+	return nil
+}
+
+// readMessage calls openpgp.ReadMessage, enforcing the decryption limits.
+// The message is read through limitedPacketReader, which bounds the packets
+// and decompresses the compressed packets of an unencrypted message.
+// The contents of an encrypted message are decompressed by go-crypto:
+// the size of the plaintext then counts against MaxDecompressedSize.
+func readMessage(
+	encryptedIO io.Reader,
+	keyRing openpgp.KeyRing,
+	prompt openpgp.PromptFunction,
+	config *packet.Config,
+	limits DecryptionLimits,
+) (*openpgp.MessageDetails, error) {
+	state := &decryptionLimitState{limits: limits}
+
+	var decryptionKeys openpgp.KeyRing
+	var trialKeyRing *trialDecryptionKeyRing
+	if keyRing != nil {
+		trialKeyRing = newTrialDecryptionKeyRing(keyRing, state.limits.MaxTrialDecryptions)
+		decryptionKeys = trialKeyRing
+	}
+	md, err := openpgp.ReadMessage(newLimitedPacketReader(encryptedIO, state), decryptionKeys, prompt, config)
+	if err != nil {
+		if trialKeyRing != nil && trialKeyRing.exhausted {
+			return nil, state.exceeded("MaxTrialDecryptions", int64(state.limits.MaxTrialDecryptions))
+		}
+		return nil, state.checkError(err)
+	}
+	md.UnverifiedBody = &limitCheckReader{
+		body:           md.UnverifiedBody,
+		state:          state,
+		countPlaintext: md.IsEncrypted,
+	}
+	return md, nil
+}
+
+// readDecryptedMessage parses the decrypted contents of an encrypted data
+// packet, enforcing the decryption limits of state. The integrity of the data
+// is checked when the end of the message body is read.
+func readDecryptedMessage(
+	decrypted io.ReadCloser,
+	keyRing openpgp.KeyRing,
+	config *packet.Config,
+	state *decryptionLimitState,
+) (*openpgp.MessageDetails, error) {
+	md, err := openpgp.ReadMessage(newLimitedPacketReader(decrypted, state), keyRing, nil, config)
+	if err != nil {
+		return nil, state.checkError(err)
+	}
+	md.UnverifiedBody = &limitCheckReader{
+		body:  checkReader{decrypted, md.UnverifiedBody},
+		state: state,
+	}
+	return md, nil
+}
+
+// isAEADProtected returns whether the encrypted data packet is protected
+// with AEAD: an AEAD encrypted data packet or a version 2 SEIPD packet.
+func isAEADProtected(edp packet.EncryptedDataPacket) bool {
+	switch p := edp.(type) {
+	case *packet.AEADEncrypted:
+		return true
+	case *packet.SymmetricallyEncrypted:
+		return p.Version == 2
+	}
+	return false
+}
+
+// isIntegrityProtected returns whether the encrypted data packet is protected
+// with an MDC or with AEAD, unlike a symmetrically encrypted data packet (tag 9).
+func isIntegrityProtected(edp packet.EncryptedDataPacket) bool {
+	switch p := edp.(type) {
+	case *packet.AEADEncrypted:
+		return true
+	case *packet.SymmetricallyEncrypted:
+		return p.IntegrityProtected
+	}
+	return false
+}
+
+// releasesIntegrityProtectedData returns whether the body of the message is
+// decrypted from an integrity protected data packet.
+func releasesIntegrityProtectedData(md *openpgp.MessageDetails) bool {
+	body, ok := md.UnverifiedBody.(*limitCheckReader)
+	return ok && body.state.integrityProtected
+}
+
+// releasesAuthenticatedChunks returns whether the body of the message is
+// AEAD-protected, and only releases authenticated chunks.
+func releasesAuthenticatedChunks(md *openpgp.MessageDetails) bool {
+	body, ok := md.UnverifiedBody.(*limitCheckReader)
+	return ok && body.state.authenticatedChunks
+}
+
+// limitCheckReader returns the decryption limit errors met while reading
+// a message body, instead of the parsing errors returned by go-crypto.
+// With countPlaintext, the body is counted against MaxDecompressedSize.
+type limitCheckReader struct {
+	body           io.Reader
+	state          *decryptionLimitState
+	countPlaintext bool
+}
+
+func (r *limitCheckReader) Read(buf []byte) (int, error) {
+	n, err := r.body.Read(buf)
+	if r.countPlaintext {
+		r.state.decompressed += int64(n)
+		if max := r.state.limits.MaxDecompressedSize; max > 0 && r.state.decompressed > max {
+			return n, r.state.exceeded("MaxDecompressedSize", max)
+		}
+	}
+	if err != nil && err != io.EOF {
+		return n, r.state.checkError(err)
+	}
+	return n, err
+}
+
+const (
+	packetTagCompressed             = 8
+	packetTagSymmetricallyEncrypted = 9
+	packetTagSEIPD                  = 18
+	packetTagAEADEncrypted          = 20
+)
+
+// packetTag returns the packet tag encoded in the first octet of a packet header.
+func packetTag(header byte) byte {
+	if header&0x40 == 0 {
+		// Old format
+		return (header & 0x3f) >> 2
+	}
+	return header & 0x3f
+}
+
+// packetSource is a packet stream, either the input or the decompressed
+// contents of a compressed packet.
+type packetSource struct {
+	r      io.Reader
+	packet io.Reader // the body of the compressed packet, nil for the input
+}
+
+// limitedPacketReader copies a stream of packets, replacing the compressed
+// packets with their decompressed contents, and enforcing the decryption
+// limits on the number of packets, the compression depth and the size of
+// the decompressed data.
+type limitedPacketReader struct {
+	state   *decryptionLimitState
+	sources []*packetSource
+	pending []byte            // the header of the current packet
+	body    *packetBodyReader // the body of the current packet, with its lengths
+	err     error
+}
+
+func newLimitedPacketReader(r io.Reader, state *decryptionLimitState) *limitedPacketReader {
+	return &limitedPacketReader{
+		state:   state,
+		sources: []*packetSource{{r: r}},
+	}
+}
+
+func (r *limitedPacketReader) Read(buf []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	for {
+		if len(r.pending) > 0 {
+			n := copy(buf, r.pending)
+			r.pending = r.pending[n:]
+			return n, nil
+		}
+
+		if r.body != nil {
+			n, err := r.body.Read(buf)
+			if err == io.EOF {
+				r.body = nil
+				if n > 0 {
+					return n, nil
+				}
+				continue
+			}
+			if err != nil {
+				return n, r.fail(err)
+			}
+			return n, nil
+		}
+
+		if len(r.sources) == 0 {
+			return 0, io.EOF
+		}
+		err := r.readHeader()
+		if err == io.EOF {
+			err = r.pop()
+		}
+		if err != nil {
+			return 0, r.fail(err)
+		}
+	}
+}
+
+func (r *limitedPacketReader) fail(err error) error {
+	r.err = err
+	return err
+}
+
+// readHeader reads the header of the next packet of the current source.
+// The header of a compressed packet is consumed, and its decompressed
+// contents become the current source; other packets are copied.
+func (r *limitedPacketReader) readHeader() error {
+	src := r.sources[len(r.sources)-1]
+
+	var header [1]byte
+	if _, err := io.ReadFull(src.r, header[:]); err != nil {
+		return err
+	}
+	if header[0]&0x80 == 0 {
+		return pgpErrors.StructuralError("tag byte does not have MSB set")
+	}
+	if err := r.state.countPacket(); err != nil {
+		return err
+	}
+
+	raw := []byte{header[0]}
+	body := &packetBodyReader{r: src.r}
+	if header[0]&0x40 == 0 {
+		// Old format: the length type is in the two lower bits
+		lengthType := header[0] & 3
+		if lengthType == 3 {
+			body.indeterminate = true
+		} else {
+			lengthBytes := make([]byte, 1<<lengthType)
+			if _, err := io.ReadFull(src.r, lengthBytes); err != nil {
+				return unexpectedEOF(err)
+			}
+			raw = append(raw, lengthBytes...)
+			for _, b := range lengthBytes {
+				body.remaining = body.remaining<<8 | int64(b)
+			}
+		}
+	} else {
+		var lengthBytes []byte
+		var err error
+		body.remaining, body.partial, lengthBytes, err = readPacketLength(src.r)
+		if err != nil {
+			return err
+		}
+		raw = append(raw, lengthBytes...)
+	}
+
+	switch packetTag(header[0]) {
+	case packetTagCompressed:
+		return r.push(body)
+	case packetTagSEIPD:
+		// The version of the packet tells whether it is AEAD-protected
+		var version [1]byte
+		if _, err := io.ReadFull(body, version[:]); err != nil {
+			return unexpectedEOF(err)
+		}
+		raw = append(raw, version[0])
+		r.state.integrityProtected = true
+		r.state.authenticatedChunks = version[0] == 2
+	case packetTagAEADEncrypted:
+		r.state.integrityProtected = true
+		r.state.authenticatedChunks = true
+	case packetTagSymmetricallyEncrypted:
+		r.state.integrityProtected = false
+		r.state.authenticatedChunks = false
+	}
+
+	r.pending = raw
+	body.copyLengths = true
+	r.body = body
+	return nil
+}
+
+// push starts reading the decompressed contents of a compressed packet.
+func (r *limitedPacketReader) push(body *packetBodyReader) error {
+	// The first source is the input, the others are compressed packets
+	depth := len(r.sources)
+	if max := r.state.limits.MaxCompressionDepth; max > 0 && depth > max {
+		return r.state.exceeded("MaxCompressionDepth", int64(max))
+	}
+
+	var algo [1]byte
+	if _, err := io.ReadFull(body, algo[:]); err != nil {
+		return unexpectedEOF(err)
+	}
+
+	var decompressed io.Reader
+	switch packet.CompressionAlgo(algo[0]) {
+	case packet.CompressionNone:
+		decompressed = body
+	case packet.CompressionZIP:
+		decompressed = flate.NewReader(body)
+	case packet.CompressionZLIB:
+		zlibReader, err := zlib.NewReader(body)
+		if err != nil {
+			return err
+		}
+		decompressed = zlibReader
+	case 3: // BZIP2
+		decompressed = bzip2.NewReader(body)
+	default:
+		return pgpErrors.UnsupportedError("unknown compression algorithm: " + fmt.Sprint(algo[0]))
+	}
+
+	r.sources = append(r.sources, &packetSource{
+		r:      &decompressionCounter{r: decompressed, state: r.state},
+		packet: body,
+	})
+	return nil
+}
+
+// pop ends the current source, discarding the remaining data of its packet.
+func (r *limitedPacketReader) pop() error {
+	src := r.sources[len(r.sources)-1]
+	r.sources = r.sources[:len(r.sources)-1]
+	if src.packet == nil {
+		return nil
+	}
+	_, err := io.Copy(ioutil.Discard, src.packet)
+	return err
+}
+
+// decompressionCounter enforces the limit on the size of the decompressed data.
+type decompressionCounter struct {
+	r     io.Reader
+	state *decryptionLimitState
+}
+
+func (c *decompressionCounter) Read(buf []byte) (int, error) {
+	n, err := c.r.Read(buf)
+	c.state.decompressed += int64(n)
+	if max := c.state.limits.MaxDecompressedSize; max > 0 && c.state.decompressed > max {
+		return n, c.state.exceeded("MaxDecompressedSize", max)
+	}
+	return n, err
+}
+
+// packetBodyReader reads the body of a packet, across partial body lengths.
+// With copyLengths, the partial body lengths are read along with the data.
+type packetBodyReader struct {
+	r             io.Reader
+	remaining     int64
+	partial       bool
+	indeterminate bool
+	copyLengths   bool
+	lengths       []byte // the encoding of the last length, not yet read
+}
+
+func (b *packetBodyReader) Read(buf []byte) (int, error) {
+	if b.indeterminate {
+		return b.r.Read(buf)
+	}
+	for b.remaining == 0 && len(b.lengths) == 0 {
+		if !b.partial {
+			return 0, io.EOF
+		}
+		length, partial, raw, err := readPacketLength(b.r)
+		if err != nil {
+			return 0, err
+		}
+		b.remaining, b.partial = length, partial
+		if b.copyLengths {
+			b.lengths = raw
+		}
+	}
+	if len(b.lengths) > 0 {
+		n := copy(buf, b.lengths)
+		b.lengths = b.lengths[n:]
+		return n, nil
+	}
+	if int64(len(buf)) > b.remaining {
+		buf = buf[:b.remaining]
+	}
+	n, err := b.r.Read(buf)
+	b.remaining -= int64(n)
+	if err == io.EOF && (b.remaining > 0 || b.partial) {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// readPacketLength reads a new format packet length (RFC 4880, section 4.2.2)
+// and returns it along with its encoding.
+func readPacketLength(r io.Reader) (length int64, partial bool, raw []byte, err error) {
+	var buf [5]byte
+	if _, err = io.ReadFull(r, buf[:1]); err != nil {
+		return 0, false, nil, unexpectedEOF(err)
+	}
+	switch {
+	case buf[0] < 192:
+		return int64(buf[0]), false, buf[:1], nil
+	case buf[0] < 224:
+		if _, err = io.ReadFull(r, buf[1:2]); err != nil {
+			return 0, false, nil, unexpectedEOF(err)
+		}
+		return (int64(buf[0])-192)<<8 + int64(buf[1]) + 192, false, buf[:2], nil
+	case buf[0] < 255:
+		return int64(1) << (buf[0] & 0x1f), true, buf[:1], nil
+	default:
+		if _, err = io.ReadFull(r, buf[1:5]); err != nil {
+			return 0, false, nil, unexpectedEOF(err)
+		}
+		length = int64(buf[1])<<24 | int64(buf[2])<<16 | int64(buf[3])<<8 | int64(buf[4])
+		return length, false, buf[:5], nil
+	}
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
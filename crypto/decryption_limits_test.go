@@ -0,0 +1,212 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/angel-one/gopenpgp/v2/constants"
+)
+
+// encryptNestedCompressed returns a message containing a literal data packet
+// in depth nested compressed packets, and its session key.
+func encryptNestedCompressed(t *testing.T, data []byte, depth int) (*PGPSplitMessage, *SessionKey) {
+	sessionKey, err := GenerateSessionKey()
+	if err != nil {
+		t.Fatal("Expected no error while generating the session key, got:", err)
+	}
+	dc, err := sessionKey.GetCipherFunc()
+	if err != nil {
+		t.Fatal("Expected no error while getting the cipher, got:", err)
+	}
+
+	var dataPacket bytes.Buffer
+	w, err := packet.SerializeSymmetricallyEncrypted(&dataPacket, dc, false, packet.CipherSuite{}, sessionKey.Key, nil)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+	output := w
+	for i := 0; i < depth; i++ {
+		if output, err = packet.SerializeCompressed(output, packet.CompressionZLIB, nil); err != nil {
+			t.Fatal("Expected no error while compressing, got:", err)
+		}
+	}
+	literal, err := packet.SerializeLiteral(output, true, "", 0)
+	if err != nil {
+		t.Fatal("Expected no error while writing literal data, got:", err)
+	}
+	if _, err = literal.Write(data); err != nil {
+		t.Fatal("Expected no error while writing literal data, got:", err)
+	}
+	// Closes the compressed and encrypted data packets as well
+	if err = literal.Close(); err != nil {
+		t.Fatal("Expected no error while closing literal data, got:", err)
+	}
+
+	keyPacket, err := keyRingTestPublic.EncryptSessionKey(sessionKey)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting the session key, got:", err)
+	}
+	return NewPGPSplitMessage(keyPacket, dataPacket.Bytes()), sessionKey
+}
+
+// encryptWithoutIntegrity returns a message with a symmetrically encrypted
+// data packet (tag 9), without integrity protection, and its session key.
+func encryptWithoutIntegrity(t *testing.T, data []byte) (*PGPSplitMessage, *SessionKey) {
+	sessionKey, err := GenerateSessionKey()
+	if err != nil {
+		t.Fatal("Expected no error while generating the session key, got:", err)
+	}
+	block, err := aes.NewCipher(sessionKey.Key)
+	if err != nil {
+		t.Fatal("Expected no error while creating the cipher, got:", err)
+	}
+
+	// Binary literal data packet, without file name and date
+	literal := append([]byte{0xc0 | 11, byte(6 + len(data)), 'b', 0, 0, 0, 0, 0}, data...)
+	stream, prefix := packet.NewOCFBEncrypter(block, make([]byte, block.BlockSize()), packet.OCFBResync)
+	ciphertext := make([]byte, len(literal))
+	stream.XORKeyStream(ciphertext, literal)
+	dataPacket := append([]byte{0xc0 | 9, byte(len(prefix) + len(ciphertext))}, prefix...)
+	dataPacket = append(dataPacket, ciphertext...)
+
+	keyPacket, err := keyRingTestPublic.EncryptSessionKey(sessionKey)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting the session key, got:", err)
+	}
+	return NewPGPSplitMessage(keyPacket, dataPacket), sessionKey
+}
+
+func assertDecryptionLimitError(t *testing.T, err error, limit string) {
+	var limitErr DecryptionLimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatal("Expected a decryption limit error, got:", err)
+	}
+	assert.Exactly(t, limit, limitErr.Limit)
+}
+
+func TestDecryptionLimitsDecompressedSize(t *testing.T) {
+	defer SetDecryptionLimits(nil)
+
+	data := make([]byte, 1<<20)
+	split, sessionKey := encryptNestedCompressed(t, data, 1)
+	message := split.GetPGPMessage()
+
+	decrypted, err := keyRingTestPrivate.Decrypt(message, nil, 0)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting, got:", err)
+	}
+	assert.Exactly(t, data, decrypted.GetBinary())
+
+	limits := NewDefaultDecryptionLimits()
+	limits.MaxDecompressedSize = 1 << 16
+	SetDecryptionLimits(limits)
+	assert.Exactly(t, limits, GetDecryptionLimits())
+
+	_, err = keyRingTestPrivate.Decrypt(message, nil, 0)
+	assertDecryptionLimitError(t, err, "MaxDecompressedSize")
+
+	_, err = sessionKey.Decrypt(split.GetBinaryDataPacket())
+	assertDecryptionLimitError(t, err, "MaxDecompressedSize")
+
+	_, err = keyRingTestPrivate.DecryptAttachment(split)
+	assertDecryptionLimitError(t, err, "MaxDecompressedSize")
+
+	reader, err := keyRingTestPrivate.DecryptStream(message.NewReader(), nil, 0)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting stream, got:", err)
+	}
+	_, err = ioutil.ReadAll(reader)
+	assertDecryptionLimitError(t, err, "MaxDecompressedSize")
+}
+
+func TestDecryptionLimitsCompressionDepth(t *testing.T) {
+	defer SetDecryptionLimits(nil)
+
+	data := []byte("Hello World!")
+	split, sessionKey := encryptNestedCompressed(t, data, GetDecryptionLimits().MaxCompressionDepth+1)
+
+	// The encrypted data is decompressed by go-crypto with a key ring
+	decrypted, err := keyRingTestPrivate.Decrypt(split.GetPGPMessage(), nil, 0)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting with a key ring, got:", err)
+	}
+	assert.Exactly(t, data, decrypted.GetBinary())
+
+	_, err = sessionKey.Decrypt(split.GetBinaryDataPacket())
+	assertDecryptionLimitError(t, err, "MaxCompressionDepth")
+
+	SetDecryptionLimits(&DecryptionLimits{})
+	decrypted, err = sessionKey.Decrypt(split.GetBinaryDataPacket())
+	if err != nil {
+		t.Fatal("Expected no error while decrypting without limits, got:", err)
+	}
+	assert.Exactly(t, data, decrypted.GetBinary())
+}
+
+func TestDecryptionLimitsPackets(t *testing.T) {
+	defer SetDecryptionLimits(nil)
+
+	password := []byte("password")
+	ciphertext, err := EncryptMessageWithPassword(NewPlainMessageFromString("Hello World!"), password)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting with password, got:", err)
+	}
+
+	// Session key and encrypted data packets, the decrypted data is parsed by go-crypto
+	SetDecryptionLimits(&DecryptionLimits{MaxPackets: 2})
+	if _, err = DecryptMessageWithPassword(ciphertext, password); err != nil {
+		t.Fatal("Expected no error while decrypting with password, got:", err)
+	}
+
+	SetDecryptionLimits(&DecryptionLimits{MaxPackets: 1})
+	_, err = DecryptMessageWithPassword(ciphertext, password)
+	assertDecryptionLimitError(t, err, "MaxPackets")
+
+	// Literal data packet in the encrypted data
+	sessionKey, err := DecryptSessionKeyWithPassword(ciphertext.GetBinary(), password)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting the session key, got:", err)
+	}
+	split, err := ciphertext.SplitMessage()
+	if err != nil {
+		t.Fatal("Expected no error while splitting, got:", err)
+	}
+	SetDecryptionLimits(&DecryptionLimits{MaxPackets: 1})
+	if _, err = sessionKey.Decrypt(split.GetBinaryDataPacket()); err != nil {
+		t.Fatal("Expected no error while decrypting with the session key, got:", err)
+	}
+}
+
+func TestDecryptionLimitsDefaultDecompressedSize(t *testing.T) {
+	defer SetDecryptionLimits(nil)
+
+	// Only the in-memory functions limit the decompressed size by default
+	assert.Exactly(t, int64(0), NewDefaultDecryptionLimits().MaxDecompressedSize)
+	assert.Exactly(t, int64(0), GetDecryptionLimits().MaxDecompressedSize)
+	assert.Exactly(t, int64(constants.DefaultMaxDecompressedSize), pgp.getInMemoryDecryptionLimits().MaxDecompressedSize)
+
+	limits := NewDefaultDecryptionLimits()
+	limits.MaxDecompressedSize = 1 << 16
+	SetDecryptionLimits(limits)
+	assert.Exactly(t, int64(1<<16), pgp.getInMemoryDecryptionLimits().MaxDecompressedSize)
+}
+
+func TestDecryptionWithoutIntegrityProtection(t *testing.T) {
+	split, _ := encryptWithoutIntegrity(t, []byte("hello"))
+
+	// Legacy messages are still decrypted with a key ring
+	decrypted, err := keyRingTestPrivate.Decrypt(split.GetPGPMessage(), nil, 0)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting, got:", err)
+	}
+	assert.Exactly(t, "hello", decrypted.GetString())
+
+	_, err = keyRingTestPrivate.DecryptAttachment(split)
+	assert.NotNil(t, err)
+}
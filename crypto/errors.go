@@ -0,0 +1,146 @@
+package crypto
+
+import (
+	"io"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgpErrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/pkg/errors"
+)
+
+// Errors identifying the categories of failures, to be matched with errors.Is.
+// The errors returned by the crypto and helper packages keep their messages,
+// but match the sentinels of their categories. An error may match several
+// sentinels, e.g. a failed password decryption may be caused by a wrong
+// password or by a failed integrity check.
+var (
+	// ErrNoDecryptionKey is matched when none of the given keys can decrypt the message or session key.
+	ErrNoDecryptionKey = errors.New("gopenpgp: no matching decryption key")
+	// ErrWrongPassword is matched when a message, session key or key cannot be decrypted with the password.
+	ErrWrongPassword = errors.New("gopenpgp: wrong password")
+	// ErrKeyLocked is matched when a private key must be unlocked before use.
+	ErrKeyLocked = errors.New("gopenpgp: key is locked")
+	// ErrIntegrity is matched when the integrity check (MDC or AEAD tag) of a message fails.
+	ErrIntegrity = errors.New("gopenpgp: integrity check failed")
+	// ErrUnsupportedAlgorithm is matched when an algorithm or feature is not supported.
+	ErrUnsupportedAlgorithm = errors.New("gopenpgp: unsupported algorithm")
+	// ErrMalformedPacket is matched when the input is not valid OpenPGP data.
+	ErrMalformedPacket = errors.New("gopenpgp: malformed packet")
+	// ErrKeyExpired is matched when a key is expired.
+	ErrKeyExpired = errors.New("gopenpgp: key is expired")
+	// ErrKeyRevoked is matched when a key is revoked.
+	ErrKeyRevoked = errors.New("gopenpgp: key is revoked")
+	// ErrTruncatedInput is matched when the input ends unexpectedly.
+	ErrTruncatedInput = errors.New("gopenpgp: truncated input")
+)
+
+// categorizedError is an error matching the sentinels of its categories with
+// errors.Is, without changing its message.
+type categorizedError struct {
+	err        error
+	categories []error
+}
+
+func (e *categorizedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *categorizedError) Unwrap() error {
+	return e.err
+}
+
+func (e *categorizedError) Is(target error) bool {
+	for _, category := range e.categories {
+		if category == target {
+			return true
+		}
+	}
+	return false
+}
+
+// NewCategorizedError returns an error with the message, matching the
+// sentinels of the categories with errors.Is.
+// * message    : The message of the error.
+// * categories : The sentinel errors matched by the error, e.g. ErrMalformedPacket.
+func NewCategorizedError(message string, categories ...error) error {
+	return &categorizedError{err: errors.New(message), categories: categories}
+}
+
+// newError returns an error with the message, matching the categories.
+func newError(message string, categories ...error) error {
+	return NewCategorizedError(message, categories...)
+}
+
+// wrapError wraps err with the message. The result matches the categories,
+// in addition to the categories of err and of the go-crypto errors it wraps.
+func wrapError(err error, message string, categories ...error) error {
+	return categorizeError(&categorizedError{err: errors.Wrap(err, message), categories: categories})
+}
+
+// categorizeError returns err matching the categories of the go-crypto and
+// io errors it wraps. It returns nil if err is nil.
+func categorizeError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var categories []error
+	addCategory := func(category error) {
+		if !errors.Is(err, category) {
+			categories = append(categories, category)
+		}
+	}
+
+	var structuralError pgpErrors.StructuralError
+	var unknownPacketTypeError pgpErrors.UnknownPacketTypeError
+	var unsupportedError pgpErrors.UnsupportedError
+	var aeadError pgpErrors.AEADError
+	var sessionKeyError pgpErrors.DecryptWithSessionKeyError
+	switch {
+	case errors.Is(err, pgpErrors.ErrKeyIncorrect):
+		addCategory(ErrNoDecryptionKey)
+	case errors.Is(err, pgpErrors.ErrMDCHashMismatch),
+		errors.Is(err, pgpErrors.ErrMDCMissing),
+		errors.Is(err, pgpErrors.ErrAEADTagVerification),
+		errors.As(err, &aeadError):
+		addCategory(ErrIntegrity)
+	case errors.Is(err, pgpErrors.ErrKeyExpired):
+		addCategory(ErrKeyExpired)
+	case errors.Is(err, pgpErrors.ErrKeyRevoked):
+		addCategory(ErrKeyRevoked)
+	case errors.As(err, &unsupportedError):
+		addCategory(ErrUnsupportedAlgorithm)
+	case errors.As(err, &structuralError), errors.As(err, &unknownPacketTypeError),
+		errors.As(err, &sessionKeyError):
+		// go-crypto reports the parsing errors of decrypted data as session key errors
+		addCategory(ErrMalformedPacket)
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		addCategory(ErrTruncatedInput)
+	}
+
+	if len(categories) == 0 {
+		return err
+	}
+	return &categorizedError{err: err, categories: categories}
+}
+
+// encryptionKeyCategories returns the categories explaining why one of the
+// entities has no valid encryption key at the time of the instance:
+// ErrKeyRevoked or ErrKeyExpired.
+func (pgp *GopenPGP) encryptionKeyCategories(entities openpgp.EntityList) []error {
+	now := pgp.getNow()
+	for _, e := range entities {
+		if _, ok := e.EncryptionKey(now); ok {
+			continue
+		}
+		key := &Key{entity: e, pgp: pgp}
+		if key.IsRevoked() {
+			return []error{ErrKeyRevoked}
+		}
+		if key.IsExpired() {
+			return []error{ErrKeyExpired}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/angel-one/gopenpgp/v2/constants"
+)
+
+func TestErrorsDecryption(t *testing.T) {
+	message := NewPlainMessageFromString("plain text")
+
+	ciphertext, err := EncryptMessageWithPassword(message, testSymmetricKey)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	_, err = DecryptMessageWithPassword(ciphertext, []byte("wrong password"))
+	assert.True(t, errors.Is(err, ErrWrongPassword))
+
+	_, err = DecryptSessionKeyWithPassword(ciphertext.GetBinary(), []byte("wrong password"))
+	assert.True(t, errors.Is(err, ErrWrongPassword))
+
+	ciphertext, err = keyRingTestPublic.Encrypt(message, nil)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	otherKey, err := GenerateKey(keyTestName, keyTestDomain, "x25519", 0)
+	if err != nil {
+		t.Fatal("Expected no error when generating the key, got:", err)
+	}
+	otherKeyRing, err := NewKeyRing(otherKey)
+	if err != nil {
+		t.Fatal("Expected no error when creating the key ring, got:", err)
+	}
+	_, err = otherKeyRing.Decrypt(ciphertext, nil, 0)
+	assert.True(t, errors.Is(err, ErrNoDecryptionKey))
+	assert.False(t, errors.Is(err, ErrWrongPassword))
+
+	split, err := ciphertext.SplitMessage()
+	if err != nil {
+		t.Fatal("Expected no error when splitting, got:", err)
+	}
+	_, err = otherKeyRing.DecryptSessionKey(split.GetBinaryKeyPacket())
+	assert.True(t, errors.Is(err, ErrNoDecryptionKey))
+
+	_, err = keyRingTestPrivate.Decrypt(NewPGPMessage(split.GetBinaryKeyPacket()), nil, 0)
+	assert.True(t, errors.Is(err, ErrTruncatedInput))
+
+	_, err = keyRingTestPrivate.Decrypt(NewPGPMessage(split.GetBinaryKeyPacket()[:20]), nil, 0)
+	assert.True(t, errors.Is(err, ErrTruncatedInput))
+
+	// The truncation of the encrypted data is only detected as a parsing error
+	truncated := NewPGPMessage(ciphertext.GetBinary()[:len(ciphertext.GetBinary())-10])
+	reader, err := keyRingTestPrivate.DecryptStream(truncated.NewReader(), nil, 0)
+	if err != nil {
+		t.Fatal("Expected no error when starting the decryption, got:", err)
+	}
+	_, err = ioutil.ReadAll(reader)
+	assert.True(t, errors.Is(err, ErrMalformedPacket))
+
+	_, err = keyRingTestPrivate.Decrypt(NewPGPMessage([]byte{0x00}), nil, 0)
+	assert.True(t, errors.Is(err, ErrMalformedPacket))
+}
+
+func TestErrorsIntegrity(t *testing.T) {
+	pgpMessage, err := NewPGPMessageFromArmored(readTestFile("message_badmdc", false))
+	if err != nil {
+		t.Fatal("Expected no error when unarmoring, got:", err)
+	}
+	split, err := pgpMessage.SplitMessage()
+	if err != nil {
+		t.Fatal("Expected no error when splitting, got:", err)
+	}
+	sk, _ := hex.DecodeString("F76D3236E4F8A38785C50BDE7167475E95360BCE67A952710F6C16F18BB0655E")
+
+	_, err = NewSessionKeyFromToken(sk, "aes256").Decrypt(split.GetBinaryDataPacket())
+	assert.True(t, errors.Is(err, ErrIntegrity))
+}
+
+func TestErrorsKeys(t *testing.T) {
+	lockedKey, err := NewKeyFromArmored(keyTestArmoredRSA)
+	if err != nil {
+		t.Fatal("Expected no error when unarmoring the key, got:", err)
+	}
+	_, err = lockedKey.Unlock([]byte("wrong password"))
+	assert.True(t, errors.Is(err, ErrWrongPassword))
+
+	_, err = NewKeyRing(lockedKey)
+	assert.True(t, errors.Is(err, ErrKeyLocked))
+
+	_, err = NewKeyFromArmored("-----BEGIN PGP PUBLIC KEY BLOCK-----\n\nAAAA\n-----END PGP PUBLIC KEY BLOCK-----")
+	assert.True(t, errors.Is(err, ErrMalformedPacket))
+
+	expiredKey, err := NewKeyFromArmored(readTestFile("key_expiredKey", false))
+	if err != nil {
+		t.Fatal("Expected no error when unarmoring the key, got:", err)
+	}
+	expiredKeyRing, err := NewKeyRing(expiredKey)
+	if err != nil {
+		t.Fatal("Expected no error when creating the key ring, got:", err)
+	}
+	_, err = expiredKeyRing.Encrypt(NewPlainMessageFromString("plain text"), nil)
+	assert.True(t, errors.Is(err, ErrKeyExpired))
+
+	_, err = expiredKeyRing.EncryptSessionKey(testSessionKey)
+	assert.True(t, errors.Is(err, ErrKeyExpired))
+
+	pgp.latestServerTime = 1632219895
+	defer func() {
+		pgp.latestServerTime = testTime
+	}()
+	revokedKey, err := NewKeyFromArmored(readTestFile("key_revoked", false))
+	if err != nil {
+		t.Fatal("Expected no error when unarmoring the key, got:", err)
+	}
+	revokedKeyRing, err := NewKeyRing(revokedKey)
+	if err != nil {
+		t.Fatal("Expected no error when creating the key ring, got:", err)
+	}
+	_, err = revokedKeyRing.Encrypt(NewPlainMessageFromString("plain text"), nil)
+	assert.True(t, errors.Is(err, ErrKeyRevoked))
+	assert.False(t, errors.Is(err, ErrKeyExpired))
+}
+
+func TestErrorsUnsupportedAlgorithm(t *testing.T) {
+	_, err := keyRingTestPublic.EncryptWithOptions(NewPlainMessageFromString("plain text"), nil, &EncryptionOptions{
+		Compression: NewCompressionConfig(constants.CompressionBZIP2, 0),
+	})
+	assert.True(t, errors.Is(err, ErrUnsupportedAlgorithm))
+
+	_, err = GenerateSessionKeyAlgo("rot13")
+	assert.True(t, errors.Is(err, ErrUnsupportedAlgorithm))
+}
+
+func TestNewCategorizedError(t *testing.T) {
+	err := NewCategorizedError("gopenpgp: unknown cipher", ErrUnsupportedAlgorithm, ErrMalformedPacket)
+	assert.EqualError(t, err, "gopenpgp: unknown cipher")
+	assert.True(t, errors.Is(err, ErrUnsupportedAlgorithm))
+	assert.True(t, errors.Is(err, ErrMalformedPacket))
+	assert.False(t, errors.Is(err, ErrIntegrity))
+}
@@ -1,20 +1,122 @@
 // Package crypto provides a high-level API for common OpenPGP functionality.
 package crypto
 
-import "sync"
+import (
+	"io"
+	"sync"
+	"time"
+)
 
 // GopenPGP is used as a "namespace" for many of the functions in this package.
-// It is a struct that keeps track of time skew between server and client.
+// It is a struct that keeps track of time skew between server and client,
+// the offset of key generation times and the decryption limits.
+//
+// The package functions use a default instance. Separate instances, created
+// with NewGopenPGP, do not share their state: the keys, key rings and session
+// keys created or bound by an instance use its clock and limits.
 type GopenPGP struct {
 	latestServerTime int64
 	generationOffset int64
+	decryptionLimits DecryptionLimits
 	lock             *sync.RWMutex
+
+	// Test-only sources set by NewGopenPGPForTesting, nil otherwise.
+	rand  io.Reader
+	clock func() time.Time
+}
+
+var pgp = NewGopenPGP()
+
+// NewGopenPGP returns a new instance using the local clock, no key generation
+// offset and the default decryption limits.
+func NewGopenPGP() *GopenPGP {
+	return &GopenPGP{
+		latestServerTime: 0,
+		generationOffset: 0,
+		decryptionLimits: *NewDefaultDecryptionLimits(),
+		lock:             &sync.RWMutex{},
+	}
+}
+
+// TestingSources are the randomness and time sources of an operation, for
+// golden-file tests: generating a key, encrypting or signing with the same
+// sources produces byte-identical outputs. Only the generation of x25519 keys
+// is reproducible, the generation of RSA keys fails with a randomness source,
+// as it does not read the same bytes from it on each run.
+//
+// TESTING ONLY: a predictable randomness source breaks the security of every
+// key, session key and message produced with it.
+type TestingSources struct {
+	// Rand is the randomness source, nil keeps the one of the instance.
+	Rand io.Reader
+	// Clock is the time source, nil keeps the time of the instance.
+	Clock func() time.Time
+}
+
+// NewGopenPGPForTesting returns an instance reading its randomness from rand
+// and its time from clock, instead of crypto/rand and the cached server time,
+// for all its operations. Use a new instance for each operation to replay its
+// sources, or pass TestingSources to the operation itself. UpdateTime has no
+// effect on the instance, the key generation offset is still applied to the
+// time given by clock. See TestingSources.
+//
+// TESTING ONLY: a predictable randomness source breaks the security of every
+// key, session key and message produced by the instance.
+// * rand  : the randomness source.
+// * clock : (optional) the time source, nil keeps the cached server time.
+func NewGopenPGPForTesting(rand io.Reader, clock func() time.Time) *GopenPGP {
+	return NewGopenPGP().withTestingSources(&TestingSources{Rand: rand, Clock: clock})
+}
+
+// orDefault returns the instance, or the default instance if it is nil.
+func (pgp *GopenPGP) orDefault() *GopenPGP {
+	if pgp == nil {
+		return defaultPGP()
+	}
+	return pgp
+}
+
+// bound returns the instance to store in bound objects: nil for the default
+// instance, so that objects of the default instance compare equal to the ones
+// created directly.
+func (pgp *GopenPGP) bound() *GopenPGP {
+	if pgp == defaultPGP() {
+		return nil
+	}
+	return pgp
+}
+
+// withTestingSources returns a copy of the instance reading from the sources
+// of an operation, or the instance itself if sources is nil. The objects
+// created by the copy must be bound to the instance instead.
+func (pgp *GopenPGP) withTestingSources(sources *TestingSources) *GopenPGP {
+	if sources == nil {
+		return pgp
+	}
+
+	pgp.lock.RLock()
+	instance := &GopenPGP{
+		latestServerTime: pgp.latestServerTime,
+		generationOffset: pgp.generationOffset,
+		decryptionLimits: pgp.decryptionLimits,
+		lock:             &sync.RWMutex{},
+		rand:             pgp.rand,
+		clock:            pgp.clock,
+	}
+	pgp.lock.RUnlock()
+
+	if sources.Rand != nil {
+		instance.rand = sources.Rand
+	}
+	if sources.Clock != nil {
+		instance.clock = sources.Clock
+	}
+	return instance
 }
 
-var pgp = GopenPGP{
-	latestServerTime: 0,
-	generationOffset: 0,
-	lock:             &sync.RWMutex{},
+// defaultPGP returns the instance used by the package functions.
+func defaultPGP() *GopenPGP {
+	return pgp
 }
 
 // clone returns a clone of the byte slice. Internal function used to make sure
@@ -0,0 +1,271 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstanceTime(t *testing.T) {
+	instance := NewGopenPGP()
+	instance.UpdateTime(1000)
+	instance.SetKeyGenerationOffset(-100)
+
+	assert.Exactly(t, int64(1000), instance.GetUnixTime())
+	assert.Exactly(t, int64(testTime), GetUnixTime())
+
+	// The key expires 22 minutes after its creation, at 1
+	armored := readTestFile("key_expiredKey", false)
+	expiredKey, err := NewKeyFromArmored(armored)
+	if err != nil {
+		t.Fatal("Expected no error when unarmoring the key, got:", err)
+	}
+	assert.True(t, expiredKey.IsExpired())
+
+	instanceKey, err := instance.NewKeyFromArmored(armored)
+	if err != nil {
+		t.Fatal("Expected no error when unarmoring the key, got:", err)
+	}
+	assert.False(t, instanceKey.IsExpired())
+	copiedKey, err := instanceKey.Copy()
+	if err != nil {
+		t.Fatal("Expected no error when copying the key, got:", err)
+	}
+	assert.False(t, copiedKey.IsExpired())
+
+	generatedKey, err := instance.GenerateKey(keyTestName, keyTestDomain, "x25519", 0)
+	if err != nil {
+		t.Fatal("Expected no error when generating the key, got:", err)
+	}
+	assert.Exactly(t, int64(900), generatedKey.GetEntity().PrimaryKey.CreationTime.Unix())
+	assert.Exactly(t, int64(testTime), GetUnixTime())
+
+	keyRing, err := instance.NewKeyRing(generatedKey)
+	if err != nil {
+		t.Fatal("Expected no error when creating the key ring, got:", err)
+	}
+	assert.False(t, keyRing.GetKeys()[0].IsExpired())
+	ciphertext, err := keyRing.Encrypt(instance.NewPlainMessageFromString("plain text"), keyRing)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting with the instance key ring, got:", err)
+	}
+	decrypted, err := keyRing.Decrypt(ciphertext, keyRing, 0)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting with the instance key ring, got:", err)
+	}
+	assert.Exactly(t, uint32(1000), decrypted.Time)
+
+	signature, err := keyRing.SignDetached(decrypted)
+	if err != nil {
+		t.Fatal("Expected no error when signing, got:", err)
+	}
+	signatureTime, err := keyRing.GetVerifiedSignatureTimestamp(decrypted, signature, 0)
+	if err != nil {
+		t.Fatal("Expected no error when verifying, got:", err)
+	}
+	assert.Exactly(t, int64(1000), signatureTime)
+}
+
+func TestInstanceClockWithoutLock(t *testing.T) {
+	var instance *GopenPGP
+	// The clock locks the instance, which must not be locked when calling it
+	instance = NewGopenPGPForTesting(bytes.NewReader(nil), func() time.Time {
+		instance.SetKeyGenerationOffset(-100)
+		return time.Unix(1000, 0)
+	})
+
+	done := make(chan int64)
+	go func() {
+		done <- instance.GetUnixTime() + instance.getNowKeyGenerationOffset().Unix()
+	}()
+	select {
+	case sum := <-done:
+		assert.Exactly(t, int64(1000+900), sum)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the clock to be called without the instance lock")
+	}
+}
+
+func TestInstanceDecryptionLimits(t *testing.T) {
+	instance := NewGopenPGP()
+	instance.SetDecryptionLimits(&DecryptionLimits{MaxPackets: 1})
+	assert.Exactly(t, NewDefaultDecryptionLimits(), GetDecryptionLimits())
+
+	ciphertext, err := EncryptMessageWithPassword(NewPlainMessageFromString("plain text"), testSymmetricKey)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	if _, err = DecryptMessageWithPassword(ciphertext, testSymmetricKey); err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	_, err = instance.DecryptMessageWithPassword(ciphertext, testSymmetricKey)
+	assert.True(t, errors.As(err, &DecryptionLimitError{}))
+
+	sessionKey, err := instance.DecryptSessionKeyWithPassword(ciphertext.GetBinary(), testSymmetricKey)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting the session key, got:", err)
+	}
+	instance.SetDecryptionLimits(&DecryptionLimits{MaxDecompressedSize: 4})
+	dataPacket, err := sessionKey.EncryptWithCompression(NewPlainMessageFromString("plain text"))
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	_, err = sessionKey.Decrypt(dataPacket)
+	assert.True(t, errors.As(err, &DecryptionLimitError{}))
+
+	_, err = NewSessionKeyFromToken(sessionKey.Key, sessionKey.Algo).Decrypt(dataPacket)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting with the default limits, got:", err)
+	}
+}
+
+// testRandReader is a deterministic randomness source for tests, returning
+// the SHA-256 hashes of a seed followed by a counter.
+type testRandReader struct {
+	seed    []byte
+	counter uint64
+	buffer  []byte
+}
+
+func (r *testRandReader) Read(p []byte) (int, error) {
+	for len(r.buffer) < len(p) {
+		block := make([]byte, len(r.seed)+8)
+		copy(block, r.seed)
+		binary.BigEndian.PutUint64(block[len(r.seed):], r.counter)
+		r.counter++
+		hash := sha256.Sum256(block)
+		r.buffer = append(r.buffer, hash[:]...)
+	}
+	n := copy(p, r.buffer)
+	r.buffer = r.buffer[n:]
+	return n, nil
+}
+
+func newTestingInstance(seed string) *GopenPGP {
+	clock := func() time.Time {
+		return time.Unix(1500000000, 0)
+	}
+	return NewGopenPGPForTesting(&testRandReader{seed: []byte(seed)}, clock)
+}
+
+func TestInstanceForTestingDeterminism(t *testing.T) {
+	outputs := func(instance *GopenPGP) [][]byte {
+		key, err := instance.GenerateKey(keyTestName, keyTestDomain, "x25519", 0)
+		if err != nil {
+			t.Fatal("Expected no error when generating the key, got:", err)
+		}
+		assert.Exactly(t, int64(1500000000), key.GetEntity().PrimaryKey.CreationTime.Unix())
+		serializedKey, err := key.Serialize()
+		if err != nil {
+			t.Fatal("Expected no error when serializing the key, got:", err)
+		}
+		keyRing, err := instance.NewKeyRing(key)
+		if err != nil {
+			t.Fatal("Expected no error when creating the key ring, got:", err)
+		}
+		message := instance.NewPlainMessageFromString("plain text")
+		ciphertext, err := keyRing.Encrypt(message, keyRing)
+		if err != nil {
+			t.Fatal("Expected no error when encrypting, got:", err)
+		}
+		passwordCiphertext, err := instance.EncryptMessageWithPassword(message, testSymmetricKey)
+		if err != nil {
+			t.Fatal("Expected no error when encrypting with a password, got:", err)
+		}
+		sessionKey, err := instance.GenerateSessionKey()
+		if err != nil {
+			t.Fatal("Expected no error when generating the session key, got:", err)
+		}
+		keyPacket, err := keyRing.EncryptSessionKey(sessionKey)
+		if err != nil {
+			t.Fatal("Expected no error when encrypting the session key, got:", err)
+		}
+		signature, err := keyRing.SignDetached(message)
+		if err != nil {
+			t.Fatal("Expected no error when signing, got:", err)
+		}
+		return [][]byte{
+			serializedKey,
+			ciphertext.GetBinary(),
+			passwordCiphertext.GetBinary(),
+			sessionKey.Key,
+			keyPacket,
+			signature.GetBinary(),
+		}
+	}
+
+	first := outputs(newTestingInstance("seed"))
+	second := outputs(newTestingInstance("seed"))
+	other := outputs(newTestingInstance("other seed"))
+	for i := range first {
+		assert.Exactly(t, first[i], second[i], "output %d", i)
+		assert.NotEqual(t, first[i], other[i])
+	}
+}
+
+func TestInstanceForTestingRandomness(t *testing.T) {
+	instance := NewGopenPGPForTesting(bytes.NewReader(nil), nil)
+	instance.UpdateTime(testTime)
+	_, err := instance.GenerateSessionKey()
+	assert.True(t, errors.Is(err, io.EOF))
+	assert.Exactly(t, int64(testTime), instance.GetUnixTime())
+}
+
+func TestInstanceForTestingRSA(t *testing.T) {
+	_, err := newTestingInstance("seed").GenerateKey(keyTestName, keyTestDomain, "rsa", 1024)
+	assert.True(t, errors.Is(err, ErrUnsupportedAlgorithm))
+}
+
+func TestTestingSourcesPerOperation(t *testing.T) {
+	sources := func(seed string) *TestingSources {
+		return &TestingSources{
+			Rand:  &testRandReader{seed: []byte(seed)},
+			Clock: func() time.Time { return time.Unix(1500000000, 0) },
+		}
+	}
+	instance := NewGopenPGP()
+	message := NewPlainMessageFromString("plain text")
+
+	outputs := func(seed string) [][]byte {
+		key, err := instance.GenerateKeyWithTestingSources(keyTestName, keyTestDomain, "x25519", 0, sources(seed))
+		if err != nil {
+			t.Fatal("Expected no error when generating the key, got:", err)
+		}
+		assert.Exactly(t, int64(1500000000), key.GetEntity().PrimaryKey.CreationTime.Unix())
+		assert.Nil(t, key.pgp.rand)
+		serializedKey, err := key.Serialize()
+		if err != nil {
+			t.Fatal("Expected no error when serializing the key, got:", err)
+		}
+		keyRing, err := instance.NewKeyRing(key)
+		if err != nil {
+			t.Fatal("Expected no error when creating the key ring, got:", err)
+		}
+		ciphertext, err := keyRing.EncryptWithOptions(message, keyRing, &EncryptionOptions{TestingSources: sources(seed)})
+		if err != nil {
+			t.Fatal("Expected no error when encrypting, got:", err)
+		}
+		signature, err := keyRing.SignDetachedWithTestingSources(message, sources(seed))
+		if err != nil {
+			t.Fatal("Expected no error when signing, got:", err)
+		}
+		return [][]byte{serializedKey, ciphertext.GetBinary(), signature.GetBinary()}
+	}
+
+	first := outputs("seed")
+	second := outputs("seed")
+	other := outputs("other seed")
+	for i := range first {
+		assert.Exactly(t, first[i], second[i], "output %d", i)
+		assert.NotEqual(t, first[i], other[i])
+	}
+
+	_, err := instance.GenerateKeyWithTestingSources(keyTestName, keyTestDomain, "rsa", 1024, sources("seed"))
+	assert.True(t, errors.Is(err, ErrUnsupportedAlgorithm))
+}
@@ -0,0 +1,806 @@
+package crypto
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/angel-one/gopenpgp/v2/constants"
+	"github.com/pkg/errors"
+)
+
+// PacketDump lists the packets of a message, signature or key, as parsed
+// without decrypting anything. Encrypted packets are listed, but not their contents.
+type PacketDump struct {
+	Packets []*PacketInfo
+}
+
+// PacketInfo describes an OpenPGP packet. Only the fields relevant to the
+// packet type are set.
+type PacketInfo struct {
+	// Tag is the packet type (RFC 4880, section 4.3).
+	Tag int
+	// Name is the name of the packet type.
+	Name string
+	// Length is the length of the packet body.
+	Length int64
+	// PartialLength is true if the packet body is split into partial
+	// lengths, or has an indeterminate length.
+	PartialLength bool
+	// Version is the version of the packet format, 0 for packets without version.
+	Version int
+
+	// KeyID is the key ID of the recipient of a session key packet,
+	// of the issuer of a signature, or of a key.
+	KeyID uint64
+	// Fingerprint is the fingerprint of a key.
+	Fingerprint []byte
+	// PublicKeyAlgorithm is the algorithm of a key, signature or session key packet.
+	PublicKeyAlgorithm string
+	// CreationTime is the creation time of a key, as a Unix timestamp.
+	CreationTime int64
+	// CipherAlgorithm is the symmetric cipher of a password encrypted session
+	// key, an AEAD packet or a locked private key.
+	CipherAlgorithm string
+	// AEADMode is the AEAD mode of a password encrypted session key or an AEAD packet.
+	AEADMode string
+	// S2K is the S2K function of a password encrypted session key or a locked private key.
+	S2K *S2KConfig
+	// CompressionAlgorithm is the algorithm of a compressed data packet.
+	CompressionAlgorithm string
+	// Signature describes a signature or one-pass signature packet.
+	Signature *SignatureInfo
+	// Literal describes a literal data packet.
+	Literal *LiteralInfo
+	// UserID is the contents of a user ID packet.
+	UserID string
+
+	// Packets are the packets contained in a compressed data packet.
+	Packets []*PacketInfo
+}
+
+// SignatureInfo describes a signature or one-pass signature packet.
+type SignatureInfo struct {
+	// Type is the signature type (RFC 4880, section 5.2.1).
+	Type int
+	// HashAlgorithm is the hash function of the signature.
+	HashAlgorithm string
+	// CreationTime is the creation time of a version 3 signature, as a Unix timestamp.
+	// The creation time of later versions is a subpacket.
+	CreationTime int64
+	// Last is true if the one-pass signature is the last before the signed data.
+	Last bool
+	// HashedSubpackets are the subpackets covered by the signature.
+	HashedSubpackets []*SubpacketInfo
+	// UnhashedSubpackets are the subpackets not covered by the signature.
+	UnhashedSubpackets []*SubpacketInfo
+}
+
+// SubpacketInfo describes a signature subpacket.
+type SubpacketInfo struct {
+	// Type is the subpacket type (RFC 4880, section 5.2.3.1).
+	Type int
+	// Name is the name of the subpacket type.
+	Name string
+	// Critical is true if the subpacket must be understood to validate the signature.
+	Critical bool
+	// Data is the body of the subpacket.
+	Data []byte
+}
+
+// LiteralInfo describes the metadata of a literal data packet.
+type LiteralInfo struct {
+	// Format is 'b' for binary data, 't' or 'u' for text.
+	Format byte
+	// Filename is the file name of the data.
+	Filename string
+	// Time is the modification time of the data, as a Unix timestamp.
+	Time int64
+}
+
+// Inspect lists the packets of the message, without decrypting it,
+// within the decryption limits of the default instance.
+func (msg *PGPMessage) Inspect() (*PacketDump, error) {
+	return pgp.InspectMessage(msg)
+}
+
+// Inspect lists the packets of the signature, within the decryption limits
+// of the default instance.
+func (sig *PGPSignature) Inspect() (*PacketDump, error) {
+	return pgp.InspectSignature(sig)
+}
+
+// InspectMessage lists the packets of a message, without decrypting it,
+// within the decryption limits of the instance.
+func (pgp *GopenPGP) InspectMessage(msg *PGPMessage) (*PacketDump, error) {
+	return pgp.inspectPackets(msg.Data)
+}
+
+// InspectSignature lists the packets of a signature, within the decryption
+// limits of the instance.
+func (pgp *GopenPGP) InspectSignature(sig *PGPSignature) (*PacketDump, error) {
+	return pgp.inspectPackets(sig.Data)
+}
+
+// Inspect lists the packets of the key, within the decryption limits of the
+// instance the key is bound to.
+func (key *Key) Inspect() (*PacketDump, error) {
+	serialized, err := key.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	return key.getPGP().inspectPackets(serialized)
+}
+
+// String renders the packets as text, one packet per line followed by its
+// fields. The contents of compressed packets are indented.
+func (dump *PacketDump) String() string {
+	var buf strings.Builder
+	writePacketInfos(&buf, dump.Packets, "")
+	return buf.String()
+}
+
+// ----- INTERNAL FUNCTIONS -----
+
+func (pgp *GopenPGP) inspectPackets(data []byte) (*PacketDump, error) {
+	state := &decryptionLimitState{limits: pgp.getInMemoryDecryptionLimits()}
+	packets, err := readPacketInfos(bytes.NewReader(data), state, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &PacketDump{Packets: packets}, nil
+}
+
+// readPacketInfos parses the packets of r. Compressed packets are
+// decompressed within the decryption limits.
+func readPacketInfos(r io.Reader, state *decryptionLimitState, depth int) ([]*PacketInfo, error) {
+	var infos []*PacketInfo
+	for {
+		tag, body, partial, err := readRawPacket(r)
+		if errors.Is(err, io.EOF) {
+			return infos, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "gopenpgp: error in reading packet")
+		}
+		if err = state.countPacket(); err != nil {
+			return nil, err
+		}
+
+		info := &PacketInfo{
+			Tag:           int(tag),
+			Name:          packetName(tag),
+			PartialLength: partial,
+		}
+		head, err := readPacketInfo(info, body)
+		if err != nil {
+			return nil, errors.Wrap(err, "gopenpgp: error in parsing "+info.Name+" packet")
+		}
+		if tag == packetTagCompressed && len(head) > 0 {
+			if info.Packets, err = readCompressedPacketInfos(head[0], body, state, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		// The data of the packet is not kept
+		if _, err = io.Copy(ioutil.Discard, body); err != nil {
+			return nil, errors.Wrap(err, "gopenpgp: error in reading packet")
+		}
+		info.Length = body.n
+		infos = append(infos, info)
+	}
+}
+
+// readCompressedPacketInfos parses the packets of a compressed packet, from
+// its body after the algorithm.
+func readCompressedPacketInfos(algo byte, body io.Reader, state *decryptionLimitState, depth int) ([]*PacketInfo, error) {
+	if max := state.limits.MaxCompressionDepth; max > 0 && depth > max {
+		return nil, state.exceeded("MaxCompressionDepth", int64(max))
+	}
+
+	var decompressed io.Reader
+	switch packet.CompressionAlgo(algo) {
+	case packet.CompressionNone:
+		decompressed = body
+	case packet.CompressionZIP:
+		decompressed = flate.NewReader(body)
+	case packet.CompressionZLIB:
+		zlibReader, err := zlib.NewReader(body)
+		if err != nil {
+			return nil, errors.Wrap(err, "gopenpgp: error in decompressing packet")
+		}
+		decompressed = zlibReader
+	case 3: // BZIP2
+		decompressed = bzip2.NewReader(body)
+	default:
+		// Unknown algorithm, the contents are not listed
+		return nil, nil
+	}
+	return readPacketInfos(&decompressionCounter{r: decompressed, state: state}, state, depth)
+}
+
+// countingReader counts the bytes read from a packet body.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(buf []byte) (int, error) {
+	n, err := c.r.Read(buf)
+	c.n += int64(n)
+	return n, err
+}
+
+// readRawPacket reads a packet header and returns its tag and a reader for
+// its body.
+func readRawPacket(r io.Reader) (tag byte, body *countingReader, partial bool, err error) {
+	var header [1]byte
+	if _, err = io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, false, err
+	}
+	if header[0]&0x80 == 0 {
+		return 0, nil, false, errors.New("tag byte does not have MSB set")
+	}
+	tag = packetTag(header[0])
+
+	bodyReader := &packetBodyReader{r: r}
+	if header[0]&0x40 == 0 {
+		// Old format: the length type is in the two lower bits
+		lengthType := header[0] & 3
+		if lengthType == 3 {
+			bodyReader.indeterminate = true
+		} else {
+			lengthBytes := make([]byte, 1<<lengthType)
+			if _, err = io.ReadFull(r, lengthBytes); err != nil {
+				return 0, nil, false, unexpectedEOF(err)
+			}
+			for _, b := range lengthBytes {
+				bodyReader.remaining = bodyReader.remaining<<8 | int64(b)
+			}
+		}
+	} else {
+		if bodyReader.remaining, bodyReader.partial, _, err = readPacketLength(r); err != nil {
+			return 0, nil, false, err
+		}
+	}
+	partial = bodyReader.partial || bodyReader.indeterminate
+	return tag, &countingReader{r: bodyReader}, partial, nil
+}
+
+// readPacketInfo reads the beginning of a packet body and sets the fields of
+// the packet from it. Only the metadata packets are read whole, the data of
+// the literal, compressed and encrypted packets is left in body.
+func readPacketInfo(info *PacketInfo, body *countingReader) ([]byte, error) {
+	var head []byte
+	var err error
+	switch info.Tag {
+	case 1, 2, 3, 4, 5, 6, 7, 13, 14: // Metadata packets
+		head, err = ioutil.ReadAll(body)
+	case 8, 18: // Compressed and SEIP data: algorithm or version
+		head, err = readPacketHead(body, nil, 1)
+	case 20: // AEAD data: version, cipher, AEAD mode, chunk size
+		head, err = readPacketHead(body, nil, 4)
+	case 11: // Literal data: format, file name length, file name, time
+		if head, err = readPacketHead(body, nil, 2); err == nil && len(head) == 2 {
+			head, err = readPacketHead(body, head, int(head[1])+4)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	info.Length = body.n
+	return head, parsePacketInfo(info, head)
+}
+
+// readPacketHead appends up to n bytes of body to head. A shorter head is
+// returned for a truncated body.
+func readPacketHead(body io.Reader, head []byte, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	read, err := io.ReadFull(body, buf)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		err = nil
+	}
+	return append(head, buf[:read]...), err
+}
+
+// parsePacketInfo sets the fields of the packet from its body.
+// Truncated bodies are reported as errors.
+func parsePacketInfo(info *PacketInfo, body []byte) error {
+	truncated := errors.New("packet is truncated")
+	switch info.Tag {
+	case 1: // Public-Key Encrypted Session Key
+		// version, key ID, algorithm
+		if len(body) < 1 {
+			return truncated
+		}
+		info.Version = int(body[0])
+		if info.Version == 3 {
+			if len(body) < 10 {
+				return truncated
+			}
+			info.KeyID = binary.BigEndian.Uint64(body[1:9])
+			info.PublicKeyAlgorithm = publicKeyAlgorithmName(body[9])
+		}
+	case 2: // Signature
+		return parseSignatureInfo(info, body)
+	case 3: // Symmetric-Key Encrypted Session Key
+		// version, cipher, AEAD mode for version 5, S2K
+		if len(body) < 2 {
+			return truncated
+		}
+		info.Version = int(body[0])
+		info.CipherAlgorithm = cipherAlgorithmName(body[1])
+		if info.Version == 5 {
+			if len(body) < 3 {
+				return truncated
+			}
+			info.AEADMode = aeadModeName(body[2])
+		}
+		// Unsupported S2K functions are not reported
+		info.S2K, _ = parseSymmetricKeyEncryptedS2K(body)
+	case 4: // One-Pass Signature
+		// version, type, hash, algorithm, key ID, last
+		if len(body) < 13 {
+			return truncated
+		}
+		info.Version = int(body[0])
+		info.Signature = &SignatureInfo{
+			Type:          int(body[1]),
+			HashAlgorithm: hashAlgorithmName(body[2]),
+			Last:          body[12] != 0,
+		}
+		info.PublicKeyAlgorithm = publicKeyAlgorithmName(body[3])
+		info.KeyID = binary.BigEndian.Uint64(body[4:12])
+	case 5, 6, 7, 14: // Secret Key, Public Key, Secret Subkey, Public Subkey
+		return parseKeyInfo(info, body)
+	case 8: // Compressed Data
+		if len(body) < 1 {
+			return truncated
+		}
+		info.CompressionAlgorithm = compressionAlgorithmName(body[0])
+	case 11: // Literal Data
+		// format, file name length, file name, time
+		if len(body) < 2 || len(body) < 6+int(body[1]) {
+			return truncated
+		}
+		nameLength := int(body[1])
+		info.Literal = &LiteralInfo{
+			Format:   body[0],
+			Filename: string(body[2 : 2+nameLength]),
+			Time:     int64(binary.BigEndian.Uint32(body[2+nameLength:])),
+		}
+	case 13: // User ID
+		info.UserID = string(body)
+	case 18: // Sym. Encrypted and Integrity Protected Data
+		if len(body) < 1 {
+			return truncated
+		}
+		info.Version = int(body[0])
+	case 20: // AEAD Encrypted Data
+		// version, cipher, AEAD mode, chunk size
+		if len(body) < 4 {
+			return truncated
+		}
+		info.Version = int(body[0])
+		info.CipherAlgorithm = cipherAlgorithmName(body[1])
+		info.AEADMode = aeadModeName(body[2])
+	}
+	return nil
+}
+
+func parseSignatureInfo(info *PacketInfo, body []byte) error {
+	truncated := errors.New("packet is truncated")
+	if len(body) < 1 {
+		return truncated
+	}
+	info.Version = int(body[0])
+	signature := &SignatureInfo{}
+	info.Signature = signature
+
+	if info.Version == 2 || info.Version == 3 {
+		// version, hashed length (5), type, time, key ID, algorithm, hash
+		if len(body) < 19 {
+			return truncated
+		}
+		signature.Type = int(body[2])
+		signature.CreationTime = int64(binary.BigEndian.Uint32(body[3:7]))
+		info.KeyID = binary.BigEndian.Uint64(body[7:15])
+		info.PublicKeyAlgorithm = publicKeyAlgorithmName(body[15])
+		signature.HashAlgorithm = hashAlgorithmName(body[16])
+		return nil
+	}
+
+	// version, type, algorithm, hash, hashed subpackets, unhashed subpackets
+	if len(body) < 6 {
+		return truncated
+	}
+	signature.Type = int(body[1])
+	info.PublicKeyAlgorithm = publicKeyAlgorithmName(body[2])
+	signature.HashAlgorithm = hashAlgorithmName(body[3])
+
+	var err error
+	hashedLength := int(binary.BigEndian.Uint16(body[4:6]))
+	if len(body) < 8+hashedLength {
+		return truncated
+	}
+	if signature.HashedSubpackets, err = parseSubpacketInfos(body[6 : 6+hashedLength]); err != nil {
+		return err
+	}
+	unhashed := body[6+hashedLength:]
+	unhashedLength := int(binary.BigEndian.Uint16(unhashed[:2]))
+	if len(unhashed) < 2+unhashedLength {
+		return truncated
+	}
+	if signature.UnhashedSubpackets, err = parseSubpacketInfos(unhashed[2 : 2+unhashedLength]); err != nil {
+		return err
+	}
+
+	for _, subpacket := range append(signature.HashedSubpackets, signature.UnhashedSubpackets...) {
+		switch {
+		case subpacket.Type == 16 && len(subpacket.Data) == 8: // Issuer
+			info.KeyID = binary.BigEndian.Uint64(subpacket.Data)
+		case subpacket.Type == 33 && len(subpacket.Data) == 33 && subpacket.Data[0] == 5: // Issuer Fingerprint, v5 key
+			info.KeyID = binary.BigEndian.Uint64(subpacket.Data[1:9])
+		case subpacket.Type == 33 && len(subpacket.Data) == 21 && subpacket.Data[0] != 5: // Issuer Fingerprint, v4 key
+			info.KeyID = binary.BigEndian.Uint64(subpacket.Data[13:21])
+		}
+	}
+	return nil
+}
+
+func parseKeyInfo(info *PacketInfo, body []byte) error {
+	// version, creation time, validity period for version 3, algorithm
+	if len(body) < 6 {
+		return errors.New("packet is truncated")
+	}
+	info.Version = int(body[0])
+	info.CreationTime = int64(binary.BigEndian.Uint32(body[1:5]))
+	algorithm := body[5]
+	if info.Version < 4 && len(body) >= 8 {
+		algorithm = body[7]
+	}
+	info.PublicKeyAlgorithm = publicKeyAlgorithmName(algorithm)
+
+	// The key ID and fingerprint are computed by go-crypto, if it supports the key
+	p, err := packet.Read(serializeRawPacket(byte(info.Tag), body))
+	if err != nil {
+		return nil
+	}
+	switch key := p.(type) {
+	case *packet.PublicKey:
+		info.KeyID = key.KeyId
+		info.Fingerprint = key.Fingerprint
+	case *packet.PrivateKey:
+		info.KeyID = key.KeyId
+		info.Fingerprint = key.Fingerprint
+		if key.Encrypted || key.Dummy() {
+			// Unsupported protections are not reported
+			info.S2K, _ = getPrivateKeyS2K(key)
+			info.CipherAlgorithm = privateKeyCipherName(key, body)
+		}
+	}
+	return nil
+}
+
+// privateKeyCipherName returns the cipher protecting a locked private key,
+// which follows the public key fields and the S2K usage.
+func privateKeyCipherName(key *packet.PrivateKey, body []byte) string {
+	var publicBuf bytes.Buffer
+	if err := key.PublicKey.Serialize(&publicBuf); err != nil {
+		return ""
+	}
+	publicPacket, err := packet.NewOpaqueReader(&publicBuf).Next()
+	if err != nil || len(body) < len(publicPacket.Contents)+2 {
+		return ""
+	}
+	return cipherAlgorithmName(body[len(publicPacket.Contents)+1])
+}
+
+// serializeRawPacket returns a reader for a new format packet with the given body.
+func serializeRawPacket(tag byte, body []byte) io.Reader {
+	var buf bytes.Buffer
+	buf.WriteByte(0xc0 | tag)
+	buf.WriteByte(255)
+	_ = binary.Write(&buf, binary.BigEndian, uint32(len(body)))
+	buf.Write(body)
+	return &buf
+}
+
+// parseSubpacketInfos parses an area of signature subpackets (RFC 4880, section 5.2.3.1).
+func parseSubpacketInfos(subpackets []byte) ([]*SubpacketInfo, error) {
+	var infos []*SubpacketInfo
+	for len(subpackets) > 0 {
+		var length int
+		switch {
+		case subpackets[0] < 192:
+			length = int(subpackets[0])
+			subpackets = subpackets[1:]
+		case subpackets[0] < 255:
+			if len(subpackets) < 2 {
+				return nil, errors.New("gopenpgp: signature subpacket is truncated")
+			}
+			length = (int(subpackets[0])-192)<<8 + int(subpackets[1]) + 192
+			subpackets = subpackets[2:]
+		default:
+			if len(subpackets) < 5 {
+				return nil, errors.New("gopenpgp: signature subpacket is truncated")
+			}
+			length = int(binary.BigEndian.Uint32(subpackets[1:5]))
+			subpackets = subpackets[5:]
+		}
+		if length == 0 || length > len(subpackets) {
+			return nil, errors.New("gopenpgp: signature subpacket is truncated")
+		}
+
+		contents := subpackets[:length]
+		subpackets = subpackets[length:]
+		subpacketType := int(contents[0] & 0x7f)
+		infos = append(infos, &SubpacketInfo{
+			Type:     subpacketType,
+			Name:     subpacketName(subpacketType),
+			Critical: contents[0]&0x80 != 0,
+			Data:     contents[1:],
+		})
+	}
+	return infos, nil
+}
+
+func writePacketInfos(buf *strings.Builder, packets []*PacketInfo, indent string) {
+	for _, p := range packets {
+		length := fmt.Sprintf("length %d", p.Length)
+		if p.PartialLength {
+			length += " (partial)"
+		}
+		fmt.Fprintf(buf, "%s:%s packet: tag %d, %s\n", indent, p.Name, p.Tag, length)
+
+		fieldIndent := indent + "\t"
+		var fields []string
+		if p.Version != 0 {
+			fields = append(fields, fmt.Sprintf("version %d", p.Version))
+		}
+		if p.PublicKeyAlgorithm != "" {
+			fields = append(fields, "algorithm "+p.PublicKeyAlgorithm)
+		}
+		if p.KeyID != 0 || p.Tag == 1 {
+			fields = append(fields, "key ID "+keyIDToHex(p.KeyID))
+		}
+		if p.CreationTime != 0 {
+			fields = append(fields, "created "+formatUnixTime(p.CreationTime))
+		}
+		if p.CipherAlgorithm != "" {
+			fields = append(fields, "cipher "+p.CipherAlgorithm)
+		}
+		if p.AEADMode != "" {
+			fields = append(fields, "AEAD mode "+p.AEADMode)
+		}
+		if p.CompressionAlgorithm != "" {
+			fields = append(fields, "compression "+p.CompressionAlgorithm)
+		}
+		if len(fields) > 0 {
+			fmt.Fprintf(buf, "%s%s\n", fieldIndent, strings.Join(fields, ", "))
+		}
+
+		if p.Fingerprint != nil {
+			fmt.Fprintf(buf, "%sfingerprint %s\n", fieldIndent, hex.EncodeToString(p.Fingerprint))
+		}
+		if p.S2K != nil {
+			fmt.Fprintf(buf, "%sS2K %s\n", fieldIndent, formatS2K(p.S2K))
+		}
+		if p.Tag == 13 {
+			fmt.Fprintf(buf, "%suser ID %q\n", fieldIndent, p.UserID)
+		}
+		if p.Literal != nil {
+			fmt.Fprintf(
+				buf, "%sformat %c, file name %q, time %s\n",
+				fieldIndent, p.Literal.Format, p.Literal.Filename, formatUnixTime(p.Literal.Time),
+			)
+		}
+		if sig := p.Signature; sig != nil {
+			fmt.Fprintf(buf, "%ssignature type 0x%02x, hash %s", fieldIndent, sig.Type, sig.HashAlgorithm)
+			if p.Tag == 4 {
+				fmt.Fprintf(buf, ", last %t", sig.Last)
+			}
+			if sig.CreationTime != 0 {
+				fmt.Fprintf(buf, ", created %s", formatUnixTime(sig.CreationTime))
+			}
+			buf.WriteString("\n")
+			writeSubpacketInfos(buf, sig.HashedSubpackets, "hashed", fieldIndent)
+			writeSubpacketInfos(buf, sig.UnhashedSubpackets, "unhashed", fieldIndent)
+		}
+
+		writePacketInfos(buf, p.Packets, fieldIndent)
+	}
+}
+
+func writeSubpacketInfos(buf *strings.Builder, subpackets []*SubpacketInfo, area, indent string) {
+	for _, s := range subpackets {
+		critical := ""
+		if s.Critical {
+			critical = " (critical)"
+		}
+		fmt.Fprintf(buf, "%s%s subpacket %d%s: %s, %s\n", indent, area, s.Type, critical, s.Name, formatSubpacketData(s))
+	}
+}
+
+func formatSubpacketData(s *SubpacketInfo) string {
+	switch s.Type {
+	case 2: // Signature Creation Time
+		if len(s.Data) == 4 {
+			return formatUnixTime(int64(binary.BigEndian.Uint32(s.Data)))
+		}
+	case 3, 9: // Signature Expiration Time, Key Expiration Time
+		if len(s.Data) == 4 {
+			return fmt.Sprintf("%d seconds", binary.BigEndian.Uint32(s.Data))
+		}
+	case 16: // Issuer
+		if len(s.Data) == 8 {
+			return keyIDToHex(binary.BigEndian.Uint64(s.Data))
+		}
+	case 28: // Signer's User ID
+		return fmt.Sprintf("%q", string(s.Data))
+	}
+	return hex.EncodeToString(s.Data)
+}
+
+func formatS2K(config *S2KConfig) string {
+	switch config.Mode {
+	case constants.S2KIteratedSalted:
+		return fmt.Sprintf("%s, count %d", config.Mode, config.Count)
+	case constants.S2KArgon2:
+		return fmt.Sprintf(
+			"%s, passes %d, parallelism %d, memory %d KiB",
+			config.Mode, config.Argon2Passes, config.Argon2Parallelism, config.Argon2Memory,
+		)
+	default:
+		return config.Mode
+	}
+}
+
+func formatUnixTime(t int64) string {
+	return time.Unix(t, 0).UTC().Format(time.RFC3339)
+}
+
+func lookupName(names map[byte]string, id byte) string {
+	if name, ok := names[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", id)
+}
+
+var packetNames = map[byte]string{
+	1:  "public-key encrypted session key",
+	2:  "signature",
+	3:  "symmetric-key encrypted session key",
+	4:  "one-pass signature",
+	5:  "secret key",
+	6:  "public key",
+	7:  "secret subkey",
+	8:  "compressed data",
+	9:  "symmetrically encrypted data",
+	10: "marker",
+	11: "literal data",
+	12: "trust",
+	13: "user ID",
+	14: "public subkey",
+	17: "user attribute",
+	18: "sym. encrypted and integrity protected data",
+	19: "modification detection code",
+	20: "AEAD encrypted data",
+}
+
+func packetName(tag byte) string {
+	return lookupName(packetNames, tag)
+}
+
+var publicKeyAlgorithmNames = map[byte]string{
+	1:  "rsa",
+	2:  "rsa-encrypt-only",
+	3:  "rsa-sign-only",
+	16: "elgamal",
+	17: "dsa",
+	18: "ecdh",
+	19: "ecdsa",
+	22: "eddsa",
+	25: "x25519",
+	26: "x448",
+	27: "ed25519",
+	28: "ed448",
+}
+
+func publicKeyAlgorithmName(id byte) string {
+	return lookupName(publicKeyAlgorithmNames, id)
+}
+
+var cipherAlgorithmNames = map[byte]string{
+	0:  "plaintext",
+	1:  "idea",
+	2:  constants.ThreeDES,
+	3:  constants.CAST5,
+	4:  "blowfish",
+	7:  constants.AES128,
+	8:  constants.AES192,
+	9:  constants.AES256,
+	10: "twofish",
+}
+
+func cipherAlgorithmName(id byte) string {
+	return lookupName(cipherAlgorithmNames, id)
+}
+
+var aeadModeNames = map[byte]string{
+	1: "eax",
+	2: "ocb",
+	3: "gcm",
+}
+
+func aeadModeName(id byte) string {
+	return lookupName(aeadModeNames, id)
+}
+
+var compressionAlgorithmNames = map[byte]string{
+	0: constants.CompressionNone,
+	1: constants.CompressionZIP,
+	2: constants.CompressionZLIB,
+	3: constants.CompressionBZIP2,
+}
+
+func compressionAlgorithmName(id byte) string {
+	return lookupName(compressionAlgorithmNames, id)
+}
+
+var hashAlgorithmNames = map[byte]string{
+	1:  "md5",
+	2:  "sha1",
+	3:  "ripemd160",
+	8:  "sha256",
+	9:  "sha384",
+	10: "sha512",
+	11: "sha224",
+	12: "sha3-256",
+	14: "sha3-512",
+}
+
+func hashAlgorithmName(id byte) string {
+	return lookupName(hashAlgorithmNames, id)
+}
+
+var subpacketNames = map[byte]string{
+	2:  "signature creation time",
+	3:  "signature expiration time",
+	4:  "exportable certification",
+	5:  "trust signature",
+	6:  "regular expression",
+	7:  "revocable",
+	9:  "key expiration time",
+	11: "preferred symmetric algorithms",
+	12: "revocation key",
+	16: "issuer",
+	20: "notation data",
+	21: "preferred hash algorithms",
+	22: "preferred compression algorithms",
+	23: "key server preferences",
+	24: "preferred key server",
+	25: "primary user ID",
+	26: "policy URI",
+	27: "key flags",
+	28: "signer's user ID",
+	29: "reason for revocation",
+	30: "features",
+	31: "signature target",
+	32: "embedded signature",
+	33: "issuer fingerprint",
+	34: "preferred AEAD algorithms",
+	35: "intended recipient fingerprint",
+}
+
+func subpacketName(subpacketType int) string {
+	return lookupName(subpacketNames, byte(subpacketType))
+}
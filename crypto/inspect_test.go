@@ -0,0 +1,180 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/angel-one/gopenpgp/v2/constants"
+)
+
+func TestInspectEncryptedMessage(t *testing.T) {
+	options := &EncryptionOptions{
+		Passwords: [][]byte{testSymmetricKey},
+		S2KConfig: NewIteratedSaltedS2KConfig(65536),
+	}
+	ciphertext, err := keyRingTestPublic.EncryptWithOptions(NewPlainMessageFromString("plain text"), nil, options)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+
+	dump, err := ciphertext.Inspect()
+	if err != nil {
+		t.Fatal("Expected no error when inspecting, got:", err)
+	}
+	if len(dump.Packets) != 3 {
+		t.Fatal("Expected 3 packets, got:", dump.String())
+	}
+
+	keyIDs, _ := ciphertext.GetEncryptionKeyIDs()
+	pkesk := dump.Packets[0]
+	assert.Exactly(t, 1, pkesk.Tag)
+	assert.Exactly(t, 3, pkesk.Version)
+	assert.Exactly(t, keyIDs[0], pkesk.KeyID)
+	assert.Exactly(t, "rsa", pkesk.PublicKeyAlgorithm)
+
+	skesk := dump.Packets[1]
+	assert.Exactly(t, 3, skesk.Tag)
+	assert.Exactly(t, constants.AES256, skesk.CipherAlgorithm)
+	assert.Exactly(t, NewIteratedSaltedS2KConfig(65536), skesk.S2K)
+
+	assert.Exactly(t, 18, dump.Packets[2].Tag)
+	assert.Exactly(t, 1, dump.Packets[2].Version)
+
+	text := dump.String()
+	assert.Contains(t, text, ":public-key encrypted session key packet: tag 1")
+	assert.Contains(t, text, "key ID "+keyIDToHex(keyIDs[0]))
+	assert.Contains(t, text, "S2K iterated-salted, count 65536")
+}
+
+func TestInspectCompressedMessage(t *testing.T) {
+	var buf bytes.Buffer
+	compressed, err := packet.SerializeCompressed(noOpWriteCloser{&buf}, packet.CompressionZIP, nil)
+	if err != nil {
+		t.Fatal("Expected no error when compressing, got:", err)
+	}
+	literal, err := packet.SerializeLiteral(compressed, false, "file.txt", 1557754627)
+	if err != nil {
+		t.Fatal("Expected no error when writing literal data, got:", err)
+	}
+	if _, err = literal.Write([]byte("plain text")); err != nil {
+		t.Fatal("Expected no error when writing literal data, got:", err)
+	}
+	if err = literal.Close(); err != nil {
+		t.Fatal("Expected no error when closing literal data, got:", err)
+	}
+
+	dump, err := NewPGPMessage(buf.Bytes()).Inspect()
+	if err != nil {
+		t.Fatal("Expected no error when inspecting, got:", err)
+	}
+	if len(dump.Packets) != 1 || len(dump.Packets[0].Packets) != 1 {
+		t.Fatal("Expected a literal data packet in a compressed packet, got:", dump.String())
+	}
+	assert.Exactly(t, constants.CompressionZIP, dump.Packets[0].CompressionAlgorithm)
+	assert.Exactly(t, &LiteralInfo{Format: 'u', Filename: "file.txt", Time: 1557754627}, dump.Packets[0].Packets[0].Literal)
+	assert.Contains(t, dump.String(), "\t:literal data packet: tag 11")
+}
+
+func TestInspectSignature(t *testing.T) {
+	signature, err := keyRingTestPrivate.SignDetached(NewPlainMessageFromString("plain text"))
+	if err != nil {
+		t.Fatal("Expected no error when signing, got:", err)
+	}
+	dump, err := signature.Inspect()
+	if err != nil {
+		t.Fatal("Expected no error when inspecting, got:", err)
+	}
+	if len(dump.Packets) != 1 {
+		t.Fatal("Expected a signature packet, got:", dump.String())
+	}
+
+	keyIDs, _ := signature.GetSignatureKeyIDs()
+	sig := dump.Packets[0]
+	assert.Exactly(t, 2, sig.Tag)
+	assert.Exactly(t, 4, sig.Version)
+	assert.Exactly(t, keyIDs[0], sig.KeyID)
+	assert.Exactly(t, int(packet.SigTypeText), sig.Signature.Type)
+
+	var subpacketTypes []int
+	for _, subpacket := range sig.Signature.HashedSubpackets {
+		subpacketTypes = append(subpacketTypes, subpacket.Type)
+	}
+	assert.Contains(t, subpacketTypes, 2)  // Signature Creation Time
+	assert.Contains(t, subpacketTypes, 33) // Issuer Fingerprint
+	assert.Contains(t, dump.String(), "signature creation time, 2019-05-13T13:37:07Z")
+}
+
+func TestInspectKey(t *testing.T) {
+	lockedKey, err := NewKeyFromArmored(keyTestArmoredRSA)
+	if err != nil {
+		t.Fatal("Expected no error when unarmoring the key, got:", err)
+	}
+	dump, err := lockedKey.Inspect()
+	if err != nil {
+		t.Fatal("Expected no error when inspecting, got:", err)
+	}
+
+	primary := dump.Packets[0]
+	assert.Exactly(t, 5, primary.Tag)
+	assert.Exactly(t, lockedKey.GetKeyID(), primary.KeyID)
+	assert.Exactly(t, lockedKey.GetFingerprint(), hex.EncodeToString(primary.Fingerprint))
+	assert.Exactly(t, constants.AES256, primary.CipherAlgorithm)
+	assert.Exactly(t, constants.S2KIteratedSalted, primary.S2K.Mode)
+
+	var userIDs []string
+	for _, p := range dump.Packets {
+		if p.Tag == 13 {
+			userIDs = append(userIDs, p.UserID)
+		}
+	}
+	assert.Exactly(t, []string{keyTestName + " <" + keyTestDomain + ">"}, userIDs)
+}
+
+func TestInspectLargeLiteralData(t *testing.T) {
+	var buf bytes.Buffer
+	literal, err := packet.SerializeLiteral(noOpWriteCloser{&buf}, true, "large.bin", 0)
+	if err != nil {
+		t.Fatal("Expected no error when writing literal data, got:", err)
+	}
+	if _, err = literal.Write(make([]byte, 1<<20)); err != nil {
+		t.Fatal("Expected no error when writing literal data, got:", err)
+	}
+	if err = literal.Close(); err != nil {
+		t.Fatal("Expected no error when closing literal data, got:", err)
+	}
+
+	dump, err := NewPGPMessage(buf.Bytes()).Inspect()
+	if err != nil {
+		t.Fatal("Expected no error when inspecting, got:", err)
+	}
+	if len(dump.Packets) != 1 {
+		t.Fatal("Expected a literal data packet, got:", dump.String())
+	}
+	assert.Exactly(t, int64(1<<20+len("large.bin")+6), dump.Packets[0].Length)
+	assert.Exactly(t, "large.bin", dump.Packets[0].Literal.Filename)
+}
+
+func TestInspectWithInstanceLimits(t *testing.T) {
+	instance := NewGopenPGP()
+	instance.SetDecryptionLimits(&DecryptionLimits{MaxPackets: 1})
+
+	ciphertext, err := keyRingTestPublic.Encrypt(NewPlainMessageFromString("plain text"), nil)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	_, err = ciphertext.Inspect()
+	assert.Nil(t, err)
+	_, err = instance.InspectMessage(ciphertext)
+	assertDecryptionLimitError(t, err, "MaxPackets")
+
+	key, err := instance.GenerateKey(keyTestName, keyTestDomain, "x25519", 0)
+	if err != nil {
+		t.Fatal("Expected no error when generating key, got:", err)
+	}
+	_, err = key.Inspect()
+	assertDecryptionLimitError(t, err, "MaxPackets")
+}
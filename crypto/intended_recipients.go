@@ -0,0 +1,275 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto"
+	"hash"
+	"io"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/pkg/errors"
+)
+
+// signatureHashIDs maps the hash functions usable for message signatures to
+// their OpenPGP identifiers (RFC 4880, section 9.4).
+var signatureHashIDs = map[crypto.Hash]uint8{
+	crypto.SHA256:   8,
+	crypto.SHA384:   9,
+	crypto.SHA512:   10,
+	crypto.SHA3_256: 12,
+	crypto.SHA3_512: 14,
+}
+
+// signatureCandidateHashes lists the hash functions that may be used for
+// message signatures, in order of preference.
+var signatureCandidateHashes = []crypto.Hash{
+	crypto.SHA256,
+	crypto.SHA384,
+	crypto.SHA512,
+	crypto.SHA3_256,
+	crypto.SHA3_512,
+}
+
+// intendedRecipientsSignWriter hashes and writes the literal data of a
+// message, and writes a signature packet listing the intended recipients of
+// the message when closed.
+type intendedRecipientsSignWriter struct {
+	output      io.Writer
+	literalData io.WriteCloser
+	hashType    crypto.Hash
+	h           hash.Hash
+	wrappedHash hash.Hash
+	salt        []byte // v6 signatures only
+	signer      *packet.PrivateKey
+	sigType     packet.SignatureType
+	recipients  []*packet.Recipient
+	config      *packet.Config
+	canonical   int
+}
+
+func (w *intendedRecipientsSignWriter) Write(data []byte) (int, error) {
+	if _, err := w.wrappedHash.Write(data); err != nil {
+		return 0, err
+	}
+	if w.sigType == packet.SigTypeText {
+		return writeCanonicalText(w.literalData, data, &w.canonical)
+	}
+	return w.literalData.Write(data)
+}
+
+func (w *intendedRecipientsSignWriter) Close() error {
+	sigLifetimeSecs := w.config.SigLifetime()
+	sig := &packet.Signature{
+		Version:            w.signer.PublicKey.Version,
+		SigType:            w.sigType,
+		PubKeyAlgo:         w.signer.PublicKey.PubKeyAlgo,
+		Hash:               w.hashType,
+		CreationTime:       w.config.Now(),
+		IssuerKeyId:        &w.signer.PublicKey.KeyId,
+		IssuerFingerprint:  w.signer.PublicKey.Fingerprint,
+		Notations:          w.config.Notations(),
+		SigLifetimeSecs:    &sigLifetimeSecs,
+		IntendedRecipients: w.recipients,
+	}
+	if err := sig.SetSalt(w.salt); err != nil {
+		return errors.Wrap(err, "gopenpgp: error in signing")
+	}
+	if err := sig.Sign(w.h, w.signer, w.config); err != nil {
+		return errors.Wrap(err, "gopenpgp: error in signing")
+	}
+
+	if err := w.literalData.Close(); err != nil {
+		return err
+	}
+	return sig.Serialize(w.output)
+}
+
+// signWithIntendedRecipients works like openpgp.Sign, but the resulting
+// signature contains an Intended Recipient Fingerprint subpacket for the
+// primary key of every recipient.
+// Only v4 and v6 signatures carry the subpacket: with other signing keys the
+// message is signed by openpgp.Sign, without it.
+// Closing the returned writer does not close output.
+func signWithIntendedRecipients(
+	output io.Writer,
+	signEntity *openpgp.Entity,
+	hints *openpgp.FileHints,
+	recipients openpgp.EntityList,
+	config *packet.Config,
+) (io.WriteCloser, error) {
+	signKey, ok := signEntity.SigningKeyById(config.Now(), config.SigningKey())
+	if !ok {
+		return nil, errors.New("gopenpgp: no valid signing keys")
+	}
+	signer := signKey.PrivateKey
+	if signer == nil {
+		return nil, errors.New("gopenpgp: no private key in signing key")
+	}
+	if signer.Encrypted {
+		return nil, newError("gopenpgp: signing key must be unlocked", ErrKeyLocked)
+	}
+	if signer.Version != 4 && signer.Version != 6 {
+		return openpgp.Sign(output, signEntity, hints, config)
+	}
+
+	hashType := selectSignatureHash(signEntity, config)
+
+	sigType := packet.SigTypeBinary
+	if !hints.IsBinary {
+		sigType = packet.SigTypeText
+	}
+
+	ops := &packet.OnePassSignature{
+		Version:    3,
+		SigType:    sigType,
+		Hash:       hashType,
+		PubKeyAlgo: signer.PubKeyAlgo,
+		KeyId:      signer.KeyId,
+		IsLast:     true,
+	}
+	var salt []byte
+	if signer.Version == 6 {
+		var err error
+		salt, err = packet.SignatureSaltForHash(hashType, config.Random())
+		if err != nil {
+			return nil, errors.Wrap(err, "gopenpgp: error in generating the signature salt")
+		}
+		ops.Version = 6
+		ops.KeyFingerprint = signer.Fingerprint
+		ops.Salt = salt
+	}
+	if err := ops.Serialize(output); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in writing one-pass signature")
+	}
+
+	var modTime uint32
+	if !hints.ModTime.IsZero() {
+		modTime = uint32(hints.ModTime.Unix())
+	}
+	literalData, err := packet.SerializeLiteral(noOpWriteCloser{output}, hints.IsBinary, hints.FileName, modTime)
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in writing literal data")
+	}
+
+	h := hashType.New()
+	if salt != nil {
+		_, _ = h.Write(salt)
+	}
+	wrappedHash := h
+	if sigType == packet.SigTypeText {
+		wrappedHash = openpgp.NewCanonicalTextHash(h)
+	}
+
+	intendedRecipients := make([]*packet.Recipient, 0, len(recipients))
+	for _, e := range recipients {
+		intendedRecipients = append(intendedRecipients, &packet.Recipient{
+			KeyVersion:  e.PrimaryKey.Version,
+			Fingerprint: e.PrimaryKey.Fingerprint,
+		})
+	}
+
+	return &intendedRecipientsSignWriter{
+		output:      output,
+		literalData: literalData,
+		hashType:    hashType,
+		h:           h,
+		wrappedHash: wrappedHash,
+		salt:        salt,
+		signer:      signer,
+		sigType:     sigType,
+		recipients:  intendedRecipients,
+		config:      config,
+	}, nil
+}
+
+// selectSignatureHash picks the first candidate hash function supported by
+// the signer, or the configured hash if the signer supports it.
+func selectSignatureHash(signEntity *openpgp.Entity, config *packet.Config) crypto.Hash {
+	var preferred []uint8
+	if selfSignature, _ := signEntity.PrimarySelfSignature(); selfSignature != nil {
+		preferred = selfSignature.PreferredHash
+	}
+	if len(preferred) == 0 {
+		return crypto.SHA256
+	}
+
+	var candidates []crypto.Hash
+	for _, candidate := range signatureCandidateHashes {
+		for _, id := range preferred {
+			if signatureHashIDs[candidate] == id && candidate.Available() {
+				candidates = append(candidates, candidate)
+				break
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return crypto.SHA256
+	}
+
+	for _, candidate := range candidates {
+		if candidate == config.Hash() {
+			return candidate
+		}
+	}
+	return candidates[0]
+}
+
+// checkIntendedRecipients verifies that the key that decrypted the message
+// is among the intended recipients listed in its signature, if any.
+func checkIntendedRecipients(md *openpgp.MessageDetails) error {
+	if md.Signature == nil || md.DecryptedWith.Entity == nil {
+		// Not decrypted with a private key, nothing to check
+		return nil
+	}
+
+	recipients := md.Signature.IntendedRecipients
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	for _, recipient := range recipients {
+		if bytes.Equal(recipient.Fingerprint, md.DecryptedWith.Entity.PrimaryKey.Fingerprint) ||
+			(md.DecryptedWith.PublicKey != nil && bytes.Equal(recipient.Fingerprint, md.DecryptedWith.PublicKey.Fingerprint)) {
+			return nil
+		}
+	}
+	return errors.New("gopenpgp: the decryption key is not an intended recipient of the message")
+}
+
+// writeCanonicalText writes buf to w, converting the line endings to <CR><LF>.
+func writeCanonicalText(w io.Writer, buf []byte, state *int) (int, error) {
+	start := 0
+	for i, c := range buf {
+		switch *state {
+		case 0:
+			if c == '\r' {
+				*state = 1
+			} else if c == '\n' {
+				if _, err := w.Write(buf[start:i]); err != nil {
+					return 0, err
+				}
+				if _, err := w.Write([]byte{'\r', '\n'}); err != nil {
+					return 0, err
+				}
+				start = i + 1
+			}
+		case 1:
+			*state = 0
+		}
+	}
+	if _, err := w.Write(buf[start:]); err != nil {
+		return 0, err
+	}
+	return len(buf), nil
+}
+
+// noOpWriteCloser turns an io.Writer into an io.WriteCloser whose Close does
+// nothing.
+type noOpWriteCloser struct {
+	io.Writer
+}
+
+func (noOpWriteCloser) Close() error {
+	return nil
+}
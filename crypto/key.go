@@ -2,6 +2,7 @@ package crypto
 
 import (
 	"bytes"
+	"context"
 	"crypto"
 	"crypto/sha256"
 	"encoding/hex"
@@ -23,13 +24,21 @@ import (
 type Key struct {
 	// PGP entities in this keyring.
 	entity *openpgp.Entity
+
+	// The instance whose clock is used, nil for the default one.
+	pgp *GopenPGP
 }
 
 // --- Create Key object
 
 // NewKeyFromArmoredReader reads an armored data into a key.
 func NewKeyFromArmoredReader(r io.Reader) (key *Key, err error) {
-	key = &Key{}
+	return pgp.NewKeyFromArmoredReader(r)
+}
+
+// NewKeyFromArmoredReader reads an armored data into a key bound to the instance.
+func (pgp *GopenPGP) NewKeyFromArmoredReader(r io.Reader) (key *Key, err error) {
+	key = &Key{pgp: pgp.bound()}
 	err = key.readFrom(r, true)
 	if err != nil {
 		return nil, err
@@ -40,7 +49,12 @@ func NewKeyFromArmoredReader(r io.Reader) (key *Key, err error) {
 
 // NewKeyFromReader reads binary data into a Key object.
 func NewKeyFromReader(r io.Reader) (key *Key, err error) {
-	key = &Key{}
+	return pgp.NewKeyFromReader(r)
+}
+
+// NewKeyFromReader reads binary data into a Key object bound to the instance.
+func (pgp *GopenPGP) NewKeyFromReader(r io.Reader) (key *Key, err error) {
+	key = &Key{pgp: pgp.bound()}
 	err = key.readFrom(r, false)
 	if err != nil {
 		return nil, err
@@ -51,19 +65,36 @@ func NewKeyFromReader(r io.Reader) (key *Key, err error) {
 
 // NewKey creates a new key from the first key in the unarmored binary data.
 func NewKey(binKeys []byte) (key *Key, err error) {
-	return NewKeyFromReader(bytes.NewReader(clone(binKeys)))
+	return pgp.NewKey(binKeys)
+}
+
+// NewKey creates a new key bound to the instance from the first key in the
+// unarmored binary data.
+func (pgp *GopenPGP) NewKey(binKeys []byte) (key *Key, err error) {
+	return pgp.NewKeyFromReader(bytes.NewReader(clone(binKeys)))
 }
 
 // NewKeyFromArmored creates a new key from the first key in an armored string.
 func NewKeyFromArmored(armored string) (key *Key, err error) {
-	return NewKeyFromArmoredReader(strings.NewReader(armored))
+	return pgp.NewKeyFromArmored(armored)
+}
+
+// NewKeyFromArmored creates a new key bound to the instance from the first
+// key in an armored string.
+func (pgp *GopenPGP) NewKeyFromArmored(armored string) (key *Key, err error) {
+	return pgp.NewKeyFromArmoredReader(strings.NewReader(armored))
 }
 
 func NewKeyFromEntity(entity *openpgp.Entity) (*Key, error) {
+	return pgp.NewKeyFromEntity(entity)
+}
+
+// NewKeyFromEntity creates a key bound to the instance from a go-crypto entity.
+func (pgp *GopenPGP) NewKeyFromEntity(entity *openpgp.Entity) (*Key, error) {
 	if entity == nil {
 		return nil, errors.New("gopenpgp: nil entity provided")
 	}
-	return &Key{entity: entity}, nil
+	return &Key{entity: entity, pgp: pgp.bound()}, nil
 }
 
 // GenerateRSAKeyWithPrimes generates a RSA key using the given primes.
@@ -72,18 +103,67 @@ func GenerateRSAKeyWithPrimes(
 	bits int,
 	primeone, primetwo, primethree, primefour []byte,
 ) (*Key, error) {
-	return generateKey(name, email, "rsa", bits, primeone, primetwo, primethree, primefour)
+	return pgp.GenerateRSAKeyWithPrimes(name, email, bits, primeone, primetwo, primethree, primefour)
+}
+
+// GenerateRSAKeyWithPrimes generates a RSA key bound to the instance using the given primes.
+func (pgp *GopenPGP) GenerateRSAKeyWithPrimes(
+	name, email string,
+	bits int,
+	primeone, primetwo, primethree, primefour []byte,
+) (*Key, error) {
+	return pgp.generateKey(context.Background(), name, email, "rsa", bits, primeone, primetwo, primethree, primefour)
 }
 
 // GenerateKey generates a key of the given keyType ("rsa" or "x25519").
 // If keyType is "rsa", bits is the RSA bitsize of the key.
 // If keyType is "x25519" bits is unused.
 func GenerateKey(name, email string, keyType string, bits int) (*Key, error) {
-	return generateKey(name, email, keyType, bits, nil, nil, nil, nil)
+	return pgp.GenerateKey(name, email, keyType, bits)
+}
+
+// GenerateKey generates a key bound to the instance, with the creation time
+// given by its clock and key generation offset. See GenerateKey.
+func (pgp *GopenPGP) GenerateKey(name, email string, keyType string, bits int) (*Key, error) {
+	return pgp.generateKey(context.Background(), name, email, keyType, bits, nil, nil, nil, nil)
+}
+
+// GenerateKeyCtx generates a key like GenerateKey, unless ctx is done first.
+// Once ctx is done, it returns an error matching ctx.Err() without waiting for
+// the generation to stop, and the private parameters of the abandoned key are
+// cleared.
+// * ctx : the context cancelling the generation.
+func GenerateKeyCtx(ctx context.Context, name, email string, keyType string, bits int) (*Key, error) {
+	return pgp.GenerateKeyCtx(ctx, name, email, keyType, bits)
+}
+
+// GenerateKeyCtx generates a key bound to the instance like GenerateKey, unless ctx is done first.
+// See GenerateKeyCtx.
+func (pgp *GopenPGP) GenerateKeyCtx(ctx context.Context, name, email string, keyType string, bits int) (*Key, error) {
+	return pgp.generateKey(ctx, name, email, keyType, bits, nil, nil, nil, nil)
+}
+
+// GenerateKeyWithTestingSources generates a key like GenerateKey, reading the
+// randomness and time from sources. The key is bound to the instance.
+// TESTING ONLY, see TestingSources.
+func (pgp *GopenPGP) GenerateKeyWithTestingSources(
+	name, email string, keyType string, bits int, sources *TestingSources,
+) (*Key, error) {
+	key, err := pgp.withTestingSources(sources).generateKey(context.Background(), name, email, keyType, bits, nil, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	key.pgp = pgp.bound()
+	return key, nil
 }
 
 // --- Operate on key
 
+// getPGP returns the instance the key is bound to.
+func (key *Key) getPGP() *GopenPGP {
+	return key.pgp.orDefault()
+}
+
 // Copy creates a deep copy of the key.
 func (key *Key) Copy() (*Key, error) {
 	serialized, err := key.Serialize()
@@ -91,11 +171,18 @@ func (key *Key) Copy() (*Key, error) {
 		return nil, err
 	}
 
-	return NewKey(serialized)
+	return key.getPGP().NewKey(serialized)
 }
 
 // Lock locks a copy of the key.
 func (key *Key) Lock(passphrase []byte) (*Key, error) {
+	return key.LockWithS2K(passphrase, nil)
+}
+
+// LockWithS2K locks a copy of the key, deriving the encryption key from the
+// passphrase with the given S2K function.
+// If s2kConfig is nil, the default of Lock is used.
+func (key *Key) LockWithS2K(passphrase []byte, s2kConfig *S2KConfig) (*Key, error) {
 	unlocked, err := key.IsUnlocked()
 	if err != nil {
 		return nil, err
@@ -114,17 +201,32 @@ func (key *Key) Lock(passphrase []byte) (*Key, error) {
 		return lockedKey, nil
 	}
 
-	if lockedKey.entity.PrivateKey != nil && !lockedKey.entity.PrivateKey.Dummy() {
-		err = lockedKey.entity.PrivateKey.Encrypt(passphrase)
-		if err != nil {
+	if s2kConfig != nil {
+		config := &packet.Config{DefaultCipher: packet.CipherAES256, Rand: key.getPGP().rand}
+		if config.S2KConfig, err = s2kConfig.getS2KConfig(); err != nil {
+			return nil, err
+		}
+		if s2kConfig.Mode == constants.S2KArgon2 {
+			// Keys protected with Argon2 must be encrypted with AEAD
+			config.AEADConfig = &packet.AEADConfig{}
+		}
+		// The key derived from the passphrase is shared by all (sub)keys
+		if err = lockedKey.entity.EncryptPrivateKeys(passphrase, config); err != nil {
 			return nil, errors.Wrap(err, "gopenpgp: error in locking key")
 		}
-	}
+	} else {
+		if lockedKey.entity.PrivateKey != nil && !lockedKey.entity.PrivateKey.Dummy() {
+			err = lockedKey.entity.PrivateKey.Encrypt(passphrase)
+			if err != nil {
+				return nil, errors.Wrap(err, "gopenpgp: error in locking key")
+			}
+		}
 
-	for _, sub := range lockedKey.entity.Subkeys {
-		if sub.PrivateKey != nil && !sub.PrivateKey.Dummy() {
-			if err := sub.PrivateKey.Encrypt(passphrase); err != nil {
-				return nil, errors.Wrap(err, "gopenpgp: error in locking sub key")
+		for _, sub := range lockedKey.entity.Subkeys {
+			if sub.PrivateKey != nil && !sub.PrivateKey.Dummy() {
+				if err := sub.PrivateKey.Encrypt(passphrase); err != nil {
+					return nil, errors.Wrap(err, "gopenpgp: error in locking sub key")
+				}
 			}
 		}
 	}
@@ -162,14 +264,15 @@ func (key *Key) Unlock(passphrase []byte) (*Key, error) {
 	if unlockedKey.entity.PrivateKey != nil && !unlockedKey.entity.PrivateKey.Dummy() {
 		err = unlockedKey.entity.PrivateKey.Decrypt(passphrase)
 		if err != nil {
-			return nil, errors.Wrap(err, "gopenpgp: error in unlocking key")
+			// The checksum failure of a wrong passphrase is not a malformed key
+			return nil, &categorizedError{errors.Wrap(err, "gopenpgp: error in unlocking key"), []error{ErrWrongPassword}}
 		}
 	}
 
 	for _, sub := range unlockedKey.entity.Subkeys {
 		if sub.PrivateKey != nil && !sub.PrivateKey.Dummy() {
 			if err := sub.PrivateKey.Decrypt(passphrase); err != nil {
-				return nil, errors.Wrap(err, "gopenpgp: error in unlocking sub key")
+				return nil, &categorizedError{errors.Wrap(err, "gopenpgp: error in unlocking sub key"), []error{ErrWrongPassword}}
 			}
 		}
 	}
@@ -229,6 +332,22 @@ func (key *Key) ArmorWithCustomHeaders(comment, version string) (string, error)
 	return armor.ArmorWithTypeAndCustomHeaders(serialized, constants.PrivateKeyHeader, version, comment)
 }
 
+// ArmorWithHeaders returns the armored key as a string, with the given armor
+// headers in order.
+// * headers : (optional) the armor headers, nil for none.
+func (key *Key) ArmorWithHeaders(headers *armor.Headers) (string, error) {
+	serialized, err := key.Serialize()
+	if err != nil {
+		return "", err
+	}
+
+	if key.IsPrivate() {
+		return armor.ArmorWithHeaders(serialized, constants.PrivateKeyHeader, headers)
+	}
+
+	return armor.ArmorWithHeaders(serialized, constants.PublicKeyHeader, headers)
+}
+
 // GetArmoredPublicKey returns the armored public keys from this keyring.
 func (key *Key) GetArmoredPublicKey() (s string, err error) {
 	serialized, err := key.GetPublicKey()
@@ -250,6 +369,18 @@ func (key *Key) GetArmoredPublicKeyWithCustomHeaders(comment, version string) (s
 	return armor.ArmorWithTypeAndCustomHeaders(serialized, constants.PublicKeyHeader, version, comment)
 }
 
+// GetArmoredPublicKeyWithHeaders returns the armored public key as a string,
+// with the given armor headers in order.
+// * headers : (optional) the armor headers, nil for none.
+func (key *Key) GetArmoredPublicKeyWithHeaders(headers *armor.Headers) (string, error) {
+	serialized, err := key.GetPublicKey()
+	if err != nil {
+		return "", err
+	}
+
+	return armor.ArmorWithHeaders(serialized, constants.PublicKeyHeader, headers)
+}
+
 // GetPublicKey returns the unarmored public keys from this keyring.
 func (key *Key) GetPublicKey() (b []byte, err error) {
 	var outBuf bytes.Buffer
@@ -264,26 +395,28 @@ func (key *Key) GetPublicKey() (b []byte, err error) {
 
 // CanVerify returns true if any of the subkeys can be used for verification.
 func (key *Key) CanVerify() bool {
-	_, canVerify := key.entity.SigningKey(getNow())
+	_, canVerify := key.entity.SigningKey(key.getPGP().getNow())
 	return canVerify
 }
 
 // CanEncrypt returns true if any of the subkeys can be used for encryption.
 func (key *Key) CanEncrypt() bool {
-	_, canEncrypt := key.entity.EncryptionKey(getNow())
+	_, canEncrypt := key.entity.EncryptionKey(key.getPGP().getNow())
 	return canEncrypt
 }
 
 // IsExpired checks whether the key is expired.
 func (key *Key) IsExpired() bool {
+	now := key.getPGP().getNow()
 	i := key.entity.PrimaryIdentity()
-	return key.entity.PrimaryKey.KeyExpired(i.SelfSignature, getNow()) || // primary key has expired
-		i.SelfSignature.SigExpired(getNow()) // user ID self-signature has expired
+	return key.entity.PrimaryKey.KeyExpired(i.SelfSignature, now) || // primary key has expired
+		i.SelfSignature.SigExpired(now) // user ID self-signature has expired
 }
 
 // IsRevoked checks whether the key or the primary identity has a valid revocation signature.
 func (key *Key) IsRevoked() bool {
-	return key.entity.Revoked(getNow()) || key.entity.PrimaryIdentity().Revoked(getNow())
+	now := key.getPGP().getNow()
+	return key.entity.Revoked(now) || key.entity.PrimaryIdentity().Revoked(now)
 }
 
 // IsPrivate returns true if the key is private.
@@ -412,12 +545,18 @@ func (key *Key) readFrom(r io.Reader, armored bool) error {
 	var err error
 	var entities openpgp.EntityList
 	if armored {
-		entities, err = openpgp.ReadArmoredKeyRing(r)
+		var block *armor.Block
+		if block, err = armor.UnarmorReader(r); err == nil {
+			if block.Type != constants.PublicKeyHeader && block.Type != constants.PrivateKeyHeader {
+				return errors.New("gopenpgp: the armored block is not a key")
+			}
+			entities, err = openpgp.ReadKeyRing(block.Body)
+		}
 	} else {
 		entities, err = openpgp.ReadKeyRing(r)
 	}
 	if err != nil {
-		return errors.Wrap(err, "gopenpgp: error in reading key ring")
+		return wrapError(err, "gopenpgp: error in reading key ring")
 	}
 
 	if len(entities) > 1 {
@@ -432,7 +571,8 @@ func (key *Key) readFrom(r io.Reader, armored bool) error {
 	return nil
 }
 
-func generateKey(
+func (pgp *GopenPGP) generateKey(
+	ctx context.Context,
 	name, email string,
 	keyType string,
 	bits int,
@@ -441,13 +581,17 @@ func generateKey(
 	if len(email) == 0 && len(name) == 0 {
 		return nil, errors.New("gopenpgp: neither name nor email set.")
 	}
+	if err := cancellationError(ctx); err != nil {
+		return nil, err
+	}
 
 	comments := ""
 
 	cfg := &packet.Config{
 		Algorithm:              packet.PubKeyAlgoRSA,
 		RSABits:                bits,
-		Time:                   getKeyGenerationTimeGenerator(),
+		Time:                   pgp.getKeyGenerationTimeGenerator(),
+		Rand:                   pgp.rand,
 		DefaultHash:            crypto.SHA256,
 		DefaultCipher:          packet.CipherAES256,
 		DefaultCompressionAlgo: packet.CompressionZLIB,
@@ -471,7 +615,12 @@ func generateKey(
 		cfg.RSAPrimes = bigPrimes[:]
 	}
 
-	newEntity, err := openpgp.NewEntity(name, comments, email, cfg)
+	if pgp.rand != nil && cfg.Algorithm == packet.PubKeyAlgoRSA && cfg.RSAPrimes == nil {
+		// crypto/rsa reads a random number of bytes from the source
+		return nil, newError("gopenpgp: RSA key generation is not reproducible with a testing randomness source", ErrUnsupportedAlgorithm)
+	}
+
+	newEntity, err := newEntityCtx(ctx, name, comments, email, cfg)
 	if err != nil {
 		return nil, errors.Wrap(err, "gopengpp: error in encoding new entity")
 	}
@@ -480,7 +629,63 @@ func generateKey(
 		return nil, errors.New("gopenpgp: error in generating private key")
 	}
 
-	return NewKeyFromEntity(newEntity)
+	return pgp.NewKeyFromEntity(newEntity)
+}
+
+// newEntityCtx generates an entity with openpgp.NewEntity, unless ctx is
+// done first. The configuration of the caller is not modified: the
+// generation reads its randomness from a copy of it, through a reader
+// failing with the cancellation error once ctx is done.
+func newEntityCtx(ctx context.Context, name, comments, email string, cfg *packet.Config) (*openpgp.Entity, error) {
+	if ctx.Done() == nil {
+		return openpgp.NewEntity(name, comments, email, cfg)
+	}
+
+	config := *cfg
+	config.Rand = &contextReader{ctx, cfg.Random()}
+	return generateEntityCtx(ctx, func() (*openpgp.Entity, error) {
+		return openpgp.NewEntity(name, comments, email, &config)
+	}, discardEntity)
+}
+
+// generateEntityCtx runs generate in a goroutine and returns its entity,
+// unless ctx is done first. A cancelled generation is abandoned: its
+// goroutine stops at the next read of randomness, or runs until the key
+// generation completes if it does not read from the configuration, and then
+// passes the entity to discard. No other goroutine is left running.
+func generateEntityCtx(
+	ctx context.Context,
+	generate func() (*openpgp.Entity, error),
+	discard func(*openpgp.Entity),
+) (*openpgp.Entity, error) {
+	type generation struct {
+		entity *openpgp.Entity
+		err    error
+	}
+	// The result is only handed over while the caller waits for it
+	generated := make(chan generation)
+	go func() {
+		entity, err := generate()
+		select {
+		case generated <- generation{entity, err}:
+		case <-ctx.Done():
+			if entity != nil {
+				discard(entity)
+			}
+		}
+	}()
+
+	select {
+	case result := <-generated:
+		return result.entity, result.err
+	case <-ctx.Done():
+		return nil, cancellationError(ctx)
+	}
+}
+
+// discardEntity clears the private parameters of an abandoned entity.
+func discardEntity(entity *openpgp.Entity) {
+	(&Key{entity: entity}).ClearPrivateParams()
 }
 
 // keyIDToHex casts a keyID to hex with the correct padding.
@@ -13,6 +13,8 @@ import (
 	"github.com/ProtonMail/go-crypto/openpgp/packet"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/angel-one/gopenpgp/v2/constants"
 )
 
 const keyTestName = "Max Mustermann"
@@ -125,6 +127,55 @@ func TestLockUnlockKeys(t *testing.T) {
 	}
 }
 
+func TestLockKeyWithS2K(t *testing.T) {
+	s2kConfig, err := keyTestEC.GetS2KConfig()
+	if err != nil {
+		t.Fatal("Cannot get the S2K of an unlocked key:", err)
+	}
+	assert.Nil(t, s2kConfig)
+
+	lockedKey, err := keyTestEC.Lock(keyTestPassphrase)
+	if err != nil {
+		t.Fatal("Cannot lock key:", err)
+	}
+	s2kConfig, err = lockedKey.GetS2KConfig()
+	if err != nil {
+		t.Fatal("Cannot get the S2K of a locked key:", err)
+	}
+	assert.Exactly(t, NewIteratedSaltedS2KConfig(65536), s2kConfig)
+
+	for _, config := range []*S2KConfig{
+		NewIteratedSaltedS2KConfig(65011712),
+		NewArgon2S2KConfig(1024, 1, 2),
+	} {
+		lockedKey, err = keyTestEC.LockWithS2K(keyTestPassphrase, config)
+		if err != nil {
+			t.Fatal("Cannot lock key:", err)
+		}
+		s2kConfig, err = lockedKey.GetS2KConfig()
+		if err != nil {
+			t.Fatal("Cannot get the S2K of a locked key:", err)
+		}
+		assert.Exactly(t, config, s2kConfig)
+
+		unlockedKey, err := lockedKey.Unlock(keyTestPassphrase)
+		if err != nil {
+			t.Fatal("Cannot unlock key:", err)
+		}
+		unlocked, err := unlockedKey.IsUnlocked()
+		if err != nil {
+			t.Fatal("Cannot check if key is unlocked:", err)
+		}
+		assert.True(t, unlocked)
+	}
+
+	_, err = keyTestEC.LockWithS2K(keyTestPassphrase, &S2KConfig{Mode: constants.S2KSimple})
+	assert.Error(t, err)
+
+	_, err = keyTestEC.LockWithS2K(keyTestPassphrase, NewIteratedSaltedS2KConfig(1024))
+	assert.Error(t, err)
+}
+
 func testLockUnlockKey(t *testing.T, armoredKey string, pass []byte) {
 	var err error
 
@@ -452,3 +503,46 @@ func TestKeyCompression(t *testing.T) {
 		keyTestEC.entity.PrimaryIdentity().SelfSignature.PreferredCompression,
 	)
 }
+
+func TestNewKeyFromArmoredReaderWithSurroundingText(t *testing.T) {
+	armored := readTestFile("keyring_publicKey", false)
+	indented := "My public key:\n\n  " + strings.ReplaceAll(armored, "\n", "\n  ") + "\n\nRegards"
+
+	key, err := NewKeyFromArmoredReader(strings.NewReader(indented))
+	if err != nil {
+		t.Fatal("Expected no error while reading key, got:", err)
+	}
+	expected, err := NewKeyFromArmored(armored)
+	if err != nil {
+		t.Fatal("Expected no error while reading key, got:", err)
+	}
+	assert.Exactly(t, expected.GetFingerprint(), key.GetFingerprint())
+
+	_, err = NewKeyFromArmoredReader(strings.NewReader(
+		"-----BEGIN " + constants.PGPMessageHeader + "-----\n\nZGF0YQ==\n-----END " + constants.PGPMessageHeader + "-----",
+	))
+	assert.NotNil(t, err)
+}
+
+func TestNewKeyFromArmoredChecksum(t *testing.T) {
+	armored := strings.TrimSpace(readTestFile("keyring_publicKey", false))
+	lines := strings.Split(armored, "\n")
+	checksumLine := len(lines) - 2
+	if !strings.HasPrefix(lines[checksumLine], "=") {
+		t.Fatal("Expected a checksum line, got:", lines[checksumLine])
+	}
+
+	// A missing checksum is accepted
+	noChecksum := append(append([]string{}, lines[:checksumLine]...), lines[checksumLine+1:]...)
+	key, err := NewKeyFromArmored(strings.Join(noChecksum, "\n"))
+	if err != nil {
+		t.Fatal("Expected no error while reading key, got:", err)
+	}
+	assert.Exactly(t, keyRingTestPublic.GetKeyIDs()[0], key.GetKeyID())
+
+	// A checksum that does not match is rejected
+	badChecksum := append([]string{}, lines...)
+	badChecksum[checksumLine] = "=AAAA"
+	_, err = NewKeyFromArmored(strings.Join(badChecksum, "\n"))
+	assert.NotNil(t, err)
+}
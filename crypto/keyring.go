@@ -16,6 +16,9 @@ type KeyRing struct {
 
 	// FirstKeyID as obtained from API to match salt
 	FirstKeyID string
+
+	// The instance whose clock and limits are used, nil for the default one.
+	pgp *GopenPGP
 }
 
 // Identity contains the name and the email of a key holder.
@@ -28,7 +31,12 @@ type Identity struct {
 
 // NewKeyRing creates a new KeyRing, empty if key is nil.
 func NewKeyRing(key *Key) (*KeyRing, error) {
-	keyRing := &KeyRing{}
+	return pgp.NewKeyRing(key)
+}
+
+// NewKeyRing creates a new KeyRing bound to the instance, empty if key is nil.
+func (pgp *GopenPGP) NewKeyRing(key *Key) (*KeyRing, error) {
+	keyRing := &KeyRing{pgp: pgp.bound()}
 	var err error
 	if key != nil {
 		err = keyRing.AddKey(key)
@@ -41,7 +49,7 @@ func (keyRing *KeyRing) AddKey(key *Key) error {
 	if key.IsPrivate() {
 		unlocked, err := key.IsUnlocked()
 		if err != nil || !unlocked {
-			return errors.New("gopenpgp: unable to add locked key to a keyring")
+			return newError("gopenpgp: unable to add locked key to a keyring", ErrKeyLocked)
 		}
 	}
 
@@ -49,13 +57,21 @@ func (keyRing *KeyRing) AddKey(key *Key) error {
 	return nil
 }
 
+// getPGP returns the instance the key ring is bound to, the default one for a nil key ring.
+func (keyRing *KeyRing) getPGP() *GopenPGP {
+	if keyRing == nil {
+		return pgp
+	}
+	return keyRing.pgp.orDefault()
+}
+
 // --- Extract keys from keyring
 
 // GetKeys returns openpgp keys contained in this KeyRing.
 func (keyRing *KeyRing) GetKeys() []*Key {
 	keys := make([]*Key, keyRing.CountEntities())
 	for i, entity := range keyRing.entities {
-		keys[i] = &Key{entity}
+		keys[i] = &Key{entity: entity, pgp: keyRing.pgp}
 	}
 	return keys
 }
@@ -65,7 +81,7 @@ func (keyRing *KeyRing) GetKey(n int) (*Key, error) {
 	if n >= keyRing.CountEntities() {
 		return nil, errors.New("gopenpgp: out of bound when fetching key")
 	}
-	return &Key{keyRing.entities[n]}, nil
+	return &Key{entity: keyRing.entities[n], pgp: keyRing.pgp}, nil
 }
 
 // getSigningEntity returns first private unlocked signing entity from keyring.
@@ -82,7 +98,7 @@ func (keyRing *KeyRing) getSigningEntity() (*openpgp.Entity, error) {
 		}
 	}
 	if signEntity == nil {
-		return nil, errors.New("gopenpgp: cannot sign message, unable to unlock signer key")
+		return nil, newError("gopenpgp: cannot sign message, unable to unlock signer key", ErrKeyLocked)
 	}
 
 	return signEntity, nil
@@ -104,12 +120,19 @@ func (keyRing *KeyRing) CountDecryptionEntities() int {
 func (keyRing *KeyRing) GetIdentities() []*Identity {
 	var identities []*Identity
 	for _, e := range keyRing.entities {
-		for _, id := range e.Identities {
-			identities = append(identities, &Identity{
-				Name:  id.UserId.Name,
-				Email: id.UserId.Email,
-			})
-		}
+		identities = append(identities, entityIdentities(e)...)
+	}
+	return identities
+}
+
+// entityIdentities returns the identities of an entity.
+func entityIdentities(e *openpgp.Entity) []*Identity {
+	var identities []*Identity
+	for _, id := range e.Identities {
+		identities = append(identities, &Identity{
+			Name:  id.UserId.Name,
+			Email: id.UserId.Email,
+		})
 	}
 	return identities
 }
@@ -187,7 +210,7 @@ func FilterExpiredKeys(contactKeys []*KeyRing) (filteredKeys []*KeyRing, err err
 	}
 
 	if len(filteredKeys) == 0 && hasExpiredEntity {
-		return filteredKeys, errors.New("gopenpgp: all contacts keys are expired")
+		return filteredKeys, newError("gopenpgp: all contacts keys are expired", ErrKeyExpired)
 	}
 
 	return filteredKeys, nil
@@ -198,7 +221,7 @@ func (keyRing *KeyRing) FirstKey() (*KeyRing, error) {
 	if len(keyRing.entities) == 0 {
 		return nil, errors.New("gopenpgp: No key available in this keyring")
 	}
-	newKeyRing := &KeyRing{}
+	newKeyRing := &KeyRing{pgp: keyRing.pgp}
 	newKeyRing.entities = keyRing.entities[:1]
 
 	return newKeyRing.Copy()
@@ -206,7 +229,7 @@ func (keyRing *KeyRing) FirstKey() (*KeyRing, error) {
 
 // Copy creates a deep copy of the keyring.
 func (keyRing *KeyRing) Copy() (*KeyRing, error) {
-	newKeyRing := &KeyRing{}
+	newKeyRing := &KeyRing{pgp: keyRing.pgp}
 
 	entities := make([]*openpgp.Entity, len(keyRing.entities))
 	for id, entity := range keyRing.entities {
@@ -17,7 +17,7 @@ import (
 // * message    : The plaintext input as a PlainMessage.
 // * privateKey : (optional) an unlocked private keyring to include signature in the message.
 func (keyRing *KeyRing) Encrypt(message *PlainMessage, privateKey *KeyRing) (*PGPMessage, error) {
-	return asymmetricEncrypt(message, keyRing, privateKey, false, nil)
+	return keyRing.getPGP().asymmetricEncrypt(message, keyRing, privateKey, nil)
 }
 
 // EncryptWithContext encrypts a PlainMessage, outputs a PGPMessage.
@@ -26,7 +26,7 @@ func (keyRing *KeyRing) Encrypt(message *PlainMessage, privateKey *KeyRing) (*PG
 // * privateKey : (optional) an unlocked private keyring to include signature in the message.
 // * signingContext : (optional) the context for the signature.
 func (keyRing *KeyRing) EncryptWithContext(message *PlainMessage, privateKey *KeyRing, signingContext *SigningContext) (*PGPMessage, error) {
-	return asymmetricEncrypt(message, keyRing, privateKey, false, signingContext)
+	return keyRing.getPGP().asymmetricEncrypt(message, keyRing, privateKey, &EncryptionOptions{SigningContext: signingContext})
 }
 
 // EncryptWithCompression encrypts with compression support a PlainMessage to PGPMessage using public/private keys.
@@ -34,7 +34,7 @@ func (keyRing *KeyRing) EncryptWithContext(message *PlainMessage, privateKey *Ke
 // * privateKey : (optional) an unlocked private keyring to include signature in the message.
 // * output  : The encrypted data as PGPMessage.
 func (keyRing *KeyRing) EncryptWithCompression(message *PlainMessage, privateKey *KeyRing) (*PGPMessage, error) {
-	return asymmetricEncrypt(message, keyRing, privateKey, true, nil)
+	return keyRing.getPGP().asymmetricEncrypt(message, keyRing, privateKey, &EncryptionOptions{Compress: true})
 }
 
 // EncryptWithContextAndCompression encrypts with compression support a PlainMessage to PGPMessage using public/private keys.
@@ -43,7 +43,34 @@ func (keyRing *KeyRing) EncryptWithCompression(message *PlainMessage, privateKey
 // * signingContext : (optional) the context for the signature.
 // * output  : The encrypted data as PGPMessage.
 func (keyRing *KeyRing) EncryptWithContextAndCompression(message *PlainMessage, privateKey *KeyRing, signingContext *SigningContext) (*PGPMessage, error) {
-	return asymmetricEncrypt(message, keyRing, privateKey, true, signingContext)
+	return keyRing.getPGP().asymmetricEncrypt(message, keyRing, privateKey, &EncryptionOptions{SigningContext: signingContext, Compress: true})
+}
+
+// EncryptWithOptions encrypts a PlainMessage to PGPMessage using public/private keys,
+// with the settings given in options.
+// * message : The plain data as a PlainMessage.
+// * privateKey : (optional) an unlocked private keyring to include signature in the message.
+// * options : (optional) the encryption settings, nil selects the defaults.
+// * output  : The encrypted data as PGPMessage.
+// The Recipients and SigningKeyRing of options are ignored, use
+// EncryptMessageWithOptions to encrypt a message with passwords only.
+func (keyRing *KeyRing) EncryptWithOptions(message *PlainMessage, privateKey *KeyRing, options *EncryptionOptions) (*PGPMessage, error) {
+	return keyRing.getPGP().asymmetricEncrypt(message, keyRing, privateKey, options)
+}
+
+// EncryptMessageWithOptions encrypts a PlainMessage to PGPMessage for the
+// recipients and the passwords given in options.
+// * message : The plain data as a PlainMessage.
+// * options : The encryption settings, with Recipients or Passwords.
+// * output  : The encrypted data as PGPMessage.
+func EncryptMessageWithOptions(message *PlainMessage, options *EncryptionOptions) (*PGPMessage, error) {
+	return pgp.EncryptMessageWithOptions(message, options)
+}
+
+// EncryptMessageWithOptions encrypts a PlainMessage to PGPMessage for the
+// recipients and the passwords given in options, using the clock of the instance.
+func (pgp *GopenPGP) EncryptMessageWithOptions(message *PlainMessage, options *EncryptionOptions) (*PGPMessage, error) {
+	return pgp.asymmetricEncrypt(message, options.recipients(), options.signingKeyRing(), options)
 }
 
 // Decrypt decrypts encrypted string using pgp keys, returning a PlainMessage
@@ -57,7 +84,7 @@ func (keyRing *KeyRing) EncryptWithContextAndCompression(message *PlainMessage,
 func (keyRing *KeyRing) Decrypt(
 	message *PGPMessage, verifyKey *KeyRing, verifyTime int64,
 ) (*PlainMessage, error) {
-	return asymmetricDecrypt(message.NewReader(), keyRing, verifyKey, verifyTime, nil)
+	return keyRing.getPGP().asymmetricDecrypt(message.NewReader(), keyRing, nil, verifyKey, verifyTime, nil, "")
 }
 
 // DecryptWithContext decrypts encrypted string using pgp keys, returning a PlainMessage
@@ -74,7 +101,7 @@ func (keyRing *KeyRing) DecryptWithContext(
 	verifyTime int64,
 	verificationContext *VerificationContext,
 ) (*PlainMessage, error) {
-	return asymmetricDecrypt(message.NewReader(), keyRing, verifyKey, verifyTime, verificationContext)
+	return keyRing.getPGP().asymmetricDecrypt(message.NewReader(), keyRing, nil, verifyKey, verifyTime, verificationContext, "")
 }
 
 // SignDetached generates and returns a PGPSignature for a given PlainMessage.
@@ -91,9 +118,17 @@ func (keyRing *KeyRing) SignDetachedWithContext(message *PlainMessage, context *
 		message.NewReader(),
 		message.IsBinary(),
 		context,
+		nil,
 	)
 }
 
+// SignDetachedWithTestingSources generates and returns a PGPSignature for a
+// given PlainMessage, reading the randomness and time from sources.
+// TESTING ONLY, see TestingSources.
+func (keyRing *KeyRing) SignDetachedWithTestingSources(message *PlainMessage, sources *TestingSources) (*PGPSignature, error) {
+	return signMessageDetached(keyRing, message.NewReader(), message.IsBinary(), nil, sources)
+}
+
 // VerifyDetached verifies a PlainMessage with a detached PGPSignature
 // and returns a SignatureVerificationError if fails.
 func (keyRing *KeyRing) VerifyDetached(message *PlainMessage, signature *PGPSignature, verifyTime int64) error {
@@ -103,6 +138,7 @@ func (keyRing *KeyRing) VerifyDetached(message *PlainMessage, signature *PGPSign
 		signature.GetBinary(),
 		verifyTime,
 		nil,
+		"",
 	)
 	return err
 }
@@ -118,6 +154,26 @@ func (keyRing *KeyRing) VerifyDetachedWithContext(message *PlainMessage, signatu
 		signature.GetBinary(),
 		verifyTime,
 		verificationContext,
+		"",
+	)
+	return err
+}
+
+// VerifyDetachedWithSigner verifies a PlainMessage with a detached PGPSignature
+// as VerifyDetached, and checks that an identity of the signing key has the
+// expected email address. On a mismatch, it returns a SignatureVerificationError
+// with status constants.SIGNATURE_BAD_SIGNER.
+// * expectedSigner : the email address of the signer, or an RFC 5322 address such as a From header.
+func (keyRing *KeyRing) VerifyDetachedWithSigner(
+	message *PlainMessage, signature *PGPSignature, verifyTime int64, expectedSigner string,
+) error {
+	_, err := verifySignature(
+		keyRing.entities,
+		message.NewReader(),
+		signature.GetBinary(),
+		verifyTime,
+		nil,
+		expectedSigner,
 	)
 	return err
 }
@@ -162,6 +218,7 @@ func (keyRing *KeyRing) GetVerifiedSignatureTimestamp(message *PlainMessage, sig
 		signature.GetBinary(),
 		verifyTime,
 		nil,
+		"",
 	)
 	if err != nil {
 		return 0, err
@@ -186,6 +243,7 @@ func (keyRing *KeyRing) GetVerifiedSignatureTimestampWithContext(
 		signature.GetBinary(),
 		verifyTime,
 		verificationContext,
+		"",
 	)
 	if err != nil {
 		return 0, err
@@ -196,11 +254,10 @@ func (keyRing *KeyRing) GetVerifiedSignatureTimestampWithContext(
 // ------ INTERNAL FUNCTIONS -------
 
 // Core for encryption+signature (non-streaming) functions.
-func asymmetricEncrypt(
+func (pgp *GopenPGP) asymmetricEncrypt(
 	plainMessage *PlainMessage,
 	publicKey, privateKey *KeyRing,
-	compress bool,
-	signingContext *SigningContext,
+	options *EncryptionOptions,
 ) (*PGPMessage, error) {
 	var outBuf bytes.Buffer
 	var encryptWriter io.WriteCloser
@@ -212,7 +269,7 @@ func asymmetricEncrypt(
 		ModTime:  plainMessage.getFormattedTime(),
 	}
 
-	encryptWriter, err = asymmetricEncryptStream(hints, &outBuf, &outBuf, publicKey, privateKey, compress, signingContext)
+	encryptWriter, err = pgp.asymmetricEncryptStream(hints, &outBuf, &outBuf, publicKey, privateKey, options)
 	if err != nil {
 		return nil, err
 	}
@@ -231,28 +288,44 @@ func asymmetricEncrypt(
 }
 
 // Core for encryption+signature (all) functions.
-func asymmetricEncryptStream(
+func (pgp *GopenPGP) asymmetricEncryptStream(
 	hints *openpgp.FileHints,
 	keyPacketWriter io.Writer,
 	dataPacketWriter io.Writer,
 	publicKey, privateKey *KeyRing,
-	compress bool,
-	signingContext *SigningContext,
+	options *EncryptionOptions,
 ) (encryptWriter io.WriteCloser, err error) {
+	pgp = pgp.withTestingSources(options.testingSources())
+	if progress := newProgressTracker(options.progress()); progress != nil {
+		keyPacketWriter = &progressWriter{keyPacketWriter, progress.addCiphertext}
+		dataPacketWriter = &progressWriter{dataPacketWriter, progress.addCiphertext}
+		progress.setPhase(constants.ProgressKeyPacketEncryption)
+		defer func() {
+			if err == nil {
+				progress.setPhase(constants.ProgressBodyEncryption)
+				encryptWriter = &progressWriteCloser{encryptWriter, progress}
+			}
+		}()
+	}
+
 	config := &packet.Config{
 		DefaultCipher: packet.CipherAES256,
-		Time:          getTimeGenerator(),
+		Time:          pgp.getTimeGenerator(),
+		Rand:          pgp.rand,
 	}
 
-	if compress {
-		config.DefaultCompressionAlgo = constants.DefaultCompression
-		config.CompressionConfig = &packet.CompressionConfig{Level: constants.DefaultCompressionLevel}
+	if err := options.compression().setPacketConfig(config); err != nil {
+		return nil, err
 	}
 
-	if signingContext != nil {
+	if signingContext := options.signingContext(); signingContext != nil {
 		config.SignatureNotations = append(config.SignatureNotations, signingContext.getNotation())
 	}
 
+	if options.aead() {
+		config.AEADConfig = &packet.AEADConfig{}
+	}
+
 	var signEntity *openpgp.Entity
 	if privateKey != nil && len(privateKey.entities) > 0 {
 		var err error
@@ -262,31 +335,218 @@ func asymmetricEncryptStream(
 		}
 	}
 
+	if publicKey == nil || signEntity != nil || options.hideRecipients() || len(options.passwords()) > 0 ||
+		options.compression().skipCompressedData() || options.encryptionState() != nil || options.aead() {
+		return pgp.asymmetricEncryptSessionKeyStream(
+			hints, keyPacketWriter, dataPacketWriter, publicKey, signEntity, options, config,
+		)
+	}
+
 	if hints.IsBinary {
-		encryptWriter, err = openpgp.EncryptSplit(keyPacketWriter, dataPacketWriter, publicKey.entities, signEntity, hints, config)
+		encryptWriter, err = openpgp.EncryptSplit(keyPacketWriter, dataPacketWriter, publicKey.entities, nil, hints, config)
 	} else {
-		encryptWriter, err = openpgp.EncryptTextSplit(keyPacketWriter, dataPacketWriter, publicKey.entities, signEntity, hints, config)
+		encryptWriter, err = openpgp.EncryptTextSplit(keyPacketWriter, dataPacketWriter, publicKey.entities, nil, hints, config)
 	}
 	if err != nil {
-		return nil, errors.Wrap(err, "gopenpgp: error in encrypting asymmetrically")
+		return nil, wrapError(err, "gopenpgp: error in encrypting asymmetrically", pgp.encryptionKeyCategories(publicKey.entities)...)
 	}
 	return encryptWriter, nil
 }
 
+// asymmetricEncryptSessionKeyStream generates a session key, writes it
+// encrypted to every recipient key and password, and encrypts the message with it.
+// If signEntity is not nil the message is also signed, and the signature embeds
+// an Intended Recipient Fingerprint subpacket for every recipient key, to prevent
+// the message from being surreptitiously forwarded. The subpackets are omitted
+// if the recipients are hidden, as they would reveal them.
+func (pgp *GopenPGP) asymmetricEncryptSessionKeyStream(
+	hints *openpgp.FileHints,
+	keyPacketWriter io.Writer,
+	dataPacketWriter io.Writer,
+	publicKey *KeyRing,
+	signEntity *openpgp.Entity,
+	options *EncryptionOptions,
+	config *packet.Config,
+) (encryptWriter io.WriteCloser, err error) {
+	hasKeys := publicKey != nil && len(publicKey.entities) > 0
+	if !hasKeys && len(options.passwords()) == 0 {
+		return nil, errors.New("gopenpgp: no encryption recipient provided")
+	}
+
+	if hasKeys {
+		config = negotiateRecipientsConfig(publicKey.entities, config)
+	}
+
+	sk, err := pgp.GenerateSessionKeyAlgo(getAlgo(config.Cipher()))
+	if err != nil {
+		return nil, err
+	}
+	state := options.encryptionState()
+	if state != nil {
+		state.sessionKey = sk
+	}
+
+	if hasKeys {
+		keyPacket, err := publicKey.encryptSessionKey(pgp, sk, options.hideRecipients(), config.AEAD() != nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "gopenpgp: error in encrypting asymmetrically")
+		}
+		if _, err = keyPacketWriter.Write(keyPacket); err != nil {
+			return nil, errors.Wrap(err, "gopenpgp: error in writing key packets")
+		}
+	}
+
+	for _, password := range options.passwords() {
+		keyPacket, err := encryptSessionKeyWithPassword(sk, password, options.s2kConfig(), config.AEAD())
+		if err != nil {
+			return nil, err
+		}
+		if _, err = keyPacketWriter.Write(keyPacket); err != nil {
+			return nil, errors.Wrap(err, "gopenpgp: error in writing key packets")
+		}
+	}
+
+	var modTime uint32
+	if !hints.ModTime.IsZero() {
+		modTime = uint32(hints.ModTime.Unix())
+	}
+
+	var intendedRecipients openpgp.EntityList
+	if hasKeys && !options.hideRecipients() {
+		intendedRecipients = publicKey.entities
+	}
+
+	dataWriter, signWriter, err := encryptStreamWithSessionKeyAndConfig(
+		hints.IsBinary,
+		hints.FileName,
+		modTime,
+		dataPacketWriter,
+		sk,
+		signEntity,
+		intendedRecipients,
+		config,
+		options.compression().skipCompressedData(),
+		options.workers(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if state != nil {
+		state.serializer = dataWriter
+	}
+	if signWriter == nil {
+		return dataWriter, nil
+	}
+	return &signAndEncryptWriteCloser{signWriter, dataWriter}, nil
+}
+
+// negotiatedCiphers and negotiatedCipherSuites are the algorithms which
+// openpgp.EncryptSplit negotiates with the recipients, in order of preference.
+var (
+	negotiatedCiphers = []uint8{
+		uint8(packet.CipherAES256),
+		uint8(packet.CipherAES128),
+	}
+	negotiatedCipherSuites = [][2]uint8{
+		{uint8(packet.CipherAES256), uint8(packet.AEADModeGCM)},
+		{uint8(packet.CipherAES256), uint8(packet.AEADModeEAX)},
+		{uint8(packet.CipherAES256), uint8(packet.AEADModeOCB)},
+		{uint8(packet.CipherAES128), uint8(packet.AEADModeGCM)},
+		{uint8(packet.CipherAES128), uint8(packet.AEADModeEAX)},
+		{uint8(packet.CipherAES128), uint8(packet.AEADModeOCB)},
+	}
+)
+
+// negotiateRecipientsConfig returns a copy of config with the cipher and the
+// AEAD mode negotiated with the preferences of the recipients, as
+// openpgp.EncryptSplit does: the configured cipher is kept if every recipient
+// supports it, and AEAD is only used if it is configured and every recipient
+// supports it.
+func negotiateRecipientsConfig(recipients openpgp.EntityList, config *packet.Config) *packet.Config {
+	ciphers := append([]uint8(nil), negotiatedCiphers...)
+	cipherSuites := append([][2]uint8(nil), negotiatedCipherSuites...)
+	aeadSupported := config.AEAD() != nil
+	for _, recipient := range recipients {
+		selfSignature, _ := recipient.PrimarySelfSignature()
+		if selfSignature == nil {
+			selfSignature = &packet.Signature{}
+		}
+		if !selfSignature.SEIPDv2 {
+			aeadSupported = false
+		}
+		ciphers = intersectPreferences(ciphers, selfSignature.PreferredSymmetric)
+		cipherSuites = intersectCipherSuites(cipherSuites, selfSignature.PreferredCipherSuites)
+	}
+	// Without common preference, use the algorithms every implementation supports
+	if len(ciphers) == 0 {
+		ciphers = []uint8{uint8(packet.CipherAES128)}
+	}
+	if len(cipherSuites) == 0 {
+		cipherSuites = [][2]uint8{{uint8(packet.CipherAES128), uint8(packet.AEADModeOCB)}}
+	}
+
+	negotiated := *config
+	negotiated.DefaultCipher = packet.CipherFunction(ciphers[0])
+	for _, cipher := range ciphers {
+		if packet.CipherFunction(cipher) == config.Cipher() {
+			negotiated.DefaultCipher = config.Cipher()
+			break
+		}
+	}
+	negotiated.AEADConfig = nil
+	if aeadSupported {
+		aeadConfig := *config.AEAD()
+		aeadConfig.DefaultMode = packet.AEADMode(cipherSuites[0][1])
+		negotiated.AEADConfig = &aeadConfig
+		negotiated.DefaultCipher = packet.CipherFunction(cipherSuites[0][0])
+	}
+	return &negotiated
+}
+
+func intersectPreferences(candidates []uint8, preferences []uint8) []uint8 {
+	var intersection []uint8
+	for _, candidate := range candidates {
+		for _, preference := range preferences {
+			if candidate == preference {
+				intersection = append(intersection, candidate)
+				break
+			}
+		}
+	}
+	return intersection
+}
+
+func intersectCipherSuites(candidates [][2]uint8, preferences [][2]uint8) [][2]uint8 {
+	var intersection [][2]uint8
+	for _, candidate := range candidates {
+		for _, preference := range preferences {
+			if candidate == preference {
+				intersection = append(intersection, candidate)
+				break
+			}
+		}
+	}
+	return intersection
+}
+
 // Core for decryption+verification (non streaming) functions.
-func asymmetricDecrypt(
+func (pgp *GopenPGP) asymmetricDecrypt(
 	encryptedIO io.Reader,
 	privateKey *KeyRing,
+	password []byte,
 	verifyKey *KeyRing,
 	verifyTime int64,
 	verificationContext *VerificationContext,
+	expectedSigner string,
 ) (message *PlainMessage, err error) {
-	messageDetails, err := asymmetricDecryptStream(
+	messageDetails, err := pgp.asymmetricDecryptStream(
 		encryptedIO,
 		privateKey,
+		password,
 		verifyKey,
 		verifyTime,
 		verificationContext,
+		pgp.getInMemoryDecryptionLimits(),
 	)
 	if err != nil {
 		return nil, err
@@ -294,12 +554,12 @@ func asymmetricDecrypt(
 
 	body, err := ioutil.ReadAll(messageDetails.UnverifiedBody)
 	if err != nil {
-		return nil, errors.Wrap(err, "gopenpgp: error in reading message body")
+		return nil, wrapError(err, "gopenpgp: error in reading message body")
 	}
 
 	if verifyKey != nil {
 		processSignatureExpiration(messageDetails, verifyTime)
-		err = verifyDetailsSignature(messageDetails, verifyKey, verificationContext)
+		err = verifyDetailsSignature(messageDetails, verifyKey, verificationContext, expectedSigner)
 	}
 
 	return &PlainMessage{
@@ -311,22 +571,42 @@ func asymmetricDecrypt(
 }
 
 // Core for decryption+verification (all) functions.
-func asymmetricDecryptStream(
+func (pgp *GopenPGP) asymmetricDecryptStream(
 	encryptedIO io.Reader,
 	privateKey *KeyRing,
+	password []byte,
 	verifyKey *KeyRing,
 	verifyTime int64,
 	verificationContext *VerificationContext,
+	limits DecryptionLimits,
 ) (messageDetails *openpgp.MessageDetails, err error) {
-	privKeyEntries := privateKey.entities
-	var additionalEntries openpgp.EntityList
+	var privKeyEntries openpgp.EntityList
+	if privateKey != nil {
+		privKeyEntries = privateKey.entities
+	}
 
 	if verifyKey != nil {
-		additionalEntries = verifyKey.entities
+		// Limit the capacity, so that append does not write into the key ring
+		privKeyEntries = append(privKeyEntries[:len(privKeyEntries):len(privKeyEntries)], verifyKey.entities...)
 	}
 
-	if additionalEntries != nil {
-		privKeyEntries = append(privKeyEntries, additionalEntries...)
+	var prompt openpgp.PromptFunction
+	if password != nil {
+		promptCalled := false
+		prompt = func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+			const message = "gopenpgp: unable to decrypt message with the given keys or password"
+			if promptCalled {
+				return nil, newError(message, ErrWrongPassword)
+			}
+			if !symmetric {
+				if len(keys) > 0 {
+					return nil, newError(message, ErrNoDecryptionKey, ErrKeyLocked)
+				}
+				return nil, newError(message, ErrNoDecryptionKey)
+			}
+			promptCalled = true
+			return password, nil
+		}
 	}
 
 	config := &packet.Config{
@@ -337,7 +617,7 @@ func asymmetricDecryptStream(
 					but the caller will remove signature expiration errors later on.
 					See processSignatureExpiration().
 				*/
-				return getNow()
+				return pgp.getNow()
 			}
 			return time.Unix(verifyTime, 0)
 		},
@@ -349,9 +629,13 @@ func asymmetricDecryptStream(
 		config.KnownNotations = map[string]bool{constants.SignatureContextName: true}
 	}
 
-	messageDetails, err = openpgp.ReadMessage(encryptedIO, privKeyEntries, nil, config)
+	messageDetails, err = readMessage(encryptedIO, privKeyEntries, prompt, config, limits)
 	if err != nil {
-		return nil, errors.Wrap(err, "gopenpgp: error in reading message")
+		if errors.Is(err, io.EOF) {
+			// The message ends before the data packet
+			return nil, wrapError(err, "gopenpgp: error in reading message", ErrTruncatedInput)
+		}
+		return nil, wrapError(err, "gopenpgp: error in reading message")
 	}
 	return messageDetails, err
 }
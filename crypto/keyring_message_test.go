@@ -1,10 +1,16 @@
 package crypto
 
 import (
+	"bytes"
+	"errors"
 	"io/ioutil"
 	"testing"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/angel-one/gopenpgp/v2/constants"
 )
 
 func TestAEADKeyRingDecryption(t *testing.T) {
@@ -78,3 +84,265 @@ func TestTextMessageEncryptionWithSignatureAndContextAndCompression(t *testing.T
 	}
 	assert.Exactly(t, message.GetString(), decrypted.GetString())
 }
+
+func TestMessageEncryptionWithIntendedRecipients(t *testing.T) {
+	var message = NewPlainMessageFromString("plain text")
+
+	ciphertext, err := keyRingTestPublic.Encrypt(message, keyRingTestPrivate)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+
+	decrypted, err := keyRingTestPrivate.Decrypt(ciphertext, keyRingTestPublic, GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, message.GetString(), decrypted.GetString())
+
+	reader, err := keyRingTestPrivate.DecryptStream(ciphertext.NewReader(), keyRingTestPublic, GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error when decrypting stream, got:", err)
+	}
+	if _, err = ioutil.ReadAll(reader); err != nil {
+		t.Fatal("Expected no error when reading the stream, got:", err)
+	}
+	if err = reader.VerifySignature(); err != nil {
+		t.Fatal("Expected no error when verifying, got:", err)
+	}
+}
+
+func TestMessageForwardedToUnintendedRecipient(t *testing.T) {
+	var message = NewPlainMessageFromString("plain text")
+
+	ciphertext, err := keyRingTestPublic.Encrypt(message, keyRingTestPrivate)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+
+	split, err := ciphertext.SplitMessage()
+	if err != nil {
+		t.Fatal("Expected no error when splitting, got:", err)
+	}
+	sessionKey, err := keyRingTestPrivate.DecryptSessionKey(split.GetBinaryKeyPacket())
+	if err != nil {
+		t.Fatal("Expected no error when decrypting the session key, got:", err)
+	}
+
+	forwardKeyRing, err := NewKeyRing(keyTestEC)
+	if err != nil {
+		t.Fatal("Expected no error when creating the keyring, got:", err)
+	}
+	forwardKeyPacket, err := forwardKeyRing.EncryptSessionKey(sessionKey)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting the session key, got:", err)
+	}
+	forwarded := NewPGPSplitMessage(forwardKeyPacket, split.GetBinaryDataPacket()).GetPGPMessage()
+
+	decrypted, err := forwardKeyRing.Decrypt(forwarded, keyRingTestPublic, GetUnixTime())
+	var sigErr SignatureVerificationError
+	if !errors.As(err, &sigErr) {
+		t.Fatal("Expected a signature verification error, got:", err)
+	}
+	assert.Exactly(t, constants.SIGNATURE_BAD_RECIPIENT, sigErr.Status)
+	assert.Exactly(t, message.GetString(), decrypted.GetString())
+}
+
+func TestMessageEncryptionWithHiddenRecipients(t *testing.T) {
+	var message = NewPlainMessageFromString("plain text")
+
+	ciphertext, err := keyRingTestPublic.EncryptWithOptions(
+		message,
+		keyRingTestPrivate,
+		&EncryptionOptions{HideRecipients: true},
+	)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+
+	keyIDs, ok := ciphertext.GetEncryptionKeyIDs()
+	assert.True(t, ok)
+	assert.Exactly(t, []uint64{0}, keyIDs)
+
+	decrypted, err := keyRingTestMultiple.Decrypt(ciphertext, keyRingTestPublic, GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, message.GetString(), decrypted.GetString())
+
+	reader, err := keyRingTestMultiple.DecryptStream(ciphertext.NewReader(), keyRingTestPublic, GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error when decrypting stream, got:", err)
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal("Expected no error when reading the stream, got:", err)
+	}
+	assert.Exactly(t, message.GetString(), string(data))
+	if err = reader.VerifySignature(); err != nil {
+		t.Fatal("Expected no error when verifying, got:", err)
+	}
+
+	_, err = keyRingTestPublic.Decrypt(ciphertext, nil, 0)
+	assert.Error(t, err)
+}
+
+func TestMessageDecryptionTrialDecryptionLimit(t *testing.T) {
+	var message = NewPlainMessageFromString("plain text")
+	options := &EncryptionOptions{HideRecipients: true}
+
+	ciphertext, err := keyRingTestPublic.EncryptWithOptions(message, nil, options)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	split, err := ciphertext.SplitMessage()
+	if err != nil {
+		t.Fatal("Expected no error when splitting, got:", err)
+	}
+	sessionKey, err := keyRingTestPrivate.DecryptSessionKey(split.GetBinaryKeyPacket())
+	if err != nil {
+		t.Fatal("Expected no error when decrypting the session key, got:", err)
+	}
+
+	decoyKey, err := GenerateKey("decoy", "decoy@example.com", "x25519", 0)
+	if err != nil {
+		t.Fatal("Expected no error when generating the key, got:", err)
+	}
+	decoyKeyRing, err := NewKeyRing(decoyKey)
+	if err != nil {
+		t.Fatal("Expected no error when creating the keyring, got:", err)
+	}
+
+	// Each wildcard packet costs a trial decryption per key of keyRingTestMultiple
+	var keyPackets []byte
+	for i := 0; i <= constants.DefaultMaxTrialDecryptions/len(keyRingTestMultiple.entities); i++ {
+		decoy, err := decoyKeyRing.EncryptSessionKeyWithOptions(sessionKey, options)
+		if err != nil {
+			t.Fatal("Expected no error when encrypting the session key, got:", err)
+		}
+		keyPackets = append(keyPackets, decoy...)
+	}
+	keyPackets = append(keyPackets, split.GetBinaryKeyPacket()...)
+
+	_, err = keyRingTestPrivate.DecryptSessionKey(keyPackets)
+	assert.NoError(t, err)
+
+	_, err = keyRingTestMultiple.DecryptSessionKey(keyPackets)
+	var limitErr DecryptionLimitError
+	assert.True(t, errors.As(err, &limitErr))
+	assert.Exactly(t, "MaxTrialDecryptions", limitErr.Limit)
+
+	tooManyTrials := NewPGPSplitMessage(keyPackets, split.GetBinaryDataPacket()).GetPGPMessage()
+	_, err = keyRingTestMultiple.Decrypt(tooManyTrials, nil, 0)
+	assert.True(t, errors.As(err, &limitErr))
+	assert.Exactly(t, "MaxTrialDecryptions", limitErr.Limit)
+}
+
+func TestSignedEncryptionNegotiatesRecipientCipher(t *testing.T) {
+	key, err := GenerateKey(keyTestName, keyTestDomain, "x25519", 0)
+	if err != nil {
+		t.Fatal("Expected no error when generating key, got:", err)
+	}
+	key.entity.PrimaryIdentity().SelfSignature.PreferredSymmetric = []uint8{uint8(packet.CipherAES128)}
+	keyRing, err := NewKeyRing(key)
+	if err != nil {
+		t.Fatal("Expected no error when creating the keyring, got:", err)
+	}
+
+	for _, signKeyRing := range []*KeyRing{nil, keyRingTestPrivate} {
+		ciphertext, err := keyRing.Encrypt(NewPlainMessageFromString("plain text"), signKeyRing)
+		if err != nil {
+			t.Fatal("Expected no error when encrypting, got:", err)
+		}
+		split, err := ciphertext.SplitMessage()
+		if err != nil {
+			t.Fatal("Expected no error when splitting, got:", err)
+		}
+		sessionKey, err := keyRing.DecryptSessionKey(split.GetBinaryKeyPacket())
+		if err != nil {
+			t.Fatal("Expected no error when decrypting the session key, got:", err)
+		}
+		assert.Exactly(t, constants.AES128, sessionKey.Algo)
+	}
+}
+
+func TestSignedEncryptionWithV6SigningKey(t *testing.T) {
+	entity, err := openpgp.NewEntity(keyTestName, "", keyTestDomain, &packet.Config{
+		V6Keys:    true,
+		Algorithm: packet.PubKeyAlgoEd25519,
+		Time:      pgp.getTimeGenerator(),
+	})
+	if err != nil {
+		t.Fatal("Expected no error when generating key, got:", err)
+	}
+	signKeyRing, err := NewKeyRing(&Key{entity: entity})
+	if err != nil {
+		t.Fatal("Expected no error when creating the keyring, got:", err)
+	}
+
+	var message = NewPlainMessageFromString("plain text")
+	ciphertext, err := keyRingTestPublic.Encrypt(message, signKeyRing)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+
+	decrypted, err := keyRingTestPrivate.Decrypt(ciphertext, signKeyRing, GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, message.GetString(), decrypted.GetString())
+
+	keys := append(openpgp.EntityList{entity}, keyRingTestPrivate.entities...)
+	md, err := openpgp.ReadMessage(ciphertext.NewReader(), keys, nil, nil)
+	if err != nil {
+		t.Fatal("Expected no error when reading the message, got:", err)
+	}
+	if _, err = ioutil.ReadAll(md.UnverifiedBody); err != nil {
+		t.Fatal("Expected no error when reading the message body, got:", err)
+	}
+	if md.Signature == nil {
+		t.Fatal("Expected a signature, got:", md.SignatureError)
+	}
+	assert.Exactly(t, 6, md.Signature.Version)
+	if len(md.Signature.IntendedRecipients) != 1 {
+		t.Fatal("Expected one intended recipient, got:", len(md.Signature.IntendedRecipients))
+	}
+	assert.Exactly(
+		t,
+		keyRingTestPublic.entities[0].PrimaryKey.Fingerprint,
+		md.Signature.IntendedRecipients[0].Fingerprint,
+	)
+}
+
+func TestDecryptSessionKeyWithUnknownKeyID(t *testing.T) {
+	sessionKey, err := GenerateSessionKey()
+	if err != nil {
+		t.Fatal("Expected no error when generating the session key, got:", err)
+	}
+	encryptionKey, ok := keyRingTestPublic.entities[0].EncryptionKey(pgp.getNow())
+	if !ok {
+		t.Fatal("Expected an encryption key")
+	}
+	publicKey := *encryptionKey.PublicKey
+	publicKey.KeyId = 0x1234
+
+	var keyPackets bytes.Buffer
+	// A packet for another key must not stop the fallback
+	otherKeyRing, err := NewKeyRing(keyTestEC)
+	if err != nil {
+		t.Fatal("Expected no error when creating the keyring, got:", err)
+	}
+	otherKeyPacket, err := otherKeyRing.EncryptSessionKey(sessionKey)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting the session key, got:", err)
+	}
+	keyPackets.Write(otherKeyPacket)
+	if err = packet.SerializeEncryptedKey(&keyPackets, &publicKey, packet.CipherAES256, sessionKey.Key, nil); err != nil {
+		t.Fatal("Expected no error when encrypting the session key, got:", err)
+	}
+
+	decrypted, err := keyRingTestPrivate.DecryptSessionKey(keyPackets.Bytes())
+	if err != nil {
+		t.Fatal("Expected no error when decrypting the session key, got:", err)
+	}
+	assert.Exactly(t, sessionKey.Key, decrypted.Key)
+}
@@ -2,14 +2,19 @@ package crypto
 
 import (
 	"bytes"
+	"math"
 	"strconv"
 
 	"github.com/pkg/errors"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/ProtonMail/go-crypto/openpgp/packet"
 )
 
 // DecryptSessionKey returns the decrypted session key from one or multiple binary encrypted session key packets.
+// The session key packets are first tried with the decryption keys matching their key ID, or with every
+// decryption key for a wildcard key ID. If none of them can be decrypted, the packets whose key ID matches
+// no decryption key, e.g. a stale one, are tried with every decryption key, as if their key ID was a wildcard.
 func (keyRing *KeyRing) DecryptSessionKey(keyPacket []byte) (*SessionKey, error) {
 	var p packet.Packet
 	var ek *packet.EncryptedKey
@@ -17,9 +22,13 @@ func (keyRing *KeyRing) DecryptSessionKey(keyPacket []byte) (*SessionKey, error)
 	var err error
 	var hasPacket = false
 	var decryptErr error
+	var skippedLockedKey bool
+	var unmatchedPackets []*packet.EncryptedKey
 
 	keyReader := bytes.NewReader(keyPacket)
 	packets := packet.NewReader(keyReader)
+	maxTrials := keyRing.getPGP().getDecryptionLimits().MaxTrialDecryptions
+	keys := newTrialDecryptionKeyRing(keyRing.entities, maxTrials)
 
 Loop:
 	for {
@@ -30,19 +39,28 @@ Loop:
 		switch p := p.(type) {
 		case *packet.EncryptedKey:
 			hasPacket = true
-			ek = p
 
-			for _, key := range keyRing.entities.DecryptionKeys() {
-				priv := key.PrivateKey
-				if priv.Encrypted {
-					continue
+			var candidates []openpgp.Key
+			if p.KeyId == 0 {
+				candidates = keys.DecryptionKeys()
+			} else {
+				for _, key := range keyRing.entities.DecryptionKeys() {
+					if key.PublicKey.KeyId == p.KeyId {
+						candidates = append(candidates, key)
+					}
 				}
-
-				if decryptErr = ek.Decrypt(priv, nil); decryptErr == nil {
-					break Loop
+				if len(candidates) == 0 {
+					unmatchedPackets = append(unmatchedPackets, p)
+					continue Loop
 				}
 			}
 
+			var decrypted bool
+			if decrypted, decryptErr = decryptEncryptedKey(p, candidates, &skippedLockedKey); decrypted {
+				ek = p
+				break Loop
+			}
+
 		case *packet.SymmetricallyEncrypted,
 			*packet.AEADEncrypted,
 			*packet.Compressed,
@@ -54,28 +72,89 @@ Loop:
 		}
 	}
 
+	if ek == nil && len(unmatchedPackets) > 0 {
+		// The trial decryption keys are unlocked, but a locked key could have matched
+		for _, key := range keyRing.entities.DecryptionKeys() {
+			skippedLockedKey = skippedLockedKey || (key.PrivateKey != nil && key.PrivateKey.Encrypted)
+		}
+	}
+	for _, p := range unmatchedPackets {
+		if ek != nil {
+			break
+		}
+		// The key ID is stale or wrong, try the packet as a wildcard one
+		p.KeyId = 0
+		var decrypted bool
+		if decrypted, decryptErr = decryptEncryptedKey(p, keys.DecryptionKeys(), &skippedLockedKey); decrypted {
+			ek = p
+		}
+	}
+
 	if !hasPacket {
 		if err != nil {
-			return nil, errors.Wrap(err, "gopenpgp: couldn't find a session key packet")
+			return nil, wrapError(err, "gopenpgp: couldn't find a session key packet")
 		} else {
 			return nil, errors.New("gopenpgp: couldn't find a session key packet")
 		}
 	}
 
-	if decryptErr != nil {
-		return nil, errors.Wrap(decryptErr, "gopenpgp: error in decrypting")
+	if ek == nil && keys.exhausted {
+		return nil, errors.Wrap(
+			DecryptionLimitError{Limit: "MaxTrialDecryptions", Max: int64(maxTrials)},
+			"gopenpgp: unable to decrypt session key",
+		)
 	}
 
-	if ek == nil || ek.Key == nil {
-		return nil, errors.New("gopenpgp: unable to decrypt session key: no valid decryption key")
+	if ek == nil && decryptErr != nil {
+		return nil, wrapError(decryptErr, "gopenpgp: error in decrypting", ErrNoDecryptionKey)
 	}
 
-	return newSessionKeyFromEncrypted(ek)
+	if ek == nil {
+		if skippedLockedKey {
+			return nil, newError("gopenpgp: unable to decrypt session key: no valid decryption key", ErrNoDecryptionKey, ErrKeyLocked)
+		}
+		return nil, newError("gopenpgp: unable to decrypt session key: no valid decryption key", ErrNoDecryptionKey)
+	}
+
+	return keyRing.getPGP().newSessionKeyFromEncrypted(ek)
+}
+
+// decryptEncryptedKey tries to decrypt a session key packet with each of the
+// candidate keys, and returns whether it succeeded, or the error of the last
+// attempt of this packet.
+func decryptEncryptedKey(ek *packet.EncryptedKey, candidates []openpgp.Key, skippedLockedKey *bool) (bool, error) {
+	var decryptErr error
+	for _, key := range candidates {
+		priv := key.PrivateKey
+		if priv == nil || priv.Encrypted {
+			*skippedLockedKey = *skippedLockedKey || priv != nil
+			continue
+		}
+
+		if decryptErr = ek.Decrypt(priv, nil); decryptErr == nil {
+			return true, nil
+		}
+	}
+	return false, decryptErr
 }
 
 // EncryptSessionKey encrypts the session key with the unarmored
 // publicKey and returns a binary public-key encrypted session key packet.
 func (keyRing *KeyRing) EncryptSessionKey(sk *SessionKey) ([]byte, error) {
+	return keyRing.encryptSessionKey(keyRing.getPGP(), sk, false, false)
+}
+
+// EncryptSessionKeyWithOptions encrypts the session key with the unarmored
+// publicKey and returns a binary public-key encrypted session key packet.
+// Only the HideRecipients setting of options is taken into account.
+func (keyRing *KeyRing) EncryptSessionKeyWithOptions(sk *SessionKey, options *EncryptionOptions) ([]byte, error) {
+	return keyRing.encryptSessionKey(keyRing.getPGP(), sk, options.hideRecipients(), false)
+}
+
+// encryptSessionKey encrypts the session key to every key of the key ring,
+// with the time and randomness of pgp. With aead, the packets are version 6
+// ones, for an AEAD-chunked (SEIPD version 2) data packet.
+func (keyRing *KeyRing) encryptSessionKey(pgp *GopenPGP, sk *SessionKey, hideRecipients, aead bool) ([]byte, error) {
 	outbuf := &bytes.Buffer{}
 	cf, err := sk.GetCipherFunc()
 	if err != nil {
@@ -84,9 +163,12 @@ func (keyRing *KeyRing) EncryptSessionKey(sk *SessionKey) ([]byte, error) {
 
 	pubKeys := make([]*packet.PublicKey, 0, len(keyRing.entities))
 	for _, e := range keyRing.entities {
-		encryptionKey, ok := e.EncryptionKey(getNow())
+		encryptionKey, ok := e.EncryptionKey(pgp.getNow())
 		if !ok {
-			return nil, errors.New("gopenpgp: encryption key is unavailable for key id " + strconv.FormatUint(e.PrimaryKey.KeyId, 16))
+			return nil, newError(
+				"gopenpgp: encryption key is unavailable for key id "+strconv.FormatUint(e.PrimaryKey.KeyId, 16),
+				pgp.encryptionKeyCategories(openpgp.EntityList{e})...,
+			)
 		}
 		pubKeys = append(pubKeys, encryptionKey.PublicKey)
 	}
@@ -94,10 +176,58 @@ func (keyRing *KeyRing) EncryptSessionKey(sk *SessionKey) ([]byte, error) {
 		return nil, errors.New("cannot set key: no public key available")
 	}
 
+	config := &packet.Config{Rand: pgp.rand}
 	for _, pub := range pubKeys {
-		if err := packet.SerializeEncryptedKey(outbuf, pub, cf, sk.Key, nil); err != nil {
+		if aead {
+			if err := packet.SerializeEncryptedKeyAEADwithHiddenOption(outbuf, pub, cf, true, sk.Key, hideRecipients, config); err != nil {
+				return nil, errors.Wrap(err, "gopenpgp: cannot set key")
+			}
+			continue
+		}
+		if hideRecipients {
+			// The key ID is only written in the packet header
+			wildcard := *pub
+			wildcard.KeyId = 0
+			pub = &wildcard
+		}
+		if err := packet.SerializeEncryptedKey(outbuf, pub, cf, sk.Key, config); err != nil {
 			return nil, errors.Wrap(err, "gopenpgp: cannot set key")
 		}
 	}
 	return outbuf.Bytes(), nil
 }
+
+// trialDecryptionKeyRing wraps a key ring to bound the number of private keys
+// returned for the session key packets with a wildcard key ID, each of which
+// costs a trial decryption.
+type trialDecryptionKeyRing struct {
+	openpgp.KeyRing
+	remaining int
+	exhausted bool
+}
+
+// A maxTrials of 0 does not limit the number of keys.
+func newTrialDecryptionKeyRing(keyRing openpgp.KeyRing, maxTrials int) *trialDecryptionKeyRing {
+	if maxTrials <= 0 {
+		maxTrials = math.MaxInt32
+	}
+	return &trialDecryptionKeyRing{KeyRing: keyRing, remaining: maxTrials}
+}
+
+// DecryptionKeys returns the unlocked decryption keys of the key ring, up to
+// the remaining number of trial decryptions.
+func (keyRing *trialDecryptionKeyRing) DecryptionKeys() []openpgp.Key {
+	var keys []openpgp.Key
+	for _, key := range keyRing.KeyRing.DecryptionKeys() {
+		if key.PrivateKey == nil || key.PrivateKey.Encrypted {
+			continue
+		}
+		if keyRing.remaining <= 0 {
+			keyRing.exhausted = true
+			break
+		}
+		keyRing.remaining--
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -2,10 +2,13 @@ package crypto
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"time"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/angel-one/gopenpgp/v2/armor"
+	"github.com/angel-one/gopenpgp/v2/constants"
 	"github.com/pkg/errors"
 )
 
@@ -40,13 +43,12 @@ func (keyRing *KeyRing) EncryptStream(
 	plainMessageMetadata *PlainMessageMetadata,
 	signKeyRing *KeyRing,
 ) (plainMessageWriter WriteCloser, err error) {
-	return encryptStream(
+	return keyRing.getPGP().encryptStream(
 		keyRing,
 		pgpMessageWriter,
 		pgpMessageWriter,
 		plainMessageMetadata,
 		signKeyRing,
-		false,
 		nil,
 	)
 }
@@ -61,14 +63,13 @@ func (keyRing *KeyRing) EncryptStreamWithContext(
 	signKeyRing *KeyRing,
 	signingContext *SigningContext,
 ) (plainMessageWriter WriteCloser, err error) {
-	return encryptStream(
+	return keyRing.getPGP().encryptStream(
 		keyRing,
 		pgpMessageWriter,
 		pgpMessageWriter,
 		plainMessageMetadata,
 		signKeyRing,
-		false,
-		signingContext,
+		&EncryptionOptions{SigningContext: signingContext},
 	)
 }
 
@@ -81,14 +82,13 @@ func (keyRing *KeyRing) EncryptStreamWithCompression(
 	plainMessageMetadata *PlainMessageMetadata,
 	signKeyRing *KeyRing,
 ) (plainMessageWriter WriteCloser, err error) {
-	return encryptStream(
+	return keyRing.getPGP().encryptStream(
 		keyRing,
 		pgpMessageWriter,
 		pgpMessageWriter,
 		plainMessageMetadata,
 		signKeyRing,
-		true,
-		nil,
+		&EncryptionOptions{Compress: true},
 	)
 }
 
@@ -103,32 +103,84 @@ func (keyRing *KeyRing) EncryptStreamWithContextAndCompression(
 	signKeyRing *KeyRing,
 	signingContext *SigningContext,
 ) (plainMessageWriter WriteCloser, err error) {
-	return encryptStream(
+	return keyRing.getPGP().encryptStream(
 		keyRing,
 		pgpMessageWriter,
 		pgpMessageWriter,
 		plainMessageMetadata,
 		signKeyRing,
-		true,
-		signingContext,
+		&EncryptionOptions{SigningContext: signingContext, Compress: true},
+	)
+}
+
+// EncryptStreamWithOptions is used to encrypt data as a Writer.
+// It takes a writer for the encrypted data and returns a WriteCloser for the plaintext data
+// If signKeyRing is not nil, it is used to do an embedded signature.
+// * options : (optional) the encryption settings, nil selects the defaults.
+func (keyRing *KeyRing) EncryptStreamWithOptions(
+	pgpMessageWriter Writer,
+	plainMessageMetadata *PlainMessageMetadata,
+	signKeyRing *KeyRing,
+	options *EncryptionOptions,
+) (plainMessageWriter WriteCloser, err error) {
+	return keyRing.getPGP().encryptStream(
+		keyRing,
+		pgpMessageWriter,
+		pgpMessageWriter,
+		plainMessageMetadata,
+		signKeyRing,
+		options,
 	)
 }
 
-func encryptStream(
+// EncryptStreamCtx is used to encrypt data as a Writer, until ctx is done.
+// It takes a writer for the encrypted data and returns a WriteCloser for the plaintext data
+// If signKeyRing is not nil, it is used to do an embedded signature.
+// Once ctx is done, writing and closing fail with an error matching ctx.Err(),
+// the encrypted message is left unterminated and its session key is wiped.
+// * ctx : the context cancelling the encryption.
+func (keyRing *KeyRing) EncryptStreamCtx(
+	ctx context.Context,
+	pgpMessageWriter Writer,
+	plainMessageMetadata *PlainMessageMetadata,
+	signKeyRing *KeyRing,
+) (plainMessageWriter WriteCloser, err error) {
+	if err := cancellationError(ctx); err != nil {
+		return nil, err
+	}
+	messageWriter := &contextWriter{ctx, pgpMessageWriter}
+	state := &encryptionState{}
+	plainMessageWriter, err = keyRing.getPGP().encryptStream(
+		keyRing,
+		messageWriter,
+		messageWriter,
+		plainMessageMetadata,
+		signKeyRing,
+		&EncryptionOptions{state: state},
+	)
+	if err != nil {
+		if cancelled := cancellationError(ctx); cancelled != nil {
+			return nil, cancelled
+		}
+		return nil, err
+	}
+	return &contextWriteCloser{ctx, plainMessageWriter, state}, nil
+}
+
+func (pgp *GopenPGP) encryptStream(
 	encryptionKeyRing *KeyRing,
 	keyPacketWriter Writer,
 	dataPacketWriter Writer,
 	plainMessageMetadata *PlainMessageMetadata,
 	signKeyRing *KeyRing,
-	compress bool,
-	signingContext *SigningContext,
+	options *EncryptionOptions,
 ) (plainMessageWriter WriteCloser, err error) {
 	if plainMessageMetadata == nil {
 		// Use sensible default metadata
 		plainMessageMetadata = &PlainMessageMetadata{
 			IsBinary: true,
 			Filename: "",
-			ModTime:  GetUnixTime(),
+			ModTime:  pgp.GetUnixTime(),
 		}
 	}
 
@@ -138,7 +190,7 @@ func encryptStream(
 		ModTime:  time.Unix(plainMessageMetadata.ModTime, 0),
 	}
 
-	plainMessageWriter, err = asymmetricEncryptStream(hints, keyPacketWriter, dataPacketWriter, encryptionKeyRing, signKeyRing, compress, signingContext)
+	plainMessageWriter, err = pgp.asymmetricEncryptStream(hints, keyPacketWriter, dataPacketWriter, encryptionKeyRing, signKeyRing, options)
 	if err != nil {
 		return nil, err
 	}
@@ -186,12 +238,11 @@ func (keyRing *KeyRing) EncryptSplitStream(
 	plainMessageMetadata *PlainMessageMetadata,
 	signKeyRing *KeyRing,
 ) (*EncryptSplitResult, error) {
-	return encryptSplitStream(
+	return keyRing.getPGP().encryptSplitStream(
 		keyRing,
 		dataPacketWriter,
 		plainMessageMetadata,
 		signKeyRing,
-		false,
 		nil,
 	)
 }
@@ -208,13 +259,12 @@ func (keyRing *KeyRing) EncryptSplitStreamWithContext(
 	signKeyRing *KeyRing,
 	signingContext *SigningContext,
 ) (*EncryptSplitResult, error) {
-	return encryptSplitStream(
+	return keyRing.getPGP().encryptSplitStream(
 		keyRing,
 		dataPacketWriter,
 		plainMessageMetadata,
 		signKeyRing,
-		false,
-		signingContext,
+		&EncryptionOptions{SigningContext: signingContext},
 	)
 }
 
@@ -228,13 +278,12 @@ func (keyRing *KeyRing) EncryptSplitStreamWithCompression(
 	plainMessageMetadata *PlainMessageMetadata,
 	signKeyRing *KeyRing,
 ) (*EncryptSplitResult, error) {
-	return encryptSplitStream(
+	return keyRing.getPGP().encryptSplitStream(
 		keyRing,
 		dataPacketWriter,
 		plainMessageMetadata,
 		signKeyRing,
-		true,
-		nil,
+		&EncryptionOptions{Compress: true},
 	)
 }
 
@@ -250,33 +299,50 @@ func (keyRing *KeyRing) EncryptSplitStreamWithContextAndCompression(
 	signKeyRing *KeyRing,
 	signingContext *SigningContext,
 ) (*EncryptSplitResult, error) {
-	return encryptSplitStream(
+	return keyRing.getPGP().encryptSplitStream(
 		keyRing,
 		dataPacketWriter,
 		plainMessageMetadata,
 		signKeyRing,
-		true,
-		signingContext,
+		&EncryptionOptions{SigningContext: signingContext, Compress: true},
+	)
+}
+
+// EncryptSplitStreamWithOptions is used to encrypt data as a stream.
+// It takes a writer for the Symmetrically Encrypted Data Packet
+// and returns a writer for the plaintext data and the key packet.
+// If signKeyRing is not nil, it is used to do an embedded signature.
+// * options : (optional) the encryption settings, nil selects the defaults.
+func (keyRing *KeyRing) EncryptSplitStreamWithOptions(
+	dataPacketWriter Writer,
+	plainMessageMetadata *PlainMessageMetadata,
+	signKeyRing *KeyRing,
+	options *EncryptionOptions,
+) (*EncryptSplitResult, error) {
+	return keyRing.getPGP().encryptSplitStream(
+		keyRing,
+		dataPacketWriter,
+		plainMessageMetadata,
+		signKeyRing,
+		options,
 	)
 }
 
-func encryptSplitStream(
+func (pgp *GopenPGP) encryptSplitStream(
 	encryptionKeyRing *KeyRing,
 	dataPacketWriter Writer,
 	plainMessageMetadata *PlainMessageMetadata,
 	signKeyRing *KeyRing,
-	compress bool,
-	signingContext *SigningContext,
+	options *EncryptionOptions,
 ) (*EncryptSplitResult, error) {
 	var keyPacketBuf bytes.Buffer
-	plainMessageWriter, err := encryptStream(
+	plainMessageWriter, err := pgp.encryptStream(
 		encryptionKeyRing,
 		&keyPacketBuf,
 		dataPacketWriter,
 		plainMessageMetadata,
 		signKeyRing,
-		compress,
-		signingContext,
+		options,
 	)
 	if err != nil {
 		return nil, err
@@ -296,6 +362,10 @@ type PlainMessageReader struct {
 	verifyTime          int64
 	readAll             bool
 	verificationContext *VerificationContext
+	ctx                 context.Context
+	progress            *progressTracker
+	body                io.Reader // the spooled body, nil to read the message directly
+	expectedSigner      string    // the email address of the signer, if set
 }
 
 // GetMetadata returns the metadata of the decrypted message.
@@ -310,9 +380,30 @@ func (msg *PlainMessageReader) GetMetadata() *PlainMessageMetadata {
 // Read is used to access the message decrypted data.
 // Makes PlainMessageReader implement the Reader interface.
 func (msg *PlainMessageReader) Read(b []byte) (n int, err error) {
-	n, err = msg.details.UnverifiedBody.Read(b)
+	if msg.ctx != nil {
+		if err = cancellationError(msg.ctx); err != nil {
+			return 0, err
+		}
+	}
+	if msg.body != nil {
+		n, err = msg.body.Read(b)
+	} else {
+		n, err = msg.details.UnverifiedBody.Read(b)
+	}
+	if msg.progress != nil {
+		msg.progress.addPlaintext(n)
+	}
 	if errors.Is(err, io.EOF) {
+		if !msg.readAll && msg.progress != nil {
+			if msg.verifyKeyRing != nil {
+				msg.progress.setPhase(constants.ProgressSignatureVerification)
+			} else {
+				msg.progress.setPhase(constants.ProgressDone)
+			}
+		}
 		msg.readAll = true
+	} else if err != nil {
+		err = categorizeError(err)
 	}
 	return
 }
@@ -327,7 +418,10 @@ func (msg *PlainMessageReader) VerifySignature() (err error) {
 	}
 	if msg.verifyKeyRing != nil {
 		processSignatureExpiration(msg.details, msg.verifyTime)
-		err = verifyDetailsSignature(msg.details, msg.verifyKeyRing, msg.verificationContext)
+		err = verifyDetailsSignature(msg.details, msg.verifyKeyRing, msg.verificationContext, msg.expectedSigner)
+		if msg.progress != nil {
+			msg.progress.setPhase(constants.ProgressDone)
+		}
 	} else {
 		err = errors.New("gopenpgp: no verify keyring was provided before decryption")
 	}
@@ -344,8 +438,9 @@ func (keyRing *KeyRing) DecryptStream(
 	verifyKeyRing *KeyRing,
 	verifyTime int64,
 ) (plainMessage *PlainMessageReader, err error) {
-	return decryptStream(
+	return keyRing.getPGP().decryptStream(
 		keyRing,
+		nil,
 		message,
 		verifyKeyRing,
 		verifyTime,
@@ -365,8 +460,9 @@ func (keyRing *KeyRing) DecryptStreamWithContext(
 	verifyTime int64,
 	verificationContext *VerificationContext,
 ) (plainMessage *PlainMessageReader, err error) {
-	return decryptStream(
+	return keyRing.getPGP().decryptStream(
 		keyRing,
+		nil,
 		message,
 		verifyKeyRing,
 		verifyTime,
@@ -374,31 +470,209 @@ func (keyRing *KeyRing) DecryptStreamWithContext(
 	)
 }
 
-func decryptStream(
+// DecryptStreamWithOptions is used to decrypt a pgp message as a Reader.
+// It takes a reader for the message data
+// and returns a PlainMessageReader for the plaintext data.
+// If verifyKeyRing is not nil, PlainMessageReader.VerifySignature() will
+// verify the embedded signature with the given key ring and verification time.
+// With the integrity-first decryption selected by the options, the
+// plaintext is only released once its integrity has been checked.
+// * options : (optional) the decryption settings, nil selects the defaults.
+func (keyRing *KeyRing) DecryptStreamWithOptions(
+	message Reader,
+	verifyKeyRing *KeyRing,
+	verifyTime int64,
+	options *DecryptionOptions,
+) (plainMessage *PlainMessageReader, err error) {
+	if options.workers() > 1 {
+		plainMessage, err = keyRing.decryptStreamParallel(message, verifyKeyRing, verifyTime, options)
+	} else {
+		plainMessage, err = keyRing.getPGP().decryptStream(
+			keyRing,
+			nil,
+			message,
+			verifyKeyRing,
+			verifyTime,
+			options.verificationContext(),
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = plainMessage.releaseAfterIntegrityCheck(options); err != nil {
+		return nil, err
+	}
+	return plainMessage, nil
+}
+
+// DecryptStreamWithProgress is used to decrypt a pgp message as a Reader.
+// It takes a reader for the message data
+// and returns a PlainMessageReader for the plaintext data.
+// If verifyKeyRing is not nil, PlainMessageReader.VerifySignature() will
+// verify the embedded signature with the given key ring and verification time.
+// The observer receives the phase of the decryption and the numbers of
+// plaintext bytes and ciphertext bytes read so far.
+// * observer : the observer of the decryption progress.
+func (keyRing *KeyRing) DecryptStreamWithProgress(
+	message Reader,
+	verifyKeyRing *KeyRing,
+	verifyTime int64,
+	observer ProgressObserver,
+) (plainMessage *PlainMessageReader, err error) {
+	progress := newProgressTracker(observer)
+	if progress == nil {
+		return keyRing.DecryptStream(message, verifyKeyRing, verifyTime)
+	}
+	progress.setPhase(constants.ProgressKeyPacketDecryption)
+	plainMessage, err = keyRing.getPGP().decryptStream(
+		keyRing,
+		nil,
+		&progressReader{message, progress.addCiphertext},
+		verifyKeyRing,
+		verifyTime,
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	progress.setPhase(constants.ProgressBodyDecryption)
+	plainMessage.progress = progress
+	return plainMessage, nil
+}
+
+// DecryptStreamCtx is used to decrypt a pgp message as a Reader, until ctx is done.
+// It takes a reader for the message data
+// and returns a PlainMessageReader for the plaintext data.
+// If verifyKeyRing is not nil, PlainMessageReader.VerifySignature() will
+// verify the embedded signature with the given key ring and verification time.
+// Once ctx is done, reading fails with an error matching ctx.Err().
+// * ctx : the context cancelling the decryption.
+func (keyRing *KeyRing) DecryptStreamCtx(
+	ctx context.Context,
+	message Reader,
+	verifyKeyRing *KeyRing,
+	verifyTime int64,
+) (plainMessage *PlainMessageReader, err error) {
+	if err := cancellationError(ctx); err != nil {
+		return nil, err
+	}
+	plainMessage, err = keyRing.getPGP().decryptStream(
+		keyRing,
+		nil,
+		newContextReader(ctx, message),
+		verifyKeyRing,
+		verifyTime,
+		nil,
+	)
+	if err != nil {
+		if cancelled := cancellationError(ctx); cancelled != nil {
+			return nil, cancelled
+		}
+		return nil, err
+	}
+	plainMessage.ctx = ctx
+	return plainMessage, nil
+}
+
+func (pgp *GopenPGP) decryptStream(
 	decryptionKeyRing *KeyRing,
+	password []byte,
 	message Reader,
 	verifyKeyRing *KeyRing,
 	verifyTime int64,
 	verificationContext *VerificationContext,
 ) (plainMessage *PlainMessageReader, err error) {
-	messageDetails, err := asymmetricDecryptStream(
-		message,
+	binaryMessage, err := unarmorMessageStream(message)
+	if err != nil {
+		return nil, err
+	}
+	messageDetails, err := pgp.asymmetricDecryptStream(
+		binaryMessage,
 		decryptionKeyRing,
+		password,
 		verifyKeyRing,
 		verifyTime,
 		verificationContext,
+		pgp.getDecryptionLimits(),
 	)
 	if err != nil {
 		return nil, err
 	}
 
 	return &PlainMessageReader{
-		messageDetails,
+		details:             messageDetails,
+		verifyKeyRing:       verifyKeyRing,
+		verifyTime:          verifyTime,
+		readAll:             false,
+		verificationContext: verificationContext,
+	}, err
+}
+
+// decryptStreamParallel decrypts the session key of the key packets of the
+// message, and then the data packet with it, on several goroutines if it is
+// a version 2 Symmetrically Encrypted Integrity Protected Data packet.
+func (keyRing *KeyRing) decryptStreamParallel(
+	message Reader,
+	verifyKeyRing *KeyRing,
+	verifyTime int64,
+	options *DecryptionOptions,
+) (plainMessage *PlainMessageReader, err error) {
+	binaryMessage, err := unarmorMessageStream(message)
+	if err != nil {
+		return nil, err
+	}
+	bufferedMessage := &peekReader{r: binaryMessage}
+	keyPackets, err := readKeyPackets(bufferedMessage)
+	if err != nil {
+		return nil, err
+	}
+	if len(keyPackets) == 0 {
+		return keyRing.getPGP().decryptStream(
+			keyRing,
+			nil,
+			bufferedMessage,
+			verifyKeyRing,
+			verifyTime,
+			options.verificationContext(),
+		)
+	}
+	sk, err := keyRing.DecryptSessionKey(bytes.Join(keyPackets, nil))
+	if err != nil {
+		return nil, err
+	}
+	defer sk.Clear()
+	return decryptStreamWithSessionKeyAndContext(
+		sk,
+		bufferedMessage,
 		verifyKeyRing,
 		verifyTime,
-		false,
-		verificationContext,
-	}, err
+		options.verificationContext(),
+		options.workers(),
+	)
+}
+
+// unarmorMessageStream returns the binary message of a stream, which is
+// unarmored if it does not start with a packet.
+func unarmorMessageStream(message Reader) (io.Reader, error) {
+	peeker := &peekReader{r: message}
+	var first [1]byte
+	n, err := io.ReadFull(message, first[:])
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, wrapError(err, "gopenpgp: error in reading message")
+	}
+	peeker.pushed = first[:n]
+	if n == 0 || first[0]&0x80 != 0 {
+		return peeker, nil
+	}
+
+	block, err := armor.UnarmorReader(peeker)
+	if err != nil {
+		return nil, wrapError(err, "gopenpgp: error in unarmoring message", ErrMalformedPacket)
+	}
+	if block.Type != constants.PGPMessageHeader {
+		return nil, newError("gopenpgp: the armored block is not a message", ErrMalformedPacket)
+	}
+	return block.Body, nil
 }
 
 // DecryptSplitStream is used to decrypt a split pgp message as a Reader.
@@ -446,6 +720,32 @@ func (keyRing *KeyRing) DecryptSplitStreamWithContext(
 	)
 }
 
+// DecryptSplitStreamWithProgress is used to decrypt a split pgp message as a Reader.
+// It takes a key packet and a reader for the data packet
+// and returns a PlainMessageReader for the plaintext data.
+// If verifyKeyRing is not nil, PlainMessageReader.VerifySignature() will
+// verify the embedded signature with the given key ring and verification time.
+// The observer receives the phase of the decryption and the numbers of
+// plaintext bytes and ciphertext bytes read so far, key packet included.
+// * observer : the observer of the decryption progress.
+func (keyRing *KeyRing) DecryptSplitStreamWithProgress(
+	keypacket []byte,
+	dataPacketReader Reader,
+	verifyKeyRing *KeyRing, verifyTime int64,
+	observer ProgressObserver,
+) (plainMessage *PlainMessageReader, err error) {
+	messageReader := io.MultiReader(
+		bytes.NewReader(keypacket),
+		dataPacketReader,
+	)
+	return keyRing.DecryptStreamWithProgress(
+		messageReader,
+		verifyKeyRing,
+		verifyTime,
+		observer,
+	)
+}
+
 // SignDetachedStream generates and returns a PGPSignature for a given message Reader.
 func (keyRing *KeyRing) SignDetachedStream(message Reader) (*PGPSignature, error) {
 	return keyRing.SignDetachedStreamWithContext(message, nil)
@@ -460,9 +760,33 @@ func (keyRing *KeyRing) SignDetachedStreamWithContext(message Reader, context *S
 		message,
 		true,
 		context,
+		nil,
 	)
 }
 
+// SignDetachedStreamCtx generates and returns a PGPSignature for a given message Reader,
+// unless ctx is done before the message is read entirely.
+// * ctx : the context cancelling the signature.
+func (keyRing *KeyRing) SignDetachedStreamCtx(ctx context.Context, message Reader) (*PGPSignature, error) {
+	if err := cancellationError(ctx); err != nil {
+		return nil, err
+	}
+	signature, err := signMessageDetached(
+		keyRing,
+		newContextReader(ctx, message),
+		true,
+		nil,
+		nil,
+	)
+	if err != nil {
+		if cancelled := cancellationError(ctx); cancelled != nil {
+			return nil, cancelled
+		}
+		return nil, err
+	}
+	return signature, nil
+}
+
 // VerifyDetachedStream verifies a message reader with a detached PGPSignature
 // and returns a SignatureVerificationError if fails.
 func (keyRing *KeyRing) VerifyDetachedStream(
@@ -476,6 +800,7 @@ func (keyRing *KeyRing) VerifyDetachedStream(
 		signature.GetBinary(),
 		verifyTime,
 		nil,
+		"",
 	)
 	return err
 }
@@ -496,10 +821,40 @@ func (keyRing *KeyRing) VerifyDetachedStreamWithContext(
 		signature.GetBinary(),
 		verifyTime,
 		verificationContext,
+		"",
 	)
 	return err
 }
 
+// VerifyDetachedStreamCtx verifies a message reader with a detached PGPSignature
+// and returns a SignatureVerificationError if fails, unless ctx is done before
+// the message is read entirely.
+// * ctx : the context cancelling the verification.
+func (keyRing *KeyRing) VerifyDetachedStreamCtx(
+	ctx context.Context,
+	message Reader,
+	signature *PGPSignature,
+	verifyTime int64,
+) error {
+	if err := cancellationError(ctx); err != nil {
+		return err
+	}
+	_, err := verifySignature(
+		keyRing.entities,
+		newContextReader(ctx, message),
+		signature.GetBinary(),
+		verifyTime,
+		nil,
+		"",
+	)
+	if err != nil {
+		if cancelled := cancellationError(ctx); cancelled != nil {
+			return cancelled
+		}
+	}
+	return err
+}
+
 // SignDetachedEncryptedStream generates and returns a PGPMessage
 // containing an encrypted detached signature for a given message Reader.
 func (keyRing *KeyRing) SignDetachedEncryptedStream(
@@ -792,3 +792,40 @@ func TestKeyRing_VerifyDetachedEncryptedStreamCompatible(t *testing.T) {
 		t.Fatal("Expected no error while verifying the detached signature, got:", err)
 	}
 }
+
+func TestKeyRing_DecryptArmoredStream(t *testing.T) {
+	messageBytes := []byte("Hello World!")
+	ciphertext, err := keyRingTestPublic.Encrypt(NewPlainMessage(messageBytes), keyRingTestPrivate)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+	armored, err := ciphertext.GetArmored()
+	if err != nil {
+		t.Fatal("Expected no error while armoring, got:", err)
+	}
+
+	decryptedReader, err := keyRingTestPrivate.DecryptStream(
+		bytes.NewReader([]byte("\n"+armored+"\n")),
+		keyRingTestPublic,
+		GetUnixTime(),
+	)
+	if err != nil {
+		t.Fatal("Expected no error while calling DecryptStream, got:", err)
+	}
+	decryptedBytes, err := ioutil.ReadAll(decryptedReader)
+	if err != nil {
+		t.Fatal("Expected no error while reading the decrypted data, got:", err)
+	}
+	if !bytes.Equal(decryptedBytes, messageBytes) {
+		t.Fatalf("Expected the decrypted data to be %s got %s", string(messageBytes), string(decryptedBytes))
+	}
+	if err = decryptedReader.VerifySignature(); err != nil {
+		t.Fatal("Expected no error while verifying the signature, got:", err)
+	}
+
+	armoredSignature := "-----BEGIN PGP SIGNATURE-----\n\nZGF0YQ==\n-----END PGP SIGNATURE-----"
+	_, err = keyRingTestPrivate.DecryptStream(bytes.NewReader([]byte(armoredSignature)), nil, 0)
+	if !errors.Is(err, ErrMalformedPacket) {
+		t.Fatal("Expected a malformed packet error, got:", err)
+	}
+}
@@ -64,11 +64,16 @@ type ClearTextMessage struct {
 // signature, or verification from the unencrypted binary data.
 // This will encrypt the message with the binary flag and preserve the file as is.
 func NewPlainMessage(data []byte) *PlainMessage {
+	return pgp.NewPlainMessage(data)
+}
+
+// NewPlainMessage generates a new binary PlainMessage, with the time of the instance.
+func (pgp *GopenPGP) NewPlainMessage(data []byte) *PlainMessage {
 	return &PlainMessage{
 		Data:     clone(data),
 		TextType: false,
 		Filename: "",
-		Time:     uint32(GetUnixTime()),
+		Time:     uint32(pgp.GetUnixTime()),
 	}
 }
 
@@ -91,11 +96,16 @@ func NewPlainMessageFromFile(data []byte, filename string, time uint32) *PlainMe
 // (i.e. set all of them to \r\n) and strip the trailing spaces for each line.
 // This allows seamless conversion to clear text signed messages (see RFC 4880 5.2.1 and 7.1).
 func NewPlainMessageFromString(text string) *PlainMessage {
+	return pgp.NewPlainMessageFromString(text)
+}
+
+// NewPlainMessageFromString generates a new text PlainMessage, with the time of the instance.
+func (pgp *GopenPGP) NewPlainMessageFromString(text string) *PlainMessage {
 	return &PlainMessage{
 		Data:     []byte(internal.Canonicalize(text)),
 		TextType: true,
 		Filename: "",
-		Time:     uint32(GetUnixTime()),
+		Time:     uint32(pgp.GetUnixTime()),
 	}
 }
 
@@ -110,12 +120,12 @@ func NewPGPMessage(data []byte) *PGPMessage {
 func NewPGPMessageFromArmored(armored string) (*PGPMessage, error) {
 	encryptedIO, err := internal.Unarmor(armored)
 	if err != nil {
-		return nil, errors.Wrap(err, "gopenpgp: error in unarmoring message")
+		return nil, wrapError(err, "gopenpgp: error in unarmoring message")
 	}
 
 	message, err := ioutil.ReadAll(encryptedIO.Body)
 	if err != nil {
-		return nil, errors.Wrap(err, "gopenpgp: error in reading armored message")
+		return nil, wrapError(err, "gopenpgp: error in reading armored message")
 	}
 
 	return &PGPMessage{
@@ -155,12 +165,12 @@ func NewPGPSignature(data []byte) *PGPSignature {
 func NewPGPSignatureFromArmored(armored string) (*PGPSignature, error) {
 	encryptedIO, err := internal.Unarmor(armored)
 	if err != nil {
-		return nil, errors.Wrap(err, "gopenpgp: error in unarmoring signature")
+		return nil, wrapError(err, "gopenpgp: error in unarmoring signature")
 	}
 
 	signature, err := ioutil.ReadAll(encryptedIO.Body)
 	if err != nil {
-		return nil, errors.Wrap(err, "gopenpgp: error in reading armored signature")
+		return nil, wrapError(err, "gopenpgp: error in reading armored signature")
 	}
 
 	return &PGPSignature{
@@ -187,7 +197,7 @@ func NewClearTextMessageFromArmored(signedMessage string) (*ClearTextMessage, er
 
 	signature, err := ioutil.ReadAll(modulusBlock.ArmoredSignature.Body)
 	if err != nil {
-		return nil, errors.Wrap(err, "gopenpgp: error in reading cleartext message")
+		return nil, wrapError(err, "gopenpgp: error in reading cleartext message")
 	}
 
 	return NewClearTextMessage(modulusBlock.Bytes, signature), nil
@@ -253,27 +263,21 @@ func (msg *PGPMessage) GetArmoredWithCustomHeaders(comment, version string) (str
 	return armor.ArmorWithTypeAndCustomHeaders(msg.Data, constants.PGPMessageHeader, version, comment)
 }
 
+// GetArmoredWithHeaders returns the armored message as a string, with the
+// given armor headers in order.
+// * headers : (optional) the armor headers, nil for none.
+func (msg *PGPMessage) GetArmoredWithHeaders(headers *armor.Headers) (string, error) {
+	return armor.ArmorWithHeaders(msg.Data, constants.PGPMessageHeader, headers)
+}
+
 // GetEncryptionKeyIDs Returns the key IDs of the keys to which the session key is encrypted.
+// The session key packets are parsed by go-crypto, the packets of the versions
+// it does not support are skipped.
 func (msg *PGPMessage) GetEncryptionKeyIDs() ([]uint64, bool) {
-	packets := packet.NewReader(bytes.NewReader(msg.Data))
-	var err error
 	var ids []uint64
-	var encryptedKey *packet.EncryptedKey
-Loop:
-	for {
-		var p packet.Packet
-		if p, err = packets.Next(); goerrors.Is(err, io.EOF) {
-			break
-		}
-		switch p := p.(type) {
-		case *packet.EncryptedKey:
-			encryptedKey = p
+	for _, p := range readLeadingPackets(msg.Data) {
+		if encryptedKey, ok := p.(*packet.EncryptedKey); ok {
 			ids = append(ids, encryptedKey.KeyId)
-		case *packet.SymmetricallyEncrypted,
-			*packet.AEADEncrypted,
-			*packet.Compressed,
-			*packet.LiteralData:
-			break Loop
 		}
 	}
 	if len(ids) > 0 {
@@ -369,6 +373,13 @@ func (sig *PGPSignature) GetArmored() (string, error) {
 	return armor.ArmorWithType(sig.Data, constants.PGPSignatureHeader)
 }
 
+// GetArmoredWithHeaders returns the armored signature as a string, with the
+// given armor headers in order.
+// * headers : (optional) the armor headers, nil for none.
+func (sig *PGPSignature) GetArmoredWithHeaders(headers *armor.Headers) (string, error) {
+	return armor.ArmorWithHeaders(sig.Data, constants.PGPSignatureHeader, headers)
+}
+
 // GetSignatureKeyIDs Returns the key IDs of the keys to which the (readable) signature packets are encrypted to.
 func (sig *PGPSignature) GetSignatureKeyIDs() ([]uint64, bool) {
 	return getSignatureKeyIDs(sig.Data)
@@ -420,32 +431,15 @@ func IsPGPMessage(data string) bool {
 }
 
 func getSignatureKeyIDs(data []byte) ([]uint64, bool) {
-	packets := packet.NewReader(bytes.NewReader(data))
-	var err error
 	var ids []uint64
-	var onePassSignaturePacket *packet.OnePassSignature
-	var signaturePacket *packet.Signature
-
-Loop:
-	for {
-		var p packet.Packet
-		if p, err = packets.Next(); goerrors.Is(err, io.EOF) {
-			break
-		}
+	for _, p := range readLeadingPackets(data) {
 		switch p := p.(type) {
 		case *packet.OnePassSignature:
-			onePassSignaturePacket = p
-			ids = append(ids, onePassSignaturePacket.KeyId)
+			ids = append(ids, p.KeyId)
 		case *packet.Signature:
-			signaturePacket = p
-			if signaturePacket.IssuerKeyId != nil {
-				ids = append(ids, *signaturePacket.IssuerKeyId)
+			if p.IssuerKeyId != nil {
+				ids = append(ids, *p.IssuerKeyId)
 			}
-		case *packet.SymmetricallyEncrypted,
-			*packet.AEADEncrypted,
-			*packet.Compressed,
-			*packet.LiteralData:
-			break Loop
 		}
 	}
 	if len(ids) > 0 {
@@ -454,6 +448,27 @@ Loop:
 	return ids, false
 }
 
+// readLeadingPackets parses the packets of data up to the first data packet,
+// such as the session key and one-pass signature packets of a message.
+func readLeadingPackets(data []byte) []packet.Packet {
+	var packets []packet.Packet
+	reader := packet.NewReader(bytes.NewReader(data))
+	for {
+		p, err := reader.Next()
+		if err != nil {
+			return packets
+		}
+		switch p.(type) {
+		case *packet.SymmetricallyEncrypted,
+			*packet.AEADEncrypted,
+			*packet.Compressed,
+			*packet.LiteralData:
+			return packets
+		}
+		packets = append(packets, p)
+	}
+}
+
 func getHexKeyIDs(keyIDs []uint64, ok bool) ([]string, bool) {
 	hexIDs := make([]string, len(keyIDs))
 
@@ -9,7 +9,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/angel-one/gopenpgp/v2/armor"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -72,6 +74,54 @@ func TestBinaryMessageEncryptionWithPassword(t *testing.T) {
 	assert.Exactly(t, message, decrypted)
 }
 
+func TestMessageEncryptionWithPasswordAndS2K(t *testing.T) {
+	var message = NewPlainMessageFromString("The secret code is... 1, 2, 3, 4, 5")
+
+	encrypted, err := EncryptMessageWithPassword(message, testSymmetricKey)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	s2kConfigs, err := encrypted.GetPasswordS2KConfigs()
+	if err != nil {
+		t.Fatal("Expected no error when reading the S2K, got:", err)
+	}
+	assert.Exactly(t, []*S2KConfig{NewIteratedSaltedS2KConfig(16777216)}, s2kConfigs)
+
+	argon2 := NewArgon2S2KConfig(2048, 2, 1)
+	encrypted, err = EncryptMessageWithPasswordAndS2K(message, testSymmetricKey, argon2)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	s2kConfigs, err = encrypted.GetPasswordS2KConfigs()
+	if err != nil {
+		t.Fatal("Expected no error when reading the S2K, got:", err)
+	}
+	assert.Exactly(t, []*S2KConfig{argon2}, s2kConfigs)
+
+	decrypted, err := DecryptMessageWithPassword(encrypted, testSymmetricKey)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, message.GetString(), decrypted.GetString())
+
+	iterated := NewIteratedSaltedS2KConfig(65536)
+	encrypted, err = keyRingTestPublic.EncryptWithOptions(message, nil, &EncryptionOptions{
+		Passwords: [][]byte{testSymmetricKey},
+		S2KConfig: iterated,
+	})
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	s2kConfigs, err = encrypted.GetPasswordS2KConfigs()
+	if err != nil {
+		t.Fatal("Expected no error when reading the S2K, got:", err)
+	}
+	assert.Exactly(t, []*S2KConfig{iterated}, s2kConfigs)
+
+	_, err = EncryptMessageWithPasswordAndS2K(message, testSymmetricKey, &S2KConfig{Mode: "unknown"})
+	assert.Error(t, err)
+}
+
 func TestTextMixedMessageDecryptionWithPassword(t *testing.T) {
 	encrypted, err := NewPGPMessageFromArmored(readTestFile("message_mixedPasswordPublic", false))
 	if err != nil {
@@ -92,6 +142,122 @@ func TestTextMixedMessageDecryptionWithPassword(t *testing.T) {
 	assert.Exactly(t, expected, decrypted.GetBinary())
 }
 
+func TestMessageEncryptionWithKeysAndPasswords(t *testing.T) {
+	var message = NewPlainMessageFromString("The secret code is... 1, 2, 3, 4, 5")
+	passwords := [][]byte{testSymmetricKey, []byte("recovery password")}
+
+	encrypted, err := keyRingTestPublic.EncryptWithOptions(
+		message,
+		keyRingTestPrivate,
+		&EncryptionOptions{Passwords: passwords},
+	)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+
+	var pkesks, skesks int
+	packets := packet.NewReader(bytes.NewReader(encrypted.GetBinary()))
+	for {
+		p, err := packets.Next()
+		if err != nil {
+			break
+		}
+		switch p.(type) {
+		case *packet.EncryptedKey:
+			pkesks++
+		case *packet.SymmetricKeyEncrypted:
+			skesks++
+		}
+	}
+	assert.Exactly(t, 1, pkesks)
+	assert.Exactly(t, 2, skesks)
+
+	decrypted, err := DecryptMessageWithKeyRingOrPassword(encrypted, keyRingTestPrivate, nil, keyRingTestPublic, GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error when decrypting with key, got:", err)
+	}
+	assert.Exactly(t, message.GetString(), decrypted.GetString())
+
+	for _, password := range passwords {
+		decrypted, err = DecryptMessageWithKeyRingOrPassword(encrypted, nil, password, keyRingTestPublic, GetUnixTime())
+		if err != nil {
+			t.Fatal("Expected no error when decrypting with password, got:", err)
+		}
+		assert.Exactly(t, message.GetString(), decrypted.GetString())
+
+		decrypted, err = DecryptMessageWithPassword(encrypted, password)
+		if err != nil {
+			t.Fatal("Expected no error when decrypting with password, got:", err)
+		}
+		assert.Exactly(t, message.GetString(), decrypted.GetString())
+	}
+
+	reader, err := DecryptStreamWithKeyRingOrPassword(encrypted.NewReader(), nil, passwords[1], keyRingTestPublic, GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error when decrypting stream with password, got:", err)
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal("Expected no error when reading the stream, got:", err)
+	}
+	assert.Exactly(t, message.GetString(), string(data))
+	if err = reader.VerifySignature(); err != nil {
+		t.Fatal("Expected no error when verifying, got:", err)
+	}
+
+	_, err = DecryptMessageWithKeyRingOrPassword(encrypted, nil, []byte("Wrong password"), nil, 0)
+	assert.Error(t, err)
+
+	_, err = DecryptMessageWithKeyRingOrPassword(encrypted, nil, nil, nil, 0)
+	assert.Error(t, err)
+}
+
+func TestMessageEncryptionWithPasswordsOnly(t *testing.T) {
+	var message = NewPlainMessageFromString("The secret code is... 1, 2, 3, 4, 5")
+
+	encrypted, err := EncryptMessageWithOptions(message, &EncryptionOptions{Passwords: [][]byte{testSymmetricKey}})
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+
+	decrypted, err := DecryptMessageWithPassword(encrypted, testSymmetricKey)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, message.GetString(), decrypted.GetString())
+
+	_, err = EncryptMessageWithOptions(message, &EncryptionOptions{Passwords: [][]byte{}})
+	assert.Error(t, err)
+
+	_, err = EncryptMessageWithOptions(message, nil)
+	assert.Error(t, err)
+}
+
+func TestMessageEncryptionWithOptionsRecipients(t *testing.T) {
+	var message = NewPlainMessageFromString("The secret code is... 1, 2, 3, 4, 5")
+
+	encrypted, err := EncryptMessageWithOptions(message, &EncryptionOptions{
+		Recipients:     keyRingTestPublic,
+		SigningKeyRing: keyRingTestPrivate,
+		Passwords:      [][]byte{testSymmetricKey},
+	})
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+
+	decrypted, err := keyRingTestPrivate.Decrypt(encrypted, keyRingTestPublic, GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error when decrypting with the key ring, got:", err)
+	}
+	assert.Exactly(t, message.GetString(), decrypted.GetString())
+
+	decrypted, err = DecryptMessageWithPassword(encrypted, testSymmetricKey)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting with the password, got:", err)
+	}
+	assert.Exactly(t, message.GetString(), decrypted.GetString())
+}
+
 func TestTextMessageEncryption(t *testing.T) {
 	var message = NewPlainMessageFromString(
 		"The secret code is... 1, 2, 3, 4, 5. I repeat: the secret code is... 1, 2, 3, 4, 5",
@@ -398,6 +564,44 @@ func TestMessageGetEncryptionKeyIDs(t *testing.T) {
 	assert.Exactly(t, encKey.PublicKey.KeyId, ids[0])
 }
 
+func TestMessageGetEncryptionKeyIDsV6(t *testing.T) {
+	config := &packet.Config{
+		V6Keys:     true,
+		Algorithm:  packet.PubKeyAlgoEd25519,
+		AEADConfig: &packet.AEADConfig{},
+		Time:       pgp.getTimeGenerator(),
+	}
+	entity, err := openpgp.NewEntity(keyTestName, "", keyTestDomain, config)
+	if err != nil {
+		t.Fatal("Expected no error when generating key, got:", err)
+	}
+
+	// A v6 session key packet is written for SEIPDv2 messages
+	var buf bytes.Buffer
+	plaintext, err := openpgp.Encrypt(&buf, openpgp.EntityList{entity}, nil, nil, config)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	if _, err = plaintext.Write([]byte("plain text")); err != nil {
+		t.Fatal("Expected no error when writing, got:", err)
+	}
+	if err = plaintext.Close(); err != nil {
+		t.Fatal("Expected no error when closing, got:", err)
+	}
+	ciphertext := NewPGPMessage(buf.Bytes())
+	dump, err := ciphertext.Inspect()
+	if err != nil {
+		t.Fatal("Expected no error when inspecting, got:", err)
+	}
+	assert.Exactly(t, 6, dump.Packets[0].Version)
+
+	ids, ok := ciphertext.GetEncryptionKeyIDs()
+	assert.True(t, ok)
+	encKey, ok := entity.EncryptionKey(GetTime())
+	assert.True(t, ok)
+	assert.Exactly(t, []uint64{encKey.PublicKey.KeyId}, ids)
+}
+
 func TestMessageGetHexGetEncryptionKeyIDs(t *testing.T) {
 	ciphertext, err := NewPGPMessageFromArmored(readTestFile("message_multipleKeyID", false))
 	if err != nil {
@@ -478,6 +682,56 @@ func TestMessageGetArmoredWithEmptyHeaders(t *testing.T) {
 	assert.NotContains(t, armored, "Comment")
 }
 
+func TestMessageGetArmoredWithHeaders(t *testing.T) {
+	ciphertext, err := keyRingTestPublic.Encrypt(NewPlainMessageFromString("plain text"), keyRingTestPrivate)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	headers := armor.NewHeaders()
+	if err = headers.Set("Charset", "UTF-8"); err != nil {
+		t.Fatal("Expected no error when setting header, got:", err)
+	}
+	if err = headers.Set("MessageID", "0123456789abcdef0123456789abcdef"); err != nil {
+		t.Fatal("Expected no error when setting header, got:", err)
+	}
+
+	armored, err := ciphertext.GetArmoredWithHeaders(headers)
+	if err != nil {
+		t.Fatal("Could not armor the ciphertext:", err)
+	}
+	data, armoredHeaders, err := armor.UnarmorWithHeaders(armored)
+	if err != nil {
+		t.Fatal("Expected no error when unarmoring, got:", err)
+	}
+	assert.Exactly(t, ciphertext.GetBinary(), data)
+	assert.Exactly(t, []string{"Charset", "MessageID"}, armoredHeaders.GetNames())
+
+	signature, err := keyRingTestPrivate.SignDetached(NewPlainMessageFromString("plain text"))
+	if err != nil {
+		t.Fatal("Expected no error when signing, got:", err)
+	}
+	armored, err = signature.GetArmoredWithHeaders(headers)
+	if err != nil {
+		t.Fatal("Could not armor the signature:", err)
+	}
+	assert.Contains(t, armored, "-----BEGIN PGP SIGNATURE-----\nCharset: UTF-8\nMessageID: ")
+
+	key, err := keyRingTestPublic.GetKey(0)
+	if err != nil {
+		t.Fatal("Expected no error when getting key, got:", err)
+	}
+	armored, err = key.ArmorWithHeaders(headers)
+	if err != nil {
+		t.Fatal("Could not armor the key:", err)
+	}
+	assert.Contains(t, armored, "-----BEGIN PGP PUBLIC KEY BLOCK-----\nCharset: UTF-8\nMessageID: ")
+	armoredPublicKey, err := key.GetArmoredPublicKeyWithHeaders(headers)
+	if err != nil {
+		t.Fatal("Could not armor the public key:", err)
+	}
+	assert.Exactly(t, armored, armoredPublicKey)
+}
+
 func TestPGPSplitMessageFromArmoredWithAEAD(t *testing.T) {
 	var message = `-----BEGIN PGP MESSAGE-----
 
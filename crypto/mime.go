@@ -3,6 +3,8 @@ package crypto
 import (
 	"bytes"
 	"io/ioutil"
+	"mime"
+	"mime/multipart"
 	"net/mail"
 	"net/textproto"
 	"strings"
@@ -28,13 +30,36 @@ type MIMECallbacks interface {
 func (keyRing *KeyRing) DecryptMIMEMessage(
 	message *PGPMessage, verifyKey *KeyRing, callbacks MIMECallbacks, verifyTime int64,
 ) {
-	decryptedMessage, err := keyRing.Decrypt(message, verifyKey, verifyTime)
+	keyRing.decryptMIMEMessage(message, verifyKey, callbacks, verifyTime, "")
+}
+
+// DecryptMIMEMessageWithSigner decrypts a MIME message as DecryptMIMEMessage,
+// and checks that an identity of the key that made the embedded or MIME
+// signature has the expected email address, usually the From address of the
+// message. On a mismatch, OnVerified is called with constants.SIGNATURE_BAD_SIGNER.
+// * expectedSigner : the email address of the signer, or an RFC 5322 address such as a From header.
+func (keyRing *KeyRing) DecryptMIMEMessageWithSigner(
+	message *PGPMessage, verifyKey *KeyRing, callbacks MIMECallbacks, verifyTime int64, expectedSigner string,
+) {
+	keyRing.decryptMIMEMessage(message, verifyKey, callbacks, verifyTime, expectedSigner)
+}
+
+// ----- INTERNAL FUNCTIONS -----
+
+func (keyRing *KeyRing) decryptMIMEMessage(
+	message *PGPMessage, verifyKey *KeyRing, callbacks MIMECallbacks, verifyTime int64, expectedSigner string,
+) {
+	decryptedMessage, err := keyRing.getPGP().asymmetricDecrypt(
+		message.NewReader(), keyRing, nil, verifyKey, verifyTime, nil, expectedSigner,
+	)
 	embeddedSigError, err := separateSigError(err)
 	if err != nil {
 		callbacks.OnError(err)
 		return
 	}
-	body, attachments, attachmentHeaders, err := parseMIME(string(decryptedMessage.GetBinary()), verifyKey)
+	body, attachments, attachmentHeaders, err := parseMIMEWithSigner(
+		string(decryptedMessage.GetBinary()), verifyKey, keyRing.getPGP(), expectedSigner,
+	)
 	mimeSigError, err := separateSigError(err)
 	if err != nil {
 		callbacks.OnError(err)
@@ -54,11 +79,9 @@ func (keyRing *KeyRing) DecryptMIMEMessage(
 	for i := 0; i < len(attachments); i++ {
 		callbacks.OnAttachment(attachmentHeaders[i], []byte(attachments[i]))
 	}
-	callbacks.OnEncryptedHeaders("")
+	callbacks.OnEncryptedHeaders(parseProtectedHeaders(string(decryptedMessage.GetBinary())))
 }
 
-// ----- INTERNAL FUNCTIONS -----
-
 func prioritizeSignatureErrors(signatureErrs ...*SignatureVerificationError) (maxError int) {
 	// select error with the highest value, if any
 	// FAILED > NO VERIFIER > NOT SIGNED > SIGNATURE OK
@@ -79,14 +102,69 @@ func separateSigError(err error) (*SignatureVerificationError, error) {
 	return nil, err
 }
 
+// protectedHeaderFields are the header fields reported from protected headers, in order.
+var protectedHeaderFields = []string{"Subject", "From", "To", "Cc", "Reply-To", "Date"}
+
+// parseProtectedHeaders returns the protected headers of a decrypted MIME
+// message, as header lines with decoded values, or an empty string if the
+// message has none. The protected headers are the header fields of the root
+// entity, or of the signed entity of a multipart/signed root, if its
+// Content-Type has the protected-headers="v1" parameter.
+func parseProtectedHeaders(mimeBody string) string {
+	mm, err := mail.ReadMessage(strings.NewReader(mimeBody))
+	if err != nil {
+		return ""
+	}
+	header := textproto.MIMEHeader(mm.Header)
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	if mediaType == "multipart/signed" {
+		part, err := multipart.NewReader(mm.Body, params["boundary"]).NextPart()
+		if err != nil {
+			return ""
+		}
+		header = part.Header
+	}
+	return formatProtectedHeaders(header)
+}
+
+// formatProtectedHeaders returns the protected headers of an entity with the
+// protected-headers="v1" parameter, or an empty string.
+func formatProtectedHeaders(header textproto.MIMEHeader) string {
+	_, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil || params["protected-headers"] != "v1" {
+		return ""
+	}
+
+	decoder := new(mime.WordDecoder)
+	var headers strings.Builder
+	for _, field := range protectedHeaderFields {
+		for _, value := range header[field] {
+			if decoded, err := decoder.DecodeHeader(value); err == nil {
+				value = decoded
+			}
+			headers.WriteString(field + ": " + value + "\r\n")
+		}
+	}
+	return headers.String()
+}
+
 func parseMIME(
-	mimeBody string, verifierKey *KeyRing,
+	mimeBody string, verifierKey *KeyRing, pgp *GopenPGP,
+) (*gomime.BodyCollector, []string, []string, error) {
+	return parseMIMEWithSigner(mimeBody, verifierKey, pgp, "")
+}
+
+func parseMIMEWithSigner(
+	mimeBody string, verifierKey *KeyRing, pgp *GopenPGP, expectedSigner string,
 ) (*gomime.BodyCollector, []string, []string, error) {
 	mm, err := mail.ReadMessage(strings.NewReader(mimeBody))
 	if err != nil {
 		return nil, nil, nil, errors.Wrap(err, "gopenpgp: error in reading message")
 	}
-	config := &packet.Config{DefaultCipher: packet.CipherAES256, Time: getTimeGenerator()}
+	config := &packet.Config{DefaultCipher: packet.CipherAES256, Time: pgp.getTimeGenerator()}
 
 	h := textproto.MIMEHeader(mm.Header)
 	mmBodyData, err := ioutil.ReadAll(mm.Body)
@@ -105,6 +183,7 @@ func parseMIME(
 	}
 
 	signatureCollector := newSignatureCollector(mimeVisitor, verifierEntities, config)
+	signatureCollector.expectedSigner = expectedSigner
 
 	err = gomime.VisitAll(bytes.NewReader(mmBodyData), h, signatureCollector)
 	if err == nil && verifierKey != nil {
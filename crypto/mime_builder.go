@@ -0,0 +1,431 @@
+package crypto
+
+import (
+	"bytes"
+	gocrypto "crypto"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/angel-one/gopenpgp/v2/constants"
+	"github.com/angel-one/gopenpgp/v2/internal"
+	"github.com/pkg/errors"
+)
+
+// MIMEAttachment is an attachment of a MIME message built by BuildMIMEContent.
+type MIMEAttachment struct {
+	FileName string
+	MIMEType string
+	Data     []byte
+}
+
+// NewMIMEAttachment returns a MIMEAttachment.
+// * fileName : the name of the attached file.
+// * mimeType : the media type of the file, application/octet-stream if empty.
+// * data : the contents of the file.
+func NewMIMEAttachment(fileName, mimeType string, data []byte) *MIMEAttachment {
+	return &MIMEAttachment{FileName: fileName, MIMEType: mimeType, Data: clone(data)}
+}
+
+// ProtectedHeaders are the header fields of a PGP/MIME message protected by
+// its encryption and signature, following the protected headers (v1) format.
+type ProtectedHeaders struct {
+	Subject string
+	From    string
+	To      string
+	Cc      string
+	ReplyTo string
+	// Date is in RFC 5322 format, the current time of the instance if empty.
+	Date string
+}
+
+// NewProtectedHeaders returns ProtectedHeaders with the subject and addresses.
+// * subject : the real subject of the message.
+// * from, to, cc : RFC 5322 address lists, empty ones are omitted.
+// The Reply-To and Date fields can be set on the result.
+func NewProtectedHeaders(subject, from, to, cc string) *ProtectedHeaders {
+	return &ProtectedHeaders{Subject: subject, From: from, To: to, Cc: cc}
+}
+
+// BuildMIMEContent returns a MIME entity, with its headers, containing a
+// text body and the attachments: a single text part without attachments,
+// and a multipart/mixed entity otherwise. The body is quoted-printable
+// and the attachments are base64 encoded, so that the entity is not changed
+// by the canonicalization of a PGP/MIME signature.
+// * body : the text of the body.
+// * bodyMIMEType : the media type of the body, text/plain if empty.
+// * attachments : (optional) the attachments.
+func BuildMIMEContent(body, bodyMIMEType string, attachments []*MIMEAttachment) ([]byte, error) {
+	return pgp.BuildMIMEContent(body, bodyMIMEType, attachments)
+}
+
+// BuildMIMEContent returns a MIME entity with a boundary generated by the instance.
+// See BuildMIMEContent.
+func (pgp *GopenPGP) BuildMIMEContent(body, bodyMIMEType string, attachments []*MIMEAttachment) ([]byte, error) {
+	return pgp.buildMIMEContent(body, bodyMIMEType, attachments, nil)
+}
+
+// BuildMIMEContentWithProtectedHeaders returns a MIME entity as
+// BuildMIMEContent, whose root also carries the protected headers, marked
+// with the protected-headers="v1" parameter of its Content-Type.
+// The entity is meant to be encrypted, e.g. with EncryptMIME.
+// * body : the text of the body.
+// * bodyMIMEType : the media type of the body, text/plain if empty.
+// * attachments : (optional) the attachments.
+// * headers : the protected headers.
+func BuildMIMEContentWithProtectedHeaders(
+	body, bodyMIMEType string, attachments []*MIMEAttachment, headers *ProtectedHeaders,
+) ([]byte, error) {
+	return pgp.BuildMIMEContentWithProtectedHeaders(body, bodyMIMEType, attachments, headers)
+}
+
+// BuildMIMEContentWithProtectedHeaders returns a MIME entity with protected
+// headers, with the boundary and date of the instance.
+// See BuildMIMEContentWithProtectedHeaders.
+func (pgp *GopenPGP) BuildMIMEContentWithProtectedHeaders(
+	body, bodyMIMEType string, attachments []*MIMEAttachment, headers *ProtectedHeaders,
+) ([]byte, error) {
+	if headers == nil {
+		return nil, errors.New("gopenpgp: no protected headers")
+	}
+	return pgp.buildMIMEContent(body, bodyMIMEType, attachments, headers)
+}
+
+// EncryptMIMEWithProtectedHeaders builds a MIME entity with protected headers
+// as BuildMIMEContentWithProtectedHeaders, and returns it encrypted, and
+// optionally signed, as EncryptMIME. The multipart/encrypted entity has the
+// obscured Subject constants.ProtectedHeadersObscuredSubject.
+// * body : the text of the body.
+// * bodyMIMEType : the media type of the body, text/plain if empty.
+// * attachments : (optional) the attachments.
+// * headers : the protected headers.
+// * signKeyRing : (optional) the key ring signing the content.
+func (keyRing *KeyRing) EncryptMIMEWithProtectedHeaders(
+	body, bodyMIMEType string, attachments []*MIMEAttachment, headers *ProtectedHeaders, signKeyRing *KeyRing,
+) ([]byte, error) {
+	content, err := keyRing.getPGP().BuildMIMEContentWithProtectedHeaders(body, bodyMIMEType, attachments, headers)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := keyRing.EncryptMIME(content, signKeyRing)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte("Subject: "+constants.ProtectedHeadersObscuredSubject+"\r\n"), encrypted...), nil
+}
+
+func (pgp *GopenPGP) buildMIMEContent(
+	body, bodyMIMEType string, attachments []*MIMEAttachment, headers *ProtectedHeaders,
+) ([]byte, error) {
+	rootParams := map[string]string{}
+	rootHeader := textproto.MIMEHeader{}
+	if headers != nil {
+		var err error
+		if rootHeader, err = pgp.protectedHeaderFields(headers); err != nil {
+			return nil, err
+		}
+		rootParams["protected-headers"] = "v1"
+	}
+
+	if bodyMIMEType == "" {
+		bodyMIMEType = "text/plain"
+	}
+	bodyHeader := textproto.MIMEHeader{}
+	bodyHeader.Set("Content-Type", mime.FormatMediaType(bodyMIMEType, map[string]string{"charset": "utf-8"}))
+	bodyHeader.Set("Content-Transfer-Encoding", "quoted-printable")
+
+	var content bytes.Buffer
+	if len(attachments) == 0 {
+		rootParams["charset"] = "utf-8"
+		rootHeader.Set("Content-Type", mime.FormatMediaType(bodyMIMEType, rootParams))
+		rootHeader.Set("Content-Transfer-Encoding", "quoted-printable")
+		writeMIMEHeader(&content, rootHeader)
+		if err := writeQuotedPrintable(&content, body); err != nil {
+			return nil, err
+		}
+		return content.Bytes(), nil
+	}
+
+	boundary, err := pgp.newMIMEBoundary()
+	if err != nil {
+		return nil, err
+	}
+	rootParams["boundary"] = boundary
+	rootHeader.Set("Content-Type", mime.FormatMediaType("multipart/mixed", rootParams))
+	writeMIMEHeader(&content, rootHeader)
+
+	multipartWriter := multipart.NewWriter(&content)
+	if err = multipartWriter.SetBoundary(boundary); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in setting the MIME boundary")
+	}
+	part, err := multipartWriter.CreatePart(bodyHeader)
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in writing the MIME body")
+	}
+	if err = writeQuotedPrintable(part, body); err != nil {
+		return nil, err
+	}
+	for _, attachment := range attachments {
+		mimeType := attachment.MIMEType
+		if mimeType == "" {
+			mimeType = "application/octet-stream"
+		}
+		contentType := mime.FormatMediaType(mimeType, map[string]string{"name": attachment.FileName})
+		disposition := mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName})
+		if contentType == "" || disposition == "" {
+			return nil, errors.New("gopenpgp: invalid MIME type or file name of the attachment")
+		}
+		attachmentHeader := textproto.MIMEHeader{}
+		attachmentHeader.Set("Content-Type", contentType)
+		attachmentHeader.Set("Content-Disposition", disposition)
+		attachmentHeader.Set("Content-Transfer-Encoding", "base64")
+		part, err = multipartWriter.CreatePart(attachmentHeader)
+		if err != nil {
+			return nil, errors.Wrap(err, "gopenpgp: error in writing the MIME attachment")
+		}
+		if err = writeBase64Lines(part, attachment.Data); err != nil {
+			return nil, err
+		}
+	}
+	if err = multipartWriter.Close(); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in writing the MIME message")
+	}
+	return content.Bytes(), nil
+}
+
+// SignMIME returns an RFC 3156 multipart/signed MIME entity, with the content
+// as first part and its detached signature by the key ring as
+// application/pgp-signature part. The line endings of the content are
+// canonicalized to CRLF and the trailing whitespace is removed before signing,
+// as done by the verification of DecryptMIMEMessage.
+// * content : the MIME entity to sign, with its headers, e.g. from BuildMIMEContent.
+func (keyRing *KeyRing) SignMIME(content []byte) ([]byte, error) {
+	canonicalContent := []byte(internal.Canonicalize(internal.TrimEachLine(string(content))))
+	signature, err := keyRing.SignDetached(keyRing.getPGP().NewPlainMessage(canonicalContent))
+	if err != nil {
+		return nil, err
+	}
+	micalg, err := signatureMicAlg(signature)
+	if err != nil {
+		return nil, err
+	}
+	armoredSignature, err := signature.GetArmored()
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in armoring the signature")
+	}
+	boundary, err := keyRing.getPGP().newMIMEBoundary()
+	if err != nil {
+		return nil, err
+	}
+
+	var signed bytes.Buffer
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mime.FormatMediaType("multipart/signed", map[string]string{
+		"micalg":   micalg,
+		"protocol": "application/pgp-signature",
+		"boundary": boundary,
+	}))
+	writeMIMEHeader(&signed, header)
+
+	// The content is written as is, since it is the signed data
+	signed.WriteString("--" + boundary + "\r\n")
+	signed.Write(canonicalContent)
+	signed.WriteString("\r\n--" + boundary + "\r\n")
+	signatureHeader := textproto.MIMEHeader{}
+	signatureHeader.Set("Content-Type", `application/pgp-signature; name="signature.asc"`)
+	signatureHeader.Set("Content-Description", "OpenPGP digital signature")
+	signatureHeader.Set("Content-Disposition", `attachment; filename="signature.asc"`)
+	writeMIMEHeader(&signed, signatureHeader)
+	signed.WriteString(internal.Canonicalize(armoredSignature))
+	signed.WriteString("\r\n--" + boundary + "--\r\n")
+	return signed.Bytes(), nil
+}
+
+// EncryptMIME returns an RFC 3156 multipart/encrypted MIME entity, with the
+// content encrypted to the key ring in an armored application/octet-stream part.
+// If a signing key ring is given, the content is first wrapped in a
+// multipart/signed entity, as done by SignMIME, and the signed entity is encrypted.
+// * content : the MIME entity to encrypt, with its headers, e.g. from BuildMIMEContent.
+// * signKeyRing : (optional) the key ring signing the content.
+func (keyRing *KeyRing) EncryptMIME(content []byte, signKeyRing *KeyRing) ([]byte, error) {
+	var err error
+	if signKeyRing != nil {
+		if content, err = signKeyRing.SignMIME(content); err != nil {
+			return nil, err
+		}
+	}
+	encrypted, err := keyRing.Encrypt(keyRing.getPGP().NewPlainMessage(content), nil)
+	if err != nil {
+		return nil, err
+	}
+	armoredMessage, err := encrypted.GetArmored()
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in armoring the message")
+	}
+	boundary, err := keyRing.getPGP().newMIMEBoundary()
+	if err != nil {
+		return nil, err
+	}
+
+	var message bytes.Buffer
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mime.FormatMediaType("multipart/encrypted", map[string]string{
+		"protocol": "application/pgp-encrypted",
+		"boundary": boundary,
+	}))
+	writeMIMEHeader(&message, header)
+
+	multipartWriter := multipart.NewWriter(&message)
+	if err = multipartWriter.SetBoundary(boundary); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in setting the MIME boundary")
+	}
+	versionHeader := textproto.MIMEHeader{}
+	versionHeader.Set("Content-Type", "application/pgp-encrypted")
+	versionHeader.Set("Content-Description", "PGP/MIME version identification")
+	part, err := multipartWriter.CreatePart(versionHeader)
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in writing the MIME version part")
+	}
+	if _, err = part.Write([]byte("Version: 1\r\n")); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in writing the MIME version part")
+	}
+	encryptedHeader := textproto.MIMEHeader{}
+	encryptedHeader.Set("Content-Type", `application/octet-stream; name="encrypted.asc"`)
+	encryptedHeader.Set("Content-Description", "OpenPGP encrypted message")
+	encryptedHeader.Set("Content-Disposition", `inline; filename="encrypted.asc"`)
+	part, err = multipartWriter.CreatePart(encryptedHeader)
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in writing the MIME encrypted part")
+	}
+	if _, err = part.Write([]byte(internal.Canonicalize(armoredMessage))); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in writing the MIME encrypted part")
+	}
+	if err = multipartWriter.Close(); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in writing the MIME message")
+	}
+	return message.Bytes(), nil
+}
+
+// ----- INTERNAL FUNCTIONS -----
+
+func (pgp *GopenPGP) newMIMEBoundary() (string, error) {
+	token, err := pgp.randomToken(24)
+	if err != nil {
+		return "", errors.Wrap(err, "gopenpgp: error in generating the MIME boundary")
+	}
+	return "gopenpgp-" + hex.EncodeToString(token), nil
+}
+
+// protectedHeaderFields returns the encoded header fields of the protected headers.
+func (pgp *GopenPGP) protectedHeaderFields(headers *ProtectedHeaders) (textproto.MIMEHeader, error) {
+	fields := textproto.MIMEHeader{}
+	if headers.Subject != "" {
+		fields.Set("Subject", mime.QEncoding.Encode("utf-8", headers.Subject))
+	}
+	for _, addressField := range []struct{ key, value string }{
+		{"From", headers.From}, {"To", headers.To}, {"Cc", headers.Cc}, {"Reply-To", headers.ReplyTo},
+	} {
+		if addressField.value == "" {
+			continue
+		}
+		addresses, err := mail.ParseAddressList(addressField.value)
+		if err != nil {
+			return nil, errors.Wrap(err, "gopenpgp: invalid addresses in the protected headers")
+		}
+		encoded := make([]string, len(addresses))
+		for i, address := range addresses {
+			encoded[i] = address.String()
+		}
+		fields.Set(addressField.key, strings.Join(encoded, ", "))
+	}
+	date := headers.Date
+	if date == "" {
+		date = pgp.getNow().Format(time.RFC1123Z)
+	} else if _, err := mail.ParseDate(date); err != nil || strings.ContainsAny(date, "\r\n") {
+		return nil, errors.New("gopenpgp: invalid date in the protected headers")
+	}
+	fields.Set("Date", date)
+	return fields, nil
+}
+
+// writeMIMEHeader writes the header fields in a stable order, followed by an empty line.
+func writeMIMEHeader(buffer *bytes.Buffer, header textproto.MIMEHeader) {
+	keys := append(append([]string{}, protectedHeaderFields...),
+		"Content-Type", "Content-Description", "Content-Disposition", "Content-Transfer-Encoding")
+	for _, key := range keys {
+		for _, value := range header[key] {
+			buffer.WriteString(key + ": " + value + "\r\n")
+		}
+	}
+	buffer.WriteString("\r\n")
+}
+
+func writeQuotedPrintable(w io.Writer, text string) error {
+	qpWriter := quotedprintable.NewWriter(w)
+	if _, err := qpWriter.Write([]byte(text)); err != nil {
+		return errors.Wrap(err, "gopenpgp: error in encoding the MIME body")
+	}
+	if err := qpWriter.Close(); err != nil {
+		return errors.Wrap(err, "gopenpgp: error in encoding the MIME body")
+	}
+	return nil
+}
+
+// writeBase64Lines writes data in base64, in lines of 76 characters.
+func writeBase64Lines(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		if _, err := w.Write([]byte(encoded[:76] + "\r\n")); err != nil {
+			return errors.Wrap(err, "gopenpgp: error in encoding the MIME attachment")
+		}
+		encoded = encoded[76:]
+	}
+	if _, err := w.Write([]byte(encoded + "\r\n")); err != nil {
+		return errors.Wrap(err, "gopenpgp: error in encoding the MIME attachment")
+	}
+	return nil
+}
+
+// micAlgs are the RFC 3156 micalg parameters of the supported hashes.
+var micAlgs = map[gocrypto.Hash]string{
+	gocrypto.SHA1:   "pgp-sha1",
+	gocrypto.SHA224: "pgp-sha224",
+	gocrypto.SHA256: "pgp-sha256",
+	gocrypto.SHA384: "pgp-sha384",
+	gocrypto.SHA512: "pgp-sha512",
+}
+
+// micAlgHash returns the hash of an RFC 3156 micalg parameter, which is case-insensitive.
+func micAlgHash(micalg string) (gocrypto.Hash, bool) {
+	for hashFunc, name := range micAlgs {
+		if strings.EqualFold(name, micalg) {
+			return hashFunc, true
+		}
+	}
+	return 0, false
+}
+
+// signatureMicAlg returns the RFC 3156 micalg parameter for the hash of a signature.
+func signatureMicAlg(signature *PGPSignature) (string, error) {
+	p, err := packet.Read(bytes.NewReader(signature.GetBinary()))
+	if err != nil {
+		return "", errors.Wrap(err, "gopenpgp: error in reading the signature")
+	}
+	sig, ok := p.(*packet.Signature)
+	if !ok {
+		return "", errors.New("gopenpgp: invalid signature packet")
+	}
+	micalg, ok := micAlgs[sig.Hash]
+	if !ok {
+		return "", errors.New("gopenpgp: unsupported signature hash for PGP/MIME")
+	}
+	return micalg, nil
+}
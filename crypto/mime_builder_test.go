@@ -0,0 +1,176 @@
+package crypto
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"testing"
+
+	"github.com/angel-one/gopenpgp/v2/constants"
+	"github.com/stretchr/testify/assert"
+)
+
+const testMIMEBody = "Hello,  \nthe report is attached.\t\n\n-- \nAlice"
+
+type builtMIMECallbacks struct {
+	body        string
+	attachments [][]byte
+	headers     string
+	verified    int
+	errs        []error
+}
+
+func (c *builtMIMECallbacks) OnBody(body string, mimetype string) { c.body = body }
+func (c *builtMIMECallbacks) OnAttachment(headers string, data []byte) {
+	c.attachments = append(c.attachments, data)
+}
+func (c *builtMIMECallbacks) OnEncryptedHeaders(headers string) { c.headers = headers }
+func (c *builtMIMECallbacks) OnVerified(verified int)           { c.verified = verified }
+func (c *builtMIMECallbacks) OnError(err error)                 { c.errs = append(c.errs, err) }
+
+func buildTestMIMEContent(t *testing.T) []byte {
+	content, err := BuildMIMEContent(testMIMEBody, "", []*MIMEAttachment{
+		NewMIMEAttachment("report.pdf", "application/pdf", bytes.Repeat([]byte{0, 1, 2, 255}, 100)),
+	})
+	if err != nil {
+		t.Fatal("Expected no error while building the MIME content, got:", err)
+	}
+	return content
+}
+
+func TestSignMIME(t *testing.T) {
+	signed, err := keyRingTestPrivate.SignMIME(buildTestMIMEContent(t))
+	if err != nil {
+		t.Fatal("Expected no error while signing, got:", err)
+	}
+	assert.Contains(t, string(signed), `micalg=pgp-sha512`)
+
+	body, attachments, _, err := parseMIME(string(signed), keyRingTestPublic, pgp)
+	if err != nil {
+		t.Fatal("Expected no error while verifying the MIME signature, got:", err)
+	}
+	bodyContent, bodyMIMEType := body.GetBody()
+	assert.Exactly(t, "text/plain", bodyMIMEType)
+	assert.Exactly(t, "Hello,  \r\nthe report is attached.\t\r\n\r\n-- \r\nAlice", bodyContent)
+	assert.Len(t, attachments, 1)
+
+	tampered := bytes.Replace(signed, []byte("Content-Transfer-Encoding: quoted-printable"), []byte("Content-Transfer-Encoding: 8bit"), 1)
+	_, _, _, err = parseMIME(string(tampered), keyRingTestPublic, pgp)
+	sigErr, ok := err.(SignatureVerificationError)
+	assert.True(t, ok)
+	assert.Exactly(t, constants.SIGNATURE_FAILED, sigErr.Status)
+}
+
+func TestEncryptMIME(t *testing.T) {
+	encrypted, err := keyRingTestPublic.EncryptMIME(buildTestMIMEContent(t), keyRingTestPrivate)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+
+	entity, err := mail.ReadMessage(bytes.NewReader(encrypted))
+	if err != nil {
+		t.Fatal("Expected no error while reading the MIME message, got:", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(entity.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal("Expected no error while parsing the content type, got:", err)
+	}
+	assert.Exactly(t, "multipart/encrypted", mediaType)
+	assert.Exactly(t, "application/pgp-encrypted", params["protocol"])
+
+	reader := multipart.NewReader(entity.Body, params["boundary"])
+	versionPart, err := reader.NextPart()
+	if err != nil {
+		t.Fatal("Expected no error while reading the version part, got:", err)
+	}
+	version, _ := ioutil.ReadAll(versionPart)
+	assert.Exactly(t, "application/pgp-encrypted", versionPart.Header.Get("Content-Type"))
+	assert.Exactly(t, "Version: 1\r\n", string(version))
+	encryptedPart, err := reader.NextPart()
+	if err != nil {
+		t.Fatal("Expected no error while reading the encrypted part, got:", err)
+	}
+	armored, _ := ioutil.ReadAll(encryptedPart)
+	message, err := NewPGPMessageFromArmored(string(armored))
+	if err != nil {
+		t.Fatal("Expected no error while unarmoring the message, got:", err)
+	}
+
+	callbacks := &builtMIMECallbacks{}
+	keyRingTestPrivate.DecryptMIMEMessage(message, keyRingTestPublic, callbacks, GetUnixTime())
+	assert.Empty(t, callbacks.errs)
+	assert.Exactly(t, constants.SIGNATURE_OK, callbacks.verified)
+	assert.Contains(t, callbacks.body, "the report is attached.")
+	assert.Exactly(t, [][]byte{bytes.Repeat([]byte{0, 1, 2, 255}, 100)}, callbacks.attachments)
+}
+
+func TestBuildMIMEContentDeterminism(t *testing.T) {
+	first, err := newTestingInstance("seed").BuildMIMEContent("body", "text/html", []*MIMEAttachment{NewMIMEAttachment("a.txt", "", []byte("a"))})
+	if err != nil {
+		t.Fatal("Expected no error while building the MIME content, got:", err)
+	}
+	second, err := newTestingInstance("seed").BuildMIMEContent("body", "text/html", []*MIMEAttachment{NewMIMEAttachment("a.txt", "", []byte("a"))})
+	if err != nil {
+		t.Fatal("Expected no error while building the MIME content, got:", err)
+	}
+	assert.Exactly(t, first, second)
+	assert.Contains(t, string(first), "Content-Type: text/html; charset=utf-8\r\n")
+	assert.Contains(t, string(first), "Content-Type: application/octet-stream; name=a.txt\r\n")
+}
+
+func TestProtectedHeaders(t *testing.T) {
+	headers := NewProtectedHeaders("Quarterly résumé", "Alice <alice@example.com>", "bob@example.com, Carol <carol@example.com>", "")
+	headers.ReplyTo = "replies@example.com"
+	headers.Date = "Mon, 19 Oct 2026 10:00:00 +0000"
+	for _, attachments := range [][]*MIMEAttachment{nil, {NewMIMEAttachment("a.txt", "text/plain", []byte("a"))}} {
+		encrypted, err := keyRingTestPublic.EncryptMIMEWithProtectedHeaders(testMIMEBody, "", attachments, headers, keyRingTestPrivate)
+		if err != nil {
+			t.Fatal("Expected no error while encrypting, got:", err)
+		}
+		assert.NotContains(t, string(encrypted), "Quarterly")
+
+		entity, err := mail.ReadMessage(bytes.NewReader(encrypted))
+		if err != nil {
+			t.Fatal("Expected no error while reading the MIME message, got:", err)
+		}
+		assert.Exactly(t, constants.ProtectedHeadersObscuredSubject, entity.Header.Get("Subject"))
+		_, params, _ := mime.ParseMediaType(entity.Header.Get("Content-Type"))
+		reader := multipart.NewReader(entity.Body, params["boundary"])
+		if _, err = reader.NextPart(); err != nil {
+			t.Fatal("Expected no error while reading the version part, got:", err)
+		}
+		encryptedPart, err := reader.NextPart()
+		if err != nil {
+			t.Fatal("Expected no error while reading the encrypted part, got:", err)
+		}
+		armored, _ := ioutil.ReadAll(encryptedPart)
+		message, err := NewPGPMessageFromArmored(string(armored))
+		if err != nil {
+			t.Fatal("Expected no error while unarmoring the message, got:", err)
+		}
+
+		callbacks := &builtMIMECallbacks{}
+		keyRingTestPrivate.DecryptMIMEMessage(message, keyRingTestPublic, callbacks, GetUnixTime())
+		assert.Empty(t, callbacks.errs)
+		assert.Exactly(t, constants.SIGNATURE_OK, callbacks.verified)
+		assert.Exactly(t,
+			"Subject: Quarterly résumé\r\n"+
+				"From: \"Alice\" <alice@example.com>\r\n"+
+				"To: <bob@example.com>, \"Carol\" <carol@example.com>\r\n"+
+				"Reply-To: <replies@example.com>\r\n"+
+				"Date: Mon, 19 Oct 2026 10:00:00 +0000\r\n",
+			callbacks.headers,
+		)
+		assert.Contains(t, callbacks.body, "the report is attached.")
+	}
+
+	_, err := BuildMIMEContentWithProtectedHeaders("body", "", nil, NewProtectedHeaders("subject", "not an address", "", ""))
+	assert.Error(t, err)
+	injected := NewProtectedHeaders("subject", "", "", "")
+	injected.Date = "Mon, 19 Oct 2026 10:00:00 +0000\r\nBcc: eve@example.com"
+	_, err = BuildMIMEContentWithProtectedHeaders("body", "", nil, injected)
+	assert.Error(t, err)
+	assert.Exactly(t, "", parseProtectedHeaders(string(buildTestMIMEContent(t))))
+}
@@ -0,0 +1,451 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	gocrypto "crypto"
+	"hash"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	pgpErrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	gomime "github.com/ProtonMail/go-mime"
+	"github.com/angel-one/gopenpgp/v2/armor"
+	"github.com/angel-one/gopenpgp/v2/constants"
+	"github.com/pkg/errors"
+)
+
+// maxMIMESignatureSize is the maximum size of the application/pgp-signature
+// part of a multipart/signed entity.
+const maxMIMESignatureSize = 1 << 20
+
+// maxMIMEDepth is the maximum nesting depth of the multipart entities walked
+// by DecryptMIMEStream.
+const maxMIMEDepth = 32
+
+// MIMEStreamCallbacks defines callback methods to process a MIME message
+// decrypted as a stream by DecryptMIMEStream.
+type MIMEStreamCallbacks interface {
+	OnBody(body string, mimetype string)
+	// OnAttachment is called with the headers and the decoded contents of an
+	// attachment, as it is decrypted. The reader is only valid during the
+	// call, and the data that is not read is skipped.
+	OnAttachment(headers string, data Reader)
+	OnEncryptedHeaders(headers string)
+	// OnVerified is called once the whole message has been read.
+	OnVerified(verified int)
+	OnError(err error)
+}
+
+// DecryptMIMEStream decrypts a MIME message as a stream, and walks its MIME
+// tree as it is decrypted: each attachment is passed to the callbacks as a
+// reader, so that only the text bodies are held in memory. The signed entity
+// of a multipart/signed message is hashed, canonicalized, with the hash of its
+// micalg parameter, and its signature is verified against this hash: the
+// signatures whose hash does not match the micalg parameter, and the salted
+// (version 6) signatures, fail the verification. The embedded and MIME
+// signatures are verified once the whole stream has been read, and the status
+// is passed to OnVerified if verifyKey is not nil.
+// As with DecryptStream, the data is released before the integrity of the
+// message is checked at the end of the stream: an integrity failure is
+// reported to OnError, after the attachments. DecryptMIMEStreamWithOptions
+// selects the integrity-first decryption instead.
+// * message : the encrypted message.
+// * verifyKey : (optional) the key ring verifying the signatures.
+// * callbacks : the callbacks receiving the parts of the message.
+// * verifyTime : the time of the verification, 0 to disable the expiration checks.
+func (keyRing *KeyRing) DecryptMIMEStream(
+	message Reader, verifyKey *KeyRing, callbacks MIMEStreamCallbacks, verifyTime int64,
+) {
+	keyRing.decryptMIMEStream(message, verifyKey, callbacks, verifyTime, nil, "")
+}
+
+// DecryptMIMEStreamWithSigner decrypts a MIME message as a stream as
+// DecryptMIMEStream, and checks that an identity of the key that made the
+// embedded or MIME signature has the expected email address, usually the From
+// address of the message. On a mismatch, OnVerified is called with
+// constants.SIGNATURE_BAD_SIGNER.
+// * expectedSigner : the email address of the signer, or an RFC 5322 address such as a From header.
+func (keyRing *KeyRing) DecryptMIMEStreamWithSigner(
+	message Reader, verifyKey *KeyRing, callbacks MIMEStreamCallbacks, verifyTime int64, expectedSigner string,
+) {
+	keyRing.decryptMIMEStream(message, verifyKey, callbacks, verifyTime, nil, expectedSigner)
+}
+
+// DecryptMIMEStreamWithOptions decrypts a MIME message as a stream as
+// DecryptMIMEStream. With the integrity-first decryption selected by the
+// options, the body and the attachments are only passed to the callbacks
+// once the integrity of the message has been checked.
+// * options : (optional) the decryption settings, nil selects the defaults.
+func (keyRing *KeyRing) DecryptMIMEStreamWithOptions(
+	message Reader, verifyKey *KeyRing, callbacks MIMEStreamCallbacks, verifyTime int64, options *DecryptionOptions,
+) {
+	keyRing.decryptMIMEStream(message, verifyKey, callbacks, verifyTime, options, "")
+}
+
+// ----- INTERNAL FUNCTIONS -----
+
+func (keyRing *KeyRing) decryptMIMEStream(
+	message Reader,
+	verifyKey *KeyRing,
+	callbacks MIMEStreamCallbacks,
+	verifyTime int64,
+	options *DecryptionOptions,
+	expectedSigner string,
+) {
+	plainReader, err := keyRing.DecryptStreamWithOptions(message, verifyKey, verifyTime, options)
+	if err != nil {
+		callbacks.OnError(err)
+		return
+	}
+	plainReader.expectedSigner = expectedSigner
+	walker := &mimeStreamWalker{
+		callbacks:      callbacks,
+		verifyKey:      verifyKey,
+		verifyTime:     verifyTime,
+		expectedSigner: expectedSigner,
+	}
+	if err = walker.walkMessage(plainReader); err != nil {
+		callbacks.OnError(err)
+		return
+	}
+	// The embedded signature can only be verified once the plaintext is read entirely
+	if _, err = io.Copy(ioutil.Discard, plainReader); err != nil {
+		callbacks.OnError(errors.Wrap(err, "gopenpgp: error in reading the message"))
+		return
+	}
+	walker.reportBody()
+	if verifyKey == nil {
+		return
+	}
+
+	embeddedSigError, err := separateSigError(plainReader.VerifySignature())
+	if err != nil {
+		callbacks.OnError(err)
+		return
+	}
+	// We only consider the signature to be failed if both embedded and mime verification failed
+	if embeddedSigError != nil && walker.mimeSigError != nil {
+		callbacks.OnError(embeddedSigError)
+		callbacks.OnError(walker.mimeSigError)
+		callbacks.OnVerified(prioritizeSignatureErrors(embeddedSigError, walker.mimeSigError))
+	} else {
+		callbacks.OnVerified(constants.SIGNATURE_OK)
+	}
+}
+
+// mimeStreamWalker walks the MIME tree of a decrypted stream.
+type mimeStreamWalker struct {
+	callbacks  MIMEStreamCallbacks
+	verifyKey  *KeyRing
+	verifyTime int64
+	// expectedSigner is the email address that an identity of the signer must have, if set.
+	expectedSigner string
+	plainBody      bytes.Buffer
+	htmlBody       bytes.Buffer
+	hasHTML        bool
+	mimeSigError   *SignatureVerificationError
+}
+
+func (w *mimeStreamWalker) walkMessage(r io.Reader) error {
+	reader := bufio.NewReader(r)
+	header, err := textproto.NewReader(reader).ReadMIMEHeader()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return errors.Wrap(err, "gopenpgp: error in reading message")
+	}
+	mediaType, params := mimeContentType(header)
+	if mediaType == "multipart/signed" {
+		return w.walkSigned(reader, params)
+	}
+	w.setMIMESigError(newSignatureNotSigned())
+	w.callbacks.OnEncryptedHeaders(formatProtectedHeaders(header))
+	return w.walk(reader, header, 0)
+}
+
+// walk reports the body and attachments of an entity, at the given nesting depth.
+func (w *mimeStreamWalker) walk(r io.Reader, header textproto.MIMEHeader, depth int) error {
+	mediaType, params := mimeContentType(header)
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if depth >= maxMIMEDepth {
+			return errors.New("gopenpgp: the MIME entities are nested too deeply")
+		}
+		multipartReader := multipart.NewReader(r, params["boundary"])
+		for {
+			part, err := multipartReader.NextPart()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return errors.Wrap(err, "gopenpgp: error in reading the MIME parts")
+			}
+			if err = w.walk(part, part.Header, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	body := gomime.DecodeContentEncoding(r, header.Get("Content-Transfer-Encoding"))
+	if body == nil {
+		body = r
+	}
+	disposition, _, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	if (mediaType == "text/plain" || mediaType == "text/html") && disposition != "attachment" {
+		data, err := ioutil.ReadAll(body)
+		if err != nil {
+			return errors.Wrap(err, "gopenpgp: error in reading the MIME body")
+		}
+		if decoded, err := gomime.DecodeCharset(data, mediaType, params); err == nil {
+			data = decoded
+		}
+		if mediaType == "text/html" {
+			w.hasHTML = true
+			w.htmlBody.Write(data)
+		} else {
+			w.plainBody.Write(data)
+		}
+		return nil
+	}
+
+	var headerBuffer bytes.Buffer
+	if err := http.Header(header).Write(&headerBuffer); err != nil {
+		return errors.Wrap(err, "gopenpgp: error in writing the attachment headers")
+	}
+	w.callbacks.OnAttachment(headerBuffer.String(), body)
+	if _, err := io.Copy(ioutil.Discard, body); err != nil {
+		return errors.Wrap(err, "gopenpgp: error in reading the MIME attachment")
+	}
+	return nil
+}
+
+// walkSigned walks the signed entity of a multipart/signed entity, while
+// hashing it canonicalized with the hash of the micalg parameter, and
+// verifies the signature against this hash.
+func (w *mimeStreamWalker) walkSigned(reader *bufio.Reader, params map[string]string) error {
+	var signed hash.Hash
+	var canonicalizer *canonicalTextWriter
+	hashFunc, supportedHash := micAlgHash(params["micalg"])
+	if w.verifyKey != nil && supportedHash {
+		signed = hashFunc.New()
+		canonicalizer = &canonicalTextWriter{out: signed}
+	}
+	signedPart := &signedPartReader{
+		reader: reader, delimiter: []byte("--" + params["boundary"]), canonicalizer: canonicalizer,
+	}
+	partReader := bufio.NewReader(signedPart)
+	header, err := textproto.NewReader(partReader).ReadMIMEHeader()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return errors.Wrap(err, "gopenpgp: error in reading the signed MIME entity")
+	}
+	w.callbacks.OnEncryptedHeaders(formatProtectedHeaders(header))
+	if err = w.walk(partReader, header, 1); err != nil {
+		return err
+	}
+	if _, err = io.Copy(ioutil.Discard, partReader); err != nil {
+		return errors.Wrap(err, "gopenpgp: error in reading the signed MIME entity")
+	}
+
+	// The rest of the entity starts with the delimiter read by signedPart
+	rest := multipart.NewReader(io.MultiReader(bytes.NewReader(signedPart.delimiterLine), reader), params["boundary"])
+	signaturePart, err := rest.NextPart()
+	if errors.Is(err, io.EOF) {
+		w.setMIMESigError(newSignatureNotSigned())
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "gopenpgp: error in reading the MIME signature")
+	}
+	signature, err := ioutil.ReadAll(io.LimitReader(
+		gomime.DecodeContentEncoding(signaturePart, signaturePart.Header.Get("Content-Transfer-Encoding")),
+		maxMIMESignatureSize,
+	))
+	if err != nil {
+		return errors.Wrap(err, "gopenpgp: error in reading the MIME signature")
+	}
+	for {
+		part, err := rest.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "gopenpgp: error in reading the MIME parts")
+		}
+		if _, err = io.Copy(ioutil.Discard, part); err != nil {
+			return errors.Wrap(err, "gopenpgp: error in reading the MIME parts")
+		}
+	}
+
+	switch {
+	case w.verifyKey == nil:
+		w.setMIMESigError(newSignatureNoVerifier())
+	case signed == nil:
+		w.setMIMESigError(newSignatureFailed(errors.New("gopenpgp: unsupported micalg parameter: " + params["micalg"])))
+	default:
+		w.setMIMESigError(w.verifySignature(signed, hashFunc, signature))
+	}
+	return nil
+}
+
+func (w *mimeStreamWalker) setMIMESigError(err error) {
+	if sigErr, ok := err.(SignatureVerificationError); ok {
+		w.mimeSigError = &sigErr
+	} else {
+		w.mimeSigError = nil
+	}
+}
+
+// verifySignature verifies the detached signature of the signed entity,
+// against the hash of the canonicalized entity.
+func (w *mimeStreamWalker) verifySignature(signed hash.Hash, hashFunc gocrypto.Hash, signature []byte) error {
+	if unarmored, err := armor.Unarmor(string(signature)); err == nil {
+		signature = unarmored
+	}
+	_, err := verifySignatureDigest(w.verifyKey.entities, signed, hashFunc, signature, w.verifyTime, w.expectedSigner)
+	if errors.Is(err, pgpErrors.ErrUnknownIssuer) {
+		return newSignatureNoVerifier()
+	}
+	return err
+}
+
+func (w *mimeStreamWalker) reportBody() {
+	if w.hasHTML {
+		w.callbacks.OnBody(sanitizeString(w.htmlBody.String()), "text/html")
+	} else {
+		w.callbacks.OnBody(sanitizeString(w.plainBody.String()), "text/plain")
+	}
+}
+
+// mimeContentType returns the media type and parameters of an entity, text/plain by default.
+func mimeContentType(header textproto.MIMEHeader) (string, map[string]string) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil || mediaType == "" {
+		return "text/plain", map[string]string{}
+	}
+	return mediaType, params
+}
+
+// signedPartReader reads the first part of a multipart/signed entity, up to
+// the line ending before the next delimiter, as gomime.GetRawMimePart.
+// The canonicalized part is written to the canonicalizer, as in the
+// verification of SignatureCollector.
+type signedPartReader struct {
+	reader        *bufio.Reader
+	delimiter     []byte
+	canonicalizer *canonicalTextWriter
+	started       bool   // the opening delimiter was read
+	lineStart     bool   // the next fragment starts a line
+	firstLine     bool   // no line of the part was read yet
+	lineEnding    []byte // the held back ending of the last line
+	pending       []byte
+	delimiterLine []byte // the delimiter line following the part
+}
+
+func (r *signedPartReader) Read(b []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.delimiterLine != nil {
+			return 0, io.EOF
+		}
+		if err := r.readFragment(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *signedPartReader) readFragment() error {
+	fragment, err := r.reader.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		err = nil
+	}
+	if err != nil && (!errors.Is(err, io.EOF) || len(fragment) == 0) {
+		return wrapError(unexpectedEOF(err), "gopenpgp: error in reading the signed MIME entity")
+	}
+	complete := len(fragment) > 0 && fragment[len(fragment)-1] == '\n'
+	atLineStart := r.lineStart || !r.started
+	r.lineStart = complete
+
+	isDelimiter := atLineStart && bytes.HasPrefix(fragment, r.delimiter)
+	if !r.started {
+		// Preamble
+		if isDelimiter {
+			r.started = true
+			r.firstLine = true
+		}
+		return nil
+	}
+	if isDelimiter {
+		r.delimiterLine = clone(fragment)
+		r.canonicalizer.finish()
+		return nil
+	}
+
+	if atLineStart {
+		if !r.firstLine {
+			r.pending = append(r.pending, r.lineEnding...)
+			r.canonicalizer.lineBreak()
+		}
+		r.firstLine = false
+	}
+	content := fragment
+	if complete {
+		endingLength := 1
+		if len(fragment) > 1 && fragment[len(fragment)-2] == '\r' {
+			endingLength = 2
+		}
+		content = fragment[:len(fragment)-endingLength]
+		r.lineEnding = append(r.lineEnding[:0], fragment[len(content):]...)
+	}
+	r.pending = append(r.pending, content...)
+	r.canonicalizer.write(content)
+	return nil
+}
+
+// canonicalTextWriter writes text with CRLF line endings and without the
+// trailing whitespace of each line, as internal.Canonicalize(internal.TrimEachLine(text)).
+// The line breaks and whitespace are only written once followed by text.
+type canonicalTextWriter struct {
+	out        io.Writer
+	lineBreaks int
+	whitespace []byte
+}
+
+func (c *canonicalTextWriter) lineBreak() {
+	if c == nil {
+		return
+	}
+	c.lineBreaks++
+	c.whitespace = c.whitespace[:0]
+}
+
+func (c *canonicalTextWriter) write(b []byte) {
+	if c == nil {
+		return
+	}
+	trimmed := bytes.TrimRight(b, " \t\r")
+	if len(trimmed) > 0 {
+		c.flushLineBreaks()
+		_, _ = c.out.Write(c.whitespace)
+		c.whitespace = c.whitespace[:0]
+		_, _ = c.out.Write(trimmed)
+	}
+	c.whitespace = append(c.whitespace, b[len(trimmed):]...)
+}
+
+func (c *canonicalTextWriter) finish() {
+	if c == nil {
+		return
+	}
+	c.flushLineBreaks()
+}
+
+func (c *canonicalTextWriter) flushLineBreaks() {
+	for ; c.lineBreaks > 0; c.lineBreaks-- {
+		_, _ = c.out.Write([]byte("\r\n"))
+	}
+}
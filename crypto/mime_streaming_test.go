@@ -0,0 +1,225 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/angel-one/gopenpgp/v2/constants"
+	"github.com/angel-one/gopenpgp/v2/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+type streamedMIMECallbacks struct {
+	builtMIMECallbacks
+	attachmentHeaders []string
+}
+
+func (c *streamedMIMECallbacks) OnAttachment(headers string, data Reader) {
+	attachment, err := ioutil.ReadAll(data)
+	if err != nil {
+		c.errs = append(c.errs, err)
+	}
+	c.attachmentHeaders = append(c.attachmentHeaders, headers)
+	c.attachments = append(c.attachments, attachment)
+}
+
+func encryptedMIMEBody(t *testing.T, encrypted []byte) []byte {
+	start := bytes.Index(encrypted, []byte("-----BEGIN PGP MESSAGE-----"))
+	end := bytes.Index(encrypted, []byte("-----END PGP MESSAGE-----"))
+	message, err := NewPGPMessageFromArmored(string(encrypted[start : end+len("-----END PGP MESSAGE-----")]))
+	if err != nil {
+		t.Fatal("Expected no error while unarmoring the message, got:", err)
+	}
+	return message.GetBinary()
+}
+
+func TestDecryptMIMEStream(t *testing.T) {
+	attachment := bytes.Repeat([]byte{0, 1, 2, 255}, 1<<18)
+	headers := NewProtectedHeaders("Streamed", "alice@example.com", "bob@example.com", "")
+	encrypted, err := keyRingTestPublic.EncryptMIMEWithProtectedHeaders(testMIMEBody, "", []*MIMEAttachment{
+		NewMIMEAttachment("large.bin", "", attachment),
+		NewMIMEAttachment("small.txt", "text/plain", []byte("small")),
+	}, headers, keyRingTestPrivate)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+	message := encryptedMIMEBody(t, encrypted)
+
+	callbacks := &streamedMIMECallbacks{}
+	keyRingTestPrivate.DecryptMIMEStream(bytes.NewReader(message), keyRingTestPublic, callbacks, GetUnixTime())
+	assert.Empty(t, callbacks.errs)
+	assert.Exactly(t, constants.SIGNATURE_OK, callbacks.verified)
+	assert.Contains(t, callbacks.headers, "Subject: Streamed\r\n")
+	assert.Exactly(t, [][]byte{attachment, []byte("small")}, callbacks.attachments)
+	assert.Contains(t, callbacks.attachmentHeaders[0], "filename=large.bin")
+
+	// Same output as DecryptMIMEMessage
+	reference := &builtMIMECallbacks{}
+	keyRingTestPrivate.DecryptMIMEMessage(NewPGPMessage(message), keyRingTestPublic, reference, GetUnixTime())
+	assert.Exactly(t, reference.body, callbacks.body)
+	assert.Exactly(t, reference.headers, callbacks.headers)
+	assert.Exactly(t, reference.attachments, callbacks.attachments)
+
+	// A signed entity modified before the encryption fails the MIME verification
+	signed, err := keyRingTestPrivate.SignMIME(buildTestMIMEContent(t))
+	if err != nil {
+		t.Fatal("Expected no error while signing, got:", err)
+	}
+	tampered := bytes.Replace(signed, []byte("attached"), []byte("ATTACHED"), 1)
+	encryptedTampered, err := keyRingTestPublic.Encrypt(NewPlainMessage(tampered), nil)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+	callbacks = &streamedMIMECallbacks{}
+	keyRingTestPrivate.DecryptMIMEStream(bytes.NewReader(encryptedTampered.GetBinary()), keyRingTestPublic, callbacks, GetUnixTime())
+	assert.Exactly(t, constants.SIGNATURE_FAILED, callbacks.verified)
+	assert.Contains(t, callbacks.body, "ATTACHED")
+
+	// A signature by an unknown key has no verifier
+	encryptedSigned, err := keyRingTestPublic.Encrypt(NewPlainMessage(signed), nil)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+	otherKeyRing, err := NewKeyRing(keyTestEC)
+	if err != nil {
+		t.Fatal("Expected no error while building the key ring, got:", err)
+	}
+	callbacks = &streamedMIMECallbacks{}
+	keyRingTestPrivate.DecryptMIMEStream(bytes.NewReader(encryptedSigned.GetBinary()), otherKeyRing, callbacks, GetUnixTime())
+	assert.Exactly(t, constants.SIGNATURE_NO_VERIFIER, callbacks.verified)
+
+	// Without signature
+	unsigned, err := keyRingTestPublic.Encrypt(NewPlainMessage(buildTestMIMEContent(t)), nil)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+	callbacks = &streamedMIMECallbacks{}
+	keyRingTestPrivate.DecryptMIMEStream(bytes.NewReader(unsigned.GetBinary()), keyRingTestPublic, callbacks, GetUnixTime())
+	assert.Exactly(t, constants.SIGNATURE_NOT_SIGNED, callbacks.verified)
+	assert.Len(t, callbacks.attachments, 1)
+
+	callbacks = &streamedMIMECallbacks{}
+	keyRingTestPublic.DecryptMIMEStream(bytes.NewReader(unsigned.GetBinary()), nil, callbacks, GetUnixTime())
+	assert.Len(t, callbacks.errs, 1)
+}
+
+func TestDecryptMIMEStreamParity(t *testing.T) {
+	mimeMessage := readTestFile("mime_testMessage", false)
+	body, attachments, _, err := parseMIME(mimeMessage, nil, pgp)
+	if err != nil {
+		t.Fatal("Expected no error while parsing message, got:", err)
+	}
+	encrypted, err := keyRingTestPublic.Encrypt(NewPlainMessage([]byte(mimeMessage)), nil)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+
+	callbacks := &streamedMIMECallbacks{}
+	keyRingTestPrivate.DecryptMIMEStream(bytes.NewReader(encrypted.GetBinary()), nil, callbacks, 0)
+	assert.Empty(t, callbacks.errs)
+	bodyContent, bodyMIMEType := body.GetBody()
+	assert.Exactly(t, sanitizeString(bodyContent), callbacks.body)
+	assert.Exactly(t, "text/html", bodyMIMEType)
+	assert.Len(t, callbacks.attachments, len(attachments))
+	for i := range attachments {
+		assert.Exactly(t, []byte(attachments[i]), callbacks.attachments[i])
+	}
+}
+
+func TestSignedPartReaderCanonicalization(t *testing.T) {
+	part := "Content-Type: text/plain  \n\nline with trailing spaces   \r\n\t\n" +
+		strings.Repeat("long line ", 10) + " \t \n\n"
+	entity := "preamble\r\n--b\r\n" + part + "\r\n--b\r\nsignature\r\n--b--\r\n"
+	expected := internal.Canonicalize(internal.TrimEachLine(part))
+
+	for _, size := range []int{16, 4096} {
+		canonicalized := &bytes.Buffer{}
+		reader := &signedPartReader{
+			reader:        bufio.NewReaderSize(strings.NewReader(entity), size),
+			delimiter:     []byte("--b"),
+			canonicalizer: &canonicalTextWriter{out: canonicalized},
+		}
+		raw, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal("Expected no error while reading the part, got:", err)
+		}
+		assert.Exactly(t, part, string(raw))
+		assert.Exactly(t, "--b\r\n", string(reader.delimiterLine))
+		assert.Exactly(t, expected, canonicalized.String())
+	}
+
+	reader := &signedPartReader{reader: bufio.NewReader(strings.NewReader("--b\r\nunterminated")), delimiter: []byte("--b")}
+	_, err := ioutil.ReadAll(reader)
+	assert.Error(t, err)
+}
+
+func TestDecryptMIMEStreamIntegrityFirst(t *testing.T) {
+	encrypted, err := keyRingTestPublic.Encrypt(NewPlainMessage(buildTestMIMEContent(t)), nil)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+	// The MDC is at the end of the data packet
+	tampered := encrypted.GetBinary()
+	tampered[len(tampered)-1] ^= 1
+
+	callbacks := &streamedMIMECallbacks{}
+	keyRingTestPrivate.DecryptMIMEStream(bytes.NewReader(tampered), nil, callbacks, 0)
+	assert.Len(t, callbacks.attachments, 1)
+	assert.NotEmpty(t, callbacks.errs)
+
+	callbacks = &streamedMIMECallbacks{}
+	keyRingTestPrivate.DecryptMIMEStreamWithOptions(
+		bytes.NewReader(tampered), nil, callbacks, 0, &DecryptionOptions{Spool: newTestSpool(t)},
+	)
+	assert.Empty(t, callbacks.attachments)
+	assert.Empty(t, callbacks.body)
+	if assert.Len(t, callbacks.errs, 1) {
+		assert.ErrorIs(t, callbacks.errs[0], ErrIntegrity)
+	}
+}
+
+func TestDecryptMIMEStreamDepth(t *testing.T) {
+	var nested strings.Builder
+	nested.WriteString("Content-Type: multipart/mixed; boundary=b0\r\n\r\n")
+	for i := 1; i <= maxMIMEDepth+1; i++ {
+		nested.WriteString(fmt.Sprintf("--b%d\r\nContent-Type: multipart/mixed; boundary=b%d\r\n\r\n", i-1, i))
+	}
+	encrypted, err := keyRingTestPublic.Encrypt(NewPlainMessageFromString(nested.String()), nil)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+
+	callbacks := &streamedMIMECallbacks{}
+	keyRingTestPrivate.DecryptMIMEStream(bytes.NewReader(encrypted.GetBinary()), nil, callbacks, 0)
+	if assert.Len(t, callbacks.errs, 1) {
+		assert.Contains(t, callbacks.errs[0].Error(), "nested too deeply")
+	}
+}
+
+func TestDecryptMIMEStreamMicAlg(t *testing.T) {
+	signed, err := keyRingTestPrivate.SignMIME(buildTestMIMEContent(t))
+	if err != nil {
+		t.Fatal("Expected no error while signing, got:", err)
+	}
+	for micalg, verified := range map[string]int{
+		"micalg=pgp-sha512": constants.SIGNATURE_OK,
+		"micalg=PGP-SHA512": constants.SIGNATURE_OK,
+		"micalg=pgp-sha256": constants.SIGNATURE_FAILED,
+		"micalg=pgp-md5":    constants.SIGNATURE_FAILED,
+		"x-micalg=none":     constants.SIGNATURE_FAILED,
+	} {
+		message := bytes.Replace(signed, []byte("micalg=pgp-sha512"), []byte(micalg), 1)
+		encrypted, err := keyRingTestPublic.Encrypt(NewPlainMessage(message), nil)
+		if err != nil {
+			t.Fatal("Expected no error while encrypting, got:", err)
+		}
+		callbacks := &streamedMIMECallbacks{}
+		keyRingTestPrivate.DecryptMIMEStream(bytes.NewReader(encrypted.GetBinary()), keyRingTestPublic, callbacks, GetUnixTime())
+		assert.Exactly(t, verified, callbacks.verified, micalg)
+		assert.Len(t, callbacks.attachments, 1, micalg)
+	}
+}
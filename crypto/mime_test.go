@@ -1,11 +1,13 @@
 package crypto
 
 import (
+	"bytes"
 	"errors"
 	"io/ioutil"
 	"path/filepath"
 	"testing"
 
+	"github.com/angel-one/gopenpgp/v2/constants"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -68,7 +70,7 @@ func TestDecrypt(t *testing.T) {
 }
 
 func TestParse(t *testing.T) {
-	body, atts, attHeaders, err := parseMIME(readTestFile("mime_testMessage", false), nil)
+	body, atts, attHeaders, err := parseMIME(readTestFile("mime_testMessage", false), nil, pgp)
 
 	if err != nil {
 		t.Fatal("Expected no error while parsing message, got:", err)
@@ -340,3 +342,53 @@ func TestMessageVerificationNoVerifierFailed(t *testing.T) {
 	expectedStatus := []int{3}
 	compareStatus(expectedStatus, callbackResults.onVerified, t)
 }
+
+func TestDecryptMIMEMessageWithSigner(t *testing.T) {
+	signerKey, err := GenerateKey(keyTestName, keyTestDomain, "x25519", 0)
+	if err != nil {
+		t.Fatal("Expected no error while generating the key, got:", err)
+	}
+	signerKeyRing, err := NewKeyRing(signerKey)
+	if err != nil {
+		t.Fatal("Expected no error while building the key ring, got:", err)
+	}
+
+	signed, err := signerKeyRing.SignMIME(buildTestMIMEContent(t))
+	if err != nil {
+		t.Fatal("Expected no error while signing, got:", err)
+	}
+	mimeSigned, err := keyRingTestPublic.Encrypt(NewPlainMessage(signed), nil)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+	embeddedSigned, err := keyRingTestPublic.Encrypt(NewPlainMessage(buildTestMIMEContent(t)), signerKeyRing)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+
+	for _, message := range []*PGPMessage{mimeSigned, embeddedSigned} {
+		callbacks := &builtMIMECallbacks{}
+		keyRingTestPrivate.DecryptMIMEMessageWithSigner(message, signerKeyRing, callbacks, GetUnixTime(), "Max <"+keyTestDomain+">")
+		assert.Empty(t, callbacks.errs)
+		assert.Exactly(t, constants.SIGNATURE_OK, callbacks.verified)
+
+		callbacks = &builtMIMECallbacks{}
+		keyRingTestPrivate.DecryptMIMEMessageWithSigner(message, signerKeyRing, callbacks, GetUnixTime(), "mallory@example.com")
+		assert.Exactly(t, constants.SIGNATURE_BAD_SIGNER, callbacks.verified)
+		assert.Contains(t, callbacks.body, "the report is attached.")
+
+		streamed := &streamedMIMECallbacks{}
+		keyRingTestPrivate.DecryptMIMEStreamWithSigner(
+			bytes.NewReader(message.GetBinary()), signerKeyRing, streamed, GetUnixTime(), "Max <"+keyTestDomain+">",
+		)
+		assert.Empty(t, streamed.errs)
+		assert.Exactly(t, constants.SIGNATURE_OK, streamed.verified)
+
+		streamed = &streamedMIMECallbacks{}
+		keyRingTestPrivate.DecryptMIMEStreamWithSigner(
+			bytes.NewReader(message.GetBinary()), signerKeyRing, streamed, GetUnixTime(), "mallory@example.com",
+		)
+		assert.Exactly(t, constants.SIGNATURE_BAD_SIGNER, streamed.verified)
+		assert.Contains(t, streamed.body, "the report is attached.")
+	}
+}
@@ -0,0 +1,177 @@
+package crypto
+
+// EncryptionOptions groups the optional settings of the public-key
+// encryption functions. A nil *EncryptionOptions selects the defaults.
+type EncryptionOptions struct {
+	// SigningContext is added to the embedded signature, if the message is signed.
+	SigningContext *SigningContext
+	// Compress enables the compression of the plaintext before encryption,
+	// with ZLIB at the default level.
+	Compress bool
+	// Compression selects the compression algorithm and level,
+	// and takes precedence over Compress.
+	Compression *CompressionConfig
+	// HideRecipients writes a wildcard (zero) key ID in the public-key
+	// encrypted session key packets instead of the key ID of the recipients.
+	// The recipients then have to try all their keys to decrypt the message.
+	HideRecipients bool
+	// Passwords are additional recipients of the message: the session key is
+	// also written encrypted with each of them, so that the message can be
+	// decrypted either with a private key or with any of the passwords.
+	Passwords [][]byte
+	// S2KConfig is the S2K function deriving keys from the passwords,
+	// nil selects the default.
+	S2KConfig *S2KConfig
+	// AEAD encrypts the message in an AEAD-chunked (SEIPD version 2) data
+	// packet, with version 6 session key packets, if all the recipient keys
+	// support it (RFC 9580). The session key must be an AES key.
+	AEAD bool
+	// Workers is the number of goroutines encrypting the chunks of an
+	// AEAD-chunked data packet. With more than one worker, at most three
+	// chunks per worker are held in memory, the writer must be closed to stop
+	// the goroutines, and the message is identical to the one encrypted
+	// on a single goroutine.
+	Workers int
+	// Recipients are the public keys the message is encrypted to by
+	// EncryptMessageWithOptions. The key ring functions encrypt to their
+	// receiver instead.
+	Recipients *KeyRing
+	// SigningKeyRing is an unlocked private key ring signing the message
+	// encrypted by EncryptMessageWithOptions. The key ring functions take
+	// it as an argument instead.
+	SigningKeyRing *KeyRing
+	// Progress receives the phase of the encryption and the numbers of
+	// plaintext and ciphertext bytes written so far.
+	Progress ProgressObserver
+	// TestingSources replace the randomness and time sources of the encryption
+	// and of the signature. TESTING ONLY, see TestingSources.
+	TestingSources *TestingSources
+
+	// state receives the session key and the serializer of the encryption,
+	// to wipe them on cancellation. See EncryptStreamCtx.
+	state *encryptionState
+}
+
+func (options *EncryptionOptions) signingContext() *SigningContext {
+	if options == nil {
+		return nil
+	}
+	return options.SigningContext
+}
+
+func (options *EncryptionOptions) compression() *CompressionConfig {
+	if options == nil {
+		return nil
+	}
+	if options.Compression != nil {
+		return options.Compression
+	}
+	if options.Compress {
+		return defaultCompressionConfig
+	}
+	return nil
+}
+
+func (options *EncryptionOptions) hideRecipients() bool {
+	return options != nil && options.HideRecipients
+}
+
+func (options *EncryptionOptions) passwords() [][]byte {
+	if options == nil {
+		return nil
+	}
+	return options.Passwords
+}
+
+func (options *EncryptionOptions) recipients() *KeyRing {
+	if options == nil {
+		return nil
+	}
+	return options.Recipients
+}
+
+func (options *EncryptionOptions) signingKeyRing() *KeyRing {
+	if options == nil {
+		return nil
+	}
+	return options.SigningKeyRing
+}
+
+func (options *EncryptionOptions) progress() ProgressObserver {
+	if options == nil {
+		return nil
+	}
+	return options.Progress
+}
+
+func (options *EncryptionOptions) testingSources() *TestingSources {
+	if options == nil {
+		return nil
+	}
+	return options.TestingSources
+}
+
+func (options *EncryptionOptions) s2kConfig() *S2KConfig {
+	if options == nil {
+		return nil
+	}
+	return options.S2KConfig
+}
+
+func (options *EncryptionOptions) aead() bool {
+	return options != nil && options.AEAD
+}
+
+func (options *EncryptionOptions) workers() int {
+	if options == nil {
+		return 0
+	}
+	return options.Workers
+}
+
+func (options *EncryptionOptions) encryptionState() *encryptionState {
+	if options == nil {
+		return nil
+	}
+	return options.state
+}
+
+// DecryptionOptions groups the optional settings of the streaming decryption
+// functions. A nil *DecryptionOptions selects the defaults.
+type DecryptionOptions struct {
+	// VerificationContext is checked against the embedded signature, if it is verified.
+	VerificationContext *VerificationContext
+	// Spool enables the integrity-first decryption: the plaintext is written
+	// to the spool, and only released once the integrity of the whole message
+	// (MDC or AEAD tag) has been checked.
+	Spool Spool
+	// AuthenticatedChunks enables the integrity-first decryption of
+	// AEAD-protected messages without spooling: each chunk is released once
+	// authenticated, and the truncation of the message is detected at its end.
+	// The messages that are not AEAD-protected are spooled, and can only be
+	// decrypted if Spool is set.
+	AuthenticatedChunks bool
+	// Workers is the number of goroutines decrypting the chunks of an
+	// AEAD-chunked (SEIPD version 2) data packet. With more than one worker,
+	// at most three chunks per worker are held in memory, and the message
+	// must be read until the end to stop the goroutines.
+	Workers int
+}
+
+func (options *DecryptionOptions) verificationContext() *VerificationContext {
+	if options == nil {
+		return nil
+	}
+	return options.VerificationContext
+}
+
+func (options *DecryptionOptions) integrityFirst() bool {
+	return options != nil && (options.Spool != nil || options.AuthenticatedChunks)
+}
+
+func (options *DecryptionOptions) workers() int {
+	if options == nil {
+		return 0
+	}
+	return options.Workers
+}
@@ -16,7 +16,29 @@ import (
 // * password: A password that will be derived into an encryption key.
 // * output  : The encrypted data as PGPMessage.
 func EncryptMessageWithPassword(message *PlainMessage, password []byte) (*PGPMessage, error) {
-	encrypted, err := passwordEncrypt(message, password)
+	return pgp.EncryptMessageWithPassword(message, password)
+}
+
+// EncryptMessageWithPassword encrypts a PlainMessage to PGPMessage with a
+// SymmetricKey, using the clock of the instance.
+func (pgp *GopenPGP) EncryptMessageWithPassword(message *PlainMessage, password []byte) (*PGPMessage, error) {
+	return pgp.EncryptMessageWithPasswordAndS2K(message, password, nil)
+}
+
+// EncryptMessageWithPasswordAndS2K encrypts a PlainMessage to PGPMessage with a
+// SymmetricKey, deriving the key from the password with the given S2K function.
+// * message : The plain data as a PlainMessage.
+// * password: A password that will be derived into an encryption key.
+// * s2kConfig: (optional) the S2K function, nil selects the default.
+// * output  : The encrypted data as PGPMessage.
+func EncryptMessageWithPasswordAndS2K(message *PlainMessage, password []byte, s2kConfig *S2KConfig) (*PGPMessage, error) {
+	return pgp.EncryptMessageWithPasswordAndS2K(message, password, s2kConfig)
+}
+
+// EncryptMessageWithPasswordAndS2K encrypts a PlainMessage to PGPMessage with a
+// SymmetricKey derived with the given S2K function, using the clock of the instance.
+func (pgp *GopenPGP) EncryptMessageWithPasswordAndS2K(message *PlainMessage, password []byte, s2kConfig *S2KConfig) (*PGPMessage, error) {
+	encrypted, err := pgp.passwordEncrypt(message, password, s2kConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -29,12 +51,89 @@ func EncryptMessageWithPassword(message *PlainMessage, password []byte) (*PGPMes
 // * password: A password that will be derived into an encryption key.
 // * output: The decrypted data as PlainMessage.
 func DecryptMessageWithPassword(message *PGPMessage, password []byte) (*PlainMessage, error) {
-	return passwordDecrypt(message.NewReader(), password)
+	return pgp.DecryptMessageWithPassword(message, password)
+}
+
+// DecryptMessageWithPassword decrypts password protected pgp binary messages,
+// using the clock and decryption limits of the instance.
+func (pgp *GopenPGP) DecryptMessageWithPassword(message *PGPMessage, password []byte) (*PlainMessage, error) {
+	return pgp.passwordDecrypt(message.NewReader(), password)
+}
+
+// DecryptMessageWithKeyRingOrPassword decrypts a PGPMessage encrypted to
+// public keys, to passwords, or to both, with whichever of keyRing and password is given.
+// * message    : The encrypted input as a PGPMessage.
+// * keyRing    : (optional) an unlocked private keyring to decrypt the message.
+// * password   : (optional) a password to decrypt the message.
+// * verifyKey  : (optional) Public key for signature verification.
+// * verifyTime : Time at verification (necessary only if verifyKey is not nil).
+// * output     : The decrypted data as PlainMessage.
+func DecryptMessageWithKeyRingOrPassword(
+	message *PGPMessage,
+	keyRing *KeyRing,
+	password []byte,
+	verifyKey *KeyRing,
+	verifyTime int64,
+) (*PlainMessage, error) {
+	return pgp.DecryptMessageWithKeyRingOrPassword(message, keyRing, password, verifyKey, verifyTime)
+}
+
+// DecryptMessageWithKeyRingOrPassword decrypts a PGPMessage encrypted to
+// public keys, to passwords, or to both, using the clock and decryption limits of the instance.
+func (pgp *GopenPGP) DecryptMessageWithKeyRingOrPassword(
+	message *PGPMessage,
+	keyRing *KeyRing,
+	password []byte,
+	verifyKey *KeyRing,
+	verifyTime int64,
+) (*PlainMessage, error) {
+	if keyRing == nil && password == nil {
+		return nil, errors.New("gopenpgp: no decryption key ring or password provided")
+	}
+	return pgp.asymmetricDecrypt(message.NewReader(), keyRing, password, verifyKey, verifyTime, nil, "")
+}
+
+// DecryptStreamWithKeyRingOrPassword is used to decrypt a pgp message, encrypted
+// to public keys, to passwords, or to both, as a Reader.
+// It takes a reader for the message data and returns a PlainMessageReader for the plaintext data.
+// The message is decrypted with whichever of keyRing and password is given.
+// If verifyKeyRing is not nil, PlainMessageReader.VerifySignature() will
+// verify the embedded signature with the given key ring and verification time.
+func DecryptStreamWithKeyRingOrPassword(
+	message Reader,
+	keyRing *KeyRing,
+	password []byte,
+	verifyKeyRing *KeyRing,
+	verifyTime int64,
+) (*PlainMessageReader, error) {
+	return pgp.DecryptStreamWithKeyRingOrPassword(message, keyRing, password, verifyKeyRing, verifyTime)
+}
+
+// DecryptStreamWithKeyRingOrPassword is used to decrypt a pgp message, encrypted
+// to public keys, to passwords, or to both, as a Reader, using the clock and
+// decryption limits of the instance.
+func (pgp *GopenPGP) DecryptStreamWithKeyRingOrPassword(
+	message Reader,
+	keyRing *KeyRing,
+	password []byte,
+	verifyKeyRing *KeyRing,
+	verifyTime int64,
+) (*PlainMessageReader, error) {
+	if keyRing == nil && password == nil {
+		return nil, errors.New("gopenpgp: no decryption key ring or password provided")
+	}
+	return pgp.decryptStream(keyRing, password, message, verifyKeyRing, verifyTime, nil)
 }
 
 // DecryptSessionKeyWithPassword decrypts the binary symmetrically encrypted
 // session key packet and returns the session key.
 func DecryptSessionKeyWithPassword(keyPacket, password []byte) (*SessionKey, error) {
+	return pgp.DecryptSessionKeyWithPassword(keyPacket, password)
+}
+
+// DecryptSessionKeyWithPassword decrypts the binary symmetrically encrypted
+// session key packet and returns the session key, bound to the instance.
+func (pgp *GopenPGP) DecryptSessionKeyWithPassword(keyPacket, password []byte) (*SessionKey, error) {
 	keyReader := bytes.NewReader(keyPacket)
 	packets := packet.NewReader(keyReader)
 
@@ -59,6 +158,7 @@ func DecryptSessionKeyWithPassword(keyPacket, password []byte) (*SessionKey, err
 				sk := &SessionKey{
 					Key:  key,
 					Algo: getAlgo(cipherFunc),
+					pgp:  pgp.bound(),
 				}
 
 				if err = sk.checkSize(); err != nil {
@@ -70,12 +170,26 @@ func DecryptSessionKeyWithPassword(keyPacket, password []byte) (*SessionKey, err
 		}
 	}
 
-	return nil, errors.New("gopenpgp: unable to decrypt any packet")
+	return nil, newError("gopenpgp: unable to decrypt any packet", ErrWrongPassword)
 }
 
 // EncryptSessionKeyWithPassword encrypts the session key with the password and
 // returns a binary symmetrically encrypted session key packet.
 func EncryptSessionKeyWithPassword(sk *SessionKey, password []byte) ([]byte, error) {
+	return EncryptSessionKeyWithPasswordAndS2K(sk, password, nil)
+}
+
+// EncryptSessionKeyWithPasswordAndS2K encrypts the session key with the password,
+// derived into a key with the given S2K function, and returns a binary
+// symmetrically encrypted session key packet.
+func EncryptSessionKeyWithPasswordAndS2K(sk *SessionKey, password []byte, s2kConfig *S2KConfig) ([]byte, error) {
+	return encryptSessionKeyWithPassword(sk, password, s2kConfig, nil)
+}
+
+// encryptSessionKeyWithPassword encrypts the session key with the password.
+// With aeadConfig, the packet is a version 6 one, for an AEAD-chunked
+// (SEIPD version 2) data packet, and is encrypted with its AEAD mode.
+func encryptSessionKeyWithPassword(sk *SessionKey, password []byte, s2kConfig *S2KConfig, aeadConfig *packet.AEADConfig) ([]byte, error) {
 	outbuf := &bytes.Buffer{}
 
 	cf, err := sk.GetCipherFunc()
@@ -93,6 +207,11 @@ func EncryptSessionKeyWithPassword(sk *SessionKey, password []byte) ([]byte, err
 
 	config := &packet.Config{
 		DefaultCipher: cf,
+		Rand:          sk.getPGP().rand,
+		AEADConfig:    aeadConfig,
+	}
+	if config.S2KConfig, err = s2kConfig.getS2KConfig(); err != nil {
+		return nil, err
 	}
 
 	err = packet.SerializeSymmetricKeyEncryptedReuseKey(outbuf, sk.Key, password, config)
@@ -104,12 +223,18 @@ func EncryptSessionKeyWithPassword(sk *SessionKey, password []byte) ([]byte, err
 
 // ----- INTERNAL FUNCTIONS ------
 
-func passwordEncrypt(message *PlainMessage, password []byte) ([]byte, error) {
+func (pgp *GopenPGP) passwordEncrypt(message *PlainMessage, password []byte, s2kConfig *S2KConfig) ([]byte, error) {
 	var outBuf bytes.Buffer
 
 	config := &packet.Config{
 		DefaultCipher: packet.CipherAES256,
-		Time:          getTimeGenerator(),
+		Time:          pgp.getTimeGenerator(),
+		Rand:          pgp.rand,
+	}
+
+	var err error
+	if config.S2KConfig, err = s2kConfig.getS2KConfig(); err != nil {
+		return nil, err
 	}
 
 	hints := &openpgp.FileHints{
@@ -135,7 +260,7 @@ func passwordEncrypt(message *PlainMessage, password []byte) ([]byte, error) {
 	return outBuf.Bytes(), nil
 }
 
-func passwordDecrypt(encryptedIO io.Reader, password []byte) (*PlainMessage, error) {
+func (pgp *GopenPGP) passwordDecrypt(encryptedIO io.Reader, password []byte) (*PlainMessage, error) {
 	firstTimeCalled := true
 	var prompt = func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
 		if firstTimeCalled {
@@ -144,18 +269,24 @@ func passwordDecrypt(encryptedIO io.Reader, password []byte) (*PlainMessage, err
 		}
 		// Re-prompt still occurs if SKESK pasrsing fails (i.e. when decrypted cipher algo is invalid).
 		// For most (but not all) cases, inputting a wrong passwords is expected to trigger this error.
-		return nil, errors.New("gopenpgp: wrong password in symmetric decryption")
+		return nil, newError("gopenpgp: wrong password in symmetric decryption", ErrWrongPassword)
 	}
 
 	config := &packet.Config{
-		Time: getTimeGenerator(),
+		Time: pgp.getTimeGenerator(),
 	}
 
 	var emptyKeyRing openpgp.EntityList
-	md, err := openpgp.ReadMessage(encryptedIO, emptyKeyRing, prompt, config)
+	md, err := readMessage(encryptedIO, emptyKeyRing, prompt, config, pgp.getInMemoryDecryptionLimits())
+	if errors.As(err, &DecryptionLimitError{}) {
+		return nil, errors.Wrap(err, "gopenpgp: error in reading password protected message")
+	}
 	if err != nil {
 		// Parsing errors when reading the message are most likely caused by incorrect password, but we cannot know for sure
-		return nil, errors.New("gopenpgp: error in reading password protected message: wrong password or malformed message")
+		return nil, newError(
+			"gopenpgp: error in reading password protected message: wrong password or malformed message",
+			ErrWrongPassword, ErrMalformedPacket,
+		)
 	}
 
 	messageBuf := bytes.NewBuffer(nil)
@@ -163,11 +294,17 @@ func passwordDecrypt(encryptedIO io.Reader, password []byte) (*PlainMessage, err
 	if errors.Is(err, pgpErrors.ErrMDCHashMismatch) {
 		// This MDC error may also be triggered if the password is correct, but the encrypted data was corrupted.
 		// To avoid confusion, we do not inform the user about the second possibility.
-		return nil, errors.New("gopenpgp: wrong password in symmetric decryption")
+		return nil, newError("gopenpgp: wrong password in symmetric decryption", ErrWrongPassword, ErrIntegrity)
+	}
+	if errors.As(err, &DecryptionLimitError{}) {
+		return nil, errors.Wrap(err, "gopenpgp: error in reading password protected message")
 	}
 	if err != nil {
 		// Parsing errors after decryption, triggered before parsing the MDC packet, are also usually the result of wrong password
-		return nil, errors.New("gopenpgp: error in reading password protected message: wrong password or malformed message")
+		return nil, newError(
+			"gopenpgp: error in reading password protected message: wrong password or malformed message",
+			ErrWrongPassword, ErrMalformedPacket,
+		)
 	}
 
 	return &PlainMessage{
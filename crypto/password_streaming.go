@@ -0,0 +1,134 @@
+package crypto
+
+import (
+	"bytes"
+	"io"
+)
+
+// EncryptStreamWithPassword is used to encrypt data with a password as a Writer.
+// It takes a writer for the encrypted data and returns a WriteCloser for the plaintext data.
+// If signKeyRing is not nil, it is used to do an embedded signature.
+func EncryptStreamWithPassword(
+	pgpMessageWriter Writer,
+	plainMessageMetadata *PlainMessageMetadata,
+	password []byte,
+	signKeyRing *KeyRing,
+) (plainMessageWriter WriteCloser, err error) {
+	return pgp.EncryptStreamWithPassword(pgpMessageWriter, plainMessageMetadata, password, signKeyRing)
+}
+
+// EncryptStreamWithPassword is used to encrypt data with a password as a Writer,
+// using the clock of the instance.
+func (pgp *GopenPGP) EncryptStreamWithPassword(
+	pgpMessageWriter Writer,
+	plainMessageMetadata *PlainMessageMetadata,
+	password []byte,
+	signKeyRing *KeyRing,
+) (plainMessageWriter WriteCloser, err error) {
+	return pgp.encryptStream(
+		nil,
+		pgpMessageWriter,
+		pgpMessageWriter,
+		plainMessageMetadata,
+		signKeyRing,
+		&EncryptionOptions{Passwords: [][]byte{password}},
+	)
+}
+
+// EncryptSplitStreamWithPassword is used to encrypt data with a password as a stream.
+// It takes a writer for the Symmetrically Encrypted Data Packet
+// and returns a writer for the plaintext data and the key packet.
+// If signKeyRing is not nil, it is used to do an embedded signature.
+func EncryptSplitStreamWithPassword(
+	dataPacketWriter Writer,
+	plainMessageMetadata *PlainMessageMetadata,
+	password []byte,
+	signKeyRing *KeyRing,
+) (*EncryptSplitResult, error) {
+	return pgp.EncryptSplitStreamWithPassword(dataPacketWriter, plainMessageMetadata, password, signKeyRing)
+}
+
+// EncryptSplitStreamWithPassword is used to encrypt data with a password as a stream,
+// using the clock of the instance.
+func (pgp *GopenPGP) EncryptSplitStreamWithPassword(
+	dataPacketWriter Writer,
+	plainMessageMetadata *PlainMessageMetadata,
+	password []byte,
+	signKeyRing *KeyRing,
+) (*EncryptSplitResult, error) {
+	return pgp.encryptSplitStream(
+		nil,
+		dataPacketWriter,
+		plainMessageMetadata,
+		signKeyRing,
+		&EncryptionOptions{Passwords: [][]byte{password}},
+	)
+}
+
+// DecryptStreamWithPassword is used to decrypt a password protected pgp message as a Reader.
+// It takes a reader for the message data
+// and returns a PlainMessageReader for the plaintext data.
+// If verifyKeyRing is not nil, PlainMessageReader.VerifySignature() will
+// verify the embedded signature with the given key ring and verification time.
+func DecryptStreamWithPassword(
+	message Reader,
+	password []byte,
+	verifyKeyRing *KeyRing,
+	verifyTime int64,
+) (plainMessage *PlainMessageReader, err error) {
+	return pgp.DecryptStreamWithPassword(message, password, verifyKeyRing, verifyTime)
+}
+
+// DecryptStreamWithPassword is used to decrypt a password protected pgp message as a Reader,
+// using the clock and decryption limits of the instance.
+func (pgp *GopenPGP) DecryptStreamWithPassword(
+	message Reader,
+	password []byte,
+	verifyKeyRing *KeyRing,
+	verifyTime int64,
+) (plainMessage *PlainMessageReader, err error) {
+	return pgp.decryptStream(
+		nil,
+		password,
+		message,
+		verifyKeyRing,
+		verifyTime,
+		nil,
+	)
+}
+
+// DecryptSplitStreamWithPassword is used to decrypt a split password protected pgp message as a Reader.
+// It takes a key packet and a reader for the data packet
+// and returns a PlainMessageReader for the plaintext data.
+// If verifyKeyRing is not nil, PlainMessageReader.VerifySignature() will
+// verify the embedded signature with the given key ring and verification time.
+func DecryptSplitStreamWithPassword(
+	keyPacket []byte,
+	dataPacketReader Reader,
+	password []byte,
+	verifyKeyRing *KeyRing,
+	verifyTime int64,
+) (plainMessage *PlainMessageReader, err error) {
+	return pgp.DecryptSplitStreamWithPassword(keyPacket, dataPacketReader, password, verifyKeyRing, verifyTime)
+}
+
+// DecryptSplitStreamWithPassword is used to decrypt a split password protected pgp message
+// as a Reader, using the clock and decryption limits of the instance.
+func (pgp *GopenPGP) DecryptSplitStreamWithPassword(
+	keyPacket []byte,
+	dataPacketReader Reader,
+	password []byte,
+	verifyKeyRing *KeyRing,
+	verifyTime int64,
+) (plainMessage *PlainMessageReader, err error) {
+	messageReader := io.MultiReader(
+		bytes.NewReader(keyPacket),
+		dataPacketReader,
+	)
+	return pgp.DecryptStreamWithPassword(
+		messageReader,
+		password,
+		verifyKeyRing,
+		verifyTime,
+	)
+}
@@ -0,0 +1,147 @@
+package crypto
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestEncryptDecryptStreamWithPassword(t *testing.T) {
+	messageBytes := []byte("Hello World!")
+	var ciphertextBuf bytes.Buffer
+	messageWriter, err := EncryptStreamWithPassword(
+		&ciphertextBuf,
+		testMeta,
+		testSymmetricKey,
+		keyRingTestPrivate,
+	)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting stream with password, got:", err)
+	}
+	if _, err = messageWriter.Write(messageBytes); err != nil {
+		t.Fatal("Expected no error while writing data, got:", err)
+	}
+	if err = messageWriter.Close(); err != nil {
+		t.Fatal("Expected no error while closing plaintext writer, got:", err)
+	}
+
+	decryptedReader, err := DecryptStreamWithPassword(
+		bytes.NewReader(ciphertextBuf.Bytes()),
+		testSymmetricKey,
+		keyRingTestPublic,
+		GetUnixTime(),
+	)
+	if err != nil {
+		t.Fatal("Expected no error while calling decrypting stream with password, got:", err)
+	}
+	decryptedBytes, err := ioutil.ReadAll(decryptedReader)
+	if err != nil {
+		t.Fatal("Expected no error while reading the decrypted data, got:", err)
+	}
+	if !bytes.Equal(decryptedBytes, messageBytes) {
+		t.Fatalf("Expected the decrypted data to be %s got %s", string(messageBytes), string(decryptedBytes))
+	}
+	if err = decryptedReader.VerifySignature(); err != nil {
+		t.Fatal("Expected no error while verifying the signature, got:", err)
+	}
+	decryptedMeta := decryptedReader.GetMetadata()
+	if !reflect.DeepEqual(testMeta, decryptedMeta) {
+		t.Fatalf("Expected the decrypted metadata to be %v got %v", testMeta, decryptedMeta)
+	}
+
+	decrypted, err := DecryptMessageWithPassword(NewPGPMessage(ciphertextBuf.Bytes()), testSymmetricKey)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting with password, got:", err)
+	}
+	if !bytes.Equal(decrypted.GetBinary(), messageBytes) {
+		t.Fatalf("Expected the decrypted data to be %s got %s", string(messageBytes), string(decrypted.GetBinary()))
+	}
+
+	_, err = DecryptStreamWithPassword(
+		bytes.NewReader(ciphertextBuf.Bytes()),
+		[]byte("Wrong password"),
+		nil,
+		0,
+	)
+	if err == nil {
+		t.Fatal("Expected an error while decrypting stream with a wrong password")
+	}
+}
+
+func TestDecryptStreamWithPasswordCompatible(t *testing.T) {
+	messageBytes := []byte("Hello World!")
+	encrypted, err := EncryptMessageWithPassword(NewPlainMessage(messageBytes), testSymmetricKey)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting with password, got:", err)
+	}
+	decryptedReader, err := DecryptStreamWithPassword(
+		encrypted.NewReader(),
+		testSymmetricKey,
+		nil,
+		0,
+	)
+	if err != nil {
+		t.Fatal("Expected no error while calling decrypting stream with password, got:", err)
+	}
+	decryptedBytes, err := ioutil.ReadAll(decryptedReader)
+	if err != nil {
+		t.Fatal("Expected no error while reading the decrypted data, got:", err)
+	}
+	if !bytes.Equal(decryptedBytes, messageBytes) {
+		t.Fatalf("Expected the decrypted data to be %s got %s", string(messageBytes), string(decryptedBytes))
+	}
+}
+
+func TestEncryptDecryptSplitStreamWithPassword(t *testing.T) {
+	messageBytes := []byte("Hello World!")
+	var dataPacketBuf bytes.Buffer
+	encryptionResult, err := EncryptSplitStreamWithPassword(
+		&dataPacketBuf,
+		testMeta,
+		testSymmetricKey,
+		keyRingTestPrivate,
+	)
+	if err != nil {
+		t.Fatal("Expected no error while calling encrypting split stream with password, got:", err)
+	}
+	if _, err = encryptionResult.Write(messageBytes); err != nil {
+		t.Fatal("Expected no error while writing data, got:", err)
+	}
+	if err = encryptionResult.Close(); err != nil {
+		t.Fatal("Expected no error while closing plaintext writer, got:", err)
+	}
+	keyPacket, err := encryptionResult.GetKeyPacket()
+	if err != nil {
+		t.Fatal("Expected no error while accessing key packet, got:", err)
+	}
+
+	sessionKey, err := DecryptSessionKeyWithPassword(keyPacket, testSymmetricKey)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting the session key, got:", err)
+	}
+	if _, err = sessionKey.Decrypt(dataPacketBuf.Bytes()); err != nil {
+		t.Fatal("Expected no error while decrypting with the session key, got:", err)
+	}
+
+	decryptedReader, err := DecryptSplitStreamWithPassword(
+		keyPacket,
+		bytes.NewReader(dataPacketBuf.Bytes()),
+		testSymmetricKey,
+		keyRingTestPublic,
+		GetUnixTime(),
+	)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting split stream with password, got:", err)
+	}
+	decryptedBytes, err := ioutil.ReadAll(decryptedReader)
+	if err != nil {
+		t.Fatal("Expected no error while reading the decrypted data, got:", err)
+	}
+	if !bytes.Equal(decryptedBytes, messageBytes) {
+		t.Fatalf("Expected the decrypted data to be %s got %s", string(messageBytes), string(decryptedBytes))
+	}
+	if err = decryptedReader.VerifySignature(); err != nil {
+		t.Fatal("Expected no error while verifying the signature, got:", err)
+	}
+}
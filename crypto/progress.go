@@ -0,0 +1,101 @@
+package crypto
+
+import (
+	"io"
+
+	"github.com/angel-one/gopenpgp/v2/constants"
+)
+
+// ProgressObserver receives the progress of an encryption or decryption.
+// It only uses types supported by gomobile, so that it can be implemented
+// in the mobile app runtime, like helper.MobileReader.
+type ProgressObserver interface {
+	// OnProgress is called with the current phase, one of the
+	// constants.Progress* values, and the total numbers of plaintext bytes
+	// processed and of ciphertext bytes written or read so far.
+	OnProgress(phase string, plaintextBytes int64, ciphertextBytes int64)
+}
+
+// progressTracker counts the bytes of an operation and reports them to its observer.
+type progressTracker struct {
+	observer        ProgressObserver
+	phase           string
+	plaintextBytes  int64
+	ciphertextBytes int64
+}
+
+// newProgressTracker returns a tracker reporting to observer, or nil if observer is nil.
+func newProgressTracker(observer ProgressObserver) *progressTracker {
+	if observer == nil {
+		return nil
+	}
+	return &progressTracker{observer: observer}
+}
+
+func (p *progressTracker) setPhase(phase string) {
+	p.phase = phase
+	p.report()
+}
+
+func (p *progressTracker) addPlaintext(n int) {
+	if n > 0 {
+		p.plaintextBytes += int64(n)
+		p.report()
+	}
+}
+
+func (p *progressTracker) addCiphertext(n int) {
+	if n > 0 {
+		p.ciphertextBytes += int64(n)
+		p.report()
+	}
+}
+
+func (p *progressTracker) report() {
+	p.observer.OnProgress(p.phase, p.plaintextBytes, p.ciphertextBytes)
+}
+
+// progressWriter counts the bytes written to writer.
+type progressWriter struct {
+	writer io.Writer
+	add    func(int)
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	n, err := w.writer.Write(b)
+	w.add(n)
+	return n, err
+}
+
+// progressWriteCloser counts the plaintext bytes written to writer,
+// and reports the end of the operation once it is closed.
+type progressWriteCloser struct {
+	writer   WriteCloser
+	progress *progressTracker
+}
+
+func (w *progressWriteCloser) Write(b []byte) (int, error) {
+	n, err := w.writer.Write(b)
+	w.progress.addPlaintext(n)
+	return n, err
+}
+
+func (w *progressWriteCloser) Close() error {
+	if err := w.writer.Close(); err != nil {
+		return err
+	}
+	w.progress.setPhase(constants.ProgressDone)
+	return nil
+}
+
+// progressReader counts the bytes read from reader.
+type progressReader struct {
+	reader io.Reader
+	add    func(int)
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.reader.Read(b)
+	r.add(n)
+	return n, err
+}
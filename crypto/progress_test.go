@@ -0,0 +1,88 @@
+package crypto
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/angel-one/gopenpgp/v2/constants"
+)
+
+type testProgressObserver struct {
+	phases          []string
+	plaintextBytes  int64
+	ciphertextBytes int64
+}
+
+func (o *testProgressObserver) OnProgress(phase string, plaintextBytes int64, ciphertextBytes int64) {
+	if len(o.phases) == 0 || o.phases[len(o.phases)-1] != phase {
+		o.phases = append(o.phases, phase)
+	}
+	o.plaintextBytes = plaintextBytes
+	o.ciphertextBytes = ciphertextBytes
+}
+
+func TestEncryptDecryptStreamProgress(t *testing.T) {
+	messageBytes := bytes.Repeat([]byte("Hello World!"), 10000)
+
+	encryptionObserver := &testProgressObserver{}
+	var dataPacketBuf bytes.Buffer
+	encryptionResult, err := keyRingTestPublic.EncryptSplitStreamWithOptions(
+		&dataPacketBuf,
+		testMeta,
+		keyRingTestPrivate,
+		&EncryptionOptions{Progress: encryptionObserver},
+	)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting split stream with key ring, got:", err)
+	}
+	for i := 0; i < len(messageBytes); i += 1000 {
+		if _, err = encryptionResult.Write(messageBytes[i : i+1000]); err != nil {
+			t.Fatal("Expected no error while writing data, got:", err)
+		}
+	}
+	if err = encryptionResult.Close(); err != nil {
+		t.Fatal("Expected no error while closing plaintext writer, got:", err)
+	}
+	keyPacket, err := encryptionResult.GetKeyPacket()
+	if err != nil {
+		t.Fatal("Expected no error while accessing key packet, got:", err)
+	}
+	assert.Exactly(t, []string{
+		constants.ProgressKeyPacketEncryption,
+		constants.ProgressBodyEncryption,
+		constants.ProgressDone,
+	}, encryptionObserver.phases)
+	assert.Exactly(t, int64(len(messageBytes)), encryptionObserver.plaintextBytes)
+	assert.Exactly(t, int64(len(keyPacket)+dataPacketBuf.Len()), encryptionObserver.ciphertextBytes)
+
+	decryptionObserver := &testProgressObserver{}
+	decryptedReader, err := keyRingTestPrivate.DecryptSplitStreamWithProgress(
+		keyPacket,
+		bytes.NewReader(dataPacketBuf.Bytes()),
+		keyRingTestPublic,
+		GetUnixTime(),
+		decryptionObserver,
+	)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting split stream with key ring, got:", err)
+	}
+	decryptedBytes, err := ioutil.ReadAll(decryptedReader)
+	if err != nil {
+		t.Fatal("Expected no error while reading the decrypted data, got:", err)
+	}
+	assert.Exactly(t, messageBytes, decryptedBytes)
+	if err = decryptedReader.VerifySignature(); err != nil {
+		t.Fatal("Expected no error while verifying the signature, got:", err)
+	}
+	assert.Exactly(t, []string{
+		constants.ProgressKeyPacketDecryption,
+		constants.ProgressBodyDecryption,
+		constants.ProgressSignatureVerification,
+		constants.ProgressDone,
+	}, decryptionObserver.phases)
+	assert.Exactly(t, int64(len(messageBytes)), decryptionObserver.plaintextBytes)
+	assert.Exactly(t, int64(len(keyPacket)+dataPacketBuf.Len()), decryptionObserver.ciphertextBytes)
+}
@@ -0,0 +1,221 @@
+package crypto
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/pkg/errors"
+)
+
+const packetTagMarker = 10
+
+// UpdateKeyPacketRecipients decrypts the session key of the key packets with
+// the key ring, and returns the key packets with new public-key encrypted
+// session key packets for the added recipients, without the packets of the
+// removed recipients. The data packet of the message is unchanged.
+// The packets with a wildcard key ID and the password packets are kept.
+// * keyPacket : the key packets of the message.
+// * addRecipients : (optional) the recipients to add, already present ones are skipped.
+// * removeRecipients : (optional) the recipients to remove.
+func (keyRing *KeyRing) UpdateKeyPacketRecipients(keyPacket []byte, addRecipients, removeRecipients *KeyRing) ([]byte, error) {
+	keyPackets, err := readKeyPackets(bytes.NewReader(keyPacket))
+	if err != nil {
+		return nil, err
+	}
+	return keyRing.updateRecipients(keyPackets, addRecipients, removeRecipients)
+}
+
+// UpdateSplitMessageRecipients returns the split message with the recipients
+// updated as in UpdateKeyPacketRecipients, and the same data packet.
+// * message : the split message.
+// * addRecipients : (optional) the recipients to add, already present ones are skipped.
+// * removeRecipients : (optional) the recipients to remove.
+func (keyRing *KeyRing) UpdateSplitMessageRecipients(
+	message *PGPSplitMessage,
+	addRecipients, removeRecipients *KeyRing,
+) (*PGPSplitMessage, error) {
+	keyPacket, err := keyRing.UpdateKeyPacketRecipients(message.GetBinaryKeyPacket(), addRecipients, removeRecipients)
+	if err != nil {
+		return nil, err
+	}
+	return NewPGPSplitMessage(keyPacket, message.GetBinaryDataPacket()), nil
+}
+
+// UpdateRecipients returns the message with the recipients updated as in
+// UpdateKeyPacketRecipients, and the same data packet.
+// * message : the message.
+// * addRecipients : (optional) the recipients to add, already present ones are skipped.
+// * removeRecipients : (optional) the recipients to remove.
+func (keyRing *KeyRing) UpdateRecipients(message *PGPMessage, addRecipients, removeRecipients *KeyRing) (*PGPMessage, error) {
+	split, err := message.SplitMessage()
+	if err != nil {
+		return nil, wrapError(err, "gopenpgp: error in splitting the message")
+	}
+	split, err = keyRing.UpdateSplitMessageRecipients(split, addRecipients, removeRecipients)
+	if err != nil {
+		return nil, err
+	}
+	return split.GetPGPMessage(), nil
+}
+
+// UpdateRecipientsStream reads a message and writes it with the recipients
+// updated as in UpdateKeyPacketRecipients. Only the key packets are held in
+// memory: the data packet is copied from the input to the output.
+// * message : the message.
+// * output : the writer for the updated message.
+// * addRecipients : (optional) the recipients to add, already present ones are skipped.
+// * removeRecipients : (optional) the recipients to remove.
+func (keyRing *KeyRing) UpdateRecipientsStream(message Reader, output Writer, addRecipients, removeRecipients *KeyRing) error {
+	bufferedMessage := &peekReader{r: message}
+	keyPackets, err := readKeyPackets(bufferedMessage)
+	if err != nil {
+		return err
+	}
+	keyPacket, err := keyRing.updateRecipients(keyPackets, addRecipients, removeRecipients)
+	if err != nil {
+		return err
+	}
+	if _, err = output.Write(keyPacket); err != nil {
+		return errors.Wrap(err, "gopenpgp: error in writing the key packets")
+	}
+	if _, err = io.Copy(output, bufferedMessage); err != nil {
+		return errors.Wrap(err, "gopenpgp: error in copying the data packet")
+	}
+	return nil
+}
+
+func (keyRing *KeyRing) updateRecipients(keyPackets [][]byte, addRecipients, removeRecipients *KeyRing) ([]byte, error) {
+	sk, err := keyRing.DecryptSessionKey(bytes.Join(keyPackets, nil))
+	if err != nil {
+		return nil, err
+	}
+	defer sk.Clear()
+
+	var updated bytes.Buffer
+	present := make(map[uint64]bool)
+	for _, keyPacket := range keyPackets {
+		keyID, isEncryptedKey := encryptedKeyID(keyPacket)
+		if isEncryptedKey && keyID != 0 {
+			if removeRecipients != nil && len(removeRecipients.entities.KeysById(keyID)) > 0 {
+				continue
+			}
+			present[keyID] = true
+		}
+		updated.Write(keyPacket)
+	}
+
+	if addRecipients != nil {
+		newPackets, err := addRecipients.EncryptSessionKey(sk)
+		if err != nil {
+			return nil, err
+		}
+		newKeyPackets, err := readKeyPackets(bytes.NewReader(newPackets))
+		if err != nil {
+			return nil, err
+		}
+		for _, keyPacket := range newKeyPackets {
+			if keyID, _ := encryptedKeyID(keyPacket); !present[keyID] {
+				updated.Write(keyPacket)
+			}
+		}
+	}
+
+	if updated.Len() == 0 {
+		return nil, errors.New("gopenpgp: the message would have no recipient left")
+	}
+	return updated.Bytes(), nil
+}
+
+// encryptedKeyID returns the key ID of a public-key encrypted session key packet.
+func encryptedKeyID(keyPacket []byte) (keyID uint64, ok bool) {
+	p, err := packet.Read(bytes.NewReader(keyPacket))
+	if err != nil {
+		return 0, false
+	}
+	encryptedKey, ok := p.(*packet.EncryptedKey)
+	if !ok {
+		return 0, false
+	}
+	return encryptedKey.KeyId, true
+}
+
+// peekReader is a reader whose next byte can be pushed back.
+type peekReader struct {
+	r      io.Reader
+	pushed []byte
+}
+
+func (r *peekReader) Read(b []byte) (int, error) {
+	if len(r.pushed) > 0 {
+		n := copy(b, r.pushed)
+		r.pushed = r.pushed[n:]
+		return n, nil
+	}
+	return r.r.Read(b)
+}
+
+// readKeyPackets reads the session key packets (and marker packets) at the
+// start of a message, and returns them with their headers. If r is a
+// *peekReader, the first octet of the following packet is pushed back.
+func readKeyPackets(r io.Reader) ([][]byte, error) {
+	var keyPackets [][]byte
+	for {
+		var header [1]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return keyPackets, nil
+			}
+			return nil, wrapError(err, "gopenpgp: error in reading the key packets")
+		}
+		if header[0]&0x80 == 0 {
+			return nil, newError("gopenpgp: invalid packet header", ErrMalformedPacket)
+		}
+		switch packetTag(header[0]) {
+		case packetTagEncryptedKey, packetTagSymmetricKeyEncrypted, packetTagMarker:
+		default:
+			if peeker, ok := r.(*peekReader); ok {
+				peeker.pushed = header[:]
+			}
+			return keyPackets, nil
+		}
+
+		raw := []byte{header[0]}
+		var length int64
+		if header[0]&0x40 == 0 {
+			lengthType := header[0] & 3
+			if lengthType == 3 {
+				return nil, newError("gopenpgp: key packet of indeterminate length", ErrMalformedPacket)
+			}
+			lengthBytes := make([]byte, 1<<lengthType)
+			if _, err := io.ReadFull(r, lengthBytes); err != nil {
+				return nil, wrapError(unexpectedEOF(err), "gopenpgp: error in reading the key packets")
+			}
+			raw = append(raw, lengthBytes...)
+			for _, b := range lengthBytes {
+				length = length<<8 | int64(b)
+			}
+		} else {
+			var lengthBytes []byte
+			var partial bool
+			var err error
+			length, partial, lengthBytes, err = readPacketLength(r)
+			if err != nil {
+				return nil, wrapError(err, "gopenpgp: error in reading the key packets")
+			}
+			if partial {
+				return nil, newError("gopenpgp: key packet with partial length", ErrMalformedPacket)
+			}
+			raw = append(raw, lengthBytes...)
+		}
+		if length > 1<<16 {
+			return nil, newError("gopenpgp: key packet is too long", ErrMalformedPacket)
+		}
+
+		body := make([]byte, length)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return nil, wrapError(unexpectedEOF(err), "gopenpgp: error in reading the key packets")
+		}
+		keyPackets = append(keyPackets, append(raw, body...))
+	}
+}
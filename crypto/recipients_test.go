@@ -0,0 +1,112 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateRecipients(t *testing.T) {
+	newKey, err := GenerateKey(keyTestName, keyTestDomain, "x25519", 0)
+	if err != nil {
+		t.Fatal("Expected no error while generating the key, got:", err)
+	}
+	newKeyRing, err := NewKeyRing(newKey)
+	if err != nil {
+		t.Fatal("Expected no error while building the key ring, got:", err)
+	}
+
+	message := NewPlainMessageFromString("shared folder file")
+	encrypted, err := keyRingTestPublic.Encrypt(message, nil)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+	_, err = newKeyRing.Decrypt(encrypted, nil, 0)
+	assert.Error(t, err)
+
+	added, err := keyRingTestPrivate.UpdateRecipients(encrypted, newKeyRing, nil)
+	if err != nil {
+		t.Fatal("Expected no error while adding a recipient, got:", err)
+	}
+	for _, keyRing := range []*KeyRing{keyRingTestPrivate, newKeyRing} {
+		decrypted, err := keyRing.Decrypt(added, nil, 0)
+		if err != nil {
+			t.Fatal("Expected no error while decrypting, got:", err)
+		}
+		assert.Exactly(t, message.GetString(), decrypted.GetString())
+	}
+
+	// Adding a present recipient does not duplicate its packet
+	again, err := newKeyRing.UpdateRecipients(added, newKeyRing, nil)
+	if err != nil {
+		t.Fatal("Expected no error while adding a present recipient, got:", err)
+	}
+	assert.Exactly(t, added.GetBinary(), again.GetBinary())
+
+	swapped, err := newKeyRing.UpdateRecipients(added, nil, keyRingTestPublic)
+	if err != nil {
+		t.Fatal("Expected no error while removing a recipient, got:", err)
+	}
+	_, err = keyRingTestPrivate.Decrypt(swapped, nil, 0)
+	assert.Error(t, err)
+	decrypted, err := newKeyRing.Decrypt(swapped, nil, 0)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting, got:", err)
+	}
+	assert.Exactly(t, message.GetString(), decrypted.GetString())
+
+	// The data packet is unchanged
+	split, err := swapped.SplitMessage()
+	if err != nil {
+		t.Fatal("Expected no error while splitting, got:", err)
+	}
+	original, err := encrypted.SplitMessage()
+	if err != nil {
+		t.Fatal("Expected no error while splitting, got:", err)
+	}
+	assert.Exactly(t, original.GetBinaryDataPacket(), split.GetBinaryDataPacket())
+
+	_, err = newKeyRing.UpdateRecipients(swapped, nil, newKeyRing)
+	assert.Error(t, err)
+	_, err = keyRingTestPrivate.UpdateRecipients(swapped, newKeyRing, nil)
+	assert.True(t, errors.Is(err, ErrNoDecryptionKey))
+}
+
+func TestUpdateRecipientsStream(t *testing.T) {
+	newKey, err := GenerateKey(keyTestName, keyTestDomain, "x25519", 0)
+	if err != nil {
+		t.Fatal("Expected no error while generating the key, got:", err)
+	}
+	newKeyRing, err := NewKeyRing(newKey)
+	if err != nil {
+		t.Fatal("Expected no error while building the key ring, got:", err)
+	}
+
+	var ciphertext bytes.Buffer
+	writer, err := keyRingTestPublic.EncryptStream(&ciphertext, nil, nil)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	if _, err = writer.Write(data); err != nil {
+		t.Fatal("Expected no error while writing data, got:", err)
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatal("Expected no error while closing the writer, got:", err)
+	}
+
+	var updated bytes.Buffer
+	err = keyRingTestPrivate.UpdateRecipientsStream(bytes.NewReader(ciphertext.Bytes()), &updated, newKeyRing, keyRingTestPublic)
+	if err != nil {
+		t.Fatal("Expected no error while updating the recipients, got:", err)
+	}
+	decrypted, err := newKeyRing.Decrypt(NewPGPMessage(updated.Bytes()), nil, 0)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting, got:", err)
+	}
+	assert.Exactly(t, data, decrypted.GetBinary())
+	_, err = keyRingTestPrivate.Decrypt(NewPGPMessage(updated.Bytes()), nil, 0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,90 @@
+package crypto
+
+import (
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// KeyPacketIterator provides the key packets of a batch re-wrap.
+type KeyPacketIterator interface {
+	// Next returns the next key packet, or io.EOF once there are no more.
+	Next() ([]byte, error)
+}
+
+// RewrapHandler receives the outcome of the re-wrap of each key packet.
+type RewrapHandler interface {
+	// OnRewrap is called, in the order of the iterator, with the index of the
+	// key packet and either the re-wrapped key packet or the error for this item.
+	OnRewrap(index int, keyPacket []byte, err error)
+}
+
+// rewrapJob is the re-wrap of a key packet by the workers of RewrapKeyPackets.
+type rewrapJob struct {
+	index     int
+	keyPacket []byte
+	err       error
+	ready     chan struct{} // closed once keyPacket or err is set
+}
+
+// RewrapKeyPackets re-encrypts the session keys of key packets, such as the
+// ones of PGPSplitMessage.GetBinaryKeyPacket, from the old key ring to the new
+// one, on several goroutines. The packets for the keys of the old key ring are
+// replaced by packets for the new key ring, the other recipients are kept and
+// the data packets are not needed. Every decrypted session key is cleared.
+// A failure for an item is reported to the handler and does not stop the batch.
+// * newKeyRing : the key ring to encrypt the session keys to.
+// * keyPackets : the key packets to re-wrap.
+// * handler : receives the result for each key packet, from a single goroutine.
+// * workers : the number of goroutines, 0 for the number of CPUs.
+// The returned error is the one of the iterator, if it fails before io.EOF.
+func (keyRing *KeyRing) RewrapKeyPackets(newKeyRing *KeyRing, keyPackets KeyPacketIterator, handler RewrapHandler, workers int) error {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	jobs := make(chan *rewrapJob, workers)
+	pending := make(chan *rewrapJob, 2*workers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				job.keyPacket, job.err = keyRing.UpdateKeyPacketRecipients(job.keyPacket, newKeyRing, keyRing)
+				close(job.ready)
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for job := range pending {
+			<-job.ready
+			handler.OnRewrap(job.index, job.keyPacket, job.err)
+		}
+	}()
+
+	var iterErr error
+	for index := 0; ; index++ {
+		keyPacket, err := keyPackets.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			iterErr = errors.Wrap(err, "gopenpgp: error in reading the key packets")
+			break
+		}
+		job := &rewrapJob{index: index, keyPacket: keyPacket, ready: make(chan struct{})}
+		pending <- job
+		jobs <- job
+	}
+	close(jobs)
+	close(pending)
+	wg.Wait()
+	<-done
+	return iterErr
+}
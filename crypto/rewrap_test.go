@@ -0,0 +1,85 @@
+package crypto
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type sliceKeyPacketIterator struct {
+	keyPackets [][]byte
+}
+
+func (it *sliceKeyPacketIterator) Next() ([]byte, error) {
+	if len(it.keyPackets) == 0 {
+		return nil, io.EOF
+	}
+	keyPacket := it.keyPackets[0]
+	it.keyPackets = it.keyPackets[1:]
+	return keyPacket, nil
+}
+
+type rewrapResults struct {
+	indexes    []int
+	keyPackets [][]byte
+	errs       []error
+}
+
+func (r *rewrapResults) OnRewrap(index int, keyPacket []byte, err error) {
+	r.indexes = append(r.indexes, index)
+	r.keyPackets = append(r.keyPackets, keyPacket)
+	r.errs = append(r.errs, err)
+}
+
+func TestRewrapKeyPackets(t *testing.T) {
+	newKey, err := GenerateKey(keyTestName, keyTestDomain, "x25519", 0)
+	if err != nil {
+		t.Fatal("Expected no error while generating the key, got:", err)
+	}
+	newKeyRing, err := NewKeyRing(newKey)
+	if err != nil {
+		t.Fatal("Expected no error while building the key ring, got:", err)
+	}
+
+	var messages []*PGPSplitMessage
+	iterator := &sliceKeyPacketIterator{}
+	for i := 0; i < 20; i++ {
+		encrypted, err := keyRingTestPublic.Encrypt(NewPlainMessageFromString("stored file"), nil)
+		if err != nil {
+			t.Fatal("Expected no error while encrypting, got:", err)
+		}
+		split, err := encrypted.SplitMessage()
+		if err != nil {
+			t.Fatal("Expected no error while splitting, got:", err)
+		}
+		messages = append(messages, split)
+		iterator.keyPackets = append(iterator.keyPackets, split.GetBinaryKeyPacket())
+	}
+	iterator.keyPackets[7] = []byte{0xc1, 0x02, 0x03}
+
+	results := &rewrapResults{}
+	if err = keyRingTestPrivate.RewrapKeyPackets(newKeyRing, iterator, results, 4); err != nil {
+		t.Fatal("Expected no error while re-wrapping, got:", err)
+	}
+
+	assert.Len(t, results.indexes, len(messages))
+	for i, split := range messages {
+		assert.Exactly(t, i, results.indexes[i])
+		if i == 7 {
+			assert.Error(t, results.errs[i])
+			continue
+		}
+		if results.errs[i] != nil {
+			t.Fatal("Expected no error while re-wrapping an item, got:", results.errs[i])
+		}
+		rewrapped := NewPGPSplitMessage(results.keyPackets[i], split.GetBinaryDataPacket())
+		decrypted, err := newKeyRing.Decrypt(rewrapped.GetPGPMessage(), nil, 0)
+		if err != nil {
+			t.Fatal("Expected no error while decrypting, got:", err)
+		}
+		assert.Exactly(t, "stored file", decrypted.GetString())
+		_, err = keyRingTestPrivate.DecryptSessionKey(results.keyPackets[i])
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,241 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto"
+	"io"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/ProtonMail/go-crypto/openpgp/s2k"
+	"github.com/angel-one/gopenpgp/v2/constants"
+	"github.com/pkg/errors"
+)
+
+// S2KConfig describes the string-to-key (S2K) function deriving an encryption
+// key from a password. A nil *S2KConfig selects the defaults of each function.
+type S2KConfig struct {
+	// Mode is the S2K function: constants.S2KIteratedSalted or constants.S2KArgon2.
+	// Parsed messages and keys may also report constants.S2KSimple,
+	// constants.S2KSalted or constants.S2KGNUDummy.
+	Mode string
+	// Count is the number of bytes hashed by the iterated and salted S2K,
+	// between 65536 and 65011712. It is rounded up to the next representable value.
+	// 0 selects the default.
+	Count int
+	// Argon2Memory is the memory cost of Argon2 in KiB, rounded up to a power of two.
+	// 0 selects 64 MiB.
+	Argon2Memory int
+	// Argon2Passes is the number of passes of Argon2, 0 selects 3.
+	Argon2Passes int
+	// Argon2Parallelism is the degree of parallelism of Argon2, 0 selects 4.
+	Argon2Parallelism int
+}
+
+// NewIteratedSaltedS2KConfig returns a configuration for the iterated and
+// salted S2K hashing count bytes.
+func NewIteratedSaltedS2KConfig(count int) *S2KConfig {
+	return &S2KConfig{Mode: constants.S2KIteratedSalted, Count: count}
+}
+
+// NewArgon2S2KConfig returns a configuration for the Argon2 S2K.
+// Argon2 is the strongest option, but not all OpenPGP implementations support it.
+// * memory      : the memory cost in KiB.
+// * passes      : the number of passes.
+// * parallelism : the degree of parallelism.
+func NewArgon2S2KConfig(memory, passes, parallelism int) *S2KConfig {
+	return &S2KConfig{
+		Mode:              constants.S2KArgon2,
+		Argon2Memory:      memory,
+		Argon2Passes:      passes,
+		Argon2Parallelism: parallelism,
+	}
+}
+
+// getS2KConfig returns the go-crypto configuration for the S2K function.
+func (config *S2KConfig) getS2KConfig() (*s2k.Config, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	switch config.Mode {
+	case "", constants.S2KIteratedSalted:
+		if config.Count != 0 && (config.Count < 65536 || config.Count > 65011712) {
+			return nil, errors.New("gopenpgp: S2K count must be between 65536 and 65011712")
+		}
+		return &s2k.Config{
+			S2KMode:  s2k.IteratedSaltedS2K,
+			Hash:     crypto.SHA256,
+			S2KCount: config.Count,
+		}, nil
+	case constants.S2KArgon2:
+		if config.Argon2Passes < 0 || config.Argon2Passes > 255 ||
+			config.Argon2Parallelism < 0 || config.Argon2Parallelism > 255 {
+			return nil, errors.New("gopenpgp: Argon2 passes and parallelism must be at most 255")
+		}
+		if config.Argon2Memory < 0 || config.Argon2Memory > maxArgon2Memory {
+			return nil, errors.New("gopenpgp: Argon2 memory must be at most 1 TiB")
+		}
+		return &s2k.Config{
+			S2KMode: s2k.Argon2S2K,
+			Argon2Config: &s2k.Argon2Config{
+				NumberOfPasses:      uint8(config.Argon2Passes),
+				DegreeOfParallelism: uint8(config.Argon2Parallelism),
+				Memory:              uint32(config.Argon2Memory),
+			},
+		}, nil
+	default:
+		return nil, newError("gopenpgp: unsupported S2K mode "+config.Mode, ErrUnsupportedAlgorithm)
+	}
+}
+
+// GetPasswordS2KConfigs returns the S2K functions used by the
+// Symmetric-Key Encrypted Session Key packets of the message,
+// one per password the message is encrypted with.
+func (msg *PGPMessage) GetPasswordS2KConfigs() ([]*S2KConfig, error) {
+	var configs []*S2KConfig
+	packets := packet.NewOpaqueReader(bytes.NewReader(msg.Data))
+	for {
+		p, err := packets.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, wrapError(err, "gopenpgp: error in reading message packets")
+		}
+		if p.Tag == packetTagSymmetricKeyEncrypted {
+			config, err := parseSymmetricKeyEncryptedS2K(p.Contents)
+			if err != nil {
+				return nil, err
+			}
+			configs = append(configs, config)
+		} else if p.Tag != packetTagEncryptedKey {
+			// The session key packets precede the encrypted data
+			break
+		}
+	}
+	return configs, nil
+}
+
+// GetS2KConfig returns the S2K function protecting the private primary key,
+// or nil if it is not locked.
+func (key *Key) GetS2KConfig() (*S2KConfig, error) {
+	if key.entity.PrivateKey == nil {
+		return nil, errors.New("gopenpgp: a public key is not protected by a password")
+	}
+	return getPrivateKeyS2K(key.entity.PrivateKey)
+}
+
+// maxArgon2Memory is the largest supported Argon2 memory cost in KiB,
+// which fits an int on all platforms.
+const (
+	maxArgon2MemoryExponent = 30
+	maxArgon2Memory         = 1 << maxArgon2MemoryExponent
+)
+
+const (
+	packetTagEncryptedKey          = 1
+	packetTagSymmetricKeyEncrypted = 3
+)
+
+// parseSymmetricKeyEncryptedS2K parses the S2K specifier of the body of a
+// Symmetric-Key Encrypted Session Key packet.
+func parseSymmetricKeyEncryptedS2K(contents []byte) (*S2KConfig, error) {
+	// Version and cipher, followed by the AEAD mode for version 5
+	offset := 2
+	if len(contents) > 0 && contents[0] == 5 {
+		offset = 3
+	}
+	if len(contents) < offset {
+		return nil, newError("gopenpgp: symmetric key encrypted session key packet is truncated", ErrMalformedPacket, ErrTruncatedInput)
+	}
+	return parseS2K(contents[offset:])
+}
+
+// getPrivateKeyS2K finds the S2K specifier in the serialized private key packet,
+// which follows the public key fields, the S2K usage and the cipher.
+func getPrivateKeyS2K(privateKey *packet.PrivateKey) (*S2KConfig, error) {
+	if !privateKey.Encrypted && !privateKey.Dummy() {
+		return nil, nil
+	}
+
+	var privateBuf, publicBuf bytes.Buffer
+	if err := privateKey.Serialize(&privateBuf); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in serializing private key")
+	}
+	if err := privateKey.PublicKey.Serialize(&publicBuf); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in serializing public key")
+	}
+	privatePacket, err := packet.NewOpaqueReader(&privateBuf).Next()
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in reading private key")
+	}
+	publicPacket, err := packet.NewOpaqueReader(&publicBuf).Next()
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in reading public key")
+	}
+
+	contents := privatePacket.Contents[len(publicPacket.Contents):]
+	if len(contents) == 0 || (contents[0] != 253 && contents[0] != 254 && contents[0] != 255) {
+		return nil, newError("gopenpgp: unsupported private key protection", ErrUnsupportedAlgorithm)
+	}
+	// S2K usage and cipher, with an additional length octet for versions 5
+	// and 6, the AEAD mode for the usage 253, and the length of the
+	// specifier for version 6
+	offset := 2
+	if privateKey.Version == 5 || privateKey.Version == 6 {
+		offset++
+	}
+	if contents[0] == 253 {
+		offset++
+	}
+	if privateKey.Version == 6 {
+		offset++
+	}
+	if len(contents) < offset {
+		return nil, newError("gopenpgp: private key protection is truncated", ErrMalformedPacket, ErrTruncatedInput)
+	}
+	return parseS2K(contents[offset:])
+}
+
+// parseS2K parses an S2K specifier (RFC 4880, section 3.7.1).
+func parseS2K(specifier []byte) (*S2KConfig, error) {
+	if len(specifier) == 0 {
+		return nil, newError("gopenpgp: S2K specifier is missing", ErrMalformedPacket, ErrTruncatedInput)
+	}
+
+	truncated := newError("gopenpgp: S2K specifier is truncated", ErrMalformedPacket, ErrTruncatedInput)
+	switch s2k.Mode(specifier[0]) {
+	case s2k.SimpleS2K:
+		return &S2KConfig{Mode: constants.S2KSimple}, nil
+	case s2k.SaltedS2K:
+		return &S2KConfig{Mode: constants.S2KSalted}, nil
+	case s2k.IteratedSaltedS2K:
+		// mode, hash, 8 bytes of salt, count
+		if len(specifier) < 11 {
+			return nil, truncated
+		}
+		c := int(specifier[10])
+		return &S2KConfig{
+			Mode:  constants.S2KIteratedSalted,
+			Count: (16 + (c & 15)) << (uint(c>>4) + 6),
+		}, nil
+	case s2k.Argon2S2K:
+		// mode, 16 bytes of salt, passes, parallelism, memory exponent
+		if len(specifier) < 20 {
+			return nil, truncated
+		}
+		if specifier[19] > maxArgon2MemoryExponent {
+			return nil, newError("gopenpgp: unsupported Argon2 memory", ErrUnsupportedAlgorithm)
+		}
+		return &S2KConfig{
+			Mode:              constants.S2KArgon2,
+			Argon2Passes:      int(specifier[17]),
+			Argon2Parallelism: int(specifier[18]),
+			Argon2Memory:      1 << uint(specifier[19]),
+		}, nil
+	case s2k.GnuS2K:
+		return &S2KConfig{Mode: constants.S2KGNUDummy}, nil
+	default:
+		return nil, newError("gopenpgp: unsupported S2K mode", ErrUnsupportedAlgorithm)
+	}
+}
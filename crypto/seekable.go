@@ -0,0 +1,508 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"math/bits"
+	"sync"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/pkg/errors"
+
+	"github.com/angel-one/gopenpgp/v2/constants"
+)
+
+// The seekable format encrypts data in the chunks of a version 2 Symmetrically
+// Encrypted Integrity Protected Data packet (see aead_chunks.go), with
+// AES-GCM, so that any range of the plaintext can be decrypted and
+// authenticated without reading the preceding chunks. The chunks hold the
+// plaintext itself, not OpenPGP packets, and the data is not an OpenPGP
+// packet: it must only be exchanged between applications using this package.
+//
+// The data is made of:
+//   - the magic bytes "GOPGPSK" and the version 2;
+//   - the body of the SEIPD packet: its header, the chunks and the final tag.
+//
+// The chunk index is kept apart from the data, as the data is written before
+// the number of chunks is known. It is made of:
+//   - the magic bytes "GOPGPSI" and the version 2;
+//   - the size of the plaintext and the number of chunks, as 64 bits
+//     big-endian integers;
+//   - the offset of each chunk in the data, as a 64 bits big-endian integer.
+//
+// The index is checked against the chunk size, and the size of the plaintext
+// it gives is authenticated by the final tag.
+const (
+	seekableVersion         = 2
+	seekableHeaderSize      = 8 + aeadChunkHeaderSize
+	seekableIndexHeaderSize = 24
+	seekableIndexEntrySize  = 8
+)
+
+var (
+	seekableMagic      = []byte("GOPGPSK")
+	seekableIndexMagic = []byte("GOPGPSI")
+)
+
+// seekableChunkSizeByte returns the OpenPGP encoding of chunkSize,
+// which must be a power of two from 64 bytes to 4 MiB.
+func seekableChunkSizeByte(chunkSize int) (byte, error) {
+	if chunkSize == 0 {
+		chunkSize = constants.DefaultSeekableChunkSize
+	}
+	if chunkSize < 1<<6 || chunkSize > 1<<(aeadChunkMaxSize+6) || chunkSize&(chunkSize-1) != 0 {
+		return 0, errors.New("gopenpgp: the chunk size must be a power of two from 64 bytes to 4 MiB")
+	}
+	return byte(bits.TrailingZeros(uint(chunkSize)) - 6), nil
+}
+
+// newSeekableCrypter returns the chunk cipher of the seekable data header.
+func newSeekableCrypter(sk *SessionKey, header []byte) (*aeadChunkCrypter, error) {
+	if len(header) != seekableHeaderSize || !bytes.Equal(header[:len(seekableMagic)], seekableMagic) {
+		return nil, newError("gopenpgp: invalid seekable data header", ErrMalformedPacket)
+	}
+	if header[len(seekableMagic)] != seekableVersion {
+		return nil, newError("gopenpgp: unsupported seekable data version", ErrUnsupportedAlgorithm)
+	}
+	if packet.AEADMode(header[10]) != packet.AEADModeGCM {
+		return nil, newError("gopenpgp: unsupported seekable data AEAD mode", ErrUnsupportedAlgorithm)
+	}
+	return newAEADChunkCrypter(sk, header[8:])
+}
+
+// seekableChunkIndex builds the chunk index of a seekable encryption.
+type seekableChunkIndex struct {
+	offset  uint64 // the offset of the next chunk in the data
+	size    uint64
+	chunks  uint64
+	entries []byte
+}
+
+// add records a chunk written to the data.
+func (index *seekableChunkIndex) add(plaintextSize, ciphertextSize int) {
+	var entry [seekableIndexEntrySize]byte
+	binary.BigEndian.PutUint64(entry[:], index.offset)
+	index.entries = append(index.entries, entry[:]...)
+	index.offset += uint64(ciphertextSize)
+	index.size += uint64(plaintextSize)
+	index.chunks++
+}
+
+func (index *seekableChunkIndex) serialize() []byte {
+	serialized := make([]byte, seekableIndexHeaderSize, seekableIndexHeaderSize+len(index.entries))
+	copy(serialized, seekableIndexMagic)
+	serialized[len(seekableIndexMagic)] = seekableVersion
+	binary.BigEndian.PutUint64(serialized[8:], index.size)
+	binary.BigEndian.PutUint64(serialized[16:], index.chunks)
+	return append(serialized, index.entries...)
+}
+
+// seekableWriter is the plaintext writer of a seekable encryption.
+type seekableWriter interface {
+	WriteCloser
+	// chunkIndex returns the chunk index, once the writer is closed.
+	chunkIndex() []byte
+}
+
+// seekableEncryptWriter encrypts the data written to it in chunks.
+type seekableEncryptWriter struct {
+	writer  io.Writer
+	crypter *aeadChunkCrypter
+	buffer  []byte
+	index   seekableChunkIndex
+	closed  bool
+}
+
+func (w *seekableEncryptWriter) Write(b []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("gopenpgp: the seekable encryption writer is closed")
+	}
+	w.buffer = append(w.buffer, b...)
+	for len(w.buffer) >= w.crypter.chunkSize {
+		if err := w.writeChunk(w.buffer[:w.crypter.chunkSize]); err != nil {
+			return 0, err
+		}
+		remaining := copy(w.buffer, w.buffer[w.crypter.chunkSize:])
+		clearMem(w.buffer[remaining:])
+		w.buffer = w.buffer[:remaining]
+	}
+	return len(b), nil
+}
+
+func (w *seekableEncryptWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	defer func() {
+		clearMem(w.buffer)
+		w.buffer = nil
+	}()
+	// The last chunk is only empty if there is no data
+	if len(w.buffer) > 0 || w.index.chunks == 0 {
+		if err := w.writeChunk(w.buffer); err != nil {
+			return err
+		}
+	}
+	return writeSeekableData(w.writer, w.crypter.finalTag(w.index.chunks, w.index.size))
+}
+
+func (w *seekableEncryptWriter) writeChunk(plaintext []byte) error {
+	ciphertext := w.crypter.sealChunk(nil, plaintext, w.index.chunks)
+	if err := writeSeekableData(w.writer, ciphertext); err != nil {
+		return err
+	}
+	w.index.add(len(plaintext), len(ciphertext))
+	return nil
+}
+
+func (w *seekableEncryptWriter) chunkIndex() []byte {
+	return w.index.serialize()
+}
+
+func writeSeekableData(w io.Writer, data []byte) error {
+	if _, err := w.Write(data); err != nil {
+		return errors.Wrap(err, "gopenpgp: error in writing the seekable data")
+	}
+	return nil
+}
+
+// SeekableEncryptResult is the plaintext writer of a seekable encryption.
+// Once it is closed, it gives the chunk index of the encrypted data, and the
+// key packet of a key ring encryption.
+type SeekableEncryptResult struct {
+	isClosed           bool
+	keyPacket          []byte
+	chunkIndex         []byte
+	plainMessageWriter seekableWriter
+}
+
+func (res *SeekableEncryptResult) Write(b []byte) (n int, err error) {
+	return res.plainMessageWriter.Write(b)
+}
+
+func (res *SeekableEncryptResult) Close() (err error) {
+	if err = res.plainMessageWriter.Close(); err != nil {
+		return err
+	}
+	res.isClosed = true
+	res.chunkIndex = res.plainMessageWriter.chunkIndex()
+	return nil
+}
+
+// GetChunkIndex returns the chunk index, to be stored along with the
+// encrypted data and passed to DecryptSeekable.
+// This can be retrieved only after the data has been fully written and the writer is closed.
+func (res *SeekableEncryptResult) GetChunkIndex() (chunkIndex []byte, err error) {
+	if !res.isClosed {
+		return nil, errors.New("gopenpgp: can't access the chunk index until the writer has been closed")
+	}
+	return res.chunkIndex, nil
+}
+
+// GetKeyPacket returns the Public-Key Encrypted Session Key Packets of a key ring encryption.
+// This can be retrieved only after the data has been fully written and the writer is closed.
+func (res *SeekableEncryptResult) GetKeyPacket() (keyPacket []byte, err error) {
+	if !res.isClosed {
+		return nil, errors.New("gopenpgp: can't access key packet until the writer has been closed")
+	}
+	if res.keyPacket == nil {
+		return nil, errors.New("gopenpgp: the data is encrypted with a session key, without key packet")
+	}
+	return res.keyPacket, nil
+}
+
+// EncryptSeekableStream is used to encrypt data as a Writer, in the seekable
+// chunked format: its decryption with DecryptSeekable gives random access to
+// the plaintext, only decrypting the chunks covering the ranges read.
+// The session key must be an AES key. The chunks are the ones of an OpenPGP
+// AEAD-chunked (SEIPD version 2) packet, but the data is not an OpenPGP
+// message: it can only be decrypted with this package.
+// The chunk index given by the result once closed must be stored along with
+// the encrypted data.
+// * dataWriter : the writer for the encrypted data.
+// * chunkSize : the size of the plaintext chunks, a power of two from 64 bytes
+// to 4 MiB, or 0 for constants.DefaultSeekableChunkSize.
+func (sk *SessionKey) EncryptSeekableStream(dataWriter Writer, chunkSize int) (*SeekableEncryptResult, error) {
+	crypter, err := sk.newSeekableEncryption(dataWriter, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+	return &SeekableEncryptResult{
+		plainMessageWriter: &seekableEncryptWriter{
+			writer:  dataWriter,
+			crypter: crypter,
+			index:   seekableChunkIndex{offset: seekableHeaderSize},
+		},
+	}, nil
+}
+
+// newSeekableEncryption writes the header of a seekable encryption with a
+// new salt, and returns its chunk cipher.
+func (sk *SessionKey) newSeekableEncryption(dataWriter Writer, chunkSize int) (*aeadChunkCrypter, error) {
+	chunkSizeByte, err := seekableChunkSizeByte(chunkSize)
+	if err != nil {
+		return nil, err
+	}
+	salt, err := sk.getPGP().randomToken(aeadChunkSaltSize)
+	if err != nil {
+		return nil, err
+	}
+	body, err := sk.newAEADChunkHeader(packet.AEADModeGCM, chunkSizeByte, salt)
+	if err != nil {
+		return nil, err
+	}
+	header := append(append(clone(seekableMagic), seekableVersion), body...)
+	crypter, err := newSeekableCrypter(sk, header)
+	if err != nil {
+		return nil, err
+	}
+	if err = writeSeekableData(dataWriter, header); err != nil {
+		return nil, err
+	}
+	return crypter, nil
+}
+
+// SeekableReader decrypts data in the seekable chunked format. It implements
+// io.Reader, io.ReaderAt and io.Seeker over the plaintext, and only decrypts
+// and authenticates the chunks covering the ranges read. The size of the
+// plaintext is authenticated when the reader is created. ReadAt may be called
+// concurrently, Read and Seek may not, as they share the offset of the reader.
+type SeekableReader struct {
+	data    io.ReaderAt
+	crypter *aeadChunkCrypter
+	chunks  int64
+	offsets []byte
+	end     int64 // the offset of the final tag
+	size    int64
+	offset  int64
+
+	lock        sync.Mutex // guards the cached chunk
+	cacheIndex  int64
+	cachedChunk []byte
+}
+
+// DecryptSeekable returns a SeekableReader decrypting the data encrypted by
+// EncryptSeekableStream.
+// * data : the encrypted data.
+// * size : the size of the encrypted data.
+// * chunkIndex : the chunk index of the encrypted data.
+func (sk *SessionKey) DecryptSeekable(data io.ReaderAt, size int64, chunkIndex []byte) (*SeekableReader, error) {
+	if size < seekableHeaderSize {
+		return nil, newError("gopenpgp: the seekable data is too short", ErrTruncatedInput)
+	}
+	header := make([]byte, seekableHeaderSize)
+	if _, err := data.ReadAt(header, 0); err != nil {
+		return nil, wrapError(err, "gopenpgp: error in reading the seekable data header")
+	}
+	crypter, err := newSeekableCrypter(sk, header)
+	if err != nil {
+		return nil, err
+	}
+	reader := &SeekableReader{data: data, crypter: crypter, cacheIndex: -1}
+	if err = reader.readChunkIndex(chunkIndex, size); err != nil {
+		return nil, err
+	}
+
+	tag := make([]byte, aeadChunkTagSize)
+	if _, err := data.ReadAt(tag, reader.end); err != nil {
+		return nil, wrapError(err, "gopenpgp: error in reading the seekable data")
+	}
+	if err = crypter.checkFinalTag(tag, uint64(reader.chunks), uint64(reader.size)); err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+// readChunkIndex checks the chunk index against the chunk size and the size
+// of the data, and keeps the chunk offsets.
+func (r *SeekableReader) readChunkIndex(chunkIndex []byte, dataSize int64) error {
+	if len(chunkIndex) < seekableIndexHeaderSize || !bytes.Equal(chunkIndex[:len(seekableIndexMagic)], seekableIndexMagic) {
+		return newError("gopenpgp: invalid seekable chunk index", ErrMalformedPacket)
+	}
+	if chunkIndex[len(seekableIndexMagic)] != seekableVersion {
+		return newError("gopenpgp: unsupported seekable chunk index version", ErrUnsupportedAlgorithm)
+	}
+	size := binary.BigEndian.Uint64(chunkIndex[8:])
+	chunks := binary.BigEndian.Uint64(chunkIndex[16:])
+	chunkSize := uint64(r.crypter.chunkSize)
+	expected := (size + chunkSize - 1) / chunkSize
+	if size == 0 {
+		expected = 1
+	}
+	if size > math.MaxInt64 || chunks != expected ||
+		uint64(len(chunkIndex)-seekableIndexHeaderSize) != chunks*seekableIndexEntrySize {
+		return newError("gopenpgp: invalid seekable chunk index", ErrMalformedPacket)
+	}
+
+	offsets := chunkIndex[seekableIndexHeaderSize:]
+	encryptedChunkSize := chunkSize + aeadChunkTagSize
+	for i := uint64(0); i < chunks; i++ {
+		if binary.BigEndian.Uint64(offsets[i*seekableIndexEntrySize:]) != seekableHeaderSize+i*encryptedChunkSize {
+			return newError("gopenpgp: invalid seekable chunk index", ErrMalformedPacket)
+		}
+	}
+	end := seekableHeaderSize + (chunks-1)*encryptedChunkSize + size - (chunks-1)*chunkSize + aeadChunkTagSize
+	if end+aeadChunkTagSize != uint64(dataSize) {
+		return newError("gopenpgp: the seekable data does not match its chunk index", ErrTruncatedInput)
+	}
+
+	r.chunks = int64(chunks)
+	r.offsets = clone(offsets)
+	r.end = int64(end)
+	r.size = int64(size)
+	return nil
+}
+
+// Size returns the size of the plaintext.
+func (r *SeekableReader) Size() int64 {
+	return r.size
+}
+
+// copyChunk copies the plaintext of chunk index, from offset off in the chunk,
+// to b. The chunk is decrypted into a new buffer unless it is cached, outside
+// of the lock, so that concurrent calls decrypt in parallel.
+func (r *SeekableReader) copyChunk(b []byte, index, off int64) (int, error) {
+	r.lock.Lock()
+	if index == r.cacheIndex {
+		n := copy(b, r.cachedChunk[off:])
+		r.lock.Unlock()
+		return n, nil
+	}
+	r.lock.Unlock()
+
+	plaintext, err := r.decryptChunk(index)
+	if err != nil {
+		return 0, err
+	}
+	n := copy(b, plaintext[off:])
+	r.cacheChunk(index, plaintext)
+	return n, nil
+}
+
+// cacheChunk replaces the cached chunk with the plaintext of chunk index.
+func (r *SeekableReader) cacheChunk(index int64, plaintext []byte) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	clearMem(r.cachedChunk)
+	r.cachedChunk = plaintext
+	r.cacheIndex = index
+}
+
+// decryptChunk returns the plaintext of chunk index, in a new buffer.
+func (r *SeekableReader) decryptChunk(index int64) ([]byte, error) {
+	start := int64(binary.BigEndian.Uint64(r.offsets[index*seekableIndexEntrySize:]))
+	end := r.end
+	if index < r.chunks-1 {
+		end = int64(binary.BigEndian.Uint64(r.offsets[(index+1)*seekableIndexEntrySize:]))
+	}
+	ciphertext := make([]byte, end-start)
+	if _, err := r.data.ReadAt(ciphertext, start); err != nil {
+		return nil, wrapError(err, "gopenpgp: error in reading the seekable data")
+	}
+
+	return r.crypter.openChunk(nil, ciphertext, uint64(index))
+}
+
+// ReadAt reads len(b) bytes of plaintext starting at offset off.
+// It implements io.ReaderAt, and is safe for concurrent use.
+func (r *SeekableReader) ReadAt(b []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("gopenpgp: negative offset")
+	}
+	chunkSize := int64(r.crypter.chunkSize)
+	for n < len(b) && off < r.size {
+		copied, err := r.copyChunk(b[n:], off/chunkSize, off%chunkSize)
+		if err != nil {
+			return n, err
+		}
+		n += copied
+		off += int64(copied)
+	}
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Read reads the plaintext from the current offset.
+// It implements io.Reader.
+func (r *SeekableReader) Read(b []byte) (n int, err error) {
+	n, err = r.ReadAt(b, r.offset)
+	r.offset += int64(n)
+	if n > 0 && errors.Is(err, io.EOF) {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek sets the offset of the next Read in the plaintext.
+// It implements io.Seeker.
+func (r *SeekableReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("gopenpgp: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("gopenpgp: negative offset")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// Clear clears the cached plaintext chunk.
+func (r *SeekableReader) Clear() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	clearMem(r.cachedChunk)
+	r.cachedChunk = nil
+	r.cacheIndex = -1
+}
+
+// EncryptSeekableStream is used to encrypt data as a Writer, in the seekable
+// chunked format, with a new AES-256 session key encrypted to the key ring.
+// It returns a writer for the plaintext data, which gives the key packet and
+// the chunk index once closed. See SessionKey.EncryptSeekableStream.
+// * dataWriter : the writer for the encrypted data.
+// * chunkSize : the size of the plaintext chunks, a power of two from 64 bytes
+// to 4 MiB, or 0 for constants.DefaultSeekableChunkSize.
+func (keyRing *KeyRing) EncryptSeekableStream(dataWriter Writer, chunkSize int) (*SeekableEncryptResult, error) {
+	sk, err := keyRing.getPGP().GenerateSessionKey()
+	if err != nil {
+		return nil, err
+	}
+	defer sk.Clear()
+	keyPacket, err := keyRing.EncryptSessionKey(sk)
+	if err != nil {
+		return nil, err
+	}
+	result, err := sk.EncryptSeekableStream(dataWriter, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+	result.keyPacket = keyPacket
+	return result, nil
+}
+
+// DecryptSeekable decrypts the session key of the key packet with the key
+// ring, and returns a SeekableReader decrypting the data encrypted by
+// EncryptSeekableStream.
+// * keyPacket : the key packet.
+// * data : the encrypted data.
+// * size : the size of the encrypted data.
+// * chunkIndex : the chunk index of the encrypted data.
+func (keyRing *KeyRing) DecryptSeekable(keyPacket []byte, data io.ReaderAt, size int64, chunkIndex []byte) (*SeekableReader, error) {
+	sk, err := keyRing.DecryptSessionKey(keyPacket)
+	if err != nil {
+		return nil, err
+	}
+	defer sk.Clear()
+	return sk.DecryptSeekable(data, size, chunkIndex)
+}
@@ -0,0 +1,118 @@
+package crypto
+
+import "io"
+
+// parallelSeekableEncryptWriter encrypts the data written to it in chunks,
+// on several goroutines, and builds the chunk index.
+type parallelSeekableEncryptWriter struct {
+	*parallelChunkWriter
+	index seekableChunkIndex // written by the goroutine writing the chunks
+}
+
+func (w *parallelSeekableEncryptWriter) chunkIndex() []byte {
+	return w.index.serialize()
+}
+
+// EncryptSeekableStreamParallel is used to encrypt data as a Writer, in the
+// seekable chunked format, encrypting the chunks on several goroutines.
+// The output and the chunk index are identical to the ones of
+// EncryptSeekableStream. At most three chunks per worker are held in memory.
+// The writer must be closed to stop the goroutines.
+// * dataWriter : the writer for the encrypted data.
+// * chunkSize : the size of the plaintext chunks, a power of two from 64 bytes
+// to 4 MiB, or 0 for constants.DefaultSeekableChunkSize.
+// * workers : the number of goroutines, 0 for the number of CPUs.
+func (sk *SessionKey) EncryptSeekableStreamParallel(dataWriter Writer, chunkSize int, workers int) (*SeekableEncryptResult, error) {
+	crypter, err := sk.newSeekableEncryption(dataWriter, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+	w := &parallelSeekableEncryptWriter{index: seekableChunkIndex{offset: seekableHeaderSize}}
+	if w.parallelChunkWriter, err = newParallelChunkWriter(dataWriter, nil, crypter, workers, w.index.add); err != nil {
+		return nil, err
+	}
+	return &SeekableEncryptResult{plainMessageWriter: w}, nil
+}
+
+// EncryptSeekableStreamParallel is used to encrypt data as a Writer, in the
+// seekable chunked format, with a new AES-256 session key encrypted to the key
+// ring, encrypting the chunks on several goroutines.
+// See SessionKey.EncryptSeekableStreamParallel.
+// * dataWriter : the writer for the encrypted data.
+// * chunkSize : the size of the plaintext chunks, a power of two from 64 bytes
+// to 4 MiB, or 0 for constants.DefaultSeekableChunkSize.
+// * workers : the number of goroutines, 0 for the number of CPUs.
+func (keyRing *KeyRing) EncryptSeekableStreamParallel(dataWriter Writer, chunkSize int, workers int) (*SeekableEncryptResult, error) {
+	sk, err := keyRing.getPGP().GenerateSessionKey()
+	if err != nil {
+		return nil, err
+	}
+	defer sk.Clear()
+	keyPacket, err := keyRing.EncryptSessionKey(sk)
+	if err != nil {
+		return nil, err
+	}
+	result, err := sk.EncryptSeekableStreamParallel(dataWriter, chunkSize, workers)
+	if err != nil {
+		return nil, err
+	}
+	result.keyPacket = keyPacket
+	return result, nil
+}
+
+// ParallelSeekableReader decrypts a stream in the seekable chunked format,
+// decrypting the chunks on several goroutines, and returns them in order.
+type ParallelSeekableReader struct {
+	reader *parallelChunkReader
+}
+
+// DecryptSeekableStreamParallel returns a ParallelSeekableReader decrypting
+// the stream encrypted by EncryptSeekableStream or
+// EncryptSeekableStreamParallel, in order, on several goroutines. The chunk
+// index is not needed, as the stream is read until the end.
+// At most three chunks per worker are held in memory. The reader must be read
+// until the end or closed to stop the goroutines.
+// * dataReader : the encrypted data.
+// * workers : the number of goroutines, 0 for the number of CPUs.
+func (sk *SessionKey) DecryptSeekableStreamParallel(dataReader Reader, workers int) (*ParallelSeekableReader, error) {
+	header := make([]byte, seekableHeaderSize)
+	if _, err := io.ReadFull(dataReader, header); err != nil {
+		return nil, wrapError(err, "gopenpgp: error in reading the seekable data header", ErrTruncatedInput)
+	}
+	crypter, err := newSeekableCrypter(sk, header)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := newParallelChunkReader(dataReader, crypter, workers)
+	if err != nil {
+		return nil, err
+	}
+	return &ParallelSeekableReader{reader: reader}, nil
+}
+
+// DecryptSeekableStreamParallel decrypts the session key of the key packet
+// with the key ring, and returns a ParallelSeekableReader decrypting the
+// stream. See SessionKey.DecryptSeekableStreamParallel.
+// * keyPacket : the key packet.
+// * dataReader : the encrypted data.
+// * workers : the number of goroutines, 0 for the number of CPUs.
+func (keyRing *KeyRing) DecryptSeekableStreamParallel(keyPacket []byte, dataReader Reader, workers int) (*ParallelSeekableReader, error) {
+	sk, err := keyRing.DecryptSessionKey(keyPacket)
+	if err != nil {
+		return nil, err
+	}
+	defer sk.Clear()
+	return sk.DecryptSeekableStreamParallel(dataReader, workers)
+}
+
+// Read reads the decrypted data. Only authenticated chunks are returned.
+// It implements io.Reader.
+func (r *ParallelSeekableReader) Read(b []byte) (n int, err error) {
+	return r.reader.Read(b)
+}
+
+// Close stops the decryption, if the reader has not been read until the end.
+func (r *ParallelSeekableReader) Close() error {
+	r.reader.stop()
+	return nil
+}
@@ -0,0 +1,139 @@
+package crypto
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeekableParallelEncryption(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+
+	sequentialKey, err := newTestingInstance("seed").GenerateSessionKey()
+	if err != nil {
+		t.Fatal("Expected no error while generating the session key, got:", err)
+	}
+	sequential, sequentialIndex := encryptSeekable(t, sequentialKey, data, 256)
+
+	for _, workers := range []int{0, 1, 4} {
+		parallelKey, err := newTestingInstance("seed").GenerateSessionKey()
+		if err != nil {
+			t.Fatal("Expected no error while generating the session key, got:", err)
+		}
+		var parallel bytes.Buffer
+		writer, err := parallelKey.EncryptSeekableStreamParallel(&parallel, 256, workers)
+		if err != nil {
+			t.Fatal("Expected no error while encrypting, got:", err)
+		}
+		for i := 0; i < len(data); i += 1000 {
+			if _, err = writer.Write(data[i : i+1000]); err != nil {
+				t.Fatal("Expected no error while writing data, got:", err)
+			}
+		}
+		if err = writer.Close(); err != nil {
+			t.Fatal("Expected no error while closing the writer, got:", err)
+		}
+		chunkIndex, err := writer.GetChunkIndex()
+		if err != nil {
+			t.Fatal("Expected no error while accessing the chunk index, got:", err)
+		}
+		assert.Exactly(t, sequential, parallel.Bytes())
+		assert.Exactly(t, sequentialIndex, chunkIndex)
+	}
+}
+
+func TestSeekableParallelDecryption(t *testing.T) {
+	for _, size := range []int{0, 255, 256, 257, 100000} {
+		data, err := RandomToken(size)
+		if err != nil {
+			t.Fatal("Expected no error while generating data, got:", err)
+		}
+		ciphertext, _ := encryptSeekable(t, testSessionKey, data, 256)
+
+		reader, err := testSessionKey.DecryptSeekableStreamParallel(bytes.NewReader(ciphertext), 4)
+		if err != nil {
+			t.Fatal("Expected no error while decrypting, got:", err)
+		}
+		decrypted, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal("Expected no error while reading, got:", err)
+		}
+		assert.Exactly(t, data, append([]byte{}, decrypted...))
+	}
+
+	ciphertext, _ := encryptSeekable(t, testSessionKey, bytes.Repeat([]byte("0123456789"), 1000), 256)
+	tampered := clone(ciphertext)
+	tampered[len(tampered)/2] ^= 1
+	reader, err := testSessionKey.DecryptSeekableStreamParallel(bytes.NewReader(tampered), 4)
+	if err != nil {
+		t.Fatal("Expected no error while starting the decryption, got:", err)
+	}
+	_, err = ioutil.ReadAll(reader)
+	assert.True(t, errors.Is(err, ErrIntegrity))
+
+	// The truncation at a chunk boundary is detected with the final tag
+	for _, truncated := range [][]byte{
+		ciphertext[:seekableHeaderSize+3*(256+16)],
+		append(clone(ciphertext[:seekableHeaderSize+3*(256+16)]), ciphertext[len(ciphertext)-16:]...),
+	} {
+		reader, err = testSessionKey.DecryptSeekableStreamParallel(bytes.NewReader(truncated), 4)
+		if err != nil {
+			t.Fatal("Expected no error while starting the decryption, got:", err)
+		}
+		_, err = ioutil.ReadAll(reader)
+		assert.True(t, errors.Is(err, ErrIntegrity))
+	}
+
+	reader, err = testSessionKey.DecryptSeekableStreamParallel(bytes.NewReader(ciphertext), 2)
+	if err != nil {
+		t.Fatal("Expected no error while starting the decryption, got:", err)
+	}
+	if _, err = reader.Read(make([]byte, 10)); err != nil {
+		t.Fatal("Expected no error while reading, got:", err)
+	}
+	assert.NoError(t, reader.Close())
+	_, err = reader.Read(make([]byte, 10))
+	assert.Error(t, err)
+}
+
+func TestKeyRingSeekableParallel(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	var ciphertext bytes.Buffer
+	result, err := keyRingTestPublic.EncryptSeekableStreamParallel(&ciphertext, 1024, 4)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+	if _, err = result.Write(data); err != nil {
+		t.Fatal("Expected no error while writing data, got:", err)
+	}
+	if err = result.Close(); err != nil {
+		t.Fatal("Expected no error while closing the writer, got:", err)
+	}
+	keyPacket, err := result.GetKeyPacket()
+	if err != nil {
+		t.Fatal("Expected no error while accessing the key packet, got:", err)
+	}
+	chunkIndex, err := result.GetChunkIndex()
+	if err != nil {
+		t.Fatal("Expected no error while accessing the chunk index, got:", err)
+	}
+
+	reader, err := keyRingTestPrivate.DecryptSeekableStreamParallel(keyPacket, bytes.NewReader(ciphertext.Bytes()), 4)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting, got:", err)
+	}
+	decrypted, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal("Expected no error while reading, got:", err)
+	}
+	assert.Exactly(t, data, decrypted)
+
+	seekableReader, err := keyRingTestPrivate.DecryptSeekable(keyPacket, bytes.NewReader(ciphertext.Bytes()), int64(ciphertext.Len()), chunkIndex)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting, got:", err)
+	}
+	assert.Exactly(t, int64(len(data)), seekableReader.Size())
+}
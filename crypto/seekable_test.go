@@ -0,0 +1,261 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingReaderAt counts the bytes read from a byte slice.
+type countingReaderAt struct {
+	reader *bytes.Reader
+	read   int
+}
+
+func (r *countingReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	n, err := r.reader.ReadAt(b, off)
+	r.read += n
+	return n, err
+}
+
+func encryptSeekable(t *testing.T, sk *SessionKey, data []byte, chunkSize int) (ciphertext, chunkIndex []byte) {
+	var buffer bytes.Buffer
+	writer, err := sk.EncryptSeekableStream(&buffer, chunkSize)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+	for i := 0; i < len(data); i += 100 {
+		end := i + 100
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err = writer.Write(data[i:end]); err != nil {
+			t.Fatal("Expected no error while writing data, got:", err)
+		}
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatal("Expected no error while closing the writer, got:", err)
+	}
+	chunkIndex, err = writer.GetChunkIndex()
+	if err != nil {
+		t.Fatal("Expected no error while accessing the chunk index, got:", err)
+	}
+	return buffer.Bytes(), chunkIndex
+}
+
+func TestSeekableEncryptDecrypt(t *testing.T) {
+	for _, size := range []int{0, 1, 64, 640, 1000} {
+		data, err := RandomToken(size)
+		if err != nil {
+			t.Fatal("Expected no error while generating data, got:", err)
+		}
+		ciphertext, chunkIndex := encryptSeekable(t, testSessionKey, data, 64)
+		chunks := (size + 63) / 64
+		if chunks == 0 {
+			chunks = 1
+		}
+		assert.Exactly(t, seekableIndexHeaderSize+chunks*seekableIndexEntrySize, len(chunkIndex))
+
+		reader, err := testSessionKey.DecryptSeekable(bytes.NewReader(ciphertext), int64(len(ciphertext)), chunkIndex)
+		if err != nil {
+			t.Fatal("Expected no error while decrypting, got:", err)
+		}
+		assert.Exactly(t, int64(size), reader.Size())
+		decrypted, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal("Expected no error while reading, got:", err)
+		}
+		assert.Exactly(t, data, append([]byte{}, decrypted...))
+	}
+}
+
+func TestSeekableSEIPDv2Chunks(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	ciphertext, _ := encryptSeekable(t, testSessionKey, data, 256)
+
+	// Without the magic bytes, the data is the body of a SEIPD version 2 packet
+	body := ciphertext[8:]
+	serialized := []byte{0xD2, 0xFF, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(serialized[2:], uint32(len(body)))
+	p, err := packet.Read(bytes.NewReader(append(serialized, body...)))
+	if err != nil {
+		t.Fatal("Expected no error while reading the packet, got:", err)
+	}
+	seipd, ok := p.(*packet.SymmetricallyEncrypted)
+	if !ok || seipd.Version != 2 {
+		t.Fatal("Expected a SEIPD version 2 packet")
+	}
+	decrypter, err := seipd.Decrypt(packet.CipherAES256, testSessionKey.Key)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting, got:", err)
+	}
+	decrypted, err := ioutil.ReadAll(decrypter)
+	if err != nil {
+		t.Fatal("Expected no error while reading, got:", err)
+	}
+	assert.NoError(t, decrypter.Close())
+	assert.Exactly(t, data, decrypted)
+}
+
+func TestSeekableRandomAccess(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	ciphertext, chunkIndex := encryptSeekable(t, testSessionKey, data, 64)
+
+	source := &countingReaderAt{reader: bytes.NewReader(ciphertext)}
+	reader, err := testSessionKey.DecryptSeekable(source, int64(len(ciphertext)), chunkIndex)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting, got:", err)
+	}
+	// Only the header and the final tag are read to open the data
+	assert.Exactly(t, seekableHeaderSize+16, source.read)
+
+	// Only the chunk covering the range is read
+	source.read = 0
+	buffer := make([]byte, 10)
+	if _, err = reader.ReadAt(buffer, 5000); err != nil {
+		t.Fatal("Expected no error while reading, got:", err)
+	}
+	assert.Exactly(t, data[5000:5010], buffer)
+	assert.Exactly(t, 64+16, source.read)
+
+	buffer = make([]byte, 100)
+	n, err := reader.ReadAt(buffer, 9950)
+	assert.Exactly(t, io.EOF, err)
+	assert.Exactly(t, data[9950:], buffer[:n])
+
+	if _, err = reader.Seek(-20, io.SeekEnd); err != nil {
+		t.Fatal("Expected no error while seeking, got:", err)
+	}
+	rest, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal("Expected no error while reading, got:", err)
+	}
+	assert.Exactly(t, data[9980:], rest)
+}
+
+func TestSeekableIntegrity(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	ciphertext, chunkIndex := encryptSeekable(t, testSessionKey, data, 64)
+
+	// A tampered chunk is only detected when it is read
+	tampered := clone(ciphertext)
+	tampered[seekableHeaderSize+3*(64+16)+5] ^= 1
+	reader, err := testSessionKey.DecryptSeekable(bytes.NewReader(tampered), int64(len(tampered)), chunkIndex)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting, got:", err)
+	}
+	if _, err = reader.ReadAt(make([]byte, 64), 0); err != nil {
+		t.Fatal("Expected no error while reading an untampered chunk, got:", err)
+	}
+	_, err = reader.ReadAt(make([]byte, 10), 3*64)
+	assert.True(t, errors.Is(err, ErrIntegrity))
+
+	// The truncation at a chunk boundary, with a matching chunk index,
+	// is detected with the final tag
+	var truncatedIndex seekableChunkIndex
+	truncatedIndex.offset = seekableHeaderSize
+	for i := 0; i < 15; i++ {
+		truncatedIndex.add(64, 64+16)
+	}
+	end := seekableHeaderSize + 15*(64+16)
+	truncated := append(clone(ciphertext[:end]), ciphertext[len(ciphertext)-16:]...)
+	_, err = testSessionKey.DecryptSeekable(bytes.NewReader(truncated), int64(len(truncated)), truncatedIndex.serialize())
+	assert.True(t, errors.Is(err, ErrIntegrity))
+
+	// The data must match the chunk index
+	_, err = testSessionKey.DecryptSeekable(bytes.NewReader(truncated), int64(len(truncated)), chunkIndex)
+	assert.True(t, errors.Is(err, ErrTruncatedInput))
+	tamperedIndex := clone(chunkIndex)
+	tamperedIndex[seekableIndexHeaderSize+2*8+7] ^= 1
+	_, err = testSessionKey.DecryptSeekable(bytes.NewReader(ciphertext), int64(len(ciphertext)), tamperedIndex)
+	assert.True(t, errors.Is(err, ErrMalformedPacket))
+	tamperedIndex = clone(chunkIndex)
+	tamperedIndex[7] = 1
+	_, err = testSessionKey.DecryptSeekable(bytes.NewReader(ciphertext), int64(len(ciphertext)), tamperedIndex)
+	assert.True(t, errors.Is(err, ErrUnsupportedAlgorithm))
+
+	otherKey, err := GenerateSessionKey()
+	if err != nil {
+		t.Fatal("Expected no error while generating the session key, got:", err)
+	}
+	_, err = otherKey.DecryptSeekable(bytes.NewReader(ciphertext), int64(len(ciphertext)), chunkIndex)
+	assert.True(t, errors.Is(err, ErrIntegrity))
+
+	_, err = testSessionKey.EncryptSeekableStream(&bytes.Buffer{}, 100)
+	assert.Error(t, err)
+}
+
+func TestKeyRingSeekable(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	var ciphertext bytes.Buffer
+	result, err := keyRingTestPublic.EncryptSeekableStream(&ciphertext, 0)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+	if _, err = result.Write(data); err != nil {
+		t.Fatal("Expected no error while writing data, got:", err)
+	}
+	if err = result.Close(); err != nil {
+		t.Fatal("Expected no error while closing the writer, got:", err)
+	}
+	keyPacket, err := result.GetKeyPacket()
+	if err != nil {
+		t.Fatal("Expected no error while accessing the key packet, got:", err)
+	}
+	chunkIndex, err := result.GetChunkIndex()
+	if err != nil {
+		t.Fatal("Expected no error while accessing the chunk index, got:", err)
+	}
+
+	reader, err := keyRingTestPrivate.DecryptSeekable(keyPacket, bytes.NewReader(ciphertext.Bytes()), int64(ciphertext.Len()), chunkIndex)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting, got:", err)
+	}
+	buffer := make([]byte, 10)
+	if _, err = reader.ReadAt(buffer, 4321); err != nil {
+		t.Fatal("Expected no error while reading, got:", err)
+	}
+	assert.Exactly(t, data[4321:4331], buffer)
+}
+
+func TestSeekableParallelReadAt(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	ciphertext, chunkIndex := encryptSeekable(t, testSessionKey, data, 64)
+	reader, err := testSessionKey.DecryptSeekable(bytes.NewReader(ciphertext), int64(len(ciphertext)), chunkIndex)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting, got:", err)
+	}
+
+	// Run with -race: the goroutines read overlapping chunks and replace the cached one
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			buffer := make([]byte, 100)
+			for off := int64(i * 10); off+100 <= int64(len(data)); off += 370 {
+				if _, err := reader.ReadAt(buffer, off); err != nil {
+					errs <- err
+					return
+				}
+				if !bytes.Equal(data[off:off+100], buffer) {
+					errs <- errors.Errorf("wrong plaintext at offset %d", off)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal("Expected no error while reading in parallel, got:", err)
+	}
+}
@@ -21,6 +21,9 @@ type SessionKey struct {
 	Key []byte
 	// The symmetric encryption algorithm used with this key.
 	Algo string
+
+	// The instance whose clock and limits are used, nil for the default one.
+	pgp *GopenPGP
 }
 
 var symKeyAlgos = map[string]packet.CipherFunction{
@@ -47,6 +50,10 @@ func (cr checkReader) Read(buf []byte) (int, error) {
 		return n, io.EOF
 	}
 
+	if errors.Is(sensitiveParsingError, pgpErrors.ErrAEADTagVerification) {
+		// An AEAD chunk failed its integrity check: this is not a parsing error
+		return n, sensitiveParsingError
+	}
 	if sensitiveParsingError != nil {
 		return n, pgpErrors.StructuralError("parsing error")
 	}
@@ -54,12 +61,17 @@ func (cr checkReader) Read(buf []byte) (int, error) {
 	return n, nil
 }
 
+// getPGP returns the instance the session key is bound to.
+func (sk *SessionKey) getPGP() *GopenPGP {
+	return sk.pgp.orDefault()
+}
+
 // GetCipherFunc returns the cipher function corresponding to the algorithm used
 // with this SessionKey.
 func (sk *SessionKey) GetCipherFunc() (packet.CipherFunction, error) {
 	cf, ok := symKeyAlgos[sk.Algo]
 	if !ok {
-		return cf, errors.New("gopenpgp: unsupported cipher function: " + sk.Algo)
+		return cf, newError("gopenpgp: unsupported cipher function: "+sk.Algo, ErrUnsupportedAlgorithm)
 	}
 	return cf, nil
 }
@@ -71,7 +83,12 @@ func (sk *SessionKey) GetBase64Key() string {
 
 // RandomToken generates a random token with the specified key size.
 func RandomToken(size int) ([]byte, error) {
-	config := &packet.Config{DefaultCipher: packet.CipherAES256}
+	return pgp.randomToken(size)
+}
+
+// randomToken generates a random token with the randomness source of the instance.
+func (pgp *GopenPGP) randomToken(size int) ([]byte, error) {
+	config := &packet.Config{DefaultCipher: packet.CipherAES256, Rand: pgp.rand}
 	symKey := make([]byte, size)
 	if _, err := io.ReadFull(config.Random(), symKey); err != nil {
 		return nil, errors.Wrap(err, "gopenpgp: error in generating random token")
@@ -82,11 +99,17 @@ func RandomToken(size int) ([]byte, error) {
 // GenerateSessionKeyAlgo generates a random key of the correct length for the
 // specified algorithm.
 func GenerateSessionKeyAlgo(algo string) (sk *SessionKey, err error) {
+	return pgp.GenerateSessionKeyAlgo(algo)
+}
+
+// GenerateSessionKeyAlgo generates a random key bound to the instance, of the
+// correct length for the specified algorithm.
+func (pgp *GopenPGP) GenerateSessionKeyAlgo(algo string) (sk *SessionKey, err error) {
 	cf, ok := symKeyAlgos[algo]
 	if !ok {
-		return nil, errors.New("gopenpgp: unknown symmetric key generation algorithm")
+		return nil, newError("gopenpgp: unknown symmetric key generation algorithm", ErrUnsupportedAlgorithm)
 	}
-	r, err := RandomToken(cf.KeySize())
+	r, err := pgp.randomToken(cf.KeySize())
 	if err != nil {
 		return nil, err
 	}
@@ -94,37 +117,56 @@ func GenerateSessionKeyAlgo(algo string) (sk *SessionKey, err error) {
 	sk = &SessionKey{
 		Key:  r,
 		Algo: algo,
+		pgp:  pgp.bound(),
 	}
 	return sk, nil
 }
 
 // GenerateSessionKey generates a random key for the default cipher.
 func GenerateSessionKey() (*SessionKey, error) {
-	return GenerateSessionKeyAlgo(constants.AES256)
+	return pgp.GenerateSessionKey()
+}
+
+// GenerateSessionKey generates a random key bound to the instance for the default cipher.
+func (pgp *GopenPGP) GenerateSessionKey() (*SessionKey, error) {
+	return pgp.GenerateSessionKeyAlgo(constants.AES256)
 }
 
 func NewSessionKeyFromToken(token []byte, algo string) *SessionKey {
+	return pgp.NewSessionKeyFromToken(token, algo)
+}
+
+// NewSessionKeyFromToken creates a session key bound to the instance from a token.
+func (pgp *GopenPGP) NewSessionKeyFromToken(token []byte, algo string) *SessionKey {
 	return &SessionKey{
 		Key:  clone(token),
 		Algo: algo,
+		pgp:  pgp.bound(),
 	}
 }
 
-func newSessionKeyFromEncrypted(ek *packet.EncryptedKey) (*SessionKey, error) {
+func (pgp *GopenPGP) newSessionKeyFromEncrypted(ek *packet.EncryptedKey) (*SessionKey, error) {
+	cipherFunc := ek.CipherFunc
+	if ek.Version == 6 {
+		// A version 6 packet does not give the cipher, which is the AES
+		// cipher of the SEIPD version 2 packet, of the size of the key
+		cipherFunc = aesCipherOfSize(len(ek.Key))
+	}
 	var algo string
 	for k, v := range symKeyAlgos {
-		if v == ek.CipherFunc {
+		if v == cipherFunc {
 			algo = k
 			break
 		}
 	}
 	if algo == "" {
-		return nil, fmt.Errorf("gopenpgp: unsupported cipher function: %v", ek.CipherFunc)
+		return nil, fmt.Errorf("gopenpgp: unsupported cipher function: %v", cipherFunc)
 	}
 
 	sk := &SessionKey{
 		Key:  ek.Key,
 		Algo: algo,
+		pgp:  pgp.bound(),
 	}
 
 	if err := sk.checkSize(); err != nil {
@@ -138,7 +180,7 @@ func newSessionKeyFromEncrypted(ek *packet.EncryptedKey) (*SessionKey, error) {
 // * message : The plain data as a PlainMessage.
 // * output  : The encrypted data as PGPMessage.
 func (sk *SessionKey) Encrypt(message *PlainMessage) ([]byte, error) {
-	return encryptWithSessionKey(message, sk, nil, false, nil)
+	return encryptWithSessionKey(message, sk, nil, nil)
 }
 
 // EncryptAndSign encrypts a PlainMessage to PGPMessage with a SessionKey and signs it with a Private key.
@@ -146,7 +188,7 @@ func (sk *SessionKey) Encrypt(message *PlainMessage) ([]byte, error) {
 // * signKeyRing: The KeyRing to sign the message
 // * output  : The encrypted data as PGPMessage.
 func (sk *SessionKey) EncryptAndSign(message *PlainMessage, signKeyRing *KeyRing) ([]byte, error) {
-	return encryptWithSessionKey(message, sk, signKeyRing, false, nil)
+	return encryptWithSessionKey(message, sk, signKeyRing, nil)
 }
 
 // EncryptAndSignWithContext encrypts a PlainMessage to PGPMessage with a SessionKey and signs it with a Private key.
@@ -155,22 +197,37 @@ func (sk *SessionKey) EncryptAndSign(message *PlainMessage, signKeyRing *KeyRing
 // * output  : The encrypted data as PGPMessage.
 // * signingContext : (optional) the context for the signature.
 func (sk *SessionKey) EncryptAndSignWithContext(message *PlainMessage, signKeyRing *KeyRing, signingContext *SigningContext) ([]byte, error) {
-	return encryptWithSessionKey(message, sk, signKeyRing, false, signingContext)
+	return encryptWithSessionKey(message, sk, signKeyRing, &EncryptionOptions{SigningContext: signingContext})
 }
 
 // EncryptWithCompression encrypts with compression support a PlainMessage to PGPMessage with a SessionKey.
 // * message : The plain data as a PlainMessage.
 // * output  : The encrypted data as PGPMessage.
 func (sk *SessionKey) EncryptWithCompression(message *PlainMessage) ([]byte, error) {
-	return encryptWithSessionKey(message, sk, nil, true, nil)
+	return encryptWithSessionKey(message, sk, nil, &EncryptionOptions{Compress: true})
+}
+
+// EncryptWithOptions encrypts a PlainMessage to PGPMessage with a SessionKey,
+// and signs it if signKeyRing is not nil.
+// The signing context and the compression of the options are used,
+// the recipients and passwords are ignored.
+// * message     : The plain data as a PlainMessage.
+// * signKeyRing : (optional) The KeyRing to sign the message.
+// * options     : (optional) The encryption options.
+// * output      : The encrypted data as PGPMessage.
+func (sk *SessionKey) EncryptWithOptions(
+	message *PlainMessage,
+	signKeyRing *KeyRing,
+	options *EncryptionOptions,
+) ([]byte, error) {
+	return encryptWithSessionKey(message, sk, signKeyRing, options)
 }
 
 func encryptWithSessionKey(
 	message *PlainMessage,
 	sk *SessionKey,
 	signKeyRing *KeyRing,
-	compress bool,
-	signingContext *SigningContext,
+	options *EncryptionOptions,
 ) ([]byte, error) {
 	var encBuf = new(bytes.Buffer)
 
@@ -183,8 +240,7 @@ func encryptWithSessionKey(
 		encBuf,
 		sk,
 		signKeyRing,
-		compress,
-		signingContext,
+		options,
 	)
 	if err != nil {
 		return nil, err
@@ -216,8 +272,7 @@ func encryptStreamWithSessionKey(
 	dataPacketWriter io.Writer,
 	sk *SessionKey,
 	signKeyRing *KeyRing,
-	compress bool,
-	signingContext *SigningContext,
+	options *EncryptionOptions,
 ) (encryptWriter, signWriter io.WriteCloser, err error) {
 	dc, err := sk.GetCipherFunc()
 	if err != nil {
@@ -225,7 +280,8 @@ func encryptStreamWithSessionKey(
 	}
 
 	config := &packet.Config{
-		Time:          getTimeGenerator(),
+		Time:          sk.getPGP().getTimeGenerator(),
+		Rand:          sk.getPGP().rand,
 		DefaultCipher: dc,
 	}
 
@@ -237,21 +293,24 @@ func encryptStreamWithSessionKey(
 		}
 	}
 
-	if compress {
-		config.DefaultCompressionAlgo = constants.DefaultCompression
-		config.CompressionConfig = &packet.CompressionConfig{Level: constants.DefaultCompressionLevel}
+	if err := options.compression().setPacketConfig(config); err != nil {
+		return nil, nil, err
 	}
 
-	if signingContext != nil {
+	if signingContext := options.signingContext(); signingContext != nil {
 		config.SignatureNotations = append(config.SignatureNotations, signingContext.getNotation())
 	}
 
+	if options.aead() {
+		config.AEADConfig = &packet.AEADConfig{}
+	}
+
 	if plainMessageMetadata == nil {
 		// Use sensible default metadata
 		plainMessageMetadata = &PlainMessageMetadata{
 			IsBinary: true,
 			Filename: "",
-			ModTime:  GetUnixTime(),
+			ModTime:  sk.getPGP().GetUnixTime(),
 		}
 	}
 
@@ -262,7 +321,10 @@ func encryptStreamWithSessionKey(
 		dataPacketWriter,
 		sk,
 		signEntity,
+		nil,
 		config,
+		options.compression().skipCompressedData(),
+		options.workers(),
 	)
 }
 
@@ -273,22 +335,62 @@ func encryptStreamWithSessionKeyAndConfig(
 	dataPacketWriter io.Writer,
 	sk *SessionKey,
 	signEntity *openpgp.Entity,
+	intendedRecipients openpgp.EntityList,
 	config *packet.Config,
+	skipCompressedData bool,
+	workers int,
 ) (encryptWriter, signWriter io.WriteCloser, err error) {
-	encryptWriter, err = packet.SerializeSymmetricallyEncrypted(
-		dataPacketWriter,
-		config.Cipher(),
-		config.AEAD() != nil,
-		packet.CipherSuite{Cipher: config.Cipher(), Mode: config.AEAD().Mode()},
-		sk.Key,
-		config,
-	)
+	var dataWriter io.WriteCloser
+	if config.AEAD() != nil && workers > 1 {
+		dataWriter, err = serializeSymmetricallyEncryptedParallel(dataPacketWriter, sk, config, workers)
+	} else {
+		dataWriter, err = packet.SerializeSymmetricallyEncrypted(
+			dataPacketWriter,
+			config.Cipher(),
+			config.AEAD() != nil,
+			packet.CipherSuite{Cipher: config.Cipher(), Mode: config.AEAD().Mode()},
+			sk.Key,
+			config,
+		)
+	}
 
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "gopenpgp: unable to encrypt")
 	}
 
-	if algo := config.Compression(); algo != packet.CompressionNone {
+	build := func(algo packet.CompressionAlgo) (io.WriteCloser, io.WriteCloser, error) {
+		return serializePlaintext(
+			dataWriter,
+			algo,
+			isBinary,
+			filename,
+			modTime,
+			signEntity,
+			intendedRecipients,
+			config,
+		)
+	}
+	if algo := config.Compression(); skipCompressedData && algo != packet.CompressionNone {
+		// The compression is chosen once the beginning of the plaintext is known
+		return newCompressionSkippingWriters(algo, signEntity != nil, build)
+	}
+	return build(config.Compression())
+}
+
+// serializePlaintext writes the compressed, signature and literal data packets
+// of a message to the encrypted data packet.
+func serializePlaintext(
+	dataWriter io.WriteCloser,
+	algo packet.CompressionAlgo,
+	isBinary bool,
+	filename string,
+	modTime uint32,
+	signEntity *openpgp.Entity,
+	intendedRecipients openpgp.EntityList,
+	config *packet.Config,
+) (encryptWriter, signWriter io.WriteCloser, err error) {
+	encryptWriter = dataWriter
+	if algo != packet.CompressionNone {
 		encryptWriter, err = packet.SerializeCompressed(encryptWriter, algo, config.CompressionConfig)
 		if err != nil {
 			return nil, nil, errors.Wrap(err, "gopenpgp: error in compression")
@@ -302,7 +404,11 @@ func encryptStreamWithSessionKeyAndConfig(
 			ModTime:  time.Unix(int64(modTime), 0),
 		}
 
-		signWriter, err = openpgp.Sign(encryptWriter, signEntity, hints, config)
+		if len(intendedRecipients) > 0 {
+			signWriter, err = signWithIntendedRecipients(encryptWriter, signEntity, hints, intendedRecipients, config)
+		} else {
+			signWriter, err = openpgp.Sign(encryptWriter, signEntity, hints, config)
+		}
 		if err != nil {
 			return nil, nil, errors.Wrap(err, "gopenpgp: unable to sign")
 		}
@@ -367,19 +473,26 @@ func decryptWithSessionKeyAndContext(
 ) (*PlainMessage, error) {
 	var messageReader = bytes.NewReader(dataPacket)
 
-	md, err := decryptStreamWithSessionKey(sk, messageReader, verifyKeyRing, verificationContext)
+	md, err := decryptStreamWithSessionKey(
+		sk,
+		messageReader,
+		verifyKeyRing,
+		verificationContext,
+		sk.getPGP().getInMemoryDecryptionLimits(),
+		0,
+	)
 	if err != nil {
 		return nil, err
 	}
 	messageBuf := new(bytes.Buffer)
 	_, err = messageBuf.ReadFrom(md.UnverifiedBody)
 	if err != nil {
-		return nil, errors.Wrap(err, "gopenpgp: error in reading message body")
+		return nil, wrapError(err, "gopenpgp: error in reading message body")
 	}
 
 	if verifyKeyRing != nil {
 		processSignatureExpiration(md, verifyTime)
-		err = verifyDetailsSignature(md, verifyKeyRing, verificationContext)
+		err = verifyDetailsSignature(md, verifyKeyRing, verificationContext, "")
 	}
 
 	return &PlainMessage{
@@ -395,15 +508,19 @@ func decryptStreamWithSessionKey(
 	messageReader io.Reader,
 	verifyKeyRing *KeyRing,
 	verificationContext *VerificationContext,
+	limits DecryptionLimits,
+	workers int,
 ) (*openpgp.MessageDetails, error) {
 	var decrypted io.ReadCloser
+	var parallel *seipdChunkReader
 	var keyring openpgp.EntityList
+	var authenticatedChunks bool
 
 	// Read symmetrically encrypted data packet
 	packets := packet.NewReader(messageReader)
 	p, err := packets.Next()
 	if err != nil {
-		return nil, errors.Wrap(err, "gopenpgp: unable to read symmetric packet")
+		return nil, wrapError(err, "gopenpgp: unable to read symmetric packet")
 	}
 
 	// Decrypt data packet
@@ -411,7 +528,7 @@ func decryptStreamWithSessionKey(
 	case *packet.SymmetricallyEncrypted, *packet.AEADEncrypted:
 		if symPacket, ok := p.(*packet.SymmetricallyEncrypted); ok {
 			if !symPacket.IntegrityProtected {
-				return nil, errors.New("gopenpgp: message is not authenticated")
+				return nil, newError("gopenpgp: message is not authenticated", ErrIntegrity)
 			}
 		}
 		dc, err := sk.GetCipherFunc()
@@ -422,16 +539,22 @@ func decryptStreamWithSessionKey(
 		if !isDataPacket {
 			return nil, errors.Wrap(err, "gopenpgp: unknown data packet")
 		}
-		decrypted, err = encryptedDataPacket.Decrypt(dc, sk.Key)
+		authenticatedChunks = isAEADProtected(encryptedDataPacket)
+		if symPacket, ok := p.(*packet.SymmetricallyEncrypted); ok && symPacket.Version == 2 && workers > 1 {
+			parallel, err = decryptSymmetricallyEncryptedParallel(symPacket, sk, workers)
+			decrypted = parallel
+		} else {
+			decrypted, err = encryptedDataPacket.Decrypt(dc, sk.Key)
+		}
 		if err != nil {
-			return nil, errors.Wrap(err, "gopenpgp: unable to decrypt symmetric packet")
+			return nil, wrapError(err, "gopenpgp: unable to decrypt symmetric packet")
 		}
 	default:
-		return nil, errors.New("gopenpgp: invalid packet type")
+		return nil, newError("gopenpgp: invalid packet type", ErrMalformedPacket)
 	}
 
 	config := &packet.Config{
-		Time: getTimeGenerator(),
+		Time: sk.getPGP().getTimeGenerator(),
 	}
 
 	if verificationContext != nil {
@@ -445,19 +568,26 @@ func decryptStreamWithSessionKey(
 		keyring = openpgp.EntityList{}
 	}
 
-	md, err := openpgp.ReadMessage(decrypted, keyring, nil, config)
+	state := &decryptionLimitState{
+		limits:              limits,
+		authenticatedChunks: authenticatedChunks,
+		integrityProtected:  true, // The data packets without MDC are rejected above
+	}
+	md, err := readDecryptedMessage(decrypted, keyring, config, state)
 	if err != nil {
-		return nil, errors.Wrap(err, "gopenpgp: unable to decode symmetric packet")
+		if parallel != nil {
+			parallel.stop()
+		}
+		return nil, wrapError(err, "gopenpgp: unable to decode symmetric packet")
 	}
-
-	md.UnverifiedBody = checkReader{decrypted, md.UnverifiedBody}
+	md.IsEncrypted = true
 	return md, nil
 }
 
 func (sk *SessionKey) checkSize() error {
 	cf, ok := symKeyAlgos[sk.Algo]
 	if !ok {
-		return errors.New("unknown symmetric key algorithm")
+		return newError("unknown symmetric key algorithm", ErrUnsupportedAlgorithm)
 	}
 
 	if cf.KeySize() != len(sk.Key) {
@@ -478,3 +608,13 @@ func getAlgo(cipher packet.CipherFunction) string {
 
 	return algo
 }
+
+// aesCipherOfSize returns the AES cipher of the key size, or 0.
+func aesCipherOfSize(keySize int) packet.CipherFunction {
+	for _, cipher := range []packet.CipherFunction{packet.CipherAES128, packet.CipherAES192, packet.CipherAES256} {
+		if cipher.KeySize() == keySize {
+			return cipher
+		}
+	}
+	return 0
+}
@@ -32,7 +32,6 @@ func (sk *SessionKey) EncryptStream(
 		dataPacketWriter,
 		plainMessageMetadata,
 		signKeyRing,
-		false,
 		nil,
 	)
 }
@@ -51,8 +50,7 @@ func (sk *SessionKey) EncryptStreamWithContext(
 		dataPacketWriter,
 		plainMessageMetadata,
 		signKeyRing,
-		false,
-		signingContext,
+		&EncryptionOptions{SigningContext: signingContext},
 	)
 }
 
@@ -70,8 +68,7 @@ func (sk *SessionKey) EncryptStreamWithCompression(
 		dataPacketWriter,
 		plainMessageMetadata,
 		signKeyRing,
-		true,
-		nil,
+		&EncryptionOptions{Compress: true},
 	)
 }
 
@@ -90,8 +87,27 @@ func (sk *SessionKey) EncryptStreamWithContextAndCompression(
 		dataPacketWriter,
 		plainMessageMetadata,
 		signKeyRing,
-		true,
-		signingContext,
+		&EncryptionOptions{SigningContext: signingContext, Compress: true},
+	)
+}
+
+// EncryptStreamWithOptions is used to encrypt data as a Writer.
+// It takes a writer for the encrypted data packet and returns a writer for the plaintext data.
+// If signKeyRing is not nil, it is used to do an embedded signature.
+// The signing context and the compression of the options are used,
+// the recipients and passwords are ignored.
+// * options : (optional) the encryption options.
+func (sk *SessionKey) EncryptStreamWithOptions(
+	dataPacketWriter Writer,
+	plainMessageMetadata *PlainMessageMetadata,
+	signKeyRing *KeyRing,
+	options *EncryptionOptions,
+) (plainMessageWriter WriteCloser, err error) {
+	return sk.encryptStream(
+		dataPacketWriter,
+		plainMessageMetadata,
+		signKeyRing,
+		options,
 	)
 }
 
@@ -99,16 +115,14 @@ func (sk *SessionKey) encryptStream(
 	dataPacketWriter Writer,
 	plainMessageMetadata *PlainMessageMetadata,
 	signKeyRing *KeyRing,
-	compress bool,
-	signingContext *SigningContext,
+	options *EncryptionOptions,
 ) (plainMessageWriter WriteCloser, err error) {
 	encryptWriter, signWriter, err := encryptStreamWithSessionKey(
 		plainMessageMetadata,
 		dataPacketWriter,
 		sk,
 		signKeyRing,
-		compress,
-		signingContext,
+		options,
 	)
 
 	if err != nil {
@@ -138,6 +152,7 @@ func (sk *SessionKey) DecryptStream(
 		verifyKeyRing,
 		verifyTime,
 		nil,
+		0,
 	)
 }
 
@@ -159,7 +174,39 @@ func (sk *SessionKey) DecryptStreamWithContext(
 		verifyKeyRing,
 		verifyTime,
 		verificationContext,
+		0,
+	)
+}
+
+// DecryptStreamWithOptions is used to decrypt a data packet as a Reader.
+// It takes a reader for the data packet
+// and returns a PlainMessageReader for the plaintext data.
+// If verifyKeyRing is not nil, PlainMessageReader.VerifySignature() will
+// verify the embedded signature with the given key ring and verification time.
+// With the integrity-first decryption selected by the options, the
+// plaintext is only released once its integrity has been checked.
+// * options : (optional) the decryption settings, nil selects the defaults.
+func (sk *SessionKey) DecryptStreamWithOptions(
+	dataPacketReader Reader,
+	verifyKeyRing *KeyRing,
+	verifyTime int64,
+	options *DecryptionOptions,
+) (plainMessage *PlainMessageReader, err error) {
+	plainMessage, err = decryptStreamWithSessionKeyAndContext(
+		sk,
+		dataPacketReader,
+		verifyKeyRing,
+		verifyTime,
+		options.verificationContext(),
+		options.workers(),
 	)
+	if err != nil {
+		return nil, err
+	}
+	if err = plainMessage.releaseAfterIntegrityCheck(options); err != nil {
+		return nil, err
+	}
+	return plainMessage, nil
 }
 
 func decryptStreamWithSessionKeyAndContext(
@@ -168,22 +215,25 @@ func decryptStreamWithSessionKeyAndContext(
 	verifyKeyRing *KeyRing,
 	verifyTime int64,
 	verificationContext *VerificationContext,
+	workers int,
 ) (plainMessage *PlainMessageReader, err error) {
 	messageDetails, err := decryptStreamWithSessionKey(
 		sessionKey,
 		dataPacketReader,
 		verifyKeyRing,
 		verificationContext,
+		sessionKey.getPGP().getDecryptionLimits(),
+		workers,
 	)
 	if err != nil {
 		return nil, errors.Wrap(err, "gopenpgp: error in reading message")
 	}
 
 	return &PlainMessageReader{
-		messageDetails,
-		verifyKeyRing,
-		verifyTime,
-		false,
-		verificationContext,
+		details:             messageDetails,
+		verifyKeyRing:       verifyKeyRing,
+		verifyTime:          verifyTime,
+		readAll:             false,
+		verificationContext: verificationContext,
 	}, err
 }
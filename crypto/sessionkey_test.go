@@ -342,6 +342,28 @@ func TestDataPacketEncryptionWithCompression(t *testing.T) {
 	assert.Exactly(t, message.GetString(), decrypted.GetString())
 }
 
+func TestSymmetricKeyPacketWithS2K(t *testing.T) {
+	password := []byte("I like encryption")
+	s2kConfig := NewArgon2S2KConfig(1024, 1, 1)
+
+	keyPacket, err := EncryptSessionKeyWithPasswordAndS2K(testSessionKey, password, s2kConfig)
+	if err != nil {
+		t.Fatal("Expected no error while generating key packet, got:", err)
+	}
+
+	s2kConfigs, err := NewPGPMessage(keyPacket).GetPasswordS2KConfigs()
+	if err != nil {
+		t.Fatal("Expected no error while reading the S2K, got:", err)
+	}
+	assert.Exactly(t, []*S2KConfig{s2kConfig}, s2kConfigs)
+
+	outputSymmetricKey, err := DecryptSessionKeyWithPassword(keyPacket, password)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting key packet, got:", err)
+	}
+	assert.Exactly(t, testSessionKey, outputSymmetricKey)
+}
+
 func TestAsymmetricKeyPacketDecryptionFailure(t *testing.T) {
 	passphrase := []byte("passphrase")
 	keyPacket, err := base64.StdEncoding.DecodeString(readTestFile("sessionkey_packet", false))
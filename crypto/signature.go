@@ -3,9 +3,13 @@ package crypto
 import (
 	"bytes"
 	"crypto"
+	"encoding"
 	"fmt"
+	"hash"
 	"io"
 	"math"
+	"net/mail"
+	"strings"
 	"time"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
@@ -68,6 +72,26 @@ func newSignatureFailed(cause error) SignatureVerificationError {
 	}
 }
 
+// newSignatureBadRecipient creates a new SignatureVerificationError, type
+// SignatureBadRecipient.
+func newSignatureBadRecipient(cause error) SignatureVerificationError {
+	return SignatureVerificationError{
+		Status:  constants.SIGNATURE_BAD_RECIPIENT,
+		Message: "Decryption key is not an intended recipient",
+		Cause:   cause,
+	}
+}
+
+// newSignatureBadSigner creates a new SignatureVerificationError, type
+// SignatureBadSigner.
+func newSignatureBadSigner(cause error) SignatureVerificationError {
+	return SignatureVerificationError{
+		Status:  constants.SIGNATURE_BAD_SIGNER,
+		Message: "Signer identity does not match the expected email",
+		Cause:   cause,
+	}
+}
+
 // newSignatureInsecure creates a new SignatureVerificationError, type
 // SignatureFailed, with a message describing the signature as insecure.
 func newSignatureInsecure() SignatureVerificationError {
@@ -117,7 +141,12 @@ func processSignatureExpiration(md *openpgp.MessageDetails, verifyTime int64) {
 }
 
 // verifyDetailsSignature verifies signature from message details.
-func verifyDetailsSignature(md *openpgp.MessageDetails, verifierKey *KeyRing, verificationContext *VerificationContext) error {
+func verifyDetailsSignature(
+	md *openpgp.MessageDetails,
+	verifierKey *KeyRing,
+	verificationContext *VerificationContext,
+	expectedSigner string,
+) error {
 	if !md.IsSigned {
 		return newSignatureNotSigned()
 	}
@@ -140,10 +169,53 @@ func verifyDetailsSignature(md *openpgp.MessageDetails, verifierKey *KeyRing, ve
 			return newSignatureBadContext(err)
 		}
 	}
+	if err := checkIntendedRecipients(md); err != nil {
+		return newSignatureBadRecipient(err)
+	}
+	if err := checkSignerIdentity(md.SignedBy.Entity, expectedSigner); err != nil {
+		return err
+	}
 
 	return nil
 }
 
+// checkSignerIdentity returns a SignatureVerificationError of type
+// SignatureBadSigner if the expected signer is set, and none of the
+// identities of the signer has its email address. Identities without
+// self-signature, or revoked by the signer, are ignored.
+// The expected signer is an email address, or an RFC 5322 address such as
+// the From header of a message.
+func checkSignerIdentity(signer *openpgp.Entity, expectedSigner string) error {
+	if expectedSigner == "" {
+		return nil
+	}
+	if address, err := mail.ParseAddress(expectedSigner); err == nil {
+		expectedSigner = address.Address
+	}
+	if signer != nil {
+		for _, identity := range signer.Identities {
+			if isBoundIdentity(identity) && strings.EqualFold(identity.UserId.Email, expectedSigner) {
+				return nil
+			}
+		}
+	}
+	return newSignatureBadSigner(errors.New("gopenpgp: no identity of the signer has the email " + expectedSigner))
+}
+
+// isBoundIdentity returns whether an identity has a self-signature that is
+// not superseded by a revocation of the identity.
+func isBoundIdentity(identity *openpgp.Identity) bool {
+	if identity.SelfSignature == nil {
+		return false
+	}
+	for _, revocation := range identity.Revocations {
+		if !revocation.CreationTime.Before(identity.SelfSignature.CreationTime) {
+			return false
+		}
+	}
+	return true
+}
+
 // SigningContext gives the context that will be
 // included in the signature's notation data.
 type SigningContext struct {
@@ -233,6 +305,7 @@ func verifySignature(
 	signature []byte,
 	verifyTime int64,
 	verificationContext *VerificationContext,
+	expectedSigner string,
 ) (*packet.Signature, error) {
 	config := &packet.Config{}
 	if verifyTime == 0 {
@@ -296,18 +369,180 @@ func verifySignature(
 		}
 	}
 
+	if err := checkSignerIdentity(signer, expectedSigner); err != nil {
+		return nil, err
+	}
+
 	return sig, nil
 }
 
+// verifySignatureDigest verifies a detached signature as verifySignature
+// does, from the running hash of the data instead of the data itself. digest
+// has hashed the data with hashFunc, and is left unchanged. Salted (version 6)
+// signatures hash their salt before the data, so they cannot be verified
+// from a running hash.
+func verifySignatureDigest(
+	pubKeyEntries openpgp.EntityList,
+	digest hash.Hash,
+	hashFunc crypto.Hash,
+	signature []byte,
+	verifyTime int64,
+	expectedSigner string,
+) (*packet.Signature, error) {
+	sig, keys, err := readDetachedSignature(pubKeyEntries, signature)
+	if err != nil {
+		return nil, newSignatureFailed(err)
+	}
+	if sig.Hash != hashFunc {
+		return nil, newSignatureFailed(errors.New("gopenpgp: the signature hash does not match the hash of the data"))
+	}
+	if sig.Version == 6 {
+		return nil, newSignatureFailed(errors.New("gopenpgp: a salted signature cannot be verified from a running hash"))
+	}
+	if sig.SigType != packet.SigTypeBinary && sig.SigType != packet.SigTypeText {
+		// The text signatures hash the data with CRLF line endings, as the digest
+		return nil, newSignatureFailed(pgpErrors.UnsupportedError("unsupported signature type"))
+	}
+
+	var signer *openpgp.Key
+	for i := range keys {
+		var signed hash.Hash
+		if signed, err = cloneHash(digest, hashFunc); err != nil {
+			return nil, newSignatureFailed(err)
+		}
+		if err = keys[i].PublicKey.VerifySignature(signed, sig); err == nil {
+			signer = &keys[i]
+			break
+		}
+	}
+	if signer == nil {
+		return nil, newSignatureFailed(err)
+	}
+
+	err = checkSignatureDetails(signer, sig, time.Unix(verifyTime+internal.CreationTimeOffset, 0))
+	if errors.Is(err, pgpErrors.ErrSignatureExpired) || errors.Is(err, pgpErrors.ErrKeyExpired) {
+		if verifyTime == 0 { // Expiration check disabled
+			err = nil
+		} else {
+			// Maybe the creation time offset pushed it over the edge
+			err = checkSignatureDetails(signer, sig, time.Unix(verifyTime, 0))
+		}
+	}
+	if err != nil {
+		return nil, newSignatureFailed(err)
+	}
+
+	if err := checkSignerIdentity(signer.Entity, expectedSigner); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+// readDetachedSignature returns the first signature of a detached signature
+// made by one of the signing keys, and these keys, as
+// openpgp.VerifyDetachedSignatureAndHash reads it.
+func readDetachedSignature(pubKeyEntries openpgp.EntityList, signature []byte) (*packet.Signature, []openpgp.Key, error) {
+	packets := packet.NewReader(bytes.NewReader(signature))
+	for {
+		p, err := packets.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, nil, pgpErrors.ErrUnknownIssuer
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		sig, ok := p.(*packet.Signature)
+		if !ok {
+			return nil, nil, pgpErrors.StructuralError("non signature packet found")
+		}
+		if sig.IssuerKeyId == nil {
+			return nil, nil, pgpErrors.StructuralError("signature doesn't have an issuer")
+		}
+		if !isAllowedHash(sig.Hash) {
+			return nil, nil, pgpErrors.StructuralError("hash algorithm or salt mismatch with cleartext message headers")
+		}
+		if keys := pubKeyEntries.KeysByIdUsage(*sig.IssuerKeyId, packet.KeyFlagSign); len(keys) > 0 {
+			return sig, keys, nil
+		}
+	}
+}
+
+// checkSignatureDetails checks the signature and the key that made it at the
+// given time, as go-crypto does for the signatures of messages: the critical
+// notations, the revocations and the expirations.
+func checkSignatureDetails(key *openpgp.Key, sig *packet.Signature, now time.Time) error {
+	primarySelfSignature, primaryIdentity := key.Entity.PrimarySelfSignature()
+	signedBySubKey := key.PublicKey != key.Entity.PrimaryKey
+	sigsToCheck := []*packet.Signature{sig, primarySelfSignature}
+	if signedBySubKey {
+		sigsToCheck = append(sigsToCheck, key.SelfSignature, key.SelfSignature.EmbeddedSignature)
+	}
+	for _, sig := range sigsToCheck {
+		for _, notation := range sig.Notations {
+			if notation.IsCritical {
+				return pgpErrors.SignatureError("unknown critical notation: " + notation.Name)
+			}
+		}
+	}
+	if key.Entity.Revoked(now) ||
+		(signedBySubKey && key.Revoked(now)) ||
+		(primaryIdentity != nil && primaryIdentity.Revoked(now)) {
+		return pgpErrors.ErrKeyRevoked
+	}
+	if key.Entity.PrimaryKey.KeyExpired(primarySelfSignature, now) ||
+		(signedBySubKey && key.PublicKey.KeyExpired(key.SelfSignature, now)) {
+		return pgpErrors.ErrKeyExpired
+	}
+	for _, sig := range sigsToCheck {
+		if sig.SigExpired(now) {
+			return pgpErrors.ErrSignatureExpired
+		}
+	}
+	return nil
+}
+
+func isAllowedHash(hashFunc crypto.Hash) bool {
+	for _, allowed := range allowedHashes {
+		if hashFunc == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// cloneHash returns a copy of the state of h, a hash of hashFunc.
+func cloneHash(h hash.Hash, hashFunc crypto.Hash) (hash.Hash, error) {
+	marshaler, ok := h.(encoding.BinaryMarshaler)
+	if !ok {
+		return nil, errors.New("gopenpgp: the hash state cannot be copied")
+	}
+	state, err := marshaler.MarshalBinary()
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: the hash state cannot be copied")
+	}
+	clone := hashFunc.New()
+	unmarshaler, ok := clone.(encoding.BinaryUnmarshaler)
+	if !ok {
+		return nil, errors.New("gopenpgp: the hash state cannot be copied")
+	}
+	if err = unmarshaler.UnmarshalBinary(state); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: the hash state cannot be copied")
+	}
+	return clone, nil
+}
+
 func signMessageDetached(
 	signKeyRing *KeyRing,
 	messageReader io.Reader,
 	isBinary bool,
 	context *SigningContext,
+	sources *TestingSources,
 ) (*PGPSignature, error) {
+	pgp := signKeyRing.getPGP().withTestingSources(sources)
 	config := &packet.Config{
 		DefaultHash: crypto.SHA512,
-		Time:        getTimeGenerator(),
+		Time:        pgp.getTimeGenerator(),
+		Rand:        pgp.rand,
 	}
 
 	signEntity, err := signKeyRing.getSigningEntity()
@@ -23,6 +23,8 @@ type SignatureCollector struct {
 	target    gomime.VisitAcceptor
 	signature string
 	verified  error
+	// expectedSigner is the email address that an identity of the signer must have, if set.
+	expectedSigner string
 }
 
 func newSignatureCollector(
@@ -102,11 +104,12 @@ func (sc *SignatureCollector) Accept(
 	canonicalizedBody := internal.Canonicalize(internal.TrimEachLine(string(str)))
 	rawBody = bytes.NewReader([]byte(canonicalizedBody))
 	if sc.keyring != nil {
-		_, err = openpgp.CheckArmoredDetachedSignature(sc.keyring, rawBody, bytes.NewReader(buffer), sc.config)
+		var signer *openpgp.Entity
+		signer, err = openpgp.CheckArmoredDetachedSignature(sc.keyring, rawBody, bytes.NewReader(buffer), sc.config)
 
 		switch {
 		case err == nil:
-			sc.verified = nil
+			sc.verified = checkSignerIdentity(signer, sc.expectedSigner)
 		case errors.Is(err, pgpErrors.ErrUnknownIssuer):
 			sc.verified = newSignatureNoVerifier()
 		default:
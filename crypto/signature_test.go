@@ -300,7 +300,7 @@ func Test_SignDetachedWithNonCriticalContext(t *testing.T) {
 	if !ok {
 		t.Fatal("Packet was not a signature")
 	}
-	notations := sig.Notations
+	notations := withoutSaltNotation(sig.Notations)
 	if len(notations) != 1 {
 		t.Fatal("Wrong number of notations")
 	}
@@ -343,7 +343,7 @@ func Test_SignDetachedWithCriticalContext(t *testing.T) {
 	if !ok {
 		t.Fatal("Packet was not a signature")
 	}
-	notations := sig.Notations
+	notations := withoutSaltNotation(sig.Notations)
 	if len(notations) != 1 {
 		t.Fatal("Wrong number of notations")
 	}
@@ -663,3 +663,73 @@ func Test_verifySignaturExpire(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestSignatureSignerIdentity(t *testing.T) {
+	signerKey, err := GenerateKey(keyTestName, keyTestDomain, "x25519", 0)
+	if err != nil {
+		t.Fatal("Expected no error while generating the key, got:", err)
+	}
+	signerKeyRing, err := NewKeyRing(signerKey)
+	if err != nil {
+		t.Fatal("Expected no error while building the key ring, got:", err)
+	}
+	message := NewPlainMessageFromString(testMessage)
+	signature, err := signerKeyRing.SignDetached(message)
+	if err != nil {
+		t.Fatal("Expected no error while signing, got:", err)
+	}
+
+	for _, expectedSigner := range []string{keyTestDomain, "MAX.Mustermann@protonmail.ch", "Max <" + keyTestDomain + ">"} {
+		if err = signerKeyRing.VerifyDetachedWithSigner(message, signature, GetUnixTime(), expectedSigner); err != nil {
+			t.Fatal("Expected no error while verifying, got:", err)
+		}
+	}
+
+	err = signerKeyRing.VerifyDetachedWithSigner(message, signature, GetUnixTime(), "mallory@example.com")
+	sigErr := &SignatureVerificationError{}
+	if !errors.As(err, sigErr) {
+		t.Fatal("Expected a SignatureVerificationError, got:", err)
+	}
+	assert.Exactly(t, constants.SIGNATURE_BAD_SIGNER, sigErr.Status)
+
+	// The signature check comes first
+	err = signerKeyRing.VerifyDetachedWithSigner(NewPlainMessageFromString("other"), signature, GetUnixTime(), keyTestDomain)
+	if !errors.As(err, sigErr) {
+		t.Fatal("Expected a SignatureVerificationError, got:", err)
+	}
+	assert.Exactly(t, constants.SIGNATURE_FAILED, sigErr.Status)
+
+	// Revoked and unbound identities are ignored
+	for _, identity := range signerKeyRing.entities[0].Identities {
+		selfSignature := identity.SelfSignature
+		identity.Revocations = []*packet.Signature{{
+			SigType:      packet.SigTypeCertificationRevocation,
+			CreationTime: selfSignature.CreationTime.Add(time.Second),
+		}}
+		err = checkSignerIdentity(signerKeyRing.entities[0], keyTestDomain)
+		if !errors.As(err, sigErr) {
+			t.Fatal("Expected a SignatureVerificationError, got:", err)
+		}
+		assert.Exactly(t, constants.SIGNATURE_BAD_SIGNER, sigErr.Status)
+
+		identity.Revocations[0].CreationTime = selfSignature.CreationTime.Add(-time.Second)
+		assert.Nil(t, checkSignerIdentity(signerKeyRing.entities[0], keyTestDomain))
+
+		identity.SelfSignature = nil
+		assert.NotNil(t, checkSignerIdentity(signerKeyRing.entities[0], keyTestDomain))
+		identity.SelfSignature = selfSignature
+		identity.Revocations = nil
+	}
+}
+
+// withoutSaltNotation removes the random salt notation that go-crypto adds
+// to v4 signatures.
+func withoutSaltNotation(notations []*packet.Notation) []*packet.Notation {
+	var filtered []*packet.Notation
+	for _, notation := range notations {
+		if notation.Name != packet.SaltNotationName {
+			filtered = append(filtered, notation)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,44 @@
+package crypto
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Spool is a temporary store for the plaintext of a message, such as a
+// temporary file, used by the integrity-first decryption. If the integrity
+// check fails, the spool holds unauthenticated plaintext and must be discarded.
+type Spool interface {
+	io.ReadWriteSeeker
+}
+
+// releaseAfterIntegrityCheck makes msg only release plaintext whose integrity
+// has been checked, as selected by the options. Unless the message is
+// AEAD-protected and the options accept authenticated chunks, the message is
+// read entirely into the spool, and then read back from it.
+func (msg *PlainMessageReader) releaseAfterIntegrityCheck(options *DecryptionOptions) error {
+	if !options.integrityFirst() {
+		return nil
+	}
+	if !msg.details.IsEncrypted || !releasesIntegrityProtectedData(msg.details) {
+		// Unencrypted data or a symmetrically encrypted data packet without MDC
+		return newError("gopenpgp: the message is not integrity protected", ErrIntegrity)
+	}
+	if options.AuthenticatedChunks && releasesAuthenticatedChunks(msg.details) {
+		return nil
+	}
+	if options.Spool == nil {
+		return errors.New("gopenpgp: the message is not AEAD-protected, a spool is required to check its integrity")
+	}
+
+	written, err := io.Copy(options.Spool, msg.details.UnverifiedBody)
+	if err != nil {
+		return wrapError(err, "gopenpgp: error in spooling the message")
+	}
+	if _, err = options.Spool.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "gopenpgp: error in rewinding the spool")
+	}
+	msg.body = io.LimitReader(options.Spool, written)
+	return nil
+}
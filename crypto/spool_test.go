@@ -0,0 +1,180 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSpool(t *testing.T) *os.File {
+	spool, err := ioutil.TempFile("", "gopenpgp-spool")
+	if err != nil {
+		t.Fatal("Expected no error when creating the spool, got:", err)
+	}
+	t.Cleanup(func() {
+		_ = spool.Close()
+		_ = os.Remove(spool.Name())
+	})
+	return spool
+}
+
+// aeadDataPacket returns a SEIPDv2 data packet encrypting a literal data
+// packet with data, in chunks of 64 bytes.
+func aeadDataPacket(t *testing.T, sk *SessionKey, data []byte) []byte {
+	var dataPacket bytes.Buffer
+	config := &packet.Config{AEADConfig: &packet.AEADConfig{ChunkSize: 64}}
+	cipherSuite := packet.CipherSuite{Cipher: packet.CipherAES256, Mode: packet.AEADModeOCB}
+	encrypted, err := packet.SerializeSymmetricallyEncrypted(&dataPacket, packet.CipherAES256, true, cipherSuite, sk.Key, config)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	literal, err := packet.SerializeLiteral(encrypted, true, "", 0)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	if _, err = literal.Write(data); err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	if err = literal.Close(); err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	return dataPacket.Bytes()
+}
+
+func TestDecryptStreamWithSpool(t *testing.T) {
+	messageBytes := bytes.Repeat([]byte("Hello World!"), 1000)
+	ciphertext, err := keyRingTestPublic.Encrypt(NewPlainMessage(messageBytes), keyRingTestPrivate)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+
+	decryptedReader, err := keyRingTestPrivate.DecryptStreamWithOptions(
+		bytes.NewReader(ciphertext.GetBinary()),
+		keyRingTestPublic,
+		GetUnixTime(),
+		&DecryptionOptions{Spool: newTestSpool(t)},
+	)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	decryptedBytes, err := ioutil.ReadAll(decryptedReader)
+	if err != nil {
+		t.Fatal("Expected no error when reading the decrypted data, got:", err)
+	}
+	assert.Exactly(t, messageBytes, decryptedBytes)
+	if err = decryptedReader.VerifySignature(); err != nil {
+		t.Fatal("Expected no error when verifying the signature, got:", err)
+	}
+
+	// The message is not AEAD-protected
+	_, err = keyRingTestPrivate.DecryptStreamWithOptions(
+		bytes.NewReader(ciphertext.GetBinary()),
+		nil,
+		0,
+		&DecryptionOptions{AuthenticatedChunks: true},
+	)
+	assert.Error(t, err)
+}
+
+func TestDecryptStreamWithSpoolBadMDC(t *testing.T) {
+	pgpMessage, err := NewPGPMessageFromArmored(readTestFile("message_badmdc", false))
+	if err != nil {
+		t.Fatal("Expected no error when unarmoring, got:", err)
+	}
+	split, err := pgpMessage.SplitMessage()
+	if err != nil {
+		t.Fatal("Expected no error when splitting, got:", err)
+	}
+	key, _ := hex.DecodeString("F76D3236E4F8A38785C50BDE7167475E95360BCE67A952710F6C16F18BB0655E")
+	sk := NewSessionKeyFromToken(key, "aes256")
+
+	_, err = sk.DecryptStreamWithOptions(
+		bytes.NewReader(split.GetBinaryDataPacket()),
+		nil,
+		0,
+		&DecryptionOptions{Spool: newTestSpool(t)},
+	)
+	assert.True(t, errors.Is(err, ErrIntegrity))
+}
+
+func TestDecryptStreamWithAuthenticatedChunks(t *testing.T) {
+	sk, err := GenerateSessionKey()
+	if err != nil {
+		t.Fatal("Expected no error when generating the session key, got:", err)
+	}
+	messageBytes := bytes.Repeat([]byte("Hello World!"), 100)
+	dataPacket := aeadDataPacket(t, sk, messageBytes)
+
+	decryptedReader, err := sk.DecryptStreamWithOptions(
+		bytes.NewReader(dataPacket),
+		nil,
+		0,
+		&DecryptionOptions{AuthenticatedChunks: true},
+	)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	decryptedBytes, err := ioutil.ReadAll(decryptedReader)
+	if err != nil {
+		t.Fatal("Expected no error when reading the decrypted data, got:", err)
+	}
+	assert.Exactly(t, messageBytes, decryptedBytes)
+
+	// Only the chunks preceding the tampered one are released
+	tampered := clone(dataPacket)
+	tampered[len(tampered)-200] ^= 1
+	decryptedReader, err = sk.DecryptStreamWithOptions(
+		bytes.NewReader(tampered),
+		nil,
+		0,
+		&DecryptionOptions{AuthenticatedChunks: true},
+	)
+	if err != nil {
+		t.Fatal("Expected no error when starting the decryption, got:", err)
+	}
+	decryptedBytes, err = ioutil.ReadAll(decryptedReader)
+	assert.Error(t, err)
+	assert.Exactly(t, messageBytes[:len(decryptedBytes)], decryptedBytes)
+	assert.True(t, len(decryptedBytes) < len(messageBytes)-100)
+}
+
+func TestDecryptStreamWithSpoolWithoutMDC(t *testing.T) {
+	// A symmetrically encrypted data packet (tag 9) has no integrity protection
+	split, _ := encryptWithoutIntegrity(t, []byte("hello"))
+
+	for _, options := range []*DecryptionOptions{
+		{Spool: newTestSpool(t)},
+		{Spool: newTestSpool(t), AuthenticatedChunks: true},
+	} {
+		decryptedReader, err := keyRingTestPrivate.DecryptStreamWithOptions(
+			bytes.NewReader(split.GetPGPMessage().GetBinary()),
+			nil,
+			0,
+			options,
+		)
+		assert.Nil(t, decryptedReader)
+		assert.True(t, errors.Is(err, ErrIntegrity))
+	}
+
+	// Without integrity-first decryption, legacy messages are still decrypted
+	decryptedReader, err := keyRingTestPrivate.DecryptStreamWithOptions(
+		bytes.NewReader(split.GetPGPMessage().GetBinary()),
+		nil,
+		0,
+		nil,
+	)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	decryptedBytes, err := ioutil.ReadAll(decryptedReader)
+	if err != nil {
+		t.Fatal("Expected no error when reading the decrypted data, got:", err)
+	}
+	assert.Exactly(t, []byte("hello"), decryptedBytes)
+}
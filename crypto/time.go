@@ -6,6 +6,26 @@ import (
 
 // UpdateTime updates cached time.
 func UpdateTime(newTime int64) {
+	pgp.UpdateTime(newTime)
+}
+
+// SetKeyGenerationOffset updates the offset when generating keys.
+func SetKeyGenerationOffset(offset int64) {
+	pgp.SetKeyGenerationOffset(offset)
+}
+
+// GetUnixTime gets latest cached time.
+func GetUnixTime() int64 {
+	return pgp.GetUnixTime()
+}
+
+// GetTime gets latest cached time.
+func GetTime() time.Time {
+	return pgp.GetTime()
+}
+
+// UpdateTime updates the cached time of the instance.
+func (pgp *GopenPGP) UpdateTime(newTime int64) {
 	pgp.lock.Lock()
 	defer pgp.lock.Unlock()
 
@@ -14,56 +34,67 @@ func UpdateTime(newTime int64) {
 	}
 }
 
-// SetKeyGenerationOffset updates the offset when generating keys.
-func SetKeyGenerationOffset(offset int64) {
+// SetKeyGenerationOffset updates the offset of the instance when generating keys.
+func (pgp *GopenPGP) SetKeyGenerationOffset(offset int64) {
 	pgp.lock.Lock()
 	defer pgp.lock.Unlock()
 
 	pgp.generationOffset = offset
 }
 
-// GetUnixTime gets latest cached time.
-func GetUnixTime() int64 {
-	return getNow().Unix()
+// GetUnixTime gets the latest cached time of the instance.
+func (pgp *GopenPGP) GetUnixTime() int64 {
+	return pgp.getNow().Unix()
 }
 
-// GetTime gets latest cached time.
-func GetTime() time.Time {
-	return getNow()
+// GetTime gets the latest cached time of the instance.
+func (pgp *GopenPGP) GetTime() time.Time {
+	return pgp.getNow()
 }
 
 // ----- INTERNAL FUNCTIONS -----
 
-// getNow returns the latest server time.
-func getNow() time.Time {
+// getNow returns the latest server time of the instance. The clock of the
+// instance is called without holding its lock.
+func (pgp *GopenPGP) getNow() time.Time {
 	pgp.lock.RLock()
-	defer pgp.lock.RUnlock()
+	clock, latestServerTime := pgp.clock, pgp.latestServerTime
+	pgp.lock.RUnlock()
+
+	if clock != nil {
+		return clock()
+	}
 
-	if pgp.latestServerTime == 0 {
+	if latestServerTime == 0 {
 		return time.Now()
 	}
 
-	return time.Unix(pgp.latestServerTime, 0)
+	return time.Unix(latestServerTime, 0)
 }
 
 // getTimeGenerator Returns a time generator function.
-func getTimeGenerator() func() time.Time {
-	return getNow
+func (pgp *GopenPGP) getTimeGenerator() func() time.Time {
+	return pgp.getNow
 }
 
 // getNowKeyGenerationOffset returns the current time with the key generation offset.
-func getNowKeyGenerationOffset() time.Time {
+func (pgp *GopenPGP) getNowKeyGenerationOffset() time.Time {
 	pgp.lock.RLock()
-	defer pgp.lock.RUnlock()
+	clock, latestServerTime, generationOffset := pgp.clock, pgp.latestServerTime, pgp.generationOffset
+	pgp.lock.RUnlock()
+
+	if clock != nil {
+		return time.Unix(clock().Unix()+generationOffset, 0)
+	}
 
-	if pgp.latestServerTime == 0 {
-		return time.Unix(time.Now().Unix()+pgp.generationOffset, 0)
+	if latestServerTime == 0 {
+		return time.Unix(time.Now().Unix()+generationOffset, 0)
 	}
 
-	return time.Unix(pgp.latestServerTime+pgp.generationOffset, 0)
+	return time.Unix(latestServerTime+generationOffset, 0)
 }
 
 // getKeyGenerationTimeGenerator Returns a time generator function with the key generation offset.
-func getKeyGenerationTimeGenerator() func() time.Time {
-	return getNowKeyGenerationOffset
+func (pgp *GopenPGP) getKeyGenerationTimeGenerator() func() time.Time {
+	return pgp.getNowKeyGenerationOffset
 }
@@ -77,3 +77,23 @@ func VerifyCleartextMessage(keyRing *crypto.KeyRing, armored string, verifyTime
 
 	return message.GetString(), nil
 }
+
+// VerifyCleartextMessageWithSigner verifies PGP-compliant armored signed plain
+// text given the public keyring, as VerifyCleartextMessage, and checks that an
+// identity of the signing key has the expected email address. It returns the
+// text, or an error with status constants.SIGNATURE_BAD_SIGNER on a mismatch.
+func VerifyCleartextMessageWithSigner(keyRing *crypto.KeyRing, armored string, verifyTime int64, expectedSigner string) (string, error) {
+	clearTextMessage, err := crypto.NewClearTextMessageFromArmored(armored)
+	if err != nil {
+		return "", errors.Wrap(err, "gopenpgp: unable to unarmor cleartext message")
+	}
+
+	message := crypto.NewPlainMessageFromString(internal.TrimEachLine(clearTextMessage.GetString()))
+	signature := crypto.NewPGPSignature(clearTextMessage.GetBinarySignature())
+	err = keyRing.VerifyDetachedWithSigner(message, signature, verifyTime, expectedSigner)
+	if err != nil {
+		return "", errors.Wrap(err, "gopenpgp: unable to verify cleartext message")
+	}
+
+	return message.GetString(), nil
+}
@@ -1,9 +1,11 @@
 package helper
 
 import (
+	"errors"
 	"regexp"
 	"testing"
 
+	"github.com/angel-one/gopenpgp/v2/constants"
 	"github.com/angel-one/gopenpgp/v2/internal"
 
 	"github.com/angel-one/gopenpgp/v2/crypto"
@@ -47,3 +49,29 @@ func TestSignClearText(t *testing.T) {
 	}
 	assert.Exactly(t, internal.Canonicalize(internal.TrimEachLine(inputPlainText)), string(clearTextMessage.GetBinary()))
 }
+
+func TestVerifyClearTextWithSigner(t *testing.T) {
+	signerKey, err := crypto.GenerateKey("Alice", "alice@example.com", "x25519", 0)
+	if err != nil {
+		t.Fatal("Cannot generate key:", err)
+	}
+	signerKeyRing, err := crypto.NewKeyRing(signerKey)
+	if err != nil {
+		t.Fatal("Cannot create keyring:", err)
+	}
+	armored, err := SignCleartextMessage(signerKeyRing, inputPlainText)
+	if err != nil {
+		t.Fatal("Cannot armor message:", err)
+	}
+
+	verified, err := VerifyCleartextMessageWithSigner(signerKeyRing, armored, crypto.GetUnixTime(), "alice@example.com")
+	if err != nil {
+		t.Fatal("Cannot verify message:", err)
+	}
+	assert.Exactly(t, signedPlainText, verified)
+
+	_, err = VerifyCleartextMessageWithSigner(signerKeyRing, armored, crypto.GetUnixTime(), "bob@example.com")
+	sigErr := &crypto.SignatureVerificationError{}
+	assert.True(t, errors.As(err, sigErr))
+	assert.Exactly(t, constants.SIGNATURE_BAD_SIGNER, sigErr.Status)
+}
@@ -38,9 +38,9 @@ func blockCipher(cipher packet.CipherFunction, key []byte) (cipher.Block, error)
 	case packet.CipherAES128, packet.CipherAES192, packet.CipherAES256:
 		return aes.NewCipher(key)
 	case packet.CipherCAST5, packet.Cipher3DES:
-		return nil, errors.New("gopenpgp: cipher not supported for quick check")
+		return nil, crypto.NewCategorizedError("gopenpgp: cipher not supported for quick check", crypto.ErrUnsupportedAlgorithm)
 	}
-	return nil, errors.New("gopenpgp: unknown cipher")
+	return nil, crypto.NewCategorizedError("gopenpgp: unknown cipher", crypto.ErrUnsupportedAlgorithm)
 }
 
 // QuickCheckDecryptReader checks with high probability if the provided session key
@@ -50,22 +50,22 @@ func blockCipher(cipher packet.CipherFunction, key []byte) (cipher.Block, error)
 func QuickCheckDecryptReader(sessionKey *crypto.SessionKey, prefixReader crypto.Reader) (bool, error) {
 	algo, err := sessionKey.GetCipherFunc()
 	if err != nil {
-		return false, errors.New("gopenpgp: cipher algorithm not found")
+		return false, crypto.NewCategorizedError("gopenpgp: cipher algorithm not found", crypto.ErrUnsupportedAlgorithm)
 	}
 	if !supported(algo) {
-		return false, errors.New("gopenpgp: cipher not supported for quick check")
+		return false, crypto.NewCategorizedError("gopenpgp: cipher not supported for quick check", crypto.ErrUnsupportedAlgorithm)
 	}
 	packetParser := packet.NewReader(prefixReader)
 	_, err = packetParser.Next()
 	if err != nil {
-		return false, errors.New("gopenpgp: failed to parse packet prefix")
+		return false, crypto.NewCategorizedError("gopenpgp: failed to parse packet prefix", crypto.ErrMalformedPacket)
 	}
 
 	blockSize := blockSize(algo)
 	encryptedData := make([]byte, blockSize+2)
 	_, err = io.ReadFull(prefixReader, encryptedData)
 	if err != nil {
-		return false, errors.New("gopenpgp: prefix is too short to check")
+		return false, crypto.NewCategorizedError("gopenpgp: prefix is too short to check", crypto.ErrTruncatedInput)
 	}
 
 	blockCipher, err := blockCipher(algo, sessionKey.Key)
@@ -28,6 +28,16 @@ func TestAESEncryption(t *testing.T) {
 	assert.Exactly(t, plaintext, decrypted)
 }
 
+func TestAESDecryptionWrongPasswordError(t *testing.T) {
+	ciphertext, err := EncryptMessageWithPassword([]byte("passphrase"), "Symmetric secret")
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+
+	_, err = DecryptMessageWithPassword([]byte("Wrong passphrase"), ciphertext)
+	assert.ErrorIs(t, err, crypto.ErrWrongPassword)
+}
+
 func TestArmoredTextMessageEncryption(t *testing.T) {
 	var plaintext = "Secret message"
 